@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/journal"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lock"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/plan"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply <plan_file>",
+	Short: "Execute a plan written by the plan command",
+	Long: `Execute exactly the installs and removals recorded in a plan file.
+
+The command refuses to run if the installed packages have changed since the plan was created.
+
+Examples:
+  brew-manager apply plan.json             # Execute the plan
+  brew-manager apply plan.json --dry-run   # Show what the plan would do`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := plan.Load(args[0])
+		if err != nil {
+			return fmt.Errorf("error loading plan: %w", err)
+		}
+
+		utils.PrintStatus(utils.Blue, fmt.Sprintf("Applying plan created at %s for %s", p.CreatedAt.Format("2006-01-02 15:04:05"), p.ConfigFile))
+
+		installed, err := state.Load(cmdRunner)
+		if err != nil {
+			return fmt.Errorf("apply failed: %w", err)
+		}
+
+		// Versions of removed packages are recorded in the history, so query them first
+		entry, snapshot := newHistoryEntry(p.ConfigFile)
+		var before *lock.Versions
+		if !dryRun && p.Counts()[plan.ActionRemove] > 0 {
+			before = historyVersions()
+		}
+
+		rep := report.New("apply")
+		if err := plan.Apply(cmdRunner, installed, rep, p, dryRun, verbose); err != nil {
+			return fmt.Errorf("apply failed: %w", err)
+		}
+
+		if !dryRun {
+			var after *lock.Versions
+			if rep.Counts()[report.StatusInstalled] > 0 {
+				after = historyVersions()
+			}
+			journal.FromReport(entry, rep, before, after)
+			recordHistory(entry, snapshot)
+		}
+
+		if err := finishReport(rep, rep); err != nil {
+			return fmt.Errorf("apply failed: %w", err)
+		}
+
+		utils.PrintStatus(utils.Green, "Plan applied successfully!")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	addReportFlags(applyCmd)
+}
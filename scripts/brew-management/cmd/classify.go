@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/classify"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	classifyType        string
+	rulesFileInClassify string
+	initRules           bool
+)
+
+// classifyCmd represents the classify command
+var classifyCmd = &cobra.Command{
+	Use:   "classify [package...]",
+	Short: "Show the group and tags the classification rules assign to packages",
+	Long: `Show the group and tags that sync --auto-detect and convert would assign to packages,
+and which rules decided them.
+
+Rules are read from classify.yaml next to the YAML file, falling back to the built-in rules.
+Use --init to write the built-in rules there as a starting point.
+
+Examples:
+  brew-manager classify git ripgrep                   # Classify formulae
+  brew-manager classify --type cask google-chrome     # Classify a cask
+  brew-manager classify --rules my-rules.yaml node    # Use a custom rules file
+  brew-manager classify --init                        # Write classify.yaml with the built-in rules`,
+	Annotations: map[string]string{annotationNoPrerequisites: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rulesPath := rulesFileInClassify
+		if rulesPath == "" {
+			yamlFile, err := getDefaultYAMLPath()
+			if err != nil {
+				return err
+			}
+			rulesPath = classify.DefaultPath(yamlFile)
+		}
+
+		if initRules {
+			if utils.FileExists(rulesPath) {
+				return fmt.Errorf("rules file already exists: %s", rulesPath)
+			}
+			if dryRun {
+				utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would write built-in rules to %s", rulesPath))
+				return nil
+			}
+			if err := utils.EnsureDir(rulesPath); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			if err := os.WriteFile(rulesPath, classify.DefaultRules(), 0644); err != nil {
+				return fmt.Errorf("failed to write rules file: %w", err)
+			}
+			utils.PrintStatus(utils.Green, fmt.Sprintf("Wrote built-in rules to %s", rulesPath))
+			return nil
+		}
+
+		if len(args) == 0 {
+			return fmt.Errorf("no packages given")
+		}
+		if !types.IsPackageType(classifyType) {
+			return fmt.Errorf("invalid package type %q: must be one of %s", classifyType, strings.Join(types.PackageTypes, ", "))
+		}
+
+		classifier, err := classify.Load(rulesPath)
+		if err != nil {
+			return fmt.Errorf("failed to load classification rules: %w", err)
+		}
+
+		// Rules matching descriptions use the metadata cache
+		meta := loadMetadata()
+
+		utils.PrintStatus(utils.Blue, fmt.Sprintf("Using rules from %s", classifier.Source))
+		results := []classifyResult{}
+		for _, name := range args {
+			description := meta.Description(classifyType, name)
+			decision := classifier.Classify(name, classifyType, description)
+			results = append(results, classifyResult{Type: classifyType, Name: name, Description: description, Decision: decision})
+
+			decidedBy := "default group"
+			if decision.GroupRule != "" {
+				decidedBy = "rule " + decision.GroupRule
+			}
+			fmt.Fprintf(utils.Output, "\n%s: %s\n", classifyType, name)
+			if description != "" {
+				fmt.Fprintf(utils.Output, "  Description: %s\n", description)
+			}
+			fmt.Fprintf(utils.Output, "  Group: %s (%s)\n", decision.Group, decidedBy)
+			fmt.Fprintf(utils.Output, "  Tags: %s\n", strings.Join(decision.Tags, ", "))
+			if len(decision.Matched) > 0 {
+				fmt.Fprintf(utils.Output, "  Matched rules: %s\n", strings.Join(decision.Matched, ", "))
+			} else {
+				fmt.Fprintln(utils.Output, "  Matched rules: none")
+			}
+		}
+
+		return printResult(results)
+	},
+}
+
+// classifyResult is the decision for one package of classify for --output
+type classifyResult struct {
+	Type              string `json:"type" yaml:"type"`
+	Name              string `json:"name" yaml:"name"`
+	Description       string `json:"description,omitempty" yaml:"description,omitempty"`
+	classify.Decision `yaml:",inline"`
+}
+
+func init() {
+	rootCmd.AddCommand(classifyCmd)
+
+	classifyCmd.Flags().StringVar(&classifyType, "type", "brew", "Package type: tap, brew, cask, mas, vscode, go, cargo or npm")
+	classifyCmd.Flags().StringVar(&rulesFileInClassify, "rules", "", "Classification rules file (default: classify.yaml next to the YAML file, or built-in rules)")
+	classifyCmd.Flags().BoolVar(&initRules, "init", false, "Write the built-in rules to the rules file")
+}
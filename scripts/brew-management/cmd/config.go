@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/location"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/output"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show where the YAML configuration is found",
+}
+
+// configPathCmd represents the config path command
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Show the resolved dotfiles directory and YAML configuration",
+	Long: `Show the dotfiles directory and YAML configuration used when no yaml_file is given, and where
+they came from. brew-manager and dofy resolve them the same way, using the first of:
+
+1. the --config flag
+2. the BREW_MANAGER_CONFIG or DOFY_HOME environment variable
+3. "path" in dotfiles/config.yaml in $XDG_CONFIG_HOME (~/.config by default)
+4. the nearest directory above the working directory containing data/brew/packages.yaml
+5. ~/projects/github.com/shiron-dev/dotfiles
+
+The flag, the variables and the config file may name the dotfiles directory or a YAML file.
+
+Examples:
+  brew-manager config path
+  BREW_MANAGER_CONFIG=~/src/dotfiles brew-manager config path
+  brew-manager config path -o json`,
+	Annotations: map[string]string{annotationNoPrerequisites: "true"},
+	Args:        cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		loc, err := resolveConfig()
+		if err != nil {
+			return err
+		}
+		if outputFormat != output.Text {
+			return printResult(loc)
+		}
+
+		source := string(loc.Source)
+		if loc.Origin != "" {
+			source += " (" + loc.Origin + ")"
+		}
+		fmt.Fprintf(utils.Output, "File:     %s\n", loc.File)
+		fmt.Fprintf(utils.Output, "Dotfiles: %s\n", loc.Dir)
+		fmt.Fprintf(utils.Output, "Source:   %s\n", source)
+		if !utils.FileExists(loc.File) {
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: %s does not exist", loc.File))
+		}
+		if loc.Source == location.SourceDefault {
+			if configFile, err := location.ConfigFile(); err == nil {
+				utils.PrintStatus(utils.Cyan, fmt.Sprintf("Set --config, %s, or \"path\" in %s to use another checkout", location.EnvBrewManagerConfig, configFile))
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configPathCmd)
+}
@@ -3,14 +3,16 @@ package cmd
 import (
 	"fmt"
 
-	"brew-manager/pkg/convert"
-	"brew-manager/pkg/utils"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/classify"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/convert"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	grouped bool
+	grouped            bool
+	rulesFileInConvert string
 )
 
 // convertCmd represents the convert command
@@ -23,16 +25,21 @@ Examples:
   brew-manager convert Brewfile packages.yaml      # Convert to grouped YAML format
   brew-manager convert --grouped Brewfile packages.yaml  # Convert to grouped YAML format`,
 	Args: cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		brewfilePath := args[0]
 		yamlPath := args[1]
 
-		if err := convert.ConvertBrewfileToYAML(brewfilePath, yamlPath, grouped, verbose); err != nil {
-			utils.PrintStatus(utils.Red, fmt.Sprintf("Conversion failed: %v", err))
-			return
+		rules := rulesFileInConvert
+		if rules == "" {
+			rules = classify.DefaultPath(yamlPath)
+		}
+
+		if err := convert.ConvertBrewfileToYAML(brewfilePath, yamlPath, rules, loadMetadata(), grouped, verbose); err != nil {
+			return fmt.Errorf("conversion failed: %w", err)
 		}
 
 		utils.PrintStatus(utils.Green, fmt.Sprintf("Successfully converted %s to %s", brewfilePath, yamlPath))
+		return nil
 	},
 }
 
@@ -41,4 +48,5 @@ func init() {
 
 	// Convert options
 	convertCmd.Flags().BoolVarP(&grouped, "grouped", "g", false, "Convert to grouped YAML format with auto-detection")
-} 
+	convertCmd.Flags().StringVar(&rulesFileInConvert, "rules", "", "Classification rules file (default: classify.yaml next to the YAML file, or built-in rules)")
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/diff"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lock"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	groupsInDiff   string
+	tagsInDiff     string
+	profileInDiff  string
+	lockFileInDiff string
+	unifiedDiff    bool
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [yaml_file]",
+	Short: "Show drift between the YAML configuration and installed packages",
+	Long: `Show how this machine differs from the YAML configuration: packages that are configured
+but not installed, packages that are installed but not configured, and packages installed with
+another version than their version pin or lockfile entry.
+
+Formulae needed by configured formulae are not reported as unconfigured. Versions are only
+compared when a package pins a version or the lockfile exists.
+
+Exit status, so diff can run from a login hook or a cron job:
+  0  no drift
+  1  drift found
+  2  diff failed, e.g. the configuration or the installed packages could not be read
+
+Examples:
+  brew-manager diff                         # Compare with every package in packages.yaml
+  brew-manager diff --profile work          # Compare with the work profile
+  brew-manager diff --groups core,dev       # Compare with the core and dev groups
+  brew-manager diff --unified               # Print drift as a unified diff
+  brew-manager diff -o json                 # Print drift as JSON`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Get YAML file path
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
+		}
+
+		lockPath := lockFileInDiff
+		if lockPath == "" {
+			lockPath = lock.DefaultPath(yamlFile)
+		}
+
+		options := &types.PruneOptions{
+			Profile: profileInDiff,
+			Groups:  utils.SplitCommaSeparated(groupsInDiff),
+			Tags:    utils.SplitCommaSeparated(tagsInDiff),
+		}
+
+		config, err := yamlPkg.LoadMergedConfig(yamlFile)
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+
+		filteredPackages, err := yamlPkg.GetFilteredPackages(config, &types.InstallOptions{
+			Profile: options.Profile,
+			Groups:  options.Groups,
+			Tags:    options.Tags,
+		})
+		if err != nil {
+			return fmt.Errorf("diff failed: %w", err)
+		}
+
+		installed, err := state.Load(cmdRunner)
+		if err != nil {
+			return fmt.Errorf("diff failed: %w", err)
+		}
+
+		graph, err := deps.Load(cmdRunner)
+		if err != nil {
+			return fmt.Errorf("diff failed: %w", err)
+		}
+
+		// Querying versions is slow, so only do it when there is something to compare with
+		var lockfile *lock.Lockfile
+		var versions *lock.Versions
+		if utils.FileExists(lockPath) {
+			if lockfile, err = lock.Load(lockPath); err != nil {
+				return err
+			}
+		}
+		if lockfile != nil || hasVersionPins(filteredPackages) {
+			if versions, err = lock.QueryVersions(cmdRunner); err != nil {
+				return fmt.Errorf("diff failed: %w", err)
+			}
+		}
+
+		result, err := diff.Compute(yamlFile, config, filteredPackages, installed, graph, lockfile, versions, options)
+		if err != nil {
+			return fmt.Errorf("diff failed: %w", err)
+		}
+
+		if err := printResult(result); err != nil {
+			return err
+		}
+		if unifiedDiff {
+			diff.WriteUnified(utils.Output, result)
+		} else {
+			printDrift(result)
+		}
+
+		return result.Err()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	// Package filters, same as install
+	diffCmd.Flags().StringVarP(&groupsInDiff, "groups", "g", "", "Compare with packages of specified groups only (comma-separated)")
+	diffCmd.Flags().StringVarP(&tagsInDiff, "tags", "t", "", "Compare with packages with specified tags only (comma-separated)")
+	diffCmd.Flags().StringVarP(&profileInDiff, "profile", "p", "", "Compare with the packages of this profile")
+	diffCmd.Flags().StringVar(&lockFileInDiff, "lockfile", "", "Lockfile path (default: <yaml_file>.lock.yaml next to the YAML file)")
+	diffCmd.Flags().BoolVar(&unifiedDiff, "unified", false, "Print drift as a unified diff from the configuration to the machine")
+}
+
+// hasVersionPins reports whether any package pins a version in the YAML
+func hasVersionPins(pkgs []types.FilteredPackage) bool {
+	for _, pkg := range pkgs {
+		if pkg.Version != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// printDrift prints the drift found by diff as lists
+func printDrift(result *diff.Result) {
+	if result.Count() == 0 {
+		utils.PrintStatus(utils.Green, "No drift: installed packages match the configuration")
+		return
+	}
+
+	if len(result.Missing) > 0 {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("%d configured packages are not installed:", len(result.Missing)))
+		for _, pkg := range result.Missing {
+			fmt.Fprintf(utils.Output, "  - %s: %s\n", pkg.Type, pkg.Label())
+		}
+	}
+	if len(result.Unconfigured) > 0 {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("%d installed packages are not configured:", len(result.Unconfigured)))
+		for _, pkg := range result.Unconfigured {
+			fmt.Fprintf(utils.Output, "  + %s: %s\n", pkg.Type, pkg.Label())
+		}
+	}
+	if len(result.Versions) > 0 {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("%d installed packages differ from their expected version:", len(result.Versions)))
+		lock.PrintDrift(result.Versions)
+	}
+}
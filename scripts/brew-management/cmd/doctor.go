@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/doctor"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [yaml_file]",
+	Short: "Check the environment and configuration for common problems",
+	Long: `Check that brew-manager can work on this machine and report each check as pass, warn or fail
+with a hint on how to fix it:
+
+- brew is installed and the Homebrew directories are on the PATH
+- mas is installed and signed in to the App Store when Mac App Store apps are configured
+- the YAML configuration exists and loads
+- the built-in schema and the schema named by the yaml-language-server comment are available
+- no stale .backup files are left next to the configuration
+- every configured tap is tapped
+
+doctor exits with status 1 when a check fails.
+
+Examples:
+  brew-manager doctor                       # Check packages.yaml
+  brew-manager doctor my-packages.yaml      # Check another configuration
+  brew-manager doctor -o json               # Print the checks as JSON`,
+	Annotations: map[string]string{annotationNoPrerequisites: "true"},
+	Args:        cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Get YAML file path
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
+		}
+
+		result := doctor.Run(cmdRunner, yamlFile, runtime.GOOS)
+
+		for _, check := range result.Checks {
+			color := utils.Green
+			switch check.Status {
+			case doctor.StatusWarn:
+				color = utils.Yellow
+			case doctor.StatusFail:
+				color = utils.Red
+			}
+			utils.PrintStatus(color, fmt.Sprintf("[%s] %s: %s", strings.ToUpper(string(check.Status)), check.Name, check.Message))
+			if check.Hint != "" {
+				fmt.Fprintf(utils.Output, "       %s\n", check.Hint)
+			}
+		}
+
+		counts := result.Counts()
+		utils.PrintStatus(utils.Cyan, fmt.Sprintf("Summary: %d passed, %d warnings, %d failed",
+			counts[doctor.StatusPass], counts[doctor.StatusWarn], counts[doctor.StatusFail]))
+
+		if err := printResult(result); err != nil {
+			return err
+		}
+		if n := result.Failed(); n > 0 {
+			return fmt.Errorf("%d checks failed", n)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/convert"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat string
+	exportOut    string
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export [yaml_file]",
+	Short: "Export YAML configuration to another format",
+	Long: `Export the YAML configuration, with includes and overlays for this host applied, to a Brewfile.
+
+Groups become heading sections in priority order (using the group's categories as the heading path),
+and package options such as restart_service: are written back. Group names, descriptions, priorities,
+tags, versions and profiles are kept in "#:" annotation comments, so 'brew-manager convert' turns
+the Brewfile back into the same configuration.
+
+Examples:
+  brew-manager export --format brewfile                  # Print a Brewfile
+  brew-manager export --format brewfile --out Brewfile   # Write a Brewfile`,
+	Annotations: map[string]string{annotationNoPrerequisites: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Get YAML file path
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
+		}
+
+		if exportFormat != "brewfile" {
+			return fmt.Errorf("unsupported export format %q: must be brewfile", exportFormat)
+		}
+
+		config, err := yamlPkg.LoadMergedConfig(yamlFile)
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+
+		// Warnings go to stderr so that they do not end up in a Brewfile written to stdout
+		if skipped := convert.Unexportable(config); len(skipped) > 0 {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: a Brewfile cannot declare %d packages, leaving out: %s\n", len(skipped), strings.Join(skipped, ", "))
+		}
+
+		if dryRun && exportOut != "" {
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would write Brewfile to %s", exportOut))
+			return nil
+		}
+
+		if err := convert.WriteBrewfile(config, filepath.Base(yamlFile), exportOut); err != nil {
+			return fmt.Errorf("export failed: %w", err)
+		}
+
+		if exportOut != "" {
+			utils.PrintStatus(utils.Green, fmt.Sprintf("Exported %s to %s", yamlFile, exportOut))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVar(&exportFormat, "format", "brewfile", "Export format (brewfile)")
+	exportCmd.Flags().StringVar(&exportOut, "out", "", "Output file (default: stdout)")
+}
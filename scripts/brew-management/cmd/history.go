@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/journal"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lock"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/output"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// forceUndo restores the configuration snapshot even if the file changed after the entry
+var forceUndo bool
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history [id]",
+	Short: "List the changes made by install, sync, prune, apply, upgrade and lint --fix",
+	Long: `List the history entries written by commands that change the machine or the YAML configuration,
+newest first, or show the packages changed by one entry.
+
+Each entry records the command, the packages it installed, removed, upgraded or added to the
+configuration with their versions, and a snapshot of the configuration before the command. Use
+'brew-manager undo' to reverse an entry.
+
+Examples:
+  brew-manager history                     # List entries
+  brew-manager history 20250101-120000     # Show one entry`,
+	Annotations: map[string]string{annotationNoPrerequisites: "true"},
+	Args:        cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		j := historyJournal()
+
+		if len(args) > 0 {
+			entry, err := j.Get(args[0])
+			if err != nil {
+				return err
+			}
+			if outputFormat != output.Text {
+				return printResult(entry)
+			}
+			printHistoryEntry(entry)
+			return nil
+		}
+
+		entries, err := j.List()
+		if err != nil {
+			return err
+		}
+		if outputFormat != output.Text {
+			return printResult(entries)
+		}
+		if len(entries) == 0 {
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("No history in %s", j.Dir))
+			return nil
+		}
+
+		w := tabwriter.NewWriter(utils.Output, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTIME\tCOMMAND\tCHANGES")
+		for i := len(entries) - 1; i >= 0; i-- {
+			entry := entries[i]
+			changes := historyChanges(entry)
+			if entry.UndoneBy != "" {
+				changes += fmt.Sprintf(" (undone by %s)", entry.UndoneBy)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.ID, entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Command, changes)
+		}
+		return w.Flush()
+	},
+}
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo [id]",
+	Short: "Reverse a history entry",
+	Long: `Reverse the changes recorded in a history entry, by default the latest one that was not undone:
+removed packages are reinstalled, installed packages are removed, and the YAML configuration is
+restored from the snapshot if the command edited it.
+
+Homebrew installs the current version of a formula, so reinstalled packages may be newer than
+the recorded version. Undo is itself recorded, so it can be undone too.
+
+Undo refuses to restore the YAML configuration if it changed after the entry, since that would
+discard the later changes; --force restores it anyway. The replaced file is backed up first.
+
+Examples:
+  brew-manager undo                        # Reverse the latest entry
+  brew-manager undo 20250101-120000        # Reverse a specific entry
+  brew-manager undo --dry-run              # Show what undo would do
+  brew-manager undo --force                # Restore the configuration despite later edits`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		j := historyJournal()
+
+		id := ""
+		if len(args) > 0 {
+			id = args[0]
+		}
+		entry, err := j.Get(id)
+		if err != nil {
+			return err
+		}
+		if entry.UndoneBy != "" {
+			return fmt.Errorf("history entry %s was already undone by %s", entry.ID, entry.UndoneBy)
+		}
+
+		utils.PrintStatus(utils.Blue, fmt.Sprintf("Undoing %s: %s (%s)", entry.ID, entry.Command, historyChanges(entry)))
+
+		installed, err := state.Load(cmdRunner)
+		if err != nil {
+			return fmt.Errorf("undo failed: %w", err)
+		}
+
+		undo, snapshot := newHistoryEntry(entry.File)
+		undo.ConfigChanged = entry.ConfigChanged
+		var before *lock.Versions
+		if !dryRun && len(entry.Installed) > 0 {
+			before = historyVersions()
+		}
+
+		rep := report.New("undo")
+		options := &types.UndoOptions{DryRun: dryRun, Verbose: verbose, Force: forceUndo}
+		if err := j.Undo(cmdRunner, installed, rep, entry, options); err != nil {
+			return fmt.Errorf("undo failed: %w", err)
+		}
+
+		if !dryRun {
+			var after *lock.Versions
+			if len(entry.Removed) > 0 {
+				after = historyVersions()
+			}
+			journal.FromReport(undo, rep, before, after)
+			if !recordHistory(undo, snapshot) && undo.Empty() {
+				utils.PrintStatus(utils.Yellow, fmt.Sprintf("Nothing left to revert for %s", entry.ID))
+			}
+			// Mark the entry even when everything was already reverted, so the next undo moves on
+			if rep.Failed() == 0 {
+				if err := j.MarkUndone(entry, undo); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := finishReport(rep, rep); err != nil {
+			return fmt.Errorf("undo failed: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(undoCmd)
+	undoCmd.Flags().BoolVar(&forceUndo, "force", false, "Restore the configuration even if it changed after the entry")
+	addReportFlags(undoCmd)
+}
+
+// historyJournal returns the journal selected by --history-dir
+func historyJournal() *journal.Journal {
+	if historyDir != "" {
+		return &journal.Journal{Dir: historyDir}
+	}
+	return &journal.Journal{Dir: journal.DefaultDir()}
+}
+
+// newHistoryEntry starts a history entry for the running command, with a snapshot of yamlFile
+// before any change. A snapshot that cannot be read only produces a warning.
+func newHistoryEntry(yamlFile string) (*journal.Entry, []byte) {
+	// Undo may run from another directory
+	if abs, err := filepath.Abs(yamlFile); err == nil {
+		yamlFile = abs
+	}
+	snapshot, err := journal.ReadSnapshot(yamlFile)
+	if err != nil {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: %v", err))
+	}
+	entry := &journal.Entry{Command: strings.Join(os.Args[1:], " "), File: yamlFile}
+	return entry, snapshot
+}
+
+// historyVersions queries installed versions for a history entry. Versions are informational,
+// so a failed query only produces a warning and no versions.
+func historyVersions() *lock.Versions {
+	versions, err := lock.QueryVersions(cmdRunner)
+	if err != nil {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: history entry will not record versions: %v", err))
+		return nil
+	}
+	return versions
+}
+
+// recordHistory writes a history entry unless it records no change, and reports whether it was
+// written. The command already made its changes, so a failed write only produces a warning.
+func recordHistory(entry *journal.Entry, snapshot []byte) bool {
+	if entry.Empty() {
+		return false
+	}
+	if err := historyJournal().Record(entry, snapshot); err != nil {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: %v", err))
+		return false
+	}
+	if verbose {
+		utils.PrintStatus(utils.Cyan, fmt.Sprintf("Recorded history entry %s; reverse it with 'brew-manager undo %s'", entry.ID, entry.ID))
+	}
+	return true
+}
+
+// historyChanges summarizes the changes of a history entry
+func historyChanges(entry *journal.Entry) string {
+	var changes []string
+	if n := len(entry.Installed); n > 0 {
+		changes = append(changes, fmt.Sprintf("%d installed", n))
+	}
+	if n := len(entry.Removed); n > 0 {
+		changes = append(changes, fmt.Sprintf("%d removed", n))
+	}
+	if n := len(entry.Upgraded); n > 0 {
+		changes = append(changes, fmt.Sprintf("%d upgraded", n))
+	}
+	if n := len(entry.Added); n > 0 {
+		changes = append(changes, fmt.Sprintf("%d added to %s", n, entry.File))
+	} else if entry.ConfigChanged {
+		changes = append(changes, fmt.Sprintf("%s edited", entry.File))
+	}
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// printHistoryEntry prints the packages changed by a history entry
+func printHistoryEntry(entry *journal.Entry) {
+	fmt.Fprintf(utils.Output, "Entry:   %s\n", entry.ID)
+	fmt.Fprintf(utils.Output, "Time:    %s\n", entry.Time.Local().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(utils.Output, "Command: %s\n", entry.Command)
+	fmt.Fprintf(utils.Output, "File:    %s\n", entry.File)
+	if entry.UndoneBy != "" {
+		fmt.Fprintf(utils.Output, "Undone:  by %s\n", entry.UndoneBy)
+	}
+
+	for _, list := range []struct {
+		title string
+		pkgs  []journal.Package
+	}{
+		{"Installed", entry.Installed},
+		{"Removed", entry.Removed},
+		{"Upgraded", entry.Upgraded},
+		{"Added to configuration", entry.Added},
+	} {
+		if len(list.pkgs) == 0 {
+			continue
+		}
+		fmt.Fprintf(utils.Output, "\n%s:\n", list.title)
+		for _, pkg := range list.pkgs {
+			name := pkg.Name
+			if pkg.Type == "mas" {
+				name = fmt.Sprintf("%d (%s)", pkg.ID, pkg.Name)
+			}
+			if pkg.PreviousVersion != "" {
+				name += " " + pkg.PreviousVersion + " ->"
+			}
+			if pkg.Version != "" {
+				name += " " + pkg.Version
+			}
+			fmt.Fprintf(utils.Output, "  %s: %s\n", pkg.Type, name)
+		}
+	}
+	if entry.ConfigChanged && len(entry.Added) == 0 {
+		fmt.Fprintf(utils.Output, "\n%s was edited\n", entry.File)
+	}
+}
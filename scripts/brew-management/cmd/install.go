@@ -3,26 +3,43 @@ package cmd
 import (
 	"fmt"
 	"sort"
+	"strings"
 
-	"brew-manager/pkg/brew"
-	"brew-manager/pkg/types"
-	"brew-manager/pkg/utils"
-	yamlPkg "brew-manager/pkg/yaml"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brew"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/journal"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lock"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/metadata"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/output"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	groups        string
-	tags          string
-	profile       string
-	skipTaps      bool
-	skipBrews     bool
-	skipCasks     bool
-	skipMas       bool
-	listGroups    bool
-	listTags      bool
-	listProfiles  bool
+	groups       string
+	tags         string
+	profile      string
+	skipTaps     bool
+	skipBrews    bool
+	skipCasks    bool
+	skipMas      bool
+	skipVSCode   bool
+	skipGo       bool
+	skipCargo    bool
+	skipNpm      bool
+	listGroups   bool
+	listTags     bool
+	listProfiles bool
+	batch        bool
+	batchSize    int
+	jobs         int
+	locked       bool
+	allowDrift   bool
+	lockFile     string
 )
 
 // installCmd represents the install command
@@ -32,146 +49,387 @@ var installCmd = &cobra.Command{
 	Long: `Install Homebrew packages from a YAML configuration file with group/tag support.
 
 Examples:
-  brew-manager install                                    # Install all packages
-  brew-manager install --groups core,development         # Install only core and development groups
-  brew-manager install --tags essential,productivity     # Install packages with essential or productivity tags
-  brew-manager install --profile developer               # Install using developer profile
-  brew-manager install --exclude-tags experimental       # Install all except experimental packages
-  brew-manager install --groups development --brews-only # Install only brew packages from development group`,
-	Run: func(cmd *cobra.Command, args []string) {
+  brew-manager install                                                   # Install all packages
+  brew-manager install --groups core,development                         # Install only core and development groups
+  brew-manager install --tags essential,productivity                     # Install packages with essential or productivity tags
+  brew-manager install --profile developer                               # Install using developer profile
+  brew-manager install --groups development --skip-casks --skip-mas      # Install development group without casks and Mac App Store apps
+  brew-manager install --skip-vscode --skip-go --skip-cargo --skip-npm   # Install only Homebrew and Mac App Store packages
+  brew-manager install --list-profiles                                   # List profiles defined in the configuration
+  brew-manager install --batch --jobs 4                                  # Batch brew installs, install taps and mas apps 4 at a time
+  brew-manager install --locked                                          # Refuse to install if installed versions drifted from packages.lock.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get YAML file path
-		yamlFile := getDefaultYAMLPath("packages.yaml")
-		if len(args) > 0 {
-			yamlFile = args[0]
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
 		}
 
 		// Handle list commands
 		if listGroups || listTags || listProfiles {
-			if err := handleListCommands(yamlFile); err != nil {
-				utils.PrintStatus(utils.Red, fmt.Sprintf("Error: %v", err))
-				return
-			}
-			return
+			return handleListCommands(yamlFile)
 		}
 
 		// Build install options
 		options := &types.InstallOptions{
-			DryRun:         dryRun,
-			Verbose:        verbose,
-			Groups:         utils.SplitCommaSeparated(groups),
-			Tags:           utils.SplitCommaSeparated(tags),
-			Profile:        profile,
-			SkipTaps:       skipTaps,
-			SkipBrews:      skipBrews,
-			SkipCasks:      skipCasks,
-			SkipMas:        skipMas,
+			DryRun:     dryRun,
+			Verbose:    verbose,
+			Groups:     utils.SplitCommaSeparated(groups),
+			Tags:       utils.SplitCommaSeparated(tags),
+			Profile:    profile,
+			SkipTaps:   skipTaps,
+			SkipBrews:  skipBrews,
+			SkipCasks:  skipCasks,
+			SkipMas:    skipMas,
+			SkipVSCode: skipVSCode,
+			SkipGo:     skipGo,
+			SkipCargo:  skipCargo,
+			SkipNpm:    skipNpm,
+			Batch:      batch,
+			BatchSize:  batchSize,
+			Jobs:       jobs,
+			Locked:     locked,
+			AllowDrift: allowDrift,
+			LockFile:   lockFile,
+		}
+		if options.LockFile == "" {
+			options.LockFile = lock.DefaultPath(yamlFile)
 		}
 
 		// Load configuration
-		config, err := yamlPkg.LoadGroupedConfig(yamlFile)
+		config, err := yamlPkg.LoadMergedConfig(yamlFile)
 		if err != nil {
-			utils.PrintStatus(utils.Red, fmt.Sprintf("Error loading config: %v", err))
-			return
+			return fmt.Errorf("error loading config: %w", err)
 		}
 
 		// Get filtered packages
-		filteredPackages := yamlPkg.GetFilteredPackages(config, options)
+		filteredPackages, err := yamlPkg.GetFilteredPackages(config, options)
+		if err != nil {
+			return err
+		}
 
 		if len(filteredPackages) == 0 {
 			utils.PrintStatus(utils.Yellow, "No packages found matching the specified criteria.")
-			return
+			rep := report.New("install")
+			rep.Finish()
+			return printResult(rep)
 		}
 
 		utils.PrintStatus(utils.Blue, fmt.Sprintf("Found %d packages to install", len(filteredPackages)))
 
+		// Query installed packages once for the whole run
+		installed, err := state.Load(cmdRunner)
+		if err != nil {
+			return err
+		}
+
+		var lockfile *lock.Lockfile
+		if options.Locked {
+			if lockfile, err = checkLockedVersions(filteredPackages, options); err != nil {
+				return err
+			}
+		}
+
 		// Install packages
-		// Note: brew.InstallPackages will need to be adapted to handle []types.FilteredPackage
-		if err := brew.InstallPackages(filteredPackages, options); err != nil {
-			utils.PrintStatus(utils.Red, fmt.Sprintf("Installation failed: %v", err))
-			return
+		entry, snapshot := newHistoryEntry(yamlFile)
+		rep := report.New("install")
+		if err := brew.InstallPackages(cmdRunner, installed, rep, filteredPackages, options); err != nil {
+			return fmt.Errorf("installation failed: %w", err)
+		}
+
+		if !options.DryRun && rep.Counts()[report.StatusInstalled] > 0 {
+			journal.FromReport(entry, rep, nil, historyVersions())
+			recordHistory(entry, snapshot)
+		}
+
+		if options.Locked && !options.DryRun {
+			reportNewDrift(lockfile, rep, filteredPackages)
+		}
+
+		if err := finishReport(rep, rep); err != nil {
+			return fmt.Errorf("installation failed: %w", err)
 		}
 
 		utils.PrintStatus(utils.Green, "Installation completed successfully!")
+		return nil
 	},
 }
 
+// checkLockedVersions compares the installed versions of packages with the lockfile
+// and refuses to continue on drift unless --allow-drift is set
+func checkLockedVersions(filteredPackages []types.FilteredPackage, options *types.InstallOptions) (*lock.Lockfile, error) {
+	lockfile, err := lock.Load(options.LockFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w (run 'brew-manager lock' to create it)", err)
+	}
+
+	versions, err := lock.QueryVersions(cmdRunner)
+	if err != nil {
+		return nil, err
+	}
+
+	drifts, unlocked := lock.CheckDrift(lockfile, versions, filteredPackages, true)
+	if len(unlocked) > 0 {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("%d packages are not in %s and will not be checked", len(unlocked), options.LockFile))
+		if options.Verbose {
+			for _, pkg := range unlocked {
+				fmt.Fprintf(utils.Output, "  - %s: %s\n", pkg.Type, pkg.Name)
+			}
+		}
+	}
+
+	if len(drifts) == 0 {
+		utils.PrintStatus(utils.Green, "Installed versions match the lockfile")
+		return lockfile, nil
+	}
+
+	utils.PrintStatus(utils.Yellow, fmt.Sprintf("%d installed packages differ from the lockfile:", len(drifts)))
+	lock.PrintDrift(drifts)
+	if !options.AllowDrift {
+		return nil, fmt.Errorf("version drift detected (use --allow-drift to install anyway, or 'brew-manager lock' to update the lockfile)")
+	}
+
+	return lockfile, nil
+}
+
+// reportNewDrift warns about packages installed in this run whose version differs from the lockfile.
+// Homebrew always installs the current version, so a drifted package has to be fixed by hand.
+func reportNewDrift(lockfile *lock.Lockfile, rep *report.Report, filteredPackages []types.FilteredPackage) {
+	newlyInstalled := make(map[string]bool)
+	for _, result := range rep.Results {
+		if result.Status == report.StatusInstalled {
+			newlyInstalled[result.Type+":"+result.Name] = true
+		}
+	}
+	if len(newlyInstalled) == 0 {
+		return
+	}
+
+	var pkgs []types.FilteredPackage
+	for _, pkg := range filteredPackages {
+		if newlyInstalled[pkg.Type+":"+pkg.Name] {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	versions, err := lock.QueryVersions(cmdRunner)
+	if err != nil {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: failed to check installed versions: %v", err))
+		return
+	}
+
+	if drifts, _ := lock.CheckDrift(lockfile, versions, pkgs, false); len(drifts) > 0 {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: %d newly installed packages differ from the lockfile:", len(drifts)))
+		lock.PrintDrift(drifts)
+	}
+}
+
+// listing is the result of the --list-groups, --list-tags and --list-profiles options
+type listing struct {
+	Groups   []groupListing   `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Tags     []tagListing     `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Profiles []profileListing `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+}
+
+// groupListing is a group in a listing
+type groupListing struct {
+	Name        string          `json:"name" yaml:"name"`
+	Description string          `json:"description" yaml:"description"`
+	Priority    int             `json:"priority" yaml:"priority"`
+	Packages    []listedPackage `json:"packages" yaml:"packages"`
+}
+
+// tagListing is a tag in a listing, with the packages that have it
+type tagListing struct {
+	Name     string          `json:"name" yaml:"name"`
+	Packages []listedPackage `json:"packages" yaml:"packages"`
+}
+
+// profileListing is a profile in a listing, with everything it extends merged in
+type profileListing struct {
+	Name            string   `json:"name" yaml:"name"`
+	Description     string   `json:"description" yaml:"description"`
+	Extends         []string `json:"extends,omitempty" yaml:"extends,omitempty"`
+	Groups          []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Tags            []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	ExcludeTags     []string `json:"exclude_tags,omitempty" yaml:"exclude_tags,omitempty"`
+	ExcludeGroups   []string `json:"exclude_groups,omitempty" yaml:"exclude_groups,omitempty"`
+	ExcludePackages []string `json:"exclude_packages,omitempty" yaml:"exclude_packages,omitempty"`
+}
+
+// listedPackage is a package in a listing, described from the YAML or else from the metadata cache
+type listedPackage struct {
+	Type        string `json:"type" yaml:"type"`
+	Name        string `json:"name" yaml:"name"`
+	ID          int64  `json:"id,omitempty" yaml:"id,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
 func handleListCommands(yamlFile string) error {
-	config, err := yamlPkg.LoadGroupedConfig(yamlFile)
+	config, err := yamlPkg.LoadMergedConfig(yamlFile)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	// Packages are shown with their descriptions in verbose mode and in results
+	var meta *metadata.Cache
+	if verbose || outputFormat != output.Text {
+		meta = loadMetadata()
+	}
+
+	var result listing
 	if listGroups {
-		utils.PrintStatus(utils.Cyan, "Available Groups:")
-		
-		// Create slice for sorting
-		type groupInfo struct {
-			name     string
-			priority int
-			desc     string
-		}
-		var groupsToSort []groupInfo // Renamed to avoid conflict
-		
 		for name, group := range config.Groups {
-			groupsToSort = append(groupsToSort, groupInfo{ // Use renamed variable
-				name:     name,
-				priority: group.Priority,
-				desc:     group.Description,
+			result.Groups = append(result.Groups, groupListing{
+				Name:        name,
+				Description: group.Description,
+				Priority:    group.Priority,
+				Packages:    listPackages(group.Packages, meta),
 			})
 		}
-		
+
 		// Sort by priority
-		sort.Slice(groupsToSort, func(i, j int) bool { // Use renamed variable
-			return groupsToSort[i].priority < groupsToSort[j].priority // Use renamed variable
+		sort.SliceStable(result.Groups, func(i, j int) bool {
+			return result.Groups[i].Priority < result.Groups[j].Priority
 		})
-		
-		for _, group := range groupsToSort { // Use renamed variable
-			fmt.Printf("  %s: %s (priority: %d)\n", group.name, group.desc, group.priority)
-		}
 	}
 
 	if listTags {
-		utils.PrintStatus(utils.Cyan, "Available Tags:")
-		tagSet := make(map[string]bool)
-		
+		tagSet := make(map[string]map[string][]types.PackageInfo) // tag -> packages with the tag, by type
+
 		for _, group := range config.Groups {
-			for _, pkgInfos := range group.Packages { // Iterate through map values (slices of PackageInfo)
+			for pkgType, pkgInfos := range group.Packages { // Iterate through map values (slices of PackageInfo)
 				for _, pkgInfo := range pkgInfos { // Iterate through PackageInfo slices
 					for _, tag := range pkgInfo.Tags { // Access Tags from PackageInfo
-						tagSet[tag] = true
+						if tagSet[tag] == nil {
+							tagSet[tag] = make(map[string][]types.PackageInfo)
+						}
+						tagSet[tag][pkgType] = append(tagSet[tag][pkgType], pkgInfo)
 					}
 				}
 			}
 		}
-		
+
 		var tags []string
 		for tag := range tagSet {
 			tags = append(tags, tag)
 		}
 		sort.Strings(tags)
-		
+
 		for _, tag := range tags {
-			fmt.Printf("  - %s\n", tag)
+			for _, pkgInfos := range tagSet[tag] {
+				sort.Slice(pkgInfos, func(i, j int) bool { return pkgInfos[i].Name < pkgInfos[j].Name })
+			}
+			result.Tags = append(result.Tags, tagListing{Name: tag, Packages: listPackages(tagSet[tag], meta)})
+		}
+	}
+
+	if listProfiles {
+		var names []string
+		for name := range config.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// Show each profile with everything it extends merged in
+		for _, name := range names {
+			profile, err := yamlPkg.ResolveProfile(config, name)
+			if err != nil {
+				return err
+			}
+			result.Profiles = append(result.Profiles, profileListing{
+				Name:            name,
+				Description:     profile.Description,
+				Extends:         profile.Chain[:len(profile.Chain)-1],
+				Groups:          profile.Groups,
+				Tags:            profile.Tags,
+				ExcludeTags:     profile.ExcludeTags,
+				ExcludeGroups:   profile.ExcludeGroups,
+				ExcludePackages: profile.ExcludePackages,
+			})
+		}
+	}
+
+	if outputFormat != output.Text {
+		return printResult(result)
+	}
+	printListing(result)
+	return nil
+}
+
+// printListing prints a listing as text; packages are only shown in verbose mode
+func printListing(result listing) {
+	if listGroups {
+		utils.PrintStatus(utils.Cyan, "Available Groups:")
+		for _, group := range result.Groups {
+			fmt.Fprintf(utils.Output, "  %s: %s (priority: %d)\n", group.Name, group.Description, group.Priority)
+			if verbose {
+				printPackageDescriptions(group.Packages)
+			}
+		}
+	}
+
+	if listTags {
+		utils.PrintStatus(utils.Cyan, "Available Tags:")
+		for _, tag := range result.Tags {
+			fmt.Fprintf(utils.Output, "  - %s\n", tag.Name)
+			if verbose {
+				printPackageDescriptions(tag.Packages)
+			}
 		}
 	}
 
 	if listProfiles {
 		utils.PrintStatus(utils.Cyan, "Available Profiles:")
-		for name, profile := range config.Profiles {
-			fmt.Printf("  %s: %s\n", name, profile.Description)
+		for _, profile := range result.Profiles {
+			fmt.Fprintf(utils.Output, "  %s: %s\n", profile.Name, profile.Description)
+			if len(profile.Extends) > 0 {
+				fmt.Fprintf(utils.Output, "    Extends: %s\n", strings.Join(profile.Extends, ", "))
+			}
 			if len(profile.Groups) > 0 {
-				fmt.Printf("    Groups: %v\n", profile.Groups)
+				fmt.Fprintf(utils.Output, "    Groups: %v\n", profile.Groups)
 			}
 			if len(profile.Tags) > 0 {
-				fmt.Printf("    Tags: %v\n", profile.Tags)
+				fmt.Fprintf(utils.Output, "    Tags: %v\n", profile.Tags)
 			}
 			if len(profile.ExcludeTags) > 0 {
-				fmt.Printf("    Exclude Tags: %v\n", profile.ExcludeTags)
+				fmt.Fprintf(utils.Output, "    Exclude Tags: %v\n", profile.ExcludeTags)
+			}
+			if len(profile.ExcludeGroups) > 0 {
+				fmt.Fprintf(utils.Output, "    Exclude Groups: %v\n", profile.ExcludeGroups)
+			}
+			if len(profile.ExcludePackages) > 0 {
+				fmt.Fprintf(utils.Output, "    Exclude Packages: %v\n", profile.ExcludePackages)
 			}
 		}
 	}
+}
 
-	return nil
+// listPackages lists packages in install order with their description, taken from the YAML
+// or else from the metadata cache
+func listPackages(packages map[string][]types.PackageInfo, meta *metadata.Cache) []listedPackage {
+	listed := []listedPackage{}
+	for _, pkgType := range brew.InstallOrder {
+		for _, pkgInfo := range packages[pkgType] {
+			description := pkgInfo.Description
+			if description == "" {
+				description = meta.Description(pkgType, pkgInfo.Name)
+			}
+			listed = append(listed, listedPackage{Type: pkgType, Name: pkgInfo.Name, ID: pkgInfo.ID, Description: description})
+		}
+	}
+	return listed
+}
+
+// printPackageDescriptions prints listed packages with their description
+func printPackageDescriptions(packages []listedPackage) {
+	for _, pkg := range packages {
+		if pkg.Description != "" {
+			fmt.Fprintf(utils.Output, "    - %s: %s - %s\n", pkg.Type, pkg.Name, pkg.Description)
+		} else {
+			fmt.Fprintf(utils.Output, "    - %s: %s\n", pkg.Type, pkg.Name)
+		}
+	}
 }
 
 func init() {
@@ -187,9 +445,25 @@ func init() {
 	installCmd.Flags().BoolVar(&skipBrews, "skip-brews", false, "Skip installing brew formulae")
 	installCmd.Flags().BoolVar(&skipCasks, "skip-casks", false, "Skip installing casks")
 	installCmd.Flags().BoolVar(&skipMas, "skip-mas", false, "Skip installing Mac App Store apps")
+	installCmd.Flags().BoolVar(&skipVSCode, "skip-vscode", false, "Skip installing VS Code extensions")
+	installCmd.Flags().BoolVar(&skipGo, "skip-go", false, "Skip installing Go packages")
+	installCmd.Flags().BoolVar(&skipCargo, "skip-cargo", false, "Skip installing Cargo packages")
+	installCmd.Flags().BoolVar(&skipNpm, "skip-npm", false, "Skip installing npm packages")
+
+	// Batching and concurrency
+	installCmd.Flags().BoolVar(&batch, "batch", false, "Install missing formulae and casks of each group with a single brew command")
+	installCmd.Flags().IntVar(&batchSize, "batch-size", 0, "Maximum packages per batched brew command (0 for no limit)")
+	installCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "Maximum number of taps or Mac App Store apps installed concurrently")
+
+	// Version locking
+	installCmd.Flags().BoolVar(&locked, "locked", false, "Refuse to install when installed versions differ from the lockfile or version pins")
+	installCmd.Flags().BoolVar(&allowDrift, "allow-drift", false, "With --locked, report version drift instead of refusing to install")
+	installCmd.Flags().StringVar(&lockFile, "lockfile", "", "Lockfile path (default: <yaml_file>.lock.yaml next to the YAML file)")
+
+	addReportFlags(installCmd)
 
 	// List commands
 	installCmd.Flags().BoolVar(&listGroups, "list-groups", false, "List available groups")
 	installCmd.Flags().BoolVar(&listTags, "list-tags", false, "List available tags")
 	installCmd.Flags().BoolVar(&listProfiles, "list-profiles", false, "List available profiles")
-} 
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lint"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/output"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	fixInLint bool
+	listRules bool
+)
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint [yaml_file]",
+	Short: "Check the YAML configuration for likely mistakes",
+	Long: `Check the YAML configuration for mistakes that are valid YAML but probably not intended,
+such as duplicate packages, profiles referring to undefined groups, casks listed under brew
+and unsorted package lists. Errors make lint fail; warnings do not.
+
+Findings are silenced by a "# lint:ignore <rule>[,<rule>...]" comment on their line or on the
+line before, or "# lint:ignore all" for every rule. Use --rules to list the rules.
+
+Examples:
+  brew-manager lint                      # Lint packages.yaml
+  brew-manager lint work.yaml            # Lint another file
+  brew-manager lint --fix                # Fix what can be fixed automatically
+  brew-manager lint --fix --dry-run      # Show what --fix would change
+  brew-manager lint --rules              # List the rules`,
+	Annotations: map[string]string{annotationNoPrerequisites: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if listRules {
+			if outputFormat != output.Text {
+				return printResult(lint.Rules)
+			}
+			for _, rule := range lint.Rules {
+				fixable := ""
+				if rule.Fixable {
+					fixable = " (fixable)"
+				}
+				fmt.Fprintf(utils.Output, "  %-20s %-8s %s%s\n", rule.ID, rule.Severity, rule.Description, fixable)
+			}
+			return nil
+		}
+
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
+		}
+		if !utils.FileExists(yamlFile) {
+			return fmt.Errorf("YAML file not found: %s", yamlFile)
+		}
+
+		result, err := lint.Lint(yamlFile, loadMetadata())
+		if err != nil {
+			return err
+		}
+
+		fixed := 0
+		if fixInLint {
+			fixable := result.Fixable()
+			if dryRun {
+				for _, f := range fixable {
+					utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would fix %s:%s", filepath.Base(yamlFile), f))
+				}
+			} else {
+				entry, snapshot := newHistoryEntry(yamlFile)
+				if fixed, err = lint.Fix(yamlFile, fixable); err != nil {
+					return fmt.Errorf("failed to fix %s: %w", yamlFile, err)
+				}
+				entry.ConfigChanged = fixed > 0
+				recordHistory(entry, snapshot)
+			}
+		}
+
+		out := lintResult{File: yamlFile, Fixed: fixed, Silenced: result.Silenced, Findings: []lintFinding{}}
+		for _, f := range result.Findings {
+			out.Findings = append(out.Findings, lintFinding{
+				Rule:     f.Rule.ID,
+				Severity: f.Rule.Severity,
+				Path:     yamlPkg.Pointer(f.Path),
+				Line:     f.Line,
+				Column:   f.Column,
+				Message:  f.Message,
+				Fixable:  f.Fixable(),
+				Fixed:    fixed > 0 && f.Fixable(),
+			})
+		}
+		if err := printResult(out); err != nil {
+			return err
+		}
+
+		errorCount := 0
+		remaining := 0
+		for _, f := range result.Findings {
+			if fixed > 0 && f.Fixable() {
+				if verbose {
+					utils.PrintStatus(utils.Green, fmt.Sprintf("Fixed %s:%s", filepath.Base(yamlFile), f))
+				}
+				continue
+			}
+			remaining++
+
+			colorFunc := utils.Yellow
+			if f.Rule.Severity == lint.SeverityError {
+				colorFunc = utils.Red
+				errorCount++
+			}
+			utils.PrintStatus(colorFunc, fmt.Sprintf("%s:%s", filepath.Base(yamlFile), f))
+		}
+
+		if verbose && result.Silenced > 0 {
+			utils.PrintStatus(utils.Cyan, fmt.Sprintf("%d findings silenced by ignore comments", result.Silenced))
+		}
+		if fixed > 0 {
+			utils.PrintStatus(utils.Green, fmt.Sprintf("Fixed %d findings in %s", fixed, yamlFile))
+		}
+		if remaining == 0 {
+			utils.PrintStatus(utils.Green, "No lint findings")
+			return nil
+		}
+
+		summary := fmt.Sprintf("%d findings (%d errors, %d warnings)", remaining, errorCount, remaining-errorCount)
+		if n := len(result.Fixable()); fixed == 0 && n > 0 {
+			summary += fmt.Sprintf(", %d fixable with --fix", n)
+		}
+		if errorCount > 0 {
+			return fmt.Errorf("lint failed: %s", summary)
+		}
+		utils.PrintStatus(utils.Yellow, summary)
+		return nil
+	},
+}
+
+// lintResult is the result of lint for --output
+type lintResult struct {
+	File     string        `json:"file" yaml:"file"`
+	Findings []lintFinding `json:"findings" yaml:"findings"`
+	Fixed    int           `json:"fixed" yaml:"fixed"`
+	Silenced int           `json:"silenced" yaml:"silenced"`
+}
+
+// lintFinding is a finding in lintResult
+type lintFinding struct {
+	Rule     string        `json:"rule" yaml:"rule"`
+	Severity lint.Severity `json:"severity" yaml:"severity"`
+	Path     string        `json:"path" yaml:"path"`
+	Line     int           `json:"line" yaml:"line"`
+	Column   int           `json:"column" yaml:"column"`
+	Message  string        `json:"message" yaml:"message"`
+	Fixable  bool          `json:"fixable" yaml:"fixable"`
+	Fixed    bool          `json:"fixed" yaml:"fixed"`
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+
+	lintCmd.Flags().BoolVar(&fixInLint, "fix", false, "Fix the findings that can be fixed automatically and save the file")
+	lintCmd.Flags().BoolVar(&listRules, "rules", false, "List the lint rules")
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lock"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+
+	"github.com/spf13/cobra"
+)
+
+var lockOut string
+
+// lockCmd represents the lock command
+var lockCmd = &cobra.Command{
+	Use:   "lock [yaml_file]",
+	Short: "Record installed package versions in a lockfile",
+	Long: `Record the installed version of every configured tap, formula, cask and Mac App Store app
+in a lockfile (packages.lock.yaml next to the YAML file by default). Taps record their checked out commit.
+
+Use 'brew-manager install --locked' to check a machine against the lockfile.
+
+Examples:
+  brew-manager lock                                  # Write packages.lock.yaml
+  brew-manager lock --lockfile team.lock.yaml        # Write to a custom path
+  brew-manager lock --dry-run                        # Show what would be recorded`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Get YAML file path
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
+		}
+
+		lockPath := lockOut
+		if lockPath == "" {
+			lockPath = lock.DefaultPath(yamlFile)
+		}
+
+		config, err := yamlPkg.LoadMergedConfig(yamlFile)
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+
+		filteredPackages, err := yamlPkg.GetFilteredPackages(config, &types.InstallOptions{})
+		if err != nil {
+			return err
+		}
+
+		versions, err := lock.QueryVersions(cmdRunner)
+		if err != nil {
+			return fmt.Errorf("lock failed: %w", err)
+		}
+
+		lockfile, missing := lock.Generate(versions, filteredPackages)
+		result := lockResult{File: lockPath, Lockfile: lockfile, Missing: []listedPackage{}, Drift: []lock.Drift{}, DryRun: dryRun}
+
+		if len(missing) > 0 {
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("%d configured packages are not installed and were not locked:", len(missing)))
+			for _, pkg := range missing {
+				fmt.Fprintf(utils.Output, "  - %s: %s\n", pkg.Type, pkg.Name)
+				result.Missing = append(result.Missing, listedPackage{Type: pkg.Type, Name: pkg.Name, ID: pkg.ID})
+			}
+		}
+
+		// Version pins in the YAML take precedence over the lockfile, so flag the ones that no longer hold
+		if drifts, _ := lock.CheckDrift(nil, versions, filteredPackages, true); len(drifts) > 0 {
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: %d installed packages differ from their pinned version:", len(drifts)))
+			lock.PrintDrift(drifts)
+			result.Drift = drifts
+		}
+
+		total := 0
+		for _, pkgType := range types.PackageTypes {
+			entries := lockfile.Packages[pkgType]
+			total += len(entries)
+			if verbose || dryRun {
+				for _, entry := range entries {
+					version := entry.Version
+					if pkgType == "tap" {
+						version = entry.Commit
+					}
+					fmt.Fprintf(utils.Output, "  %s: %s %s\n", pkgType, entry.Name, version)
+				}
+			}
+		}
+
+		if dryRun {
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would lock %d packages in %s", total, lockPath))
+			return printResult(result)
+		}
+
+		if err := lock.Save(lockfile, lockPath); err != nil {
+			return fmt.Errorf("error writing lockfile: %w", err)
+		}
+
+		utils.PrintStatus(utils.Green, fmt.Sprintf("Locked %d packages in %s", total, lockPath))
+		return printResult(result)
+	},
+}
+
+// lockResult is the result of lock for --output
+type lockResult struct {
+	File     string          `json:"file" yaml:"file"`
+	Lockfile *lock.Lockfile  `json:"lockfile" yaml:"lockfile"`
+	Missing  []listedPackage `json:"missing" yaml:"missing"` // Configured packages that are not installed
+	Drift    []lock.Drift    `json:"drift" yaml:"drift"`     // Installed packages that differ from their pinned version
+	DryRun   bool            `json:"dry_run" yaml:"dry_run"`
+}
+
+func init() {
+	rootCmd.AddCommand(lockCmd)
+
+	lockCmd.Flags().StringVar(&lockOut, "lockfile", "", "Lockfile path (default: <yaml_file>.lock.yaml next to the YAML file)")
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/metadata"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var metadataType string
+
+// metadataCmd represents the metadata command
+var metadataCmd = &cobra.Command{
+	Use:   "metadata",
+	Short: "Manage the offline package metadata cache",
+	Long: `Manage the offline cache of installed package metadata (description, homepage, tap and dependencies).
+
+sync and convert fill in package descriptions from the cache, classification rules can match
+descriptions, and install --list-groups --verbose shows them. The cache is only updated by refresh.
+
+Examples:
+  brew-manager metadata refresh                        # Query brew and rewrite the cache
+  brew-manager metadata show git ripgrep               # Show cached metadata of formulae
+  brew-manager metadata show --type cask slack         # Show cached metadata of a cask`,
+}
+
+// metadataRefreshCmd represents the metadata refresh command
+var metadataRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Rebuild the metadata cache from brew info",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := metadata.Refresh(cmdRunner)
+		if err != nil {
+			return fmt.Errorf("refresh failed: %w", err)
+		}
+
+		cachePath := metadataPath()
+		if dryRun {
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would cache metadata of %d packages in %s", cache.Len(), cachePath))
+			return nil
+		}
+
+		if err := metadata.Save(cache, cachePath); err != nil {
+			return err
+		}
+
+		utils.PrintStatus(utils.Green, fmt.Sprintf("Cached metadata of %d packages in %s", cache.Len(), cachePath))
+		return nil
+	},
+}
+
+// metadataShowCmd represents the metadata show command
+var metadataShowCmd = &cobra.Command{
+	Use:   "show <package>...",
+	Short: "Show cached metadata of packages",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if metadataType != "brew" && metadataType != "cask" {
+			return fmt.Errorf("invalid package type %q: must be brew or cask", metadataType)
+		}
+
+		cache, err := metadata.Load(metadataPath())
+		if err != nil {
+			return err
+		}
+		if cache.Len() == 0 {
+			return fmt.Errorf("metadata cache %s is empty; run 'brew-manager metadata refresh'", metadataPath())
+		}
+		if verbose {
+			utils.PrintStatus(utils.Blue, fmt.Sprintf("Metadata cached at %s", cache.GeneratedAt.Local().Format("2006-01-02 15:04:05")))
+		}
+
+		found := []metadata.Package{}
+		for _, name := range args {
+			pkg, ok := cache.Lookup(metadataType, name)
+			if !ok {
+				utils.PrintStatus(utils.Yellow, fmt.Sprintf("%s: %s is not in the metadata cache", metadataType, name))
+				continue
+			}
+			found = append(found, pkg)
+			fmt.Fprintf(utils.Output, "%s: %s\n", metadataType, pkg.Name)
+			fmt.Fprintf(utils.Output, "  Description: %s\n", pkg.Description)
+			fmt.Fprintf(utils.Output, "  Homepage: %s\n", pkg.Homepage)
+			fmt.Fprintf(utils.Output, "  Tap: %s\n", pkg.Tap)
+			if len(pkg.Dependencies) > 0 {
+				fmt.Fprintf(utils.Output, "  Dependencies: %s\n", strings.Join(pkg.Dependencies, ", "))
+			}
+		}
+
+		return printResult(found)
+	},
+}
+
+// metadataPath returns the metadata cache path selected by --metadata-cache
+func metadataPath() string {
+	if metadataFile != "" {
+		return metadataFile
+	}
+	return metadata.DefaultPath()
+}
+
+// loadMetadata loads the metadata cache for enriching output. The cache is optional, so a
+// cache that cannot be read only produces a warning and no metadata.
+func loadMetadata() *metadata.Cache {
+	cache, err := metadata.Load(metadataPath())
+	if err != nil {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: ignoring metadata cache: %v", err))
+		return nil
+	}
+	return cache
+}
+
+func init() {
+	rootCmd.AddCommand(metadataCmd)
+	metadataCmd.AddCommand(metadataRefreshCmd)
+	metadataCmd.AddCommand(metadataShowCmd)
+
+	metadataShowCmd.Flags().StringVar(&metadataType, "type", "brew", "Package type: brew or cask")
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/plan"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	groupsInPlan     string
+	tagsInPlan       string
+	profileInPlan    string
+	skipTapsInPlan   bool
+	skipBrewsInPlan  bool
+	skipCasksInPlan  bool
+	skipMasInPlan    bool
+	skipVSCodeInPlan bool
+	skipGoInPlan     bool
+	skipCargoInPlan  bool
+	skipNpmInPlan    bool
+	noPruneInPlan    bool
+	keepInPlan       string
+	planOut          string
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan [yaml_file]",
+	Short: "Compute an execution plan and write it as JSON",
+	Long: `Compute the full set of installs, skips and removals needed to converge this machine
+to the YAML configuration, and write it as a JSON plan file without changing anything.
+
+The plan can be reviewed and then executed with 'brew-manager apply'.
+
+Examples:
+  brew-manager plan                                   # Write plan.json for all packages
+  brew-manager plan --profile developer --out dev.json
+  brew-manager plan --groups core --no-prune          # Only plan installs for the core group`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Get YAML file path
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
+		}
+
+		installOptions := &types.InstallOptions{
+			Verbose:    verbose,
+			Groups:     utils.SplitCommaSeparated(groupsInPlan),
+			Tags:       utils.SplitCommaSeparated(tagsInPlan),
+			Profile:    profileInPlan,
+			SkipTaps:   skipTapsInPlan,
+			SkipBrews:  skipBrewsInPlan,
+			SkipCasks:  skipCasksInPlan,
+			SkipMas:    skipMasInPlan,
+			SkipVSCode: skipVSCodeInPlan,
+			SkipGo:     skipGoInPlan,
+			SkipCargo:  skipCargoInPlan,
+			SkipNpm:    skipNpmInPlan,
+		}
+
+		var pruneOptions *types.PruneOptions
+		if !noPruneInPlan {
+			pruneOptions = &types.PruneOptions{
+				Verbose:    verbose,
+				Profile:    profileInPlan,
+				Groups:     utils.SplitCommaSeparated(groupsInPlan),
+				Tags:       utils.SplitCommaSeparated(tagsInPlan),
+				Keep:       utils.SplitCommaSeparated(keepInPlan),
+				SkipTaps:   skipTapsInPlan,
+				SkipBrews:  skipBrewsInPlan,
+				SkipCasks:  skipCasksInPlan,
+				SkipMas:    skipMasInPlan,
+				SkipVSCode: skipVSCodeInPlan,
+				SkipGo:     skipGoInPlan,
+				SkipCargo:  skipCargoInPlan,
+				SkipNpm:    skipNpmInPlan,
+			}
+		}
+
+		config, err := yamlPkg.LoadMergedConfig(yamlFile)
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+
+		filteredPackages, err := yamlPkg.GetFilteredPackages(config, installOptions)
+		if err != nil {
+			return fmt.Errorf("planning failed: %w", err)
+		}
+
+		installed, err := state.Load(cmdRunner)
+		if err != nil {
+			return fmt.Errorf("planning failed: %w", err)
+		}
+
+		// Formula dependencies only matter for removals
+		var graph *deps.Graph
+		if pruneOptions != nil && !pruneOptions.SkipBrews {
+			if graph, err = deps.Load(cmdRunner); err != nil {
+				return fmt.Errorf("planning failed: %w", err)
+			}
+		}
+
+		p, err := plan.BuildPlan(installed, graph, yamlFile, config, filteredPackages, installOptions, pruneOptions)
+		if err != nil {
+			return fmt.Errorf("planning failed: %w", err)
+		}
+
+		if verbose {
+			for _, step := range p.Steps {
+				fmt.Fprintf(utils.Output, "  %-7s %-4s %s\n", step.Action, step.Type, step.Name)
+			}
+		}
+
+		if err := plan.Save(p, planOut); err != nil {
+			return fmt.Errorf("error writing plan: %w", err)
+		}
+
+		counts := p.Counts()
+		utils.PrintStatus(utils.Green, fmt.Sprintf("Plan written to %s: %d to install, %d already installed, %d to remove",
+			planOut, counts[plan.ActionInstall], counts[plan.ActionSkip], counts[plan.ActionRemove]))
+		return printResult(p)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+
+	// Package filters, same as install
+	planCmd.Flags().StringVarP(&groupsInPlan, "groups", "g", "", "Plan only specified groups (comma-separated)")
+	planCmd.Flags().StringVarP(&tagsInPlan, "tags", "t", "", "Plan only packages with specified tags (comma-separated)")
+	planCmd.Flags().StringVarP(&profileInPlan, "profile", "p", "", "Plan using predefined profile")
+
+	// Package type skip flags
+	planCmd.Flags().BoolVar(&skipTapsInPlan, "skip-taps", false, "Skip taps")
+	planCmd.Flags().BoolVar(&skipBrewsInPlan, "skip-brews", false, "Skip brew formulae")
+	planCmd.Flags().BoolVar(&skipCasksInPlan, "skip-casks", false, "Skip casks")
+	planCmd.Flags().BoolVar(&skipMasInPlan, "skip-mas", false, "Skip Mac App Store apps")
+	planCmd.Flags().BoolVar(&skipVSCodeInPlan, "skip-vscode", false, "Skip VS Code extensions")
+	planCmd.Flags().BoolVar(&skipGoInPlan, "skip-go", false, "Skip Go packages")
+	planCmd.Flags().BoolVar(&skipCargoInPlan, "skip-cargo", false, "Skip Cargo packages")
+	planCmd.Flags().BoolVar(&skipNpmInPlan, "skip-npm", false, "Skip npm packages")
+
+	planCmd.Flags().BoolVar(&noPruneInPlan, "no-prune", false, "Do not plan removals of packages missing from the YAML configuration")
+	planCmd.Flags().StringVar(&keepInPlan, "keep", "", "Never plan removals of packages matching these glob patterns (comma-separated)")
+	planCmd.Flags().StringVar(&planOut, "out", "plan.json", "Path of the plan file to write")
+}
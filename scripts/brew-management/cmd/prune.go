@@ -2,21 +2,37 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
-	"brew-manager/pkg/types"
-	"brew-manager/pkg/utils"
-	"brew-manager/pkg/yaml"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/hooks"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/journal"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/prune"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	skipTapsInPrune  bool
-	skipBrewsInPrune bool
-	skipCasksInPrune bool
-	skipMasInPrune   bool
-	confirmAll       bool
+	skipTapsInPrune   bool
+	skipBrewsInPrune  bool
+	skipCasksInPrune  bool
+	skipMasInPrune    bool
+	skipVSCodeInPrune bool
+	skipGoInPrune     bool
+	skipCargoInPrune  bool
+	skipNpmInPrune    bool
+	confirmAll        bool
+	profileInPrune    string
+	groupsInPrune     string
+	tagsInPrune       string
+	keepInPrune       string
 )
 
 // pruneCmd represents the prune command
@@ -35,30 +51,41 @@ Examples:
   brew-manager prune packages.yaml          # Use specific YAML file
   brew-manager prune --dry-run              # Show what would be removed
   brew-manager prune --skip-brews           # Only remove casks, taps, and mas apps
-  brew-manager prune --confirm-all          # Remove all without individual confirmation`,
-	Run: func(cmd *cobra.Command, args []string) {
+  brew-manager prune --confirm-all          # Remove all without individual confirmation
+  brew-manager prune --profile work         # Converge this machine to the work profile
+  brew-manager prune --groups core,dev      # Remove everything outside the core and dev groups
+  brew-manager prune --keep 'brew:lib*,python@*'  # Never remove packages matching these patterns`,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get YAML file path
-		yamlFile := getDefaultYAMLPath("packages.yaml")
-		if len(args) > 0 {
-			yamlFile = args[0]
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
 		}
 
 		// Build prune options
 		options := &types.PruneOptions{
 			DryRun:     dryRun,
 			Verbose:    verbose,
+			Profile:    profileInPrune,
+			Groups:     utils.SplitCommaSeparated(groupsInPrune),
+			Tags:       utils.SplitCommaSeparated(tagsInPrune),
+			Keep:       utils.SplitCommaSeparated(keepInPrune),
 			SkipTaps:   skipTapsInPrune,
 			SkipBrews:  skipBrewsInPrune,
 			SkipCasks:  skipCasksInPrune,
 			SkipMas:    skipMasInPrune,
+			SkipVSCode: skipVSCodeInPrune,
+			SkipGo:     skipGoInPrune,
+			SkipCargo:  skipCargoInPrune,
+			SkipNpm:    skipNpmInPrune,
 			ConfirmAll: confirmAll,
 		}
 
 		// Perform prune
-		if err := prunePackages(yamlFile, options); err != nil {
-			utils.PrintStatus(utils.Red, fmt.Sprintf("Prune failed: %v", err))
-			return
+		if err := prunePackages(cmdRunner, yamlFile, options); err != nil {
+			return fmt.Errorf("prune failed: %w", err)
 		}
+		return nil
 	},
 }
 
@@ -70,252 +97,191 @@ func init() {
 	pruneCmd.Flags().BoolVar(&skipBrewsInPrune, "skip-brews", false, "Skip removing brew formulae")
 	pruneCmd.Flags().BoolVar(&skipCasksInPrune, "skip-casks", false, "Skip removing casks")
 	pruneCmd.Flags().BoolVar(&skipMasInPrune, "skip-mas", false, "Skip removing Mac App Store apps")
+	pruneCmd.Flags().BoolVar(&skipVSCodeInPrune, "skip-vscode", false, "Skip removing VS Code extensions")
+	pruneCmd.Flags().BoolVar(&skipGoInPrune, "skip-go", false, "Skip removing Go packages")
+	pruneCmd.Flags().BoolVar(&skipCargoInPrune, "skip-cargo", false, "Skip removing Cargo packages")
+	pruneCmd.Flags().BoolVar(&skipNpmInPrune, "skip-npm", false, "Skip removing npm packages")
 	pruneCmd.Flags().BoolVar(&confirmAll, "confirm-all", false, "Remove all packages without individual confirmation")
+	// Package filters, same as install
+	pruneCmd.Flags().StringVarP(&groupsInPrune, "groups", "g", "", "Keep only packages of specified groups (comma-separated)")
+	pruneCmd.Flags().StringVarP(&tagsInPrune, "tags", "t", "", "Keep only packages with specified tags (comma-separated)")
+	pruneCmd.Flags().StringVarP(&profileInPrune, "profile", "p", "", "Keep only the packages of this profile")
+	pruneCmd.Flags().StringVar(&keepInPrune, "keep", "", "Never remove packages matching these glob patterns, optionally prefixed with type: (comma-separated)")
+	addReportFlags(pruneCmd)
 }
 
 // prunePackages removes packages not defined in the YAML configuration
-func prunePackages(yamlFile string, options *types.PruneOptions) error {
+func prunePackages(r runner.Runner, yamlFile string, options *types.PruneOptions) error {
 	// Load YAML configuration
-	config, err := yaml.LoadGroupedConfig(yamlFile)
+	config, err := yaml.LoadMergedConfig(yamlFile)
 	if err != nil {
 		return fmt.Errorf("failed to load YAML configuration: %w", err)
 	}
 
-	// Get all packages from YAML
-	yamlPackages := getAllPackagesFromConfig(config)
+	// Get the packages to keep, limited to the profile if one was given
+	yamlPackages, err := prune.KeepSet(config, options)
+	if err != nil {
+		return err
+	}
 
 	// Get currently installed packages
-	installedPackages, installedMasApps, err := yaml.GetInstalledPackages()
+	installed, err := state.Load(r)
 	if err != nil {
-		return fmt.Errorf("failed to get installed packages: %w", err)
+		return err
+	}
+
+	// Keep formulae that kept formulae depend on
+	var required map[string][]string
+	var graph *deps.Graph
+	if !options.SkipBrews {
+		if graph, err = deps.Load(r); err != nil {
+			return err
+		}
+		required = prune.KeepDependencies(graph, yamlPackages, installed, options)
 	}
 
-	// Find packages to remove
-	packagesToRemove := findPackagesToRemove(yamlPackages, installedPackages, installedMasApps, options)
+	// Find packages to remove, removing formulae before their dependencies
+	packagesToRemove := prune.FindPackagesToRemove(yamlPackages, installed, options)
+	packagesToRemove["brew"] = graph.RemovalOrder(packagesToRemove["brew"])
 
-	if len(packagesToRemove["taps"]) == 0 && len(packagesToRemove["brews"]) == 0 &&
-		len(packagesToRemove["casks"]) == 0 && len(packagesToRemove["mas"]) == 0 {
+	if len(required) > 0 {
+		showKeptDependencies(required, options.Verbose)
+	}
+
+	result := &pruneResult{Remove: packagesToRemove, KeptDependencies: required, DryRun: options.DryRun}
+	if prune.CountPackages(packagesToRemove) == 0 {
 		utils.PrintStatus(utils.Green, "No packages to remove. All installed packages are defined in YAML configuration.")
-		return nil
+		return printResult(result)
 	}
 
 	// Show what will be removed
 	showRemovalSummary(packagesToRemove)
 
+	configured := prune.ConfiguredPackages(config)
+
 	if options.DryRun {
+		for _, pkgType := range prune.RemovalOrder {
+			for _, pkg := range packagesToRemove[pkgType] {
+				hooks.Run(r, hooks.PostRemove, prune.ConfiguredPackage(configured, pkgType, pkg), true, options.Verbose)
+			}
+		}
 		utils.PrintStatus(utils.Yellow, "[DRY RUN] No packages were actually removed.")
-		return nil
+		return printResult(result)
 	}
 
 	// Confirm removal unless --confirm-all is used
 	if !options.ConfirmAll {
 		if !confirmRemoval() {
 			utils.PrintStatus(utils.Yellow, "Prune operation cancelled.")
-			return nil
+			result.Cancelled = true
+			return printResult(result)
 		}
 	}
 
-	// Remove packages in reverse order: mas, casks, brews, taps
-	order := []string{"mas", "cask", "brew", "tap"}
-	for _, pkgType := range order {
-		if err := removePackagesByType(pkgType, packagesToRemove[pkgType], options); err != nil {
+	// Versions of removed packages are recorded in the history, so query them first
+	entry, snapshot := newHistoryEntry(yamlFile)
+	versions := historyVersions()
+
+	// Remove packages in reverse install order
+	rep := report.New("prune")
+	for _, pkgType := range prune.RemovalOrder {
+		if err := prune.RemovePackagesByType(r, installed, rep, pkgType, packagesToRemove[pkgType], configured, options); err != nil {
 			return fmt.Errorf("failed to remove %s packages: %w", pkgType, err)
 		}
 	}
 
-	utils.PrintStatus(utils.Green, "Prune operation completed successfully.")
-	return nil
-}
+	journal.FromReport(entry, rep, versions, nil)
+	recordHistory(entry, snapshot)
 
-// getAllPackagesFromConfig extracts all packages from the configuration
-func getAllPackagesFromConfig(config *types.PackageGrouped) map[string]map[string]bool {
-	result := map[string]map[string]bool{
-		"tap":  make(map[string]bool),
-		"brew": make(map[string]bool),
-		"cask": make(map[string]bool),
-		"mas":  make(map[string]bool), // MAS uses ID as string key
+	result.Report = rep
+	if err := finishReport(rep, result); err != nil {
+		return err
 	}
 
-	for _, group := range config.Groups {
-		for pkgType, pkgInfos := range group.Packages { // Iterate over package types (brew, cask, etc.)
-			for _, pkgInfo := range pkgInfos { // Iterate over packages of that type
-				switch pkgType {
-				case "tap":
-					result["tap"][pkgInfo.Name] = true
-				case "brew":
-					result["brew"][pkgInfo.Name] = true
-				case "cask":
-					result["cask"][pkgInfo.Name] = true
-				case "mas":
-					if pkgInfo.ID != 0 { // Ensure ID is present for MAS apps
-						result["mas"][fmt.Sprintf("%d", pkgInfo.ID)] = true
-					}
-				}
-			}
-		}
-	}
+	utils.PrintStatus(utils.Green, "Prune operation completed successfully.")
+	return nil
+}
 
-	return result
+// pruneResult is the result of prune for --output
+type pruneResult struct {
+	Remove           map[string][]string `json:"remove" yaml:"remove"`                                           // Packages to remove by type; mas apps as "ID (Name)"
+	KeptDependencies map[string][]string `json:"kept_dependencies,omitempty" yaml:"kept_dependencies,omitempty"` // Unconfigured formulae kept for the formulae that need them
+	DryRun           bool                `json:"dry_run" yaml:"dry_run"`
+	Cancelled        bool                `json:"cancelled,omitempty" yaml:"cancelled,omitempty"`
+	Report           *report.Report      `json:"report,omitempty" yaml:"report,omitempty"`
 }
 
-// findPackagesToRemove identifies packages to remove
-func findPackagesToRemove(yamlPackages map[string]map[string]bool,
-	installedPackages map[string][]string, installedMasApps []types.MasApp,
-	options *types.PruneOptions) map[string][]string {
+// showRemovalSummary displays what will be removed
+func showRemovalSummary(packagesToRemove map[string][]string) {
+	utils.PrintStatus(utils.Blue, "Packages to be removed:")
 
-	result := map[string][]string{
-		"taps":  []string{},
-		"brews": []string{},
-		"casks": []string{},
-		"mas":   []string{},
+	if len(packagesToRemove["tap"]) > 0 {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Taps (%d):", len(packagesToRemove["tap"])))
+		for _, tap := range packagesToRemove["tap"] {
+			fmt.Fprintf(utils.Output, "  - %s\n", tap)
+		}
 	}
 
-	// Check taps
-	if !options.SkipTaps {
-		for _, installed := range installedPackages["taps"] {
-			if !yamlPackages["tap"][installed] {
-				result["taps"] = append(result["taps"], installed)
-			}
+	if len(packagesToRemove["brew"]) > 0 {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Brew formulae (%d):", len(packagesToRemove["brew"])))
+		for _, brew := range packagesToRemove["brew"] {
+			fmt.Fprintf(utils.Output, "  - %s\n", brew)
 		}
 	}
 
-	// Check brews
-	if !options.SkipBrews {
-		for _, installed := range installedPackages["brews"] {
-			if !yamlPackages["brew"][installed] {
-				result["brews"] = append(result["brews"], installed)
-			}
+	if len(packagesToRemove["cask"]) > 0 {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Casks (%d):", len(packagesToRemove["cask"])))
+		for _, cask := range packagesToRemove["cask"] {
+			fmt.Fprintf(utils.Output, "  - %s\n", cask)
 		}
 	}
 
-	// Check casks
-	if !options.SkipCasks {
-		for _, installed := range installedPackages["casks"] {
-			if !yamlPackages["cask"][installed] {
-				result["casks"] = append(result["casks"], installed)
-			}
+	if len(packagesToRemove["mas"]) > 0 {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Mac App Store apps (%d):", len(packagesToRemove["mas"])))
+		for _, mas := range packagesToRemove["mas"] {
+			fmt.Fprintf(utils.Output, "  - %s\n", mas)
 		}
 	}
 
-	// Check mas apps
-	if !options.SkipMas {
-		for _, installed := range installedMasApps {
-			idStr := fmt.Sprintf("%d", installed.ID)
-			if !yamlPackages["mas"][idStr] {
-				result["mas"] = append(result["mas"], fmt.Sprintf("%d (%s)", installed.ID, installed.Name))
+	for _, tool := range []struct{ pkgType, title string }{
+		{"vscode", "VS Code extensions"},
+		{"go", "Go packages"},
+		{"cargo", "Cargo packages"},
+		{"npm", "npm packages"},
+	} {
+		if len(packagesToRemove[tool.pkgType]) > 0 {
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("%s (%d):", tool.title, len(packagesToRemove[tool.pkgType])))
+			for _, name := range packagesToRemove[tool.pkgType] {
+				fmt.Fprintf(utils.Output, "  - %s\n", name)
 			}
 		}
 	}
-
-	return result
 }
 
-// showRemovalSummary displays what will be removed
-func showRemovalSummary(packagesToRemove map[string][]string) {
-	utils.PrintStatus(utils.Blue, "Packages to be removed:")
-
-	if len(packagesToRemove["taps"]) > 0 {
-		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Taps (%d):", len(packagesToRemove["taps"])))
-		for _, tap := range packagesToRemove["taps"] {
-			fmt.Printf("  - %s\n", tap)
-		}
+// showKeptDependencies displays the unconfigured formulae that are kept because other kept formulae need them
+func showKeptDependencies(required map[string][]string, verbose bool) {
+	if !verbose {
+		utils.PrintStatus(utils.Cyan, fmt.Sprintf("Keeping %d formulae required by kept packages (use --verbose to list them)", len(required)))
+		return
 	}
 
-	if len(packagesToRemove["brews"]) > 0 {
-		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Brew formulae (%d):", len(packagesToRemove["brews"])))
-		for _, brew := range packagesToRemove["brews"] {
-			fmt.Printf("  - %s\n", brew)
-		}
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	if len(packagesToRemove["casks"]) > 0 {
-		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Casks (%d):", len(packagesToRemove["casks"])))
-		for _, cask := range packagesToRemove["casks"] {
-			fmt.Printf("  - %s\n", cask)
-		}
-	}
-
-	if len(packagesToRemove["mas"]) > 0 {
-		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Mac App Store apps (%d):", len(packagesToRemove["mas"])))
-		for _, mas := range packagesToRemove["mas"] {
-			fmt.Printf("  - %s\n", mas)
-		}
+	utils.PrintStatus(utils.Cyan, fmt.Sprintf("Keeping %d formulae required by kept packages:", len(required)))
+	for _, name := range names {
+		fmt.Fprintf(utils.Output, "  - %s (required by %s)\n", name, strings.Join(required[name], ", "))
 	}
 }
 
 // confirmRemoval asks for user confirmation
 func confirmRemoval() bool {
-	fmt.Print("\nAre you sure you want to remove these packages? [y/N]: ")
+	fmt.Fprint(utils.Output, "\nAre you sure you want to remove these packages? [y/N]: ")
 	var response string
 	fmt.Scanln(&response)
 	response = strings.ToLower(strings.TrimSpace(response))
 	return response == "y" || response == "yes"
 }
-
-// removePackagesByType removes packages of a specific type
-func removePackagesByType(pkgType string, packages []string, options *types.PruneOptions) error {
-	if len(packages) == 0 {
-		return nil
-	}
-
-	utils.PrintStatus(utils.Blue, fmt.Sprintf("Removing %s packages...", pkgType))
-
-	for _, pkg := range packages {
-		if options.Verbose {
-			utils.PrintStatus(utils.Cyan, fmt.Sprintf("Processing %s: %s", pkgType, pkg))
-		}
-
-		if err := removeSinglePackage(pkgType, pkg, options.Verbose); err != nil {
-			utils.PrintStatus(utils.Red, fmt.Sprintf("Failed to remove %s: %s - %v", pkgType, pkg, err))
-			continue
-		}
-
-		utils.PrintStatus(utils.Green, fmt.Sprintf("Removed %s: %s", pkgType, pkg))
-	}
-
-	return nil
-}
-
-// removeSinglePackage removes a single package
-func removeSinglePackage(pkgType string, pkg string, verbose bool) error {
-	switch pkgType {
-	case "tap":
-		return removeTap(pkg, verbose)
-	case "brew":
-		return removeBrew(pkg, verbose)
-	case "cask":
-		return removeCask(pkg, verbose)
-	case "mas":
-		// Extract ID from "ID (Name)" format
-		parts := strings.SplitN(pkg, " ", 2)
-		if len(parts) > 0 {
-			return removeMas(parts[0], verbose)
-		}
-		return fmt.Errorf("invalid mas package format: %s", pkg)
-	default:
-		return fmt.Errorf("unknown package type: %s", pkgType)
-	}
-}
-
-// removeTap removes a tap
-func removeTap(name string, verbose bool) error {
-	return utils.RunCommandSilent("brew", "untap", name)
-}
-
-// removeBrew removes a brew formula
-func removeBrew(name string, verbose bool) error {
-	return utils.RunCommandSilent("brew", "uninstall", name)
-}
-
-// removeCask removes a cask
-func removeCask(name string, verbose bool) error {
-	return utils.RunCommandSilent("brew", "uninstall", "--cask", name)
-}
-
-// removeMas removes a Mac App Store app
-func removeMas(id string, verbose bool) error {
-	if !utils.CommandExists("mas") {
-		return fmt.Errorf("mas is not installed, cannot remove Mac App Store apps")
-	}
-	return utils.RunCommandSilent("mas", "uninstall", id)
-}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportFile   string
+	reportFormat string
+)
+
+// addReportFlags adds the --report and --report-format flags to a command
+func addReportFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&reportFile, "report", "", "Write a per-package result report to this file")
+	cmd.Flags().StringVar(&reportFormat, "report-format", "", "Report format: json or junit (default: inferred from the file extension)")
+}
+
+// finishReport prints the result summary, writes the --report file if requested, writes result
+// in the --output format and returns an error when any package failed
+func finishReport(rep *report.Report, result any) error {
+	rep.Finish()
+	rep.PrintSummary(verbose)
+	if err := printResult(result); err != nil {
+		return err
+	}
+
+	if reportFile != "" {
+		if err := rep.Write(reportFile, reportFormat); err != nil {
+			return err
+		}
+		utils.PrintStatus(utils.Green, fmt.Sprintf("Report written to %s", reportFile))
+	}
+
+	if failed := rep.Failed(); failed > 0 {
+		return fmt.Errorf("%d packages failed", failed)
+	}
+
+	return nil
+}
@@ -3,16 +3,36 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
-	"brew-manager/pkg/utils"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/diff"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/location"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/output"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	verbose bool
-	dryRun  bool
+	verbose    bool
+	dryRun     bool
+	recordFile string
+	replayDir  string
+	// metadataFile is the package metadata cache; empty for the default location
+	metadataFile string
+	// historyDir is the journal of mutating commands; empty for the default location
+	historyDir string
+	outputFlag string
+	// configFlag is the dotfiles directory or YAML configuration; empty to resolve it
+	configFlag string
+
+	// outputFormat is the --output format of command results
+	outputFormat = output.Text
+
+	// cmdRunner executes every external command issued by subcommands
+	cmdRunner runner.Runner = runner.NewExecRunner()
+	// recordOut receives the command log written by --record
+	recordOut *os.File
 )
 
 // rootCmd represents the base command
@@ -27,29 +47,79 @@ This tool provides a unified interface for all brew management operations includ
 - Converting Brewfile to YAML format
 - Validating YAML configuration files
 - Removing packages not defined in YAML configuration (prune)
+- Computing reviewable execution plans and applying them (plan/apply)
+- Upgrading configured packages only (outdated/upgrade)
+- Reviewing and reversing past changes (history/undo)
+- Showing drift between YAML configuration and installed packages (diff)
+- Diagnosing the environment and configuration (doctor)
 
 Examples:
   brew-manager install --groups core,development
   brew-manager install --profile developer
   brew-manager sync --auto-detect
   brew-manager prune --dry-run
+  brew-manager diff --profile developer
+  brew-manager doctor
+  brew-manager plan --out plan.json && brew-manager apply plan.json
   brew-manager validate`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		// Check prerequisites for most commands, skip for validate, help, and completion
-		commandName := cmd.Name()
-		if commandName != "validate" && commandName != "help" && commandName != "completion" {
-			if err := utils.CheckPrerequisites(); err != nil {
-				utils.PrintStatus(utils.Red, fmt.Sprintf("Error: %v", err))
-				os.Exit(1)
+	// Errors are printed by Execute; usage is not repeated for runtime failures
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		format, err := output.ParseFormat(outputFlag)
+		if err != nil {
+			return err
+		}
+		// Machine-readable results own stdout; status messages move to stderr
+		outputFormat = format
+		if outputFormat != output.Text {
+			utils.Output = os.Stderr
+		}
+
+		if err := setupRunner(); err != nil {
+			return err
+		}
+
+		if needsPrerequisites(cmd) {
+			if err := utils.CheckPrerequisites(cmdRunner); err != nil {
+				return err
 			}
 		}
+		return nil
 	},
 }
 
+// annotationNoPrerequisites marks commands that work without brew and the other package tools,
+// such as those that only read the YAML configuration or the history
+const annotationNoPrerequisites = "brew-manager/no-prerequisites"
+
+// needsPrerequisites reports whether cmd needs the tools checked by utils.CheckPrerequisites.
+// Commands opt out with annotationNoPrerequisites; cobra's help and completion commands, which
+// cannot be annotated, never need them.
+func needsPrerequisites(cmd *cobra.Command) bool {
+	if cmd.Annotations[annotationNoPrerequisites] == "true" {
+		return false
+	}
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		if c.Name() == "help" || c.Name() == "completion" {
+			return false
+		}
+	}
+	return true
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
+// Commands exit with status 1 on failure, except diff, which uses 1 for drift only.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	cmd, err := rootCmd.ExecuteC()
+	if recordOut != nil {
+		recordOut.Close()
+	}
+	if err != nil {
 		utils.PrintStatus(utils.Red, fmt.Sprintf("Error: %v", err))
+		if cmd == diffCmd {
+			os.Exit(diff.ExitCode(err))
+		}
 		os.Exit(1)
 	}
 }
@@ -58,26 +128,64 @@ func init() {
 	// Global flags
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 	rootCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "d", false, "Show what would be done without actually doing it")
+	rootCmd.PersistentFlags().StringVar(&recordFile, "record", "", "Record every executed command as JSON lines to this file")
+	rootCmd.PersistentFlags().StringVar(&replayDir, "replay", "", "Replay canned command output from this fixture directory instead of running commands")
+	rootCmd.PersistentFlags().StringVar(&metadataFile, "metadata-cache", "", "Package metadata cache file (default: brew-manager/metadata.json in the user cache directory)")
+	rootCmd.PersistentFlags().StringVar(&historyDir, "history-dir", "", "History directory of install, sync, prune, apply and lint --fix runs (default: brew-manager/history in the user config directory)")
+	rootCmd.PersistentFlags().StringVarP(&outputFlag, "output", "o", "text", "Output format of command results: text, json or yaml")
+	rootCmd.PersistentFlags().StringVar(&configFlag, "config", "", "Dotfiles directory or YAML configuration used when no yaml_file is given (default: see 'brew-manager config path')")
+}
+
+// printResult writes the result of a command to stdout in the --output format. In text mode
+// nothing is written, as commands print their results as they go.
+func printResult(result any) error {
+	if outputFormat == output.Text {
+		return nil
+	}
+	return output.Write(os.Stdout, outputFormat, result)
 }
 
-// getDefaultYAMLPath returns the default path for YAML configuration files
-func getDefaultYAMLPath(filename string) string {
-	// デフォルトのYAMLパス
-	defaultPath := filepath.Join(os.Getenv("HOME"), "projects/github.com/shiron-dev/dotfiles/data/brew/packages.yaml")
-	if filename == "" || filename == "packages-grouped.yml" || filename == "packages.yml" || filename == "packages.yaml" {
-		return defaultPath
+// setupRunner selects the command runner according to --replay and --record
+func setupRunner() error {
+	if replayDir != "" {
+		fake, err := runner.LoadFixtures(replayDir)
+		if err != nil {
+			return fmt.Errorf("failed to load replay fixtures: %w", err)
+		}
+		cmdRunner = fake
+	}
+
+	if recordFile != "" {
+		file, err := os.Create(recordFile)
+		if err != nil {
+			return fmt.Errorf("failed to create record file: %w", err)
+		}
+		recordOut = file
+		cmdRunner = runner.NewRecordingRunner(cmdRunner, file)
 	}
 
-	// Get current working directory
-	cwd, err := os.Getwd()
+	return nil
+}
+
+// resolveConfig resolves the dotfiles directory and YAML configuration from --config,
+// the environment, the shared config file or the working directory
+func resolveConfig() (*location.Location, error) {
+	return location.Resolve(location.Options{Flag: configFlag, FlagName: "--config"})
+}
+
+// getDefaultYAMLPath returns the resolved YAML configuration
+func getDefaultYAMLPath() (string, error) {
+	loc, err := resolveConfig()
 	if err != nil {
-		return filepath.Join(".", "data", "brew", filename)
+		return "", err
 	}
-	// Look for data directory relative to current location
-	dataPath := filepath.Join(cwd, "../../data/brew", filename)
-	if utils.FileExists(dataPath) {
-		return dataPath
+	return loc.File, nil
+}
+
+// yamlFileArg returns the YAML configuration given as the first argument, or the resolved one
+func yamlFileArg(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
 	}
-	// Fall back to relative path
-	return filepath.Join("data", "brew", filename)
+	return getDefaultYAMLPath()
 }
@@ -1,11 +1,15 @@
 package cmd
 
 import (
-	"brew-manager/pkg/sync"
-	"brew-manager/pkg/types"
-	"brew-manager/pkg/utils"
 	"fmt"
 
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/classify"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/journal"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/sync"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +18,8 @@ var (
 	sortPackages bool
 	showOnly     bool
 	interactive  bool
+	autoDetect   bool
+	rulesFile    string
 )
 
 // syncCmd represents the sync command
@@ -29,11 +35,11 @@ Examples:
   brew-manager sync --backup --default-group system    # Add missing packages to 'system' group
   brew-manager sync --interactive                      # Prompt for group/tag for each package
   brew-manager sync --auto-detect --sort               # Auto-detect groups/tags and sort`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get YAML file path
-		yamlFile := getDefaultYAMLPath("packages.yaml")
-		if len(args) > 0 {
-			yamlFile = args[0]
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
 		}
 
 		// Build sync options
@@ -46,14 +52,40 @@ Examples:
 			DefaultGroup: "",
 			DefaultTags:  nil,
 			Interactive:  interactive,
-			AutoDetect:   false,
+			AutoDetect:   autoDetect,
+			RulesFile:    rulesFile,
+		}
+		if options.RulesFile == "" {
+			options.RulesFile = classify.DefaultPath(yamlFile)
 		}
 
-		// Perform sync
-		if err := sync.SyncGroupedPackages(yamlFile, options); err != nil {
-			utils.PrintStatus(utils.Red, fmt.Sprintf("Sync failed: %v", err))
-			return
+		// Get currently installed packages
+		installed, err := state.Load(cmdRunner)
+		if err != nil {
+			return fmt.Errorf("sync failed: %w", err)
 		}
+
+		// Formulae that other formulae depend on are not proposed as new packages
+		graph, err := deps.Load(cmdRunner)
+		if err != nil {
+			return fmt.Errorf("sync failed: %w", err)
+		}
+
+		// Perform sync, taking descriptions of new packages from the metadata cache
+		entry, snapshot := newHistoryEntry(yamlFile)
+		result, err := sync.SyncGroupedPackages(installed, graph, loadMetadata(), yamlFile, options)
+		if err != nil {
+			return fmt.Errorf("sync failed: %w", err)
+		}
+
+		if result.Added {
+			entry.ConfigChanged = true
+			for _, pkg := range result.Packages {
+				entry.Added = append(entry.Added, journal.Package{Type: pkg.Type, Name: pkg.Name, ID: pkg.ID})
+			}
+			recordHistory(entry, snapshot)
+		}
+		return printResult(result)
 	},
 }
 
@@ -65,4 +97,6 @@ func init() {
 	syncCmd.Flags().BoolVarP(&sortPackages, "sort", "s", false, "Sort packages alphabetically within categories")
 	syncCmd.Flags().BoolVar(&showOnly, "show-only", false, "Only show missing packages without modifying the file")
 	syncCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Prompt for group/tag assignment for each new package")
-} 
+	syncCmd.Flags().BoolVar(&autoDetect, "auto-detect", false, "Assign groups and tags with the classification rules")
+	syncCmd.Flags().StringVar(&rulesFile, "rules", "", "Classification rules file (default: classify.yaml next to the YAML file, or built-in rules)")
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/journal"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/upgrade"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	groupsInUpgrade    string
+	tagsInUpgrade      string
+	profileInUpgrade   string
+	greedyInUpgrade    bool
+	skipBrewsInUpgrade bool
+	skipCasksInUpgrade bool
+	skipMasInUpgrade   bool
+)
+
+// outdatedCmd represents the outdated command
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated [yaml_file]",
+	Short: "List configured packages with newer versions available",
+	Long: `List the formulae, casks and Mac App Store apps in the YAML configuration that have a newer
+version available, selected by the same groups, tags and profile options as install.
+
+Examples:
+  brew-manager outdated                     # Check every configured package
+  brew-manager outdated --profile work      # Check the packages of the work profile
+  brew-manager outdated --greedy            # Include casks that update themselves`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
+		}
+
+		outdated, err := findOutdated(yamlFile, upgradeOptions())
+		if err != nil {
+			return err
+		}
+		if err := printResult(outdated); err != nil {
+			return err
+		}
+
+		if len(outdated) == 0 {
+			utils.PrintStatus(utils.Green, "All configured packages are up to date")
+			return nil
+		}
+
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("%d configured packages are outdated:", len(outdated)))
+		w := tabwriter.NewWriter(utils.Output, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  TYPE\tNAME\tINSTALLED\tLATEST")
+		for _, pkg := range outdated {
+			latest := pkg.Latest
+			if pkg.Pinned {
+				latest += " (pinned)"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", pkg.Type, pkg.Name, pkg.Installed, latest)
+		}
+		return w.Flush()
+	},
+}
+
+// upgradeCmd represents the upgrade command
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [yaml_file]",
+	Short: "Upgrade configured packages with newer versions available",
+	Long: `Upgrade the outdated formulae, casks and Mac App Store apps in the YAML configuration,
+selected by the same groups, tags and profile options as install. Packages marked pinned: true
+in the YAML, or pinned with brew pin, are skipped.
+
+Every package is upgraded on its own, so one failure does not stop the others; failures are
+listed in the summary and make the command exit with status 1. Upgrades are recorded in the
+history with the versions before and after, but undo cannot downgrade them.
+
+Examples:
+  brew-manager upgrade                      # Upgrade every configured package
+  brew-manager upgrade --groups core        # Upgrade the core group only
+  brew-manager upgrade --greedy --skip-mas  # Include self-updating casks, leave mas apps alone
+  brew-manager upgrade --dry-run            # Show what would be upgraded`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		yamlFile, err := yamlFileArg(args)
+		if err != nil {
+			return err
+		}
+
+		options := upgradeOptions()
+		outdated, err := findOutdated(yamlFile, options)
+		if err != nil {
+			return err
+		}
+
+		if len(outdated) == 0 {
+			utils.PrintStatus(utils.Green, "All configured packages are up to date")
+		} else {
+			utils.PrintStatus(utils.Blue, fmt.Sprintf("Found %d outdated packages", len(outdated)))
+		}
+
+		entry, _ := newHistoryEntry(yamlFile)
+		rep := report.New("upgrade")
+		upgrade.UpgradePackages(cmdRunner, rep, outdated, options)
+
+		if !options.DryRun {
+			journal.FromUpgrade(entry, rep, outdated)
+			recordHistory(entry, nil)
+		}
+
+		if err := finishReport(rep, rep); err != nil {
+			return fmt.Errorf("upgrade failed: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(outdatedCmd)
+	rootCmd.AddCommand(upgradeCmd)
+
+	addUpgradeFlags(outdatedCmd)
+	addUpgradeFlags(upgradeCmd)
+	addReportFlags(upgradeCmd)
+}
+
+// addUpgradeFlags adds the package selection flags shared by outdated and upgrade
+func addUpgradeFlags(cmd *cobra.Command) {
+	// Package filters, same as install
+	cmd.Flags().StringVarP(&groupsInUpgrade, "groups", "g", "", "Only packages of specified groups (comma-separated)")
+	cmd.Flags().StringVarP(&tagsInUpgrade, "tags", "t", "", "Only packages with specified tags (comma-separated)")
+	cmd.Flags().StringVarP(&profileInUpgrade, "profile", "p", "", "Only the packages of this profile")
+	cmd.Flags().BoolVar(&greedyInUpgrade, "greedy", false, "Include casks that update themselves or have no version")
+	cmd.Flags().BoolVar(&skipBrewsInUpgrade, "skip-brews", false, "Skip brew formulae")
+	cmd.Flags().BoolVar(&skipCasksInUpgrade, "skip-casks", false, "Skip casks")
+	cmd.Flags().BoolVar(&skipMasInUpgrade, "skip-mas", false, "Skip Mac App Store apps")
+}
+
+// upgradeOptions builds the options of outdated and upgrade from their flags
+func upgradeOptions() *types.UpgradeOptions {
+	return &types.UpgradeOptions{
+		DryRun:    dryRun,
+		Verbose:   verbose,
+		Groups:    utils.SplitCommaSeparated(groupsInUpgrade),
+		Tags:      utils.SplitCommaSeparated(tagsInUpgrade),
+		Profile:   profileInUpgrade,
+		Greedy:    greedyInUpgrade,
+		SkipBrews: skipBrewsInUpgrade,
+		SkipCasks: skipCasksInUpgrade,
+		SkipMas:   skipMasInUpgrade,
+	}
+}
+
+// findOutdated returns the configured packages selected by options that have a newer version
+func findOutdated(yamlFile string, options *types.UpgradeOptions) ([]upgrade.Package, error) {
+	config, err := yamlPkg.LoadMergedConfig(yamlFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %w", err)
+	}
+
+	filteredPackages, err := yamlPkg.GetFilteredPackages(config, &types.InstallOptions{
+		Groups:  options.Groups,
+		Tags:    options.Tags,
+		Profile: options.Profile,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return upgrade.FindOutdated(cmdRunner, filteredPackages, options)
+}
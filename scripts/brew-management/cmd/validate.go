@@ -1,19 +1,25 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 
-	"brew-manager/pkg/types"
-	"brew-manager/pkg/utils"
-	"brew-manager/pkg/validate"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brewfile"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/convert"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/validate"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	all        bool
-	schemaFile string
+	all              bool
+	schemaFile       string
+	explain          bool
+	validateHostname string
+	validateArch     string
 )
 
 // validateCmd represents the validate command
@@ -26,47 +32,88 @@ Examples:
   brew-manager validate                                          # Validate all YAML files
   brew-manager validate packages.yml                             # Validate specific file
   brew-manager validate --schema packages-grouped.schema.json packages-grouped.yml
-  brew-manager validate --all --verbose                          # Validate all with verbose output`,
-	Run: func(cmd *cobra.Command, args []string) {
+  brew-manager validate --all --verbose                          # Validate all with verbose output
+  brew-manager validate --explain                                # Show which file each package came from
+  brew-manager validate --hostname work-mbp --arch amd64         # Validate the merged result for another machine
+  brew-manager validate Brewfile                                 # Check Brewfile syntax`,
+	Annotations: map[string]string{annotationNoPrerequisites: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Build validate options
 		options := &types.ValidateOptions{
 			Verbose:    verbose,
 			All:        all,
 			SchemaFile: schemaFile,
+			Explain:    explain,
+			Hostname:   validateHostname,
+			Arch:       validateArch,
 		}
 
+		var results []*validate.FileResult
+		var yamlFile string
+		var err error
 		if all {
 			// Validate all YAML files in data directory
-			dataDir := filepath.Dir(getDefaultYAMLPath("packages.yaml"))
-			
-			if err := validate.ValidateAllYAMLFiles(dataDir, options); err != nil {
-				utils.PrintStatus(utils.Red, fmt.Sprintf("Validation failed: %v", err))
-				return
+			if yamlFile, err = getDefaultYAMLPath(); err != nil {
+				return err
 			}
+			results, err = validate.ValidateAllYAMLFiles(filepath.Dir(yamlFile), options)
 		} else {
-			// Validate specific file
-			var yamlFile string
-			if len(args) > 0 {
-				yamlFile = args[0]
+			// Validate specific file, by default the grouped config file
+			if yamlFile, err = yamlFileArg(args); err != nil {
+				return err
+			}
+
+			var result *validate.FileResult
+			if convert.IsBrewfile(yamlFile) {
+				// Brewfiles are checked for syntax instead
+				result, err = validateBrewfile(yamlFile)
 			} else {
-				// Default to grouped config file
-				yamlFile = getDefaultYAMLPath("packages.yaml")
+				result, err = validate.ValidateYAMLFile(yamlFile, options)
+			}
+			if result != nil {
+				results = append(results, result)
 			}
+		}
 
-			if err := validate.ValidateYAMLFile(yamlFile, options); err != nil {
-				utils.PrintStatus(utils.Red, fmt.Sprintf("Validation failed: %v", err))
-				return
+		if results != nil {
+			if err := printResult(results); err != nil {
+				return err
 			}
 		}
+		if err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
 
 		utils.PrintStatus(utils.Green, "Validation completed successfully!")
+		return nil
 	},
 }
 
+// validateBrewfile checks the syntax of a Brewfile, returning the result also when it is invalid
+func validateBrewfile(filePath string) (*validate.FileResult, error) {
+	err := convert.ValidateBrewfile(filePath, verbose)
+	if err == nil {
+		return &validate.FileResult{File: filePath, Valid: true}, nil
+	}
+
+	var syntaxErr *brewfile.Error
+	if !errors.As(err, &syntaxErr) {
+		return nil, err
+	}
+	return &validate.FileResult{File: filePath, Errors: []validate.Error{{
+		Line:    syntaxErr.Pos.Line,
+		Column:  syntaxErr.Pos.Column,
+		Message: syntaxErr.Msg,
+	}}}, err
+}
+
 func init() {
 	rootCmd.AddCommand(validateCmd)
 
 	// Validate options
 	validateCmd.Flags().BoolVarP(&all, "all", "a", false, "Validate all YAML files")
-	validateCmd.Flags().StringVar(&schemaFile, "schema", "", "Use specific schema file")
-} 
+	validateCmd.Flags().StringVar(&schemaFile, "schema", "", "Validate against this JSON Schema file instead of the built-in packages.schema.json")
+	validateCmd.Flags().BoolVar(&explain, "explain", false, "Show which file each package came from after merging includes and overlays")
+	validateCmd.Flags().StringVar(&validateHostname, "hostname", "", "Apply the overlays of this hostname instead of the local one")
+	validateCmd.Flags().StringVar(&validateArch, "arch", "", "Apply the overlays of this architecture (arm64 or amd64) instead of the local one")
+}
@@ -1,6 +1,6 @@
 package main
 
-import "brew-manager/cmd"
+import "github.com/shiron-dev/dotfiles/scripts/brew-management/cmd"
 
 func main() {
 	cmd.Execute()
@@ -2,49 +2,131 @@ package brew
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"brew-manager/pkg/types"
-	"brew-manager/pkg/utils"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/hooks"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
 )
 
-// InstallPackages installs packages based on configuration and options
-func InstallPackages(filteredPackages []types.FilteredPackage, options *types.InstallOptions) error {
-	if err := utils.CheckPrerequisites(); err != nil {
+// InstallOrder is the order in which package types are installed: taps, brews, casks, mas, then
+// VS Code extensions and Go, Cargo and npm packages, whose tools usually come from brew
+var InstallOrder = types.PackageTypes
+
+// packageGroup holds the filtered packages of one group, keyed by package type
+type packageGroup struct {
+	name     string
+	priority int
+	packages map[string][]types.FilteredPackage
+}
+
+// InstallPackages installs packages based on configuration and options.
+// The installed snapshot is consulted instead of querying brew per package and is updated as packages are installed.
+//
+// Taps from every group are installed first so that formulae in any group can use them.
+// The other package types are then installed group by group in priority order.
+// The outcome for every package is recorded in rep.
+func InstallPackages(r runner.Runner, installed *state.Snapshot, rep *report.Report, filteredPackages []types.FilteredPackage, options *types.InstallOptions) error {
+	if err := utils.CheckPrerequisites(r); err != nil {
 		return err
 	}
 
-	// Group packages by type
-	packagesByType := make(map[string][]types.PackageInfo)
-	for _, filteredPkg := range filteredPackages {
-		packagesByType[filteredPkg.Type] = append(packagesByType[filteredPkg.Type], filteredPkg.PackageInfo)
+	groups := groupByPriority(filteredPackages)
+
+	var taps []types.FilteredPackage
+	for _, group := range groups {
+		taps = append(taps, group.packages["tap"]...)
 	}
+	if len(taps) > 0 {
+		if ShouldSkipType("tap", options) {
+			utils.PrintStatus(utils.Yellow, "Skipping tap packages as requested")
+			recordSkipped(rep, taps, "skipped by "+SkipFlag("tap"))
+		} else if err := installPackagesByType(r, installed, rep, "tap", taps, options); err != nil {
+			return fmt.Errorf("failed to install tap packages: %w", err)
+		}
+	}
+
+	for _, group := range groups {
+		if options.Verbose {
+			utils.PrintStatus(utils.Blue, fmt.Sprintf("Installing group %s (priority %d)", group.name, group.priority))
+		}
 
-	// Install in order: taps, brews, casks, mas
-	order := []string{"tap", "brew", "cask", "mas"}
+		for _, pkgType := range InstallOrder[1:] {
+			pkgInfos := group.packages[pkgType]
+			if len(pkgInfos) == 0 {
+				continue
+			}
 
-	for _, pkgType := range order {
-		pkgInfos := packagesByType[pkgType]
-		if len(pkgInfos) == 0 {
-			continue
+			if ShouldSkipType(pkgType, options) {
+				utils.PrintStatus(utils.Yellow, fmt.Sprintf("Skipping %s packages as requested", pkgType))
+				recordSkipped(rep, pkgInfos, "skipped by "+SkipFlag(pkgType))
+				continue
+			}
+
+			if err := installPackagesByType(r, installed, rep, pkgType, pkgInfos, options); err != nil {
+				return fmt.Errorf("failed to install %s packages: %w", pkgType, err)
+			}
 		}
+	}
 
-		if shouldSkipType(pkgType, options) {
-			utils.PrintStatus(utils.Yellow, fmt.Sprintf("Skipping %s packages as requested", pkgType))
-			continue
+	return nil
+}
+
+// OrderForInstall returns filtered packages in the order InstallPackages installs them: the taps of
+// every group first, then the other packages group by group in priority order, by InstallOrder
+// within each group
+func OrderForInstall(filteredPackages []types.FilteredPackage) []types.FilteredPackage {
+	groups := groupByPriority(filteredPackages)
+	ordered := make([]types.FilteredPackage, 0, len(filteredPackages))
+	for _, group := range groups {
+		ordered = append(ordered, group.packages["tap"]...)
+	}
+	for _, group := range groups {
+		for _, pkgType := range InstallOrder[1:] {
+			ordered = append(ordered, group.packages[pkgType]...)
 		}
+	}
+	return ordered
+}
 
-		if err := installPackagesByType(pkgType, pkgInfos, options); err != nil {
-			return fmt.Errorf("failed to install %s packages: %w", pkgType, err)
+// groupByPriority splits filtered packages into groups ordered by priority, then by name
+func groupByPriority(filteredPackages []types.FilteredPackage) []*packageGroup {
+	byName := make(map[string]*packageGroup)
+	var groups []*packageGroup
+
+	for _, pkg := range filteredPackages {
+		group, ok := byName[pkg.Group]
+		if !ok {
+			group = &packageGroup{
+				name:     pkg.Group,
+				priority: pkg.Priority,
+				packages: make(map[string][]types.FilteredPackage),
+			}
+			byName[pkg.Group] = group
+			groups = append(groups, group)
 		}
+		group.packages[pkg.Type] = append(group.packages[pkg.Type], pkg)
 	}
 
-	return nil
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].priority != groups[j].priority {
+			return groups[i].priority < groups[j].priority
+		}
+		return groups[i].name < groups[j].name
+	})
+
+	return groups
 }
 
-// shouldSkipType checks if a package type should be skipped
-func shouldSkipType(pkgType string, options *types.InstallOptions) bool {
+// ShouldSkipType checks if a package type should be skipped
+func ShouldSkipType(pkgType string, options *types.InstallOptions) bool {
 	switch pkgType {
 	case "tap":
 		return options.SkipTaps
@@ -54,181 +136,330 @@ func shouldSkipType(pkgType string, options *types.InstallOptions) bool {
 		return options.SkipCasks
 	case "mas":
 		return options.SkipMas
+	case "vscode":
+		return options.SkipVSCode
+	case "go":
+		return options.SkipGo
+	case "cargo":
+		return options.SkipCargo
+	case "npm":
+		return options.SkipNpm
 	}
 	return false
 }
 
-// installPackagesByType installs packages of a specific type
-func installPackagesByType(pkgType string, pkgInfos []types.PackageInfo, options *types.InstallOptions) error {
+// SkipFlag returns the command-line flag that skips a package type
+func SkipFlag(pkgType string) string {
+	switch pkgType {
+	case "tap", "brew", "cask":
+		return "--skip-" + pkgType + "s"
+	default:
+		return "--skip-" + pkgType
+	}
+}
+
+// installPackagesByType installs packages of a specific type.
+// Formulae and casks are batched when requested; taps and mas apps are installed by a bounded worker pool
+// and the other types one at a time.
+func installPackagesByType(r runner.Runner, installed *state.Snapshot, rep *report.Report, pkgType string, pkgInfos []types.FilteredPackage, options *types.InstallOptions) error {
 	utils.PrintStatus(utils.Blue, fmt.Sprintf("Installing %s packages...", pkgType))
 
+	pending := pendingPackages(r, installed, rep, pkgType, pkgInfos, options)
+	if len(pending) == 0 || options.DryRun {
+		return nil
+	}
+
+	switch pkgType {
+	case "brew", "cask":
+		if options.Batch {
+			installBatched(r, installed, rep, pkgType, pending, options)
+			return nil
+		}
+		// brew holds a global lock, so formulae and casks are installed one at a time
+		installConcurrently(r, installed, rep, pkgType, pending, 1, options.Verbose)
+	case "tap", "mas":
+		installConcurrently(r, installed, rep, pkgType, pending, options.Jobs, options.Verbose)
+	default:
+		// code, go, cargo and npm each update shared state, so their packages are installed one at a time
+		installConcurrently(r, installed, rep, pkgType, pending, 1, options.Verbose)
+	}
+
+	return nil
+}
+
+// pendingPackages returns the packages that still need to be installed
+func pendingPackages(r runner.Runner, installed *state.Snapshot, rep *report.Report, pkgType string, pkgInfos []types.FilteredPackage, options *types.InstallOptions) []types.FilteredPackage {
+	var pending []types.FilteredPackage
+
 	for _, pkgInfo := range pkgInfos {
 		if options.Verbose {
 			utils.PrintStatus(utils.Cyan, fmt.Sprintf("Processing %s: %s", pkgType, pkgInfo.Name))
 		}
 
-		alreadyInstalled := false
-		switch pkgType {
-		case "tap":
-			if output, err := utils.RunCommand("brew", "tap"); err == nil {
-				installedTaps := strings.Fields(output)
-				for _, installed := range installedTaps {
-					if installed == pkgInfo.Name {
-						alreadyInstalled = true
-						break
-					}
-				}
-			}
-		case "brew":
-			if output, err := utils.RunCommand("brew", "list", "--formula"); err == nil {
-				installedBrews := strings.Fields(output)
-				for _, installed := range installedBrews {
-					if installed == pkgInfo.Name || strings.HasPrefix(pkgInfo.Name, installed+"/") {
-						alreadyInstalled = true
-						break
-					}
-				}
-			}
-		case "cask":
-			if output, err := utils.RunCommand("brew", "list", "--cask"); err == nil {
-				installedCasks := strings.Fields(output)
-				for _, installed := range installedCasks {
-					if installed == pkgInfo.Name {
-						alreadyInstalled = true
-						break
-					}
-				}
-			}
-		case "mas":
-			if output, err := utils.RunCommand("mas", "list"); err == nil {
-				lines := strings.Split(strings.TrimSpace(output), "\n")
-				for _, line := range lines {
-					if strings.HasPrefix(line, strconv.FormatInt(pkgInfo.ID, 10)) {
-						alreadyInstalled = true
-						break
-					}
-				}
+		if installed.IsInstalled(pkgType, pkgInfo.PackageInfo) {
+			if options.Verbose && !options.DryRun {
+				utils.PrintStatus(utils.Yellow, fmt.Sprintf("%s already installed: %s", utils.Capitalize(pkgType), pkgInfo.Name))
 			}
+			rep.Add(newResult(pkgInfo, report.StatusAlreadyPresent))
+			continue
 		}
 
 		if options.DryRun {
-			if !alreadyInstalled {
-				utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would install %s: %s", pkgType, pkgInfo.Name))
-			}
+			hooks.Run(r, hooks.PreInstall, pkgInfo, true, options.Verbose)
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would install %s: %s", pkgType, pkgInfo.Name))
+			hooks.Run(r, hooks.PostInstall, pkgInfo, true, options.Verbose)
+			result := newResult(pkgInfo, report.StatusSkipped)
+			result.Message = "dry run"
+			rep.Add(result)
 			continue
 		}
 
-		if alreadyInstalled {
-			if options.Verbose {
-				utils.PrintStatus(utils.Yellow, fmt.Sprintf("%s already installed: %s", strings.Title(pkgType), pkgInfo.Name))
+		pending = append(pending, pkgInfo)
+	}
+
+	return pending
+}
+
+// installConcurrently installs packages one per command using at most jobs workers
+func installConcurrently(r runner.Runner, installed *state.Snapshot, rep *report.Report, pkgType string, pkgInfos []types.FilteredPackage, jobs int, verbose bool) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+
+	for _, pkgInfo := range pkgInfos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(pkgInfo types.FilteredPackage) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			start := time.Now()
+			if err := hooks.Run(r, hooks.PreInstall, pkgInfo, false, verbose); err != nil {
+				utils.PrintStatus(utils.Red, fmt.Sprintf("Not installing %s: %s - %v", pkgType, pkgInfo.Name, err))
+				rep.Add(failedResult(pkgInfo, err, time.Since(start)))
+				return
 			}
+			if err := InstallSinglePackage(r, pkgType, pkgInfo.PackageInfo, verbose); err != nil {
+				utils.PrintStatus(utils.Red, fmt.Sprintf("Failed to install %s: %s - %v", pkgType, pkgInfo.Name, err))
+				rep.Add(failedResult(pkgInfo, err, time.Since(start)))
+				return
+			}
+
+			installed.MarkInstalled(pkgType, pkgInfo.PackageInfo)
+			rep.Add(installedResult(r, pkgInfo, time.Since(start), verbose))
+		}(pkgInfo)
+	}
+
+	wg.Wait()
+}
+
+// installBatched installs formulae or casks with one brew invocation per batch.
+// When a batch fails, the installed state is queried again to find out which packages made it.
+// Pre-install hooks run before the batch, and packages whose hook failed are left out of it.
+func installBatched(r runner.Runner, installed *state.Snapshot, rep *report.Report, pkgType string, pkgInfos []types.FilteredPackage, options *types.InstallOptions) {
+	var ready []types.FilteredPackage
+	for _, pkgInfo := range pkgInfos {
+		start := time.Now()
+		if err := hooks.Run(r, hooks.PreInstall, pkgInfo, false, options.Verbose); err != nil {
+			utils.PrintStatus(utils.Red, fmt.Sprintf("Not installing %s: %s - %v", pkgType, pkgInfo.Name, err))
+			rep.Add(failedResult(pkgInfo, err, time.Since(start)))
 			continue
 		}
+		ready = append(ready, pkgInfo)
+	}
+	if len(ready) == 0 {
+		return
+	}
+
+	for _, batch := range splitBatches(ready, options.BatchSize) {
+		args := []string{"install"}
+		if pkgType == "cask" {
+			args = append(args, "--cask")
+		}
+		for _, pkgInfo := range batch {
+			args = append(args, pkgInfo.Name)
+		}
 
-		if err := installSinglePackage(pkgType, pkgInfo, options.Verbose); err != nil {
-			utils.PrintStatus(utils.Red, fmt.Sprintf("Failed to install %s: %s - %v", pkgType, pkgInfo.Name, err))
-			// Decide if we should continue or stop on error. For now, continue.
-			continue
+		if options.Verbose {
+			utils.PrintStatus(utils.Cyan, fmt.Sprintf("Running: brew %s", strings.Join(args, " ")))
+		}
+
+		start := time.Now()
+		batchErr := runner.Run(r, "brew", args...)
+		elapsed := time.Since(start)
+		if batchErr != nil {
+			if err := installed.Reload(r); err != nil {
+				utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: failed to refresh installed packages: %v", err))
+			}
 		}
 
-		utils.PrintStatus(utils.Green, fmt.Sprintf("Installed %s: %s", pkgType, pkgInfo.Name))
+		for _, pkgInfo := range batch {
+			if batchErr != nil && !installed.IsInstalled(pkgType, pkgInfo.PackageInfo) {
+				utils.PrintStatus(utils.Red, fmt.Sprintf("Failed to install %s: %s - %v", pkgType, pkgInfo.Name, batchErr))
+				rep.Add(failedResult(pkgInfo, batchErr, elapsed))
+				continue
+			}
+
+			installed.MarkInstalled(pkgType, pkgInfo.PackageInfo)
+			rep.Add(installedResult(r, pkgInfo, elapsed, options.Verbose))
+		}
 	}
+}
 
-	return nil
+// installedResult runs the post-install hook of a package that was installed and creates its
+// report entry. A failed hook makes the result failed, although the package stays installed.
+func installedResult(r runner.Runner, pkg types.FilteredPackage, duration time.Duration, verbose bool) report.Result {
+	utils.PrintStatus(utils.Green, fmt.Sprintf("Installed %s: %s", pkg.Type, pkg.Name))
+
+	start := time.Now()
+	if err := hooks.Run(r, hooks.PostInstall, pkg, false, verbose); err != nil {
+		utils.PrintStatus(utils.Red, fmt.Sprintf("Installed %s: %s but %v", pkg.Type, pkg.Name, err))
+		return failedResult(pkg, err, duration+time.Since(start))
+	}
+
+	result := newResult(pkg, report.StatusInstalled)
+	result.Duration = duration + time.Since(start)
+	return result
+}
+
+// splitBatches splits packages into batches of at most size packages (0 for a single batch)
+func splitBatches(pkgInfos []types.FilteredPackage, size int) [][]types.FilteredPackage {
+	if size <= 0 || size >= len(pkgInfos) {
+		return [][]types.FilteredPackage{pkgInfos}
+	}
+
+	var batches [][]types.FilteredPackage
+	for start := 0; start < len(pkgInfos); start += size {
+		end := start + size
+		if end > len(pkgInfos) {
+			end = len(pkgInfos)
+		}
+		batches = append(batches, pkgInfos[start:end])
+	}
+	return batches
+}
+
+// newResult creates a report entry for a package
+func newResult(pkg types.FilteredPackage, status report.Status) report.Result {
+	return report.Result{
+		Type:   pkg.Type,
+		Name:   pkg.Name,
+		ID:     pkg.ID,
+		Group:  pkg.Group,
+		Status: status,
+	}
+}
+
+// failedResult creates a report entry for a package that failed to install
+func failedResult(pkg types.FilteredPackage, err error, duration time.Duration) report.Result {
+	result := newResult(pkg, report.StatusFailed)
+	result.Error = err.Error()
+	result.Output = runner.ErrorOutput(err)
+	result.Duration = duration
+	return result
 }
 
-// installSinglePackage installs a single package
-func installSinglePackage(pkgType string, pkgInfo types.PackageInfo, verbose bool) error {
+// recordSkipped records packages that were not processed
+func recordSkipped(rep *report.Report, pkgs []types.FilteredPackage, message string) {
+	for _, pkg := range pkgs {
+		result := newResult(pkg, report.StatusSkipped)
+		result.Message = message
+		rep.Add(result)
+	}
+}
+
+// InstallSinglePackage installs a single package without checking whether it is already installed
+func InstallSinglePackage(r runner.Runner, pkgType string, pkgInfo types.PackageInfo, verbose bool) error {
 	switch pkgType {
 	case "tap":
-		return installTap(pkgInfo.Name, verbose)
+		return installTap(r, pkgInfo.Name)
 	case "brew":
-		return installBrew(pkgInfo.Name, verbose)
+		return installBrew(r, pkgInfo.Name)
 	case "cask":
-		return installCask(pkgInfo.Name, verbose)
+		return installCask(r, pkgInfo.Name)
 	case "mas":
 		// 'mas' type requires ID. Ensure it's present.
 		if pkgInfo.ID == 0 {
 			return fmt.Errorf("missing ID for mas package: %s", pkgInfo.Name)
 		}
-		return installMas(pkgInfo.Name, pkgInfo.ID, verbose)
+		return installMas(r, pkgInfo.ID)
+	case "vscode":
+		return installVSCode(r, pkgInfo.Name)
+	case "go":
+		return installGo(r, pkgInfo.Name, pkgInfo.Version)
+	case "cargo":
+		return installCargo(r, pkgInfo.Name, pkgInfo.Version)
+	case "npm":
+		return installNpm(r, pkgInfo.Name, pkgInfo.Version)
 	default:
 		return fmt.Errorf("unknown package type: %s", pkgType)
 	}
 }
 
 // installTap installs a tap
-func installTap(name string, verbose bool) error {
-	// Check if already installed
-	if output, err := utils.RunCommand("brew", "tap"); err == nil {
-		installedTaps := strings.Fields(output)
-		for _, installed := range installedTaps {
-			if installed == name {
-				if verbose {
-					utils.PrintStatus(utils.Yellow, fmt.Sprintf("Tap already installed: %s", name))
-				}
-				return nil
-			}
-		}
-	}
-
-	return utils.RunCommandSilent("brew", "tap", name)
+func installTap(r runner.Runner, name string) error {
+	return runner.Run(r, "brew", "tap", name)
 }
 
 // installBrew installs a brew formula
-func installBrew(name string, verbose bool) error {
-	// Check if already installed
-	if output, err := utils.RunCommand("brew", "list", "--formula"); err == nil {
-		installedBrews := strings.Fields(output)
-		for _, installed := range installedBrews {
-			if installed == name || strings.HasPrefix(name, installed+"/") {
-				if verbose {
-					utils.PrintStatus(utils.Yellow, fmt.Sprintf("Formula already installed: %s", name))
-				}
-				return nil
-			}
-		}
-	}
-
-	return utils.RunCommandSilent("brew", "install", name)
+func installBrew(r runner.Runner, name string) error {
+	return runner.Run(r, "brew", "install", name)
 }
 
 // installCask installs a cask
-func installCask(name string, verbose bool) error {
-	// Check if already installed
-	if output, err := utils.RunCommand("brew", "list", "--cask"); err == nil {
-		installedCasks := strings.Fields(output)
-		for _, installed := range installedCasks {
-			if installed == name {
-				if verbose {
-					utils.PrintStatus(utils.Yellow, fmt.Sprintf("Cask already installed: %s", name))
-				}
-				return nil
-			}
-		}
-	}
-
-	return utils.RunCommandSilent("brew", "install", "--cask", name)
+func installCask(r runner.Runner, name string) error {
+	return runner.Run(r, "brew", "install", "--cask", name)
 }
 
 // installMas installs a Mac App Store app
-func installMas(name string, id int64, verbose bool) error {
-	if !utils.CommandExists("mas") {
+func installMas(r runner.Runner, id int64) error {
+	if !r.CommandExists("mas") {
 		return fmt.Errorf("mas is not installed, cannot install Mac App Store apps")
 	}
 
-	// Check if already installed
-	if output, err := utils.RunCommand("mas", "list"); err == nil {
-		lines := strings.Split(strings.TrimSpace(output), "\n")
-		for _, line := range lines {
-			if strings.HasPrefix(line, strconv.FormatInt(id, 10)) {
-				if verbose {
-					utils.PrintStatus(utils.Yellow, fmt.Sprintf("App already installed: %s", name))
-				}
-				return nil
-			}
-		}
+	return runner.Run(r, "mas", "install", strconv.FormatInt(id, 10))
+}
+
+// installVSCode installs a VS Code extension
+func installVSCode(r runner.Runner, id string) error {
+	if !r.CommandExists("code") {
+		return fmt.Errorf("code is not installed, cannot install VS Code extensions")
 	}
+	return runner.Run(r, "code", "--install-extension", id)
+}
 
-	return utils.RunCommandSilent("mas", "install", strconv.FormatInt(id, 10))
+// installGo installs a Go program by package path, at the pinned version or the latest one
+func installGo(r runner.Runner, path string, version string) error {
+	if !r.CommandExists("go") {
+		return fmt.Errorf("go is not installed, cannot install Go packages")
+	}
+	if version == "" {
+		version = "latest"
+	}
+	return runner.Run(r, "go", "install", path+"@"+version)
+}
+
+// installCargo installs a Rust crate, at the pinned version if there is one
+func installCargo(r runner.Runner, name string, version string) error {
+	if !r.CommandExists("cargo") {
+		return fmt.Errorf("cargo is not installed, cannot install Cargo packages")
+	}
+	if version != "" {
+		return runner.Run(r, "cargo", "install", name, "--version", version)
+	}
+	return runner.Run(r, "cargo", "install", name)
+}
+
+// installNpm installs a global npm package, at the pinned version if there is one
+func installNpm(r runner.Runner, name string, version string) error {
+	if !r.CommandExists("npm") {
+		return fmt.Errorf("npm is not installed, cannot install npm packages")
+	}
+	if version != "" {
+		name += "@" + version
+	}
+	return runner.Run(r, "npm", "install", "--global", name)
 }
@@ -0,0 +1,253 @@
+package brew_test
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brew"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// scripted is a command answered by the test on top of the replay fixtures
+type scripted struct {
+	argv     []string
+	exitCode int
+}
+
+func pkg(group string, priority int, pkgType string, name string) types.FilteredPackage {
+	return types.FilteredPackage{
+		PackageInfo: types.PackageInfo{Name: name},
+		Type:        pkgType,
+		Group:       group,
+		Priority:    priority,
+	}
+}
+
+// commandCalls returns the calls made to commands the replay fixtures do not answer,
+// that is every install or removal, in the order they were made
+func commandCalls(fake *runner.FakeRunner, fixtures *runner.FakeRunner) []string {
+	calls := []string{}
+	for _, call := range fake.Calls() {
+		if _, ok := fixtures.Responses[call]; !ok {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// statuses returns the status of every result keyed by type:name
+func statuses(rep *report.Report) map[string]report.Status {
+	got := make(map[string]report.Status)
+	for _, result := range rep.Results {
+		got[result.Type+":"+result.Name] = result.Status
+	}
+
+	return got
+}
+
+func TestInstallPackages(t *testing.T) {
+	t.Parallel()
+
+	xcode := pkg("core", 10, "mas", "Xcode")
+	xcode.ID = 497799835
+
+	tests := []struct {
+		name     string
+		packages []types.FilteredPackage
+		options  types.InstallOptions
+		scripts  []scripted
+		want     []string
+		statuses map[string]report.Status
+	}{
+		{
+			"installs missing packages by group priority",
+			[]types.FilteredPackage{
+				pkg("core", 10, "tap", "shiron-dev/tap"),
+				pkg("core", 10, "brew", "git"),
+				pkg("core", 10, "brew", "fd"),
+				pkg("core", 10, "cask", "firefox"),
+				xcode,
+				pkg("dev", 5, "tap", "homebrew/cask-fonts"),
+				pkg("dev", 5, "brew", "bat"),
+				pkg("dev", 5, "vscode", "github.copilot"),
+				pkg("dev", 5, "vscode", "golang.go"),
+			},
+			types.InstallOptions{},
+			[]scripted{
+				{[]string{"brew", "tap", "homebrew/cask-fonts"}, 0},
+				{[]string{"brew", "install", "bat"}, 0},
+				{[]string{"brew", "install", "fd"}, 0},
+				{[]string{"brew", "install", "--cask", "firefox"}, 1},
+				{[]string{"code", "--install-extension", "golang.go"}, 0},
+			},
+			[]string{
+				"brew tap homebrew/cask-fonts",
+				"brew install bat",
+				"code --install-extension golang.go",
+				"brew install fd",
+				"brew install --cask firefox",
+			},
+			map[string]report.Status{
+				"tap:shiron-dev/tap":      report.StatusAlreadyPresent,
+				"tap:homebrew/cask-fonts": report.StatusInstalled,
+				"brew:git":                report.StatusAlreadyPresent,
+				"brew:bat":                report.StatusInstalled,
+				"brew:fd":                 report.StatusInstalled,
+				"cask:firefox":            report.StatusFailed,
+				"mas:Xcode":               report.StatusAlreadyPresent,
+				"vscode:github.copilot":   report.StatusAlreadyPresent,
+				"vscode:golang.go":        report.StatusInstalled,
+			},
+		},
+		{
+			"dry run installs nothing",
+			[]types.FilteredPackage{
+				pkg("core", 10, "brew", "git"),
+				pkg("core", 10, "brew", "fd"),
+			},
+			types.InstallOptions{DryRun: true},
+			[]scripted{
+				{[]string{"brew", "install", "fd"}, 0},
+			},
+			[]string{},
+			map[string]report.Status{
+				"brew:git": report.StatusAlreadyPresent,
+				"brew:fd":  report.StatusSkipped,
+			},
+		},
+		{
+			"skipped types",
+			[]types.FilteredPackage{
+				pkg("core", 10, "brew", "fd"),
+				pkg("core", 10, "cask", "firefox"),
+			},
+			types.InstallOptions{SkipCasks: true},
+			[]scripted{
+				{[]string{"brew", "install", "fd"}, 0},
+				{[]string{"brew", "install", "--cask", "firefox"}, 0},
+			},
+			[]string{"brew install fd"},
+			map[string]report.Status{
+				"brew:fd":      report.StatusInstalled,
+				"cask:firefox": report.StatusSkipped,
+			},
+		},
+		{
+			"batch",
+			[]types.FilteredPackage{
+				pkg("core", 10, "brew", "fd"),
+				pkg("core", 10, "brew", "git"),
+				pkg("core", 10, "brew", "bat"),
+			},
+			types.InstallOptions{Batch: true},
+			[]scripted{
+				{[]string{"brew", "install", "fd", "bat"}, 0},
+			},
+			[]string{"brew install fd bat"},
+			map[string]report.Status{
+				"brew:fd":  report.StatusInstalled,
+				"brew:git": report.StatusAlreadyPresent,
+				"brew:bat": report.StatusInstalled,
+			},
+		},
+		{
+			"failed batch",
+			[]types.FilteredPackage{
+				pkg("core", 10, "brew", "fd"),
+				pkg("core", 10, "brew", "bat"),
+			},
+			types.InstallOptions{Batch: true},
+			[]scripted{
+				{[]string{"brew", "install", "fd", "bat"}, 1},
+			},
+			[]string{"brew install fd bat"},
+			map[string]report.Status{
+				"brew:fd":  report.StatusFailed,
+				"brew:bat": report.StatusFailed,
+			},
+		},
+		{
+			"missing tool",
+			[]types.FilteredPackage{
+				pkg("core", 10, "go", "golang.org/x/tools/gopls"),
+			},
+			types.InstallOptions{},
+			nil,
+			[]string{},
+			map[string]report.Status{
+				"go:golang.org/x/tools/gopls": report.StatusFailed,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fixtures, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fake, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			installed, err := state.Load(fake)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.scripts {
+				fake.Script(runner.Response{ExitCode: s.exitCode}, s.argv[0], s.argv[1:]...)
+			}
+
+			rep := report.New("install")
+			if err := brew.InstallPackages(fake, installed, rep, tt.packages, &tt.options); err != nil {
+				t.Fatalf("InstallPackages() error = %v", err)
+			}
+
+			if got := commandCalls(fake, fixtures); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("InstallPackages() calls = %v, want %v", got, tt.want)
+			}
+			if got := statuses(rep); !reflect.DeepEqual(got, tt.statuses) {
+				t.Errorf("InstallPackages() statuses = %v, want %v", got, tt.statuses)
+			}
+		})
+	}
+}
+
+func TestOrderForInstall(t *testing.T) {
+	t.Parallel()
+
+	packages := []types.FilteredPackage{
+		pkg("core", 10, "cask", "firefox"),
+		pkg("core", 10, "brew", "git"),
+		pkg("dev", 5, "brew", "bat"),
+		pkg("core", 10, "tap", "shiron-dev/tap"),
+		pkg("extra", 5, "npm", "typescript"),
+	}
+
+	want := []string{"shiron-dev/tap", "bat", "typescript", "git", "firefox"}
+
+	var got []string
+	for _, p := range brew.OrderForInstall(packages) {
+		got = append(got, p.Name)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OrderForInstall() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,206 @@
+package brewfile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// annotationMarker starts a brew-manager annotation comment. Annotations carry YAML-only settings
+// (group names, priorities, tags, profiles...) through a Brewfile; Homebrew Bundle ignores them.
+const annotationMarker = "#:"
+
+// Annotation is one key=value pair of an annotation comment
+type Annotation struct {
+	Key   string
+	Value string
+}
+
+// Annotations are the key=value pairs of an annotation comment, in order
+type Annotations []Annotation
+
+// Get returns the value of an annotation and whether it is present
+func (a Annotations) Get(key string) (string, bool) {
+	for _, annotation := range a {
+		if annotation.Key == key {
+			return annotation.Value, true
+		}
+	}
+	return "", false
+}
+
+// Entry is one package line of a Brewfile
+type Entry struct {
+	Type        string   // tap, brew, cask, mas, vscode, go, cargo or whalebrew
+	Name        string   // Package name, or app name for mas
+	ID          int64    // For mas apps
+	Options     []string // Arguments after the name in canonical form, e.g. `restart_service: true`; excludes the mas id
+	Condition   string   // Ruby condition from enclosing if/unless blocks or a modifier, e.g. "OS.mac?"; empty when unconditional
+	Annotations Annotations
+	Pos         Position
+}
+
+// Section is a run of entries under the same heading path
+type Section struct {
+	Categories  []string // Heading path, outermost first; empty before the first heading
+	Annotations Annotations
+	Entries     []Entry
+	Line        int // Line of the heading; 0 before the first heading
+}
+
+// File is a parsed Brewfile. Every comment line starting with one or more "#" is a heading,
+// its level being the number of "#", like the Brewfile written by dofy.
+type File struct {
+	Annotations []Annotations // File-level annotation lines, such as profiles
+	Sections    []Section
+}
+
+// Entries returns every entry of the file in order
+func (f *File) Entries() []Entry {
+	var entries []Entry
+	for _, section := range f.Sections {
+		entries = append(entries, section.Entries...)
+	}
+	return entries
+}
+
+// ParseFile parses a Brewfile
+func ParseFile(filePath string) (*File, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Brewfile: %w", err)
+	}
+
+	return Parse(string(data))
+}
+
+// parseAnnotations parses space-separated key=value pairs; values containing spaces are double-quoted
+func parseAnnotations(s string) (Annotations, error) {
+	var annotations Annotations
+	s = strings.TrimSpace(s)
+	for s != "" {
+		key, rest, found := strings.Cut(s, "=")
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid annotation: %s", s)
+		}
+
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, fmt.Errorf("invalid annotation %s: %w", key, err)
+			}
+			value, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+
+		annotations = append(annotations, Annotation{Key: key, Value: value})
+		s = strings.TrimSpace(rest)
+	}
+	return annotations, nil
+}
+
+// Write writes a Brewfile with a header comment. Headings are written where the heading path changes,
+// preceded by a blank line, like the Brewfile written by dofy.
+func Write(w io.Writer, f *File, header string) error {
+	var b strings.Builder
+
+	if header != "" {
+		b.WriteString("# " + header + "\n")
+	}
+	for _, annotations := range f.Annotations {
+		b.WriteString(annotationMarker + " " + formatAnnotations(annotations) + "\n")
+	}
+
+	var previous []string
+	for i, section := range f.Sections {
+		if len(section.Categories) == 0 {
+			if i == 0 && len(section.Entries) > 0 {
+				b.WriteString("\n")
+			}
+		} else {
+			// Write the headings from the first level that differs; a section whose path does not
+			// go deeper than the previous one always repeats its own heading
+			level := 0
+			for level < len(section.Categories) && level < len(previous) && section.Categories[level] == previous[level] {
+				level++
+			}
+			if level == len(section.Categories) {
+				level--
+			}
+			for ; level < len(section.Categories); level++ {
+				b.WriteString("\n" + strings.Repeat("#", level+1) + " " + section.Categories[level])
+				if level == len(section.Categories)-1 && len(section.Annotations) > 0 {
+					b.WriteString(" " + annotationMarker + " " + formatAnnotations(section.Annotations))
+				}
+				b.WriteString("\n")
+			}
+			previous = section.Categories
+		}
+
+		for _, entry := range section.Entries {
+			b.WriteString(entry.String() + "\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// String formats an entry as a Brewfile line
+func (e Entry) String() string {
+	line := fmt.Sprintf("%s %s", e.Type, strconv.Quote(e.Name))
+	if e.Type == "mas" {
+		line += fmt.Sprintf(", id: %d", e.ID)
+	}
+	for _, option := range e.Options {
+		line += ", " + option
+	}
+	if e.Condition != "" {
+		line += " if " + e.Condition
+	}
+	if len(e.Annotations) > 0 {
+		line += " " + annotationMarker + " " + formatAnnotations(e.Annotations)
+	}
+	return line
+}
+
+// formatAnnotations formats annotations as space-separated key=value pairs
+func formatAnnotations(annotations Annotations) string {
+	parts := make([]string, 0, len(annotations))
+	for _, annotation := range annotations {
+		value := annotation.Value
+		if value == "" || strings.ContainsAny(value, " \t\"#\\") {
+			value = strconv.Quote(value)
+		}
+		parts = append(parts, annotation.Key+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Slug converts a heading into a group name or tag, e.g. "Usual Tools" into "usual-tools"
+func Slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
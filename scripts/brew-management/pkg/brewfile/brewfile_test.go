@@ -0,0 +1,173 @@
+package brewfile_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brewfile"
+)
+
+// clearPositions drops source positions, which a written and parsed file does not keep
+func clearPositions(f *brewfile.File) {
+	for i := range f.Sections {
+		f.Sections[i].Line = 0
+		for j := range f.Sections[i].Entries {
+			f.Sections[i].Entries[j].Pos = brewfile.Position{}
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		file *brewfile.File
+		want string
+	}{
+		{
+			"nested headings",
+			&brewfile.File{Sections: []brewfile.Section{
+				{Categories: []string{"Dev"}, Entries: []brewfile.Entry{{Type: "brew", Name: "go"}}},
+				{Categories: []string{"Dev", "Editors"}, Entries: []brewfile.Entry{{Type: "cask", Name: "zed"}}},
+				{Categories: []string{"Dev", "Editors"}, Entries: []brewfile.Entry{{Type: "cask", Name: "helix"}}},
+				{Categories: []string{"Media"}, Entries: []brewfile.Entry{{Type: "cask", Name: "vlc"}}},
+			}},
+			"# header\n\n# Dev\nbrew \"go\"\n\n## Editors\ncask \"zed\"\n\n## Editors\ncask \"helix\"\n\n# Media\ncask \"vlc\"\n",
+		},
+		{
+			"annotations",
+			&brewfile.File{
+				Annotations: []brewfile.Annotations{{{Key: "profile", Value: "work"}, {Key: "description", Value: "Work machine"}}},
+				Sections: []brewfile.Section{
+					{Categories: []string{"Core"}, Annotations: brewfile.Annotations{{Key: "priority", Value: "1"}}, Entries: []brewfile.Entry{
+						{Type: "mas", Name: "Xcode", ID: 497799835, Annotations: brewfile.Annotations{{Key: "tags", Value: ""}}},
+					}},
+				},
+			},
+			"# header\n#: profile=work description=\"Work machine\"\n\n# Core #: priority=1\nmas \"Xcode\", id: 497799835 #: tags=\"\"\n",
+		},
+		{
+			"entries before the first heading",
+			&brewfile.File{Sections: []brewfile.Section{
+				{Entries: []brewfile.Entry{{Type: "tap", Name: "homebrew/bundle"}}},
+			}},
+			"# header\n\ntap \"homebrew/bundle\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var b strings.Builder
+			if err := brewfile.Write(&b, tt.file, "header"); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("Write() = %q, want %q", got, tt.want)
+			}
+
+			// A header is a comment like any heading, so the round trip is checked without one
+			b.Reset()
+			if err := brewfile.Write(&b, tt.file, ""); err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := brewfile.Parse(b.String())
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			clearPositions(parsed)
+			// Parse always starts with a section for entries before the first heading
+			want := tt.file
+			if len(want.Sections[0].Categories) > 0 {
+				want = &brewfile.File{Annotations: tt.file.Annotations, Sections: append([]brewfile.Section{{}}, tt.file.Sections...)}
+			}
+			if !reflect.DeepEqual(parsed, want) {
+				t.Errorf("Parse(Write()) = %+v, want %+v", parsed, want)
+			}
+		})
+	}
+}
+
+func TestEntry_String(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		entry brewfile.Entry
+		want  string
+	}{
+		{"plain", brewfile.Entry{Type: "brew", Name: "git"}, `brew "git"`},
+		{"options", brewfile.Entry{Type: "brew", Name: "postgresql@16", Options: []string{"restart_service: true", `link: false`}}, `brew "postgresql@16", restart_service: true, link: false`},
+		{"mas", brewfile.Entry{Type: "mas", Name: "Xcode", ID: 497799835}, `mas "Xcode", id: 497799835`},
+		{"condition", brewfile.Entry{Type: "cask", Name: "rectangle", Condition: "OS.mac?"}, `cask "rectangle" if OS.mac?`},
+		{"quoted name", brewfile.Entry{Type: "vscode", Name: `a"b`}, `vscode "a\"b"`},
+		{"annotations", brewfile.Entry{Type: "brew", Name: "jq", Annotations: brewfile.Annotations{{Key: "tags", Value: "cli,json"}, {Key: "description", Value: "JSON # processor"}}}, `brew "jq" #: tags=cli,json description="JSON # processor"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.entry.String(); got != tt.want {
+				t.Errorf("Entry.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnnotations_Get(t *testing.T) {
+	t.Parallel()
+
+	annotations := brewfile.Annotations{{Key: "group", Value: "core"}, {Key: "tags", Value: ""}}
+
+	tests := []struct {
+		name   string
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{"present", "group", "core", true},
+		{"empty value", "tags", "", true},
+		{"missing", "priority", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := annotations.Get(tt.key)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Annotations.Get() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSlug(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"words", "Usual Tools", "usual-tools"},
+		{"punctuation", "  Dev / Editors & IDEs ", "dev-editors-ides"},
+		{"digits", "Python 3", "python-3"},
+		{"non-ASCII letters", "Outils Généraux", "outils-généraux"},
+		{"empty", "---", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := brewfile.Slug(tt.s); got != tt.want {
+				t.Errorf("Slug() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package brewfile
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Position is a 1-based line and column in a Brewfile
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Error is a syntax error at a position in a Brewfile
+type Error struct {
+	Pos Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// tokenKind is the kind of a lexical token
+type tokenKind int
+
+const (
+	tokEOF     tokenKind = iota
+	tokNewline           // End of a line
+	tokComment           // "#" up to the end of the line
+	tokIdent             // Identifier or method chain, e.g. brew, true, OS.mac? or Hardware::CPU.arm?
+	tokLabel             // Hash key written as "key:"
+	tokString            // Quoted string; value holds the unescaped content
+	tokSymbol            // Symbol written as ":name"; value holds the name
+	tokNumber            // Integer or decimal number
+	tokPunct             // , [ ] { } ( ) => ! && || == !=
+)
+
+// token is a lexical token of a Brewfile
+type token struct {
+	kind  tokenKind
+	text  string // Source text
+	value string // Unescaped string content, label or symbol name
+	pos   Position
+}
+
+// describe returns a token description for error messages
+func (t token) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokNewline:
+		return "end of line"
+	case tokComment:
+		return "comment"
+	case tokString:
+		return t.text
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// lexer splits Brewfile source into tokens
+type lexer struct {
+	src  []rune
+	off  int
+	line int
+	col  int
+}
+
+// tokenize splits Brewfile source into tokens, ending with tokEOF
+func tokenize(src string) ([]token, error) {
+	l := &lexer{src: []rune(src), line: 1, col: 1}
+
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+// peek returns the rune at offset n from the current one, or 0 past the end
+func (l *lexer) peek(n int) rune {
+	if l.off+n < len(l.src) {
+		return l.src[l.off+n]
+	}
+	return 0
+}
+
+// advance consumes one rune
+func (l *lexer) advance() rune {
+	r := l.src[l.off]
+	l.off++
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+// next returns the next token
+func (l *lexer) next() (token, error) {
+	// Skip horizontal whitespace and escaped line breaks
+	for l.off < len(l.src) {
+		r := l.peek(0)
+		if r == ' ' || r == '\t' || r == '\r' {
+			l.advance()
+		} else if r == '\\' && l.peek(1) == '\n' {
+			l.advance()
+			l.advance()
+		} else {
+			break
+		}
+	}
+
+	pos := Position{Line: l.line, Column: l.col}
+	start := l.off
+	if l.off >= len(l.src) {
+		return token{kind: tokEOF, pos: pos}, nil
+	}
+
+	r := l.advance()
+	switch {
+	case r == '\n':
+		return token{kind: tokNewline, text: "\n", pos: pos}, nil
+
+	case r == '#':
+		for l.off < len(l.src) && l.peek(0) != '\n' {
+			l.advance()
+		}
+		return token{kind: tokComment, text: strings.TrimRight(string(l.src[start:l.off]), " \t\r"), pos: pos}, nil
+
+	case r == '"' || r == '\'':
+		value, err := l.quoted(r, pos)
+		if err != nil {
+			return token{}, err
+		}
+		return token{kind: tokString, text: string(l.src[start:l.off]), value: value, pos: pos}, nil
+
+	case r == ':' && isIdentStart(l.peek(0)):
+		for l.off < len(l.src) && isIdentPart(l.peek(0)) {
+			l.advance()
+		}
+		if r := l.peek(0); r == '?' || r == '!' {
+			l.advance()
+		}
+		text := string(l.src[start:l.off])
+		return token{kind: tokSymbol, text: text, value: text[1:], pos: pos}, nil
+
+	case unicode.IsDigit(r):
+		for l.off < len(l.src) && (unicode.IsDigit(l.peek(0)) || l.peek(0) == '_' || (l.peek(0) == '.' && unicode.IsDigit(l.peek(1)))) {
+			l.advance()
+		}
+		return token{kind: tokNumber, text: string(l.src[start:l.off]), pos: pos}, nil
+
+	case isIdentStart(r):
+		l.ident()
+		text := string(l.src[start:l.off])
+		// "key:" is a hash label, unlike "Hardware::CPU"
+		if l.peek(0) == ':' && l.peek(1) != ':' {
+			l.advance()
+			return token{kind: tokLabel, text: text + ":", value: text, pos: pos}, nil
+		}
+		return token{kind: tokIdent, text: text, pos: pos}, nil
+	}
+
+	switch two := string([]rune{r, l.peek(0)}); two {
+	case "=>", "&&", "||", "==", "!=":
+		l.advance()
+		return token{kind: tokPunct, text: two, pos: pos}, nil
+	}
+	if strings.ContainsRune(",[]{}()!", r) {
+		return token{kind: tokPunct, text: string(r), pos: pos}, nil
+	}
+
+	return token{}, &Error{Pos: pos, Msg: fmt.Sprintf("unexpected character %q", r)}
+}
+
+// ident consumes the rest of an identifier or method chain such as OS.mac? or Hardware::CPU.arm?
+func (l *lexer) ident() {
+	for l.off < len(l.src) {
+		switch r := l.peek(0); {
+		case isIdentPart(r):
+			l.advance()
+		case r == '.' && isIdentStart(l.peek(1)):
+			l.advance()
+		case r == ':' && l.peek(1) == ':' && isIdentStart(l.peek(2)):
+			l.advance()
+			l.advance()
+		case r == '?' || r == '!':
+			// Predicate and bang methods, but not "!=" or "?" starting something else
+			if l.peek(1) == '=' {
+				return
+			}
+			l.advance()
+			if !(l.peek(0) == '.' && isIdentStart(l.peek(1))) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// quoted consumes a string literal after its opening quote and returns its content.
+// Double-quoted strings support the usual backslash escapes; single-quoted ones only \' and \\.
+func (l *lexer) quoted(quote rune, pos Position) (string, error) {
+	var b strings.Builder
+	for {
+		if l.off >= len(l.src) || l.peek(0) == '\n' {
+			return "", &Error{Pos: pos, Msg: "unterminated string"}
+		}
+
+		r := l.advance()
+		switch {
+		case r == quote:
+			return b.String(), nil
+		case r == '\\' && l.off < len(l.src):
+			escaped := l.advance()
+			if quote == '\'' {
+				if escaped != '\'' && escaped != '\\' {
+					b.WriteRune('\\')
+				}
+				b.WriteRune(escaped)
+				continue
+			}
+			switch escaped {
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			default:
+				b.WriteRune(escaped)
+			}
+		case r == '#' && quote == '"' && l.peek(0) == '{':
+			return "", &Error{Pos: pos, Msg: "string interpolation is not supported"}
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+// isIdentStart reports whether r can start an identifier
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// isIdentPart reports whether r can continue an identifier
+func isIdentPart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
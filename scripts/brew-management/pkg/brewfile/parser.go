@@ -0,0 +1,464 @@
+package brewfile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// entryTypes are the Brewfile directives that declare packages
+var entryTypes = map[string]bool{
+	"tap":       true,
+	"brew":      true,
+	"cask":      true,
+	"mas":       true,
+	"vscode":    true,
+	"go":        true,
+	"cargo":     true,
+	"whalebrew": true,
+}
+
+// block is an open if/unless block
+type block struct {
+	condition string // Condition of the current branch
+	previous  []string
+	pos       Position
+}
+
+// parser builds a File from tokens
+type parser struct {
+	tokens []token
+	i      int
+	file   *File
+	blocks []block
+}
+
+// Parse parses Brewfile content. It accepts the subset of the Homebrew Bundle DSL that declares
+// packages: tap (with an optional URL), brew and cask with options, mas with an id, vscode, go,
+// cargo, whalebrew, and if/unless/elsif/else blocks or modifiers. Anything else is a syntax error.
+func Parse(src string) (*File, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, file: &File{Sections: []Section{{}}}}
+	for p.peek().kind != tokEOF {
+		if err := p.statement(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(p.blocks) > 0 {
+		return nil, &Error{Pos: p.blocks[len(p.blocks)-1].pos, Msg: "if without end"}
+	}
+
+	return p.file, nil
+}
+
+// peek returns the current token
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+// next consumes the current token
+func (p *parser) next() token {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// skipNewlines consumes line breaks, which are allowed inside brackets and after commas
+func (p *parser) skipNewlines() {
+	for p.peek().kind == tokNewline {
+		p.next()
+	}
+}
+
+// errorf returns a syntax error at a token
+func errorf(tok token, format string, args ...any) error {
+	return &Error{Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// endStatement consumes the end of a statement: a line break or the end of the file
+func (p *parser) endStatement() error {
+	switch tok := p.peek(); tok.kind {
+	case tokNewline:
+		p.next()
+		return nil
+	case tokEOF:
+		return nil
+	default:
+		return errorf(tok, "unexpected %s", tok.describe())
+	}
+}
+
+// statement parses one line: a comment, a block keyword or a package entry
+func (p *parser) statement() error {
+	tok := p.next()
+	switch tok.kind {
+	case tokNewline:
+		return nil
+	case tokComment:
+		if err := p.comment(tok); err != nil {
+			return err
+		}
+		return p.endStatement()
+	case tokIdent:
+	default:
+		return errorf(tok, "unexpected %s at the start of a statement", tok.describe())
+	}
+
+	switch keyword := tok.text; {
+	case keyword == "if" || keyword == "unless":
+		condition, err := p.condition(tok)
+		if err != nil {
+			return err
+		}
+		if keyword == "unless" {
+			condition = negate(condition)
+		}
+		p.blocks = append(p.blocks, block{condition: condition, pos: tok.pos})
+
+	case keyword == "elsif" || keyword == "else":
+		if len(p.blocks) == 0 {
+			return errorf(tok, "%s without if", keyword)
+		}
+		current := &p.blocks[len(p.blocks)-1]
+		current.previous = append(current.previous, current.condition)
+		current.condition = ""
+		if keyword == "elsif" {
+			condition, err := p.condition(tok)
+			if err != nil {
+				return err
+			}
+			current.condition = condition
+		}
+
+	case keyword == "end":
+		if len(p.blocks) == 0 {
+			return errorf(tok, "end without if")
+		}
+		p.blocks = p.blocks[:len(p.blocks)-1]
+
+	case entryTypes[keyword]:
+		return p.entry(tok)
+
+	default:
+		return errorf(tok, "unsupported directive %q", keyword)
+	}
+
+	p.skipTrailingComment()
+	return p.endStatement()
+}
+
+// skipTrailingComment consumes a comment at the end of a statement
+func (p *parser) skipTrailingComment() {
+	if p.peek().kind == tokComment {
+		p.next()
+	}
+}
+
+// comment handles a comment line: a file annotation or a heading starting a new section
+func (p *parser) comment(tok token) error {
+	if strings.HasPrefix(tok.text, annotationMarker) {
+		annotations, err := parseAnnotations(tok.text[len(annotationMarker):])
+		if err != nil {
+			return errorf(tok, "%v", err)
+		}
+		p.file.Annotations = append(p.file.Annotations, annotations)
+		return nil
+	}
+
+	level := 0
+	for level < len(tok.text) && tok.text[level] == '#' {
+		level++
+	}
+
+	text, annotationText, _ := strings.Cut(tok.text[level:], " "+annotationMarker)
+	annotations, err := parseAnnotations(annotationText)
+	if err != nil {
+		return errorf(tok, "%v", err)
+	}
+
+	// A heading replaces the heading of its level and closes deeper ones
+	previous := p.file.Sections[len(p.file.Sections)-1].Categories
+	categories := append([]string{}, previous[:min(level-1, len(previous))]...)
+	categories = append(categories, strings.TrimSpace(text))
+
+	p.file.Sections = append(p.file.Sections, Section{Categories: categories, Annotations: annotations, Line: tok.pos.Line})
+	return nil
+}
+
+// condition parses the condition of an if, unless or elsif up to the end of the line
+func (p *parser) condition(keyword token) (string, error) {
+	var parts []string
+	for {
+		tok := p.peek()
+		if tok.kind == tokNewline || tok.kind == tokEOF || tok.kind == tokComment {
+			break
+		}
+		p.next()
+		if tok.kind == tokLabel {
+			return "", errorf(tok, "unexpected %s in condition", tok.describe())
+		}
+		parts = append(parts, tok.text)
+	}
+
+	if len(parts) == 0 {
+		return "", errorf(keyword, "%s without a condition", keyword.text)
+	}
+	return joinCondition(parts), nil
+}
+
+// entry parses a package entry after its directive
+func (p *parser) entry(keyword token) error {
+	nameTok := p.next()
+	if nameTok.kind != tokString {
+		return errorf(nameTok, "expected a quoted name after %s, got %s", keyword.text, nameTok.describe())
+	}
+	if nameTok.value == "" {
+		return errorf(nameTok, "empty %s name", keyword.text)
+	}
+
+	entry := Entry{Type: keyword.text, Name: nameTok.value, Pos: keyword.pos}
+
+	for p.peek().kind == tokPunct && p.peek().text == "," {
+		p.next()
+		p.skipNewlines()
+		if err := p.argument(keyword.text, &entry); err != nil {
+			return err
+		}
+	}
+
+	if entry.Type == "mas" && entry.ID == 0 {
+		return errorf(nameTok, "mas %q without an id", entry.Name)
+	}
+
+	// Conditions of the enclosing blocks, and a trailing if/unless modifier
+	var conditions []string
+	for _, b := range p.blocks {
+		conditions = append(conditions, b.branch())
+	}
+	if tok := p.peek(); tok.kind == tokIdent && (tok.text == "if" || tok.text == "unless") {
+		p.next()
+		condition, err := p.condition(tok)
+		if err != nil {
+			return err
+		}
+		if tok.text == "unless" {
+			condition = negate(condition)
+		}
+		conditions = append(conditions, condition)
+	}
+	entry.Condition = joinConditions(conditions)
+
+	if tok := p.peek(); tok.kind == tokComment {
+		p.next()
+		if strings.HasPrefix(tok.text, annotationMarker) {
+			annotations, err := parseAnnotations(tok.text[len(annotationMarker):])
+			if err != nil {
+				return errorf(tok, "%v", err)
+			}
+			entry.Annotations = annotations
+		}
+	}
+
+	if err := p.endStatement(); err != nil {
+		return err
+	}
+
+	current := &p.file.Sections[len(p.file.Sections)-1]
+	current.Entries = append(current.Entries, entry)
+	return nil
+}
+
+// argument parses one argument after the name: a "key: value" option, a "key => value" option,
+// the URL of a tap, or the id of a mas app
+func (p *parser) argument(directive string, entry *Entry) error {
+	tok := p.peek()
+
+	if tok.kind == tokLabel {
+		p.next()
+		p.skipNewlines()
+		if directive == "mas" && tok.value == "id" {
+			idTok := p.next()
+			id, err := strconv.ParseInt(strings.ReplaceAll(idTok.text, "_", ""), 10, 64)
+			if idTok.kind != tokNumber || err != nil || id <= 0 {
+				return errorf(idTok, "mas id must be a positive integer, got %s", idTok.describe())
+			}
+			entry.ID = id
+			return nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return err
+		}
+		entry.Options = append(entry.Options, tok.value+": "+value)
+		return nil
+	}
+
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	if arrow := p.peek(); arrow.kind == tokPunct && arrow.text == "=>" {
+		p.next()
+		p.skipNewlines()
+		rhs, err := p.value()
+		if err != nil {
+			return err
+		}
+		entry.Options = append(entry.Options, value+" => "+rhs)
+		return nil
+	}
+
+	if directive != "tap" || tok.kind != tokString || len(entry.Options) > 0 {
+		return errorf(tok, "unexpected positional argument %s", tok.describe())
+	}
+	entry.Options = append(entry.Options, value)
+	return nil
+}
+
+// value parses a literal and returns it in canonical form: a string, symbol, number, true, false,
+// nil, or an array or hash of those
+func (p *parser) value() (string, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return strconv.Quote(tok.value), nil
+	case tokSymbol, tokNumber:
+		return tok.text, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false", "nil":
+			return tok.text, nil
+		}
+	case tokPunct:
+		switch tok.text {
+		case "[":
+			return p.collection(tok, "]", func() (string, error) { return p.value() })
+		case "{":
+			return p.collection(tok, "}", p.pair)
+		}
+	}
+	return "", errorf(tok, "expected a value, got %s", tok.describe())
+}
+
+// pair parses a hash entry, "key: value" or "key => value"
+func (p *parser) pair() (string, error) {
+	if tok := p.peek(); tok.kind == tokLabel {
+		p.next()
+		p.skipNewlines()
+		value, err := p.value()
+		if err != nil {
+			return "", err
+		}
+		return tok.value + ": " + value, nil
+	}
+
+	key, err := p.value()
+	if err != nil {
+		return "", err
+	}
+	if arrow := p.next(); arrow.kind != tokPunct || arrow.text != "=>" {
+		return "", errorf(arrow, "expected => after hash key, got %s", arrow.describe())
+	}
+	p.skipNewlines()
+	value, err := p.value()
+	if err != nil {
+		return "", err
+	}
+	return key + " => " + value, nil
+}
+
+// collection parses comma-separated items up to a closing bracket; line breaks and a trailing comma are allowed
+func (p *parser) collection(open token, closing string, item func() (string, error)) (string, error) {
+	var items []string
+	for {
+		p.skipNewlines()
+		if tok := p.peek(); tok.kind == tokPunct && tok.text == closing {
+			p.next()
+			break
+		}
+		if p.peek().kind == tokEOF {
+			return "", errorf(open, "unclosed %s", open.text)
+		}
+
+		value, err := item()
+		if err != nil {
+			return "", err
+		}
+		items = append(items, value)
+
+		p.skipNewlines()
+		tok := p.peek()
+		if tok.kind == tokEOF {
+			return "", errorf(open, "unclosed %s", open.text)
+		}
+		if tok.kind == tokPunct && tok.text == "," {
+			p.next()
+			continue
+		}
+		if tok.kind != tokPunct || tok.text != closing {
+			return "", errorf(tok, "expected , or %s, got %s", closing, tok.describe())
+		}
+	}
+
+	return open.text + strings.Join(items, ", ") + closing, nil
+}
+
+// branch returns the condition under which the current branch of a block applies
+func (b block) branch() string {
+	var conditions []string
+	for _, previous := range b.previous {
+		conditions = append(conditions, negate(previous))
+	}
+	if b.condition != "" {
+		conditions = append(conditions, b.condition)
+	}
+	return joinConditions(conditions)
+}
+
+// joinCondition joins condition tokens with spaces, except around parentheses and after "!"
+func joinCondition(parts []string) string {
+	var b strings.Builder
+	for i, part := range parts {
+		if i > 0 && part != ")" && parts[i-1] != "(" && parts[i-1] != "!" {
+			b.WriteByte(' ')
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// joinConditions combines conditions that must all hold
+func joinConditions(conditions []string) string {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	var parts []string
+	for _, condition := range conditions {
+		if isSimpleCondition(condition) {
+			parts = append(parts, condition)
+		} else {
+			parts = append(parts, "("+condition+")")
+		}
+	}
+	return strings.Join(parts, " && ")
+}
+
+// negate negates a condition
+func negate(condition string) string {
+	if isSimpleCondition(condition) {
+		return "!" + condition
+	}
+	return "!(" + condition + ")"
+}
+
+// isSimpleCondition reports whether a condition is a single method call, optionally negated
+func isSimpleCondition(condition string) bool {
+	return !strings.ContainsAny(condition, " ()")
+}
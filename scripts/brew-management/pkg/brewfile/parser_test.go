@@ -0,0 +1,193 @@
+package brewfile_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brewfile"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		src  string
+		want []brewfile.Entry
+	}{
+		{
+			"directives",
+			"tap \"homebrew/bundle\"\nbrew \"git\"\ncask 'visual-studio-code'\nmas \"Xcode\", id: 497_799_835\nvscode \"golang.go\"\ngo \"golang.org/x/tools/gopls\"\ncargo \"ripgrep\"\nwhalebrew \"whalebrew/wget\"\n",
+			[]brewfile.Entry{
+				{Type: "tap", Name: "homebrew/bundle", Pos: brewfile.Position{Line: 1, Column: 1}},
+				{Type: "brew", Name: "git", Pos: brewfile.Position{Line: 2, Column: 1}},
+				{Type: "cask", Name: "visual-studio-code", Pos: brewfile.Position{Line: 3, Column: 1}},
+				{Type: "mas", Name: "Xcode", ID: 497799835, Pos: brewfile.Position{Line: 4, Column: 1}},
+				{Type: "vscode", Name: "golang.go", Pos: brewfile.Position{Line: 5, Column: 1}},
+				{Type: "go", Name: "golang.org/x/tools/gopls", Pos: brewfile.Position{Line: 6, Column: 1}},
+				{Type: "cargo", Name: "ripgrep", Pos: brewfile.Position{Line: 7, Column: 1}},
+				{Type: "whalebrew", Name: "whalebrew/wget", Pos: brewfile.Position{Line: 8, Column: 1}},
+			},
+		},
+		{
+			"options in canonical form",
+			"tap \"user/repo\", \"https://example.com/repo.git\"\n" +
+				"brew 'mysql', restart_service: :changed, link: false, args: ['with-foo', \"bar\"]\n" +
+				"  brew \"nginx\", \"restart_service\" => true,\n    conflicts_with: { \"a\" => 1, b: 2.5 }\n",
+			[]brewfile.Entry{
+				{Type: "tap", Name: "user/repo", Options: []string{`"https://example.com/repo.git"`}, Pos: brewfile.Position{Line: 1, Column: 1}},
+				{Type: "brew", Name: "mysql", Options: []string{"restart_service: :changed", "link: false", `args: ["with-foo", "bar"]`}, Pos: brewfile.Position{Line: 2, Column: 1}},
+				{Type: "brew", Name: "nginx", Options: []string{`"restart_service" => true`, `conflicts_with: {"a" => 1, b: 2.5}`}, Pos: brewfile.Position{Line: 3, Column: 3}},
+			},
+		},
+		{
+			"string escapes",
+			"brew \"a\\\"b\\tc\"\nbrew 'it\\'s \\n'\n",
+			[]brewfile.Entry{
+				{Type: "brew", Name: "a\"b\tc", Pos: brewfile.Position{Line: 1, Column: 1}},
+				{Type: "brew", Name: `it's \n`, Pos: brewfile.Position{Line: 2, Column: 1}},
+			},
+		},
+		{
+			"comments and line continuations",
+			"brew \"git\" # version control\n\n\tbrew \\\n  \"jq\" #: tags=cli,json\n",
+			[]brewfile.Entry{
+				{Type: "brew", Name: "git", Pos: brewfile.Position{Line: 1, Column: 1}},
+				{Type: "brew", Name: "jq", Annotations: brewfile.Annotations{{Key: "tags", Value: "cli,json"}}, Pos: brewfile.Position{Line: 3, Column: 2}},
+			},
+		},
+		{
+			"conditions",
+			"if OS.mac?\n  brew \"a\"\n  if Hardware::CPU.arm?\n    brew \"b\"\n  end\nelsif OS.linux? && Hardware::CPU.arm?\n  brew \"c\"\nelse\n  brew \"d\"\nend\n" +
+				"cask \"e\" unless Hardware::CPU.intel?\nbrew \"f\" if OS.mac? || OS.linux?\n",
+			[]brewfile.Entry{
+				{Type: "brew", Name: "a", Condition: "OS.mac?", Pos: brewfile.Position{Line: 2, Column: 3}},
+				{Type: "brew", Name: "b", Condition: "OS.mac? && Hardware::CPU.arm?", Pos: brewfile.Position{Line: 4, Column: 5}},
+				{Type: "brew", Name: "c", Condition: "!OS.mac? && (OS.linux? && Hardware::CPU.arm?)", Pos: brewfile.Position{Line: 7, Column: 3}},
+				{Type: "brew", Name: "d", Condition: "!OS.mac? && (!(OS.linux? && Hardware::CPU.arm?))", Pos: brewfile.Position{Line: 9, Column: 3}},
+				{Type: "cask", Name: "e", Condition: "!Hardware::CPU.intel?", Pos: brewfile.Position{Line: 11, Column: 1}},
+				{Type: "brew", Name: "f", Condition: "OS.mac? || OS.linux?", Pos: brewfile.Position{Line: 12, Column: 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := brewfile.Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := f.Entries(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() entries = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Sections(t *testing.T) {
+	t.Parallel()
+
+	src := `#: profile=work groups=core
+tap "homebrew/bundle"
+
+# Core
+brew "git"
+## Shell #: tags=shell,cli
+brew "zsh"
+### Plugins
+### Prompts
+brew "starship"
+# Media
+cask "vlc"
+`
+
+	f, err := brewfile.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantAnnotations := []brewfile.Annotations{{{Key: "profile", Value: "work"}, {Key: "groups", Value: "core"}}}
+	if !reflect.DeepEqual(f.Annotations, wantAnnotations) {
+		t.Errorf("Parse() annotations = %v, want %v", f.Annotations, wantAnnotations)
+	}
+
+	type section struct {
+		categories  []string
+		annotations brewfile.Annotations
+		entries     []string
+		line        int
+	}
+
+	want := []section{
+		{nil, nil, []string{"homebrew/bundle"}, 0},
+		{[]string{"Core"}, nil, []string{"git"}, 4},
+		{[]string{"Core", "Shell"}, brewfile.Annotations{{Key: "tags", Value: "shell,cli"}}, []string{"zsh"}, 6},
+		{[]string{"Core", "Shell", "Plugins"}, nil, nil, 8},
+		{[]string{"Core", "Shell", "Prompts"}, nil, []string{"starship"}, 9},
+		{[]string{"Media"}, nil, []string{"vlc"}, 11},
+	}
+
+	var got []section
+	for _, s := range f.Sections {
+		var entries []string
+		for _, entry := range s.Entries {
+			entries = append(entries, entry.Name)
+		}
+		var categories []string
+		if len(s.Categories) > 0 {
+			categories = s.Categories
+		}
+		got = append(got, section{categories, s.Annotations, entries, s.Line})
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() sections = %+v, want %+v", got, want)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		src  string
+		want brewfile.Error
+	}{
+		{"unquoted name", "brew git\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 6}, Msg: `expected a quoted name after brew, got "git"`}},
+		{"empty name", "\ncask \"\"\n", brewfile.Error{Pos: brewfile.Position{Line: 2, Column: 6}, Msg: "empty cask name"}},
+		{"mas without id", "mas \"Xcode\"\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 5}, Msg: `mas "Xcode" without an id`}},
+		{"invalid mas id", "mas \"Xcode\", id: \"x\"\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 18}, Msg: `mas id must be a positive integer, got "x"`}},
+		{"positional argument", "brew \"a\", \"b\"\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 11}, Msg: `unexpected positional argument "b"`}},
+		{"unsupported directive", "brew \"a\"\ninstall \"b\"\n", brewfile.Error{Pos: brewfile.Position{Line: 2, Column: 1}, Msg: `unsupported directive "install"`}},
+		{"if without end", "if OS.mac?\n  brew \"a\"\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 1}, Msg: "if without end"}},
+		{"if without condition", "if\nend\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 1}, Msg: "if without a condition"}},
+		{"end without if", "end\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 1}, Msg: "end without if"}},
+		{"else without if", "brew \"a\"\n  else\n", brewfile.Error{Pos: brewfile.Position{Line: 2, Column: 3}, Msg: "else without if"}},
+		{"unterminated string", "brew \"a\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 6}, Msg: "unterminated string"}},
+		{"interpolation", "brew \"#{name}\"\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 6}, Msg: "string interpolation is not supported"}},
+		{"unclosed array", "brew \"a\", args: [\"x\",\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 17}, Msg: "unclosed ["}},
+		{"missing comma", "brew \"a\", args: [\"x\" \"y\"]\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 22}, Msg: `expected , or ], got "y"`}},
+		{"unexpected character", "brew \"a\" @\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 10}, Msg: "unexpected character '@'"}},
+		{"trailing tokens", "brew \"a\" true\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 10}, Msg: `unexpected "true"`}},
+		{"invalid annotation", "# Core #: tags\n", brewfile.Error{Pos: brewfile.Position{Line: 1, Column: 1}, Msg: "invalid annotation: tags"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := brewfile.Parse(tt.src)
+
+			var got *brewfile.Error
+			if !errors.As(err, &got) {
+				t.Fatalf("Parse() error = %v, want a *brewfile.Error", err)
+			}
+			if *got != tt.want {
+				t.Errorf("Parse() error = %v, want %v", got, &tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package classify
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RulesFileName is the name of the rules file looked up next to packages.yaml
+const RulesFileName = "classify.yaml"
+
+//go:embed default_rules.yaml
+var defaultRules []byte
+
+// Matcher selects packages. Every field that is set must match.
+type Matcher struct {
+	Names []string `yaml:"names,omitempty"` // Exact names, case-insensitive
+	Glob  string   `yaml:"glob,omitempty"`  // Shell-style pattern; * and ? also match "/"
+	Regex string   `yaml:"regex,omitempty"` // Regular expression against the lower-cased name
+	Type  string   `yaml:"type,omitempty"`  // Package type: tap, brew, cask, mas, vscode, go, cargo or npm
+
+	// Description is a regular expression against the lower-cased package description from the
+	// metadata cache; it never matches packages without a cached description
+	Description string `yaml:"description,omitempty"`
+}
+
+// Rule maps the packages selected by a matcher to a group and tags
+type Rule struct {
+	Name  string   `yaml:"name,omitempty"`
+	Match Matcher  `yaml:"match"`
+	Group string   `yaml:"group,omitempty"`
+	Tags  []string `yaml:"tags,omitempty"`
+}
+
+// GroupDefinition describes a group created for classified packages
+type GroupDefinition struct {
+	Description string `yaml:"description"`
+	Priority    int    `yaml:"priority"`
+}
+
+// Rules is the content of a rules file
+type Rules struct {
+	DefaultGroup string                     `yaml:"default_group"`
+	Groups       map[string]GroupDefinition `yaml:"groups,omitempty"`
+	TypeTags     map[string][]string        `yaml:"type_tags,omitempty"`
+	Rules        []Rule                     `yaml:"rules"`
+}
+
+// Decision is the outcome of classifying a package, with the rules that produced it
+type Decision struct {
+	Group     string   `json:"group" yaml:"group"`
+	Tags      []string `json:"tags" yaml:"tags"`
+	GroupRule string   `json:"group_rule,omitempty" yaml:"group_rule,omitempty"` // Rule that decided the group; empty when the default group was used
+	Matched   []string `json:"matched" yaml:"matched"`                           // Every matching rule, in order
+}
+
+// Classifier assigns groups and tags to packages using rules
+type Classifier struct {
+	Rules  *Rules
+	Source string // Path of the rules file, or "built-in defaults"
+
+	patterns     []*regexp.Regexp // Compiled glob or regex of each rule, nil when unset
+	descriptions []*regexp.Regexp // Compiled description pattern of each rule, nil when unset
+}
+
+// DefaultPath returns the rules file path for a YAML configuration
+func DefaultPath(yamlFile string) string {
+	return filepath.Join(filepath.Dir(yamlFile), RulesFileName)
+}
+
+// DefaultRules returns the built-in rules file content
+func DefaultRules() []byte {
+	return defaultRules
+}
+
+// Load loads rules from a file, falling back to the built-in defaults when it does not exist
+func Load(filePath string) (*Classifier, error) {
+	if filePath == "" || !utils.FileExists(filePath) {
+		return Default()
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	c, err := parse(data, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return c, nil
+}
+
+// Default returns a classifier with the built-in rules
+func Default() (*Classifier, error) {
+	c, err := parse(defaultRules, "built-in defaults")
+	if err != nil {
+		return nil, fmt.Errorf("invalid built-in classification rules: %w", err)
+	}
+	return c, nil
+}
+
+// parse parses and compiles rules
+func parse(data []byte, source string) (*Classifier, error) {
+	var rules Rules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	if rules.DefaultGroup == "" {
+		rules.DefaultGroup = "optional"
+	}
+
+	c := &Classifier{Rules: &rules, Source: source}
+	for i, rule := range rules.Rules {
+		m := rule.Match
+		if len(m.Names) == 0 && m.Glob == "" && m.Regex == "" && m.Type == "" && m.Description == "" {
+			return nil, fmt.Errorf("%s has an empty match", ruleLabel(i, rule))
+		}
+		if m.Glob != "" && m.Regex != "" {
+			return nil, fmt.Errorf("%s sets both glob and regex", ruleLabel(i, rule))
+		}
+
+		var pattern *regexp.Regexp
+		var err error
+		switch {
+		case m.Glob != "":
+			pattern, err = regexp.Compile(globToRegexp(strings.ToLower(m.Glob)))
+		case m.Regex != "":
+			pattern, err = regexp.Compile(m.Regex)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern: %w", ruleLabel(i, rule), err)
+		}
+		c.patterns = append(c.patterns, pattern)
+
+		var description *regexp.Regexp
+		if m.Description != "" {
+			if description, err = regexp.Compile(m.Description); err != nil {
+				return nil, fmt.Errorf("%s: invalid description pattern: %w", ruleLabel(i, rule), err)
+			}
+		}
+		c.descriptions = append(c.descriptions, description)
+	}
+
+	return c, nil
+}
+
+// Classify decides the group and tags of a package. description may be empty when it is unknown.
+func (c *Classifier) Classify(name, pkgType, description string) Decision {
+	lower := strings.ToLower(name)
+	lowerDescription := strings.ToLower(description)
+	decision := Decision{Group: c.Rules.DefaultGroup}
+
+	for i, rule := range c.Rules.Rules {
+		if !c.matches(i, lower, pkgType, lowerDescription) {
+			continue
+		}
+		label := ruleLabel(i, rule)
+		decision.Matched = append(decision.Matched, label)
+		if rule.Group != "" && decision.GroupRule == "" {
+			decision.Group = rule.Group
+			decision.GroupRule = label
+		}
+		decision.Tags = append(decision.Tags, rule.Tags...)
+	}
+
+	decision.Tags = utils.UniqueStrings(append(decision.Tags, c.Rules.TypeTags[pkgType]...))
+	return decision
+}
+
+// Group returns the definition of a group, or a generic one for groups the rules do not define
+func (c *Classifier) Group(name string) GroupDefinition {
+	if def, ok := c.Rules.Groups[name]; ok {
+		return def
+	}
+	return GroupDefinition{
+		Description: fmt.Sprintf("Auto-created group for %s", name),
+		Priority:    5, // Default priority for auto-created groups
+	}
+}
+
+// matches reports whether rule i matches a package type and a lower-cased package name and description
+func (c *Classifier) matches(i int, lower, pkgType, description string) bool {
+	m := c.Rules.Rules[i].Match
+
+	if m.Type != "" && m.Type != pkgType {
+		return false
+	}
+	if len(m.Names) > 0 {
+		found := false
+		for _, candidate := range m.Names {
+			if strings.ToLower(candidate) == lower {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if c.patterns[i] != nil && !c.patterns[i].MatchString(lower) {
+		return false
+	}
+	if c.descriptions[i] != nil && (description == "" || !c.descriptions[i].MatchString(description)) {
+		return false
+	}
+	return true
+}
+
+// ruleLabel names a rule for reports: its name, or its position in the file
+func ruleLabel(i int, rule Rule) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return fmt.Sprintf("rule %d", i+1)
+}
+
+// globToRegexp converts a shell-style glob into an anchored regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
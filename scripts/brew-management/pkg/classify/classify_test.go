@@ -0,0 +1,270 @@
+package classify_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/classify"
+)
+
+const rules = `default_group: misc
+groups:
+  tools:
+    description: Tools
+    priority: 3
+type_tags:
+  cask: [application]
+rules:
+  - name: exact
+    match:
+      names: [Git, gh]
+    group: tools
+    tags: [vcs]
+  - name: glob
+    match:
+      glob: 'owner/*'
+    group: tapped
+  - name: regex
+    match:
+      regex: '^python(@.*)?$'
+    group: languages
+    tags: [python]
+  - name: type
+    match:
+      type: vscode
+    group: editor
+  - name: type and names
+    match:
+      type: cask
+      names: [git]
+    group: never
+  - name: description
+    match:
+      description: '\bweb browser\b'
+    group: browsers
+  - match:
+      glob: '*'
+    tags: [all]
+  - name: late
+    match:
+      names: [gh]
+    group: late
+    tags: [cli]
+`
+
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), classify.RulesFileName)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestDefault(t *testing.T) {
+	t.Parallel()
+
+	c, err := classify.Default()
+	if err != nil {
+		t.Fatalf("Default() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		pkgName   string
+		pkgType   string
+		wantGroup string
+		wantRule  string
+	}{
+		{"go", "go", "brew", "development", "go"},
+		{"versioned go", "go@1.22", "brew", "development", "go"},
+		{"go does not match google-chrome", "google-chrome", "cask", "productivity", "chrome"},
+		{"go does not match mongosh", "mongosh", "brew", "optional", ""},
+		{"type rule before name rules", "golang.go", "vscode", "development", "editor-extensions"},
+		{"tap-qualified formula", "hashicorp/tap/terraform", "brew", "development", "terraform"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := c.Classify(tt.pkgName, tt.pkgType, "")
+			if got.Group != tt.wantGroup || got.GroupRule != tt.wantRule {
+				t.Errorf("Classify() = %s by %q, want %s by %q", got.Group, got.GroupRule, tt.wantGroup, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	c, err := classify.Load(writeRules(t, rules))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		pkgName     string
+		pkgType     string
+		description string
+		want        classify.Decision
+	}{
+		{
+			"exact names ignore case",
+			"GIT",
+			"brew",
+			"",
+			classify.Decision{Group: "tools", Tags: []string{"vcs", "all"}, GroupRule: "exact", Matched: []string{"exact", "rule 7"}},
+		},
+		{
+			"first matching rule decides the group, tags come from every rule",
+			"gh",
+			"brew",
+			"",
+			classify.Decision{Group: "tools", Tags: []string{"vcs", "all", "cli"}, GroupRule: "exact", Matched: []string{"exact", "rule 7", "late"}},
+		},
+		{
+			"glob matches slashes",
+			"owner/tap/tool",
+			"brew",
+			"",
+			classify.Decision{Group: "tapped", Tags: []string{"all"}, GroupRule: "glob", Matched: []string{"glob", "rule 7"}},
+		},
+		{
+			"regex",
+			"python@3.12",
+			"brew",
+			"",
+			classify.Decision{Group: "languages", Tags: []string{"python", "all"}, GroupRule: "regex", Matched: []string{"regex", "rule 7"}},
+		},
+		{
+			"regex is anchored by the rule",
+			"micropython",
+			"brew",
+			"",
+			classify.Decision{Group: "misc", Tags: []string{"all"}, Matched: []string{"rule 7"}},
+		},
+		{
+			"type",
+			"golang.go",
+			"vscode",
+			"",
+			classify.Decision{Group: "editor", Tags: []string{"all"}, GroupRule: "type", Matched: []string{"type", "rule 7"}},
+		},
+		{
+			"every matcher of a rule must match",
+			"git",
+			"cask",
+			"",
+			classify.Decision{Group: "tools", Tags: []string{"vcs", "all", "application"}, GroupRule: "exact", Matched: []string{"exact", "type and names", "rule 7"}},
+		},
+		{
+			"description",
+			"zen",
+			"cask",
+			"Privacy-focused Web Browser",
+			classify.Decision{Group: "browsers", Tags: []string{"all", "application"}, GroupRule: "description", Matched: []string{"description", "rule 7"}},
+		},
+		{
+			"unknown description",
+			"zen",
+			"cask",
+			"",
+			classify.Decision{Group: "misc", Tags: []string{"all", "application"}, Matched: []string{"rule 7"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := c.Classify(tt.pkgName, tt.pkgType, tt.description); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Classify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		content    string
+		wantSource string
+		wantErr    bool
+	}{
+		{"rules file", rules, "", false},
+		{"missing file", "", "built-in defaults", false},
+		{"default group", "rules: []\n", "", false},
+		{"invalid YAML", "rules: [\n", "", true},
+		{"empty match", "rules:\n  - group: tools\n    match: {}\n", "", true},
+		{"glob and regex", "rules:\n  - match:\n      glob: 'a*'\n      regex: '^a'\n", "", true},
+		{"invalid regex", "rules:\n  - match:\n      regex: '('\n", "", true},
+		{"invalid description", "rules:\n  - match:\n      description: '['\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), classify.RulesFileName)
+			if tt.content != "" {
+				path = writeRules(t, tt.content)
+			}
+
+			c, err := classify.Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			wantSource := tt.wantSource
+			if wantSource == "" {
+				wantSource = path
+			}
+			if c.Source != wantSource {
+				t.Errorf("Load() source = %q, want %q", c.Source, wantSource)
+			}
+			if c.Rules.DefaultGroup == "" {
+				t.Error("Load() left the default group empty")
+			}
+		})
+	}
+}
+
+func TestClassifier_Group(t *testing.T) {
+	t.Parallel()
+
+	c, err := classify.Load(writeRules(t, rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		group string
+		want  classify.GroupDefinition
+	}{
+		{"defined group", "tools", classify.GroupDefinition{Description: "Tools", Priority: 3}},
+		{"undefined group", "tapped", classify.GroupDefinition{Description: "Auto-created group for tapped", Priority: 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := c.Group(tt.group); got != tt.want {
+				t.Errorf("Classifier.Group() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,20 +1,22 @@
 package convert
 
 import (
-	"bufio"
 	"fmt"
-	"os"
-	"regexp"
+	"path/filepath"
 	"strconv"
 	"strings"
 
-	"brew-manager/pkg/types"
-	"brew-manager/pkg/utils"
-	yamlPkg "brew-manager/pkg/yaml"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brewfile"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/classify"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/metadata"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
 )
 
-// ConvertBrewfileToYAML converts a Brewfile to YAML format
-func ConvertBrewfileToYAML(brewfilePath, yamlPath string, grouped bool, verbose bool) error {
+// ConvertBrewfileToYAML converts a Brewfile to YAML format, classifying packages with the rules in rulesFile
+// (the built-in rules when it does not exist). Descriptions are taken from meta, which may be nil.
+func ConvertBrewfileToYAML(brewfilePath, yamlPath, rulesFile string, meta *metadata.Cache, grouped bool, verbose bool) error {
 	if !utils.FileExists(brewfilePath) {
 		return fmt.Errorf("Brewfile not found: %s", brewfilePath)
 	}
@@ -24,13 +26,22 @@ func ConvertBrewfileToYAML(brewfilePath, yamlPath string, grouped bool, verbose
 	}
 
 	// Parse Brewfile
-	brewfileData, err := parseBrewfile(brewfilePath, verbose)
+	brewfileData, err := brewfile.ParseFile(brewfilePath)
 	if err != nil {
 		return fmt.Errorf("failed to parse Brewfile: %w", err)
 	}
 
+	classifier, err := classify.Load(rulesFile)
+	if err != nil {
+		return fmt.Errorf("failed to load classification rules: %w", err)
+	}
+
 	// Convert to grouped format (only supported format now)
-	groupedConfig := convertToGroupedFormat(brewfileData, verbose)
+	groupedConfig, err := convertToGroupedFormat(brewfileData, classifier, meta, verbose)
+	if err != nil {
+		return fmt.Errorf("failed to convert Brewfile: %w", err)
+	}
+	yamlPkg.SortPackages(groupedConfig)
 	if err := yamlPkg.SaveGroupedConfig(groupedConfig, yamlPath); err != nil {
 		return fmt.Errorf("failed to save grouped YAML: %w", err)
 	}
@@ -39,234 +50,228 @@ func ConvertBrewfileToYAML(brewfilePath, yamlPath string, grouped bool, verbose
 	return nil
 }
 
-// BrewfileData represents parsed Brewfile content
-type BrewfileData struct {
-	Taps    []string
-	Brews   []string
-	Casks   []string
-	MasApps []types.MasApp
-}
+// convertToGroupedFormat converts a parsed Brewfile to grouped YAML format. Each heading section becomes a group
+// named after its heading path and its packages are tagged with the heading of each level; annotations
+// written by export take precedence. Entries before the first heading are grouped and tagged with classifier.
+// Descriptions that are not annotated come from meta.
+func convertToGroupedFormat(data *brewfile.File, classifier *classify.Classifier, meta *metadata.Cache, verbose bool) (*types.PackageGrouped, error) {
+	if verbose {
+		utils.PrintStatus(utils.Blue, fmt.Sprintf("Converting to grouped YAML format with rules from %s", classifier.Source))
+	}
 
-// parseBrewfile parses a Brewfile and extracts package information
-func parseBrewfile(filePath string, verbose bool) (*BrewfileData, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open Brewfile: %w", err)
+	config := &types.PackageGrouped{
+		Groups:   make(map[string]types.Group),
+		Profiles: make(map[string]types.Profile),
 	}
-	defer file.Close()
 
-	data := &BrewfileData{
-		Taps:    []string{},
-		Brews:   []string{},
-		Casks:   []string{},
-		MasApps: []types.MasApp{},
+	// Packages outside of any heading are classified, so the groups defined by the rules are initialized
+	classified := len(data.Sections) > 0 && len(data.Sections[0].Entries) > 0
+	if classified {
+		for name, def := range classifier.Rules.Groups {
+			config.Groups[name] = types.Group{
+				Description: def.Description,
+				Priority:    def.Priority,
+				Packages:    make(map[string][]types.PackageInfo), // Initialize the map
+			}
+		}
 	}
 
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
-
-	// Regex patterns for different types
-	tapRegex := regexp.MustCompile(`^tap\s+["']?([^"'\s]+)["']?`)
-	brewRegex := regexp.MustCompile(`^brew\s+["']?([^"'\s]+)["']?`)
-	caskRegex := regexp.MustCompile(`^cask\s+["']?([^"'\s]+)["']?`)
-	masRegex := regexp.MustCompile(`^mas\s+["']?([^"']+?)["']?\s*,\s*id:\s*(\d+)`)
-
-	for scanner.Scan() {
-		lineNum++
-		line := strings.TrimSpace(scanner.Text())
-		
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
+	headed := 0 // Number of groups created from headings, for default priorities
+	for _, section := range data.Sections {
+		groupName, exists := section.Annotations.Get("group")
+		// Headings without packages only nest other headings, unless annotated as a group
+		if len(section.Categories) == 0 || (len(section.Entries) == 0 && !exists) {
 			continue
 		}
-
-		if verbose {
-			utils.PrintStatus(utils.Cyan, fmt.Sprintf("Processing line %d: %s", lineNum, line))
+		if !exists {
+			groupName = headingGroupName(section.Categories)
 		}
 
-		// Parse tap
-		if matches := tapRegex.FindStringSubmatch(line); len(matches) > 1 {
-			data.Taps = append(data.Taps, matches[1])
-			continue
+		group, exists := config.Groups[groupName]
+		if !exists {
+			headed++
+			group = types.Group{
+				Description: section.Categories[len(section.Categories)-1],
+				Priority:    defaultPriority(headed),
+				Packages:    make(map[string][]types.PackageInfo),
+			}
+			if len(section.Categories) != 1 || section.Categories[0] != groupName {
+				group.Categories = section.Categories
+			}
+			if description, ok := section.Annotations.Get("description"); ok {
+				group.Description = description
+			}
+			if value, ok := section.Annotations.Get("priority"); ok {
+				priority, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid priority annotation: %s", section.Line, value)
+				}
+				group.Priority = priority
+			}
 		}
 
-		// Parse brew
-		if matches := brewRegex.FindStringSubmatch(line); len(matches) > 1 {
-			data.Brews = append(data.Brews, matches[1])
-			continue
+		// Packages are tagged with their headings unless the section or the entry says otherwise
+		sectionTags := headingTags(section.Categories)
+		if tags, ok := section.Annotations.Get("tags"); ok {
+			sectionTags = utils.SplitCommaSeparated(tags)
 		}
 
-		// Parse cask
-		if matches := caskRegex.FindStringSubmatch(line); len(matches) > 1 {
-			data.Casks = append(data.Casks, matches[1])
-			continue
+		for _, entry := range section.Entries {
+			if !supportedEntry(entry) {
+				continue
+			}
+			pkgInfo := types.PackageInfo{
+				Name:    entry.Name,
+				ID:      entry.ID,
+				Tags:    sectionTags,
+				Options: entry.Options,
+			}
+			if tags, ok := entry.Annotations.Get("tags"); ok {
+				pkgInfo.Tags = utils.SplitCommaSeparated(tags)
+			}
+			pkgInfo.Description, _ = entry.Annotations.Get("description")
+			if pkgInfo.Description == "" {
+				pkgInfo.Description = meta.Description(entry.Type, entry.Name)
+			}
+			pkgInfo.Version, _ = entry.Annotations.Get("version")
+
+			group.Packages[entry.Type] = append(group.Packages[entry.Type], pkgInfo)
+			if verbose {
+				utils.PrintStatus(utils.Cyan, fmt.Sprintf("Added %s '%s' to group '%s' with tags: %v", entry.Type, entry.Name, groupName, pkgInfo.Tags))
+			}
 		}
+		config.Groups[groupName] = group
+	}
 
-		// Parse mas
-		if matches := masRegex.FindStringSubmatch(line); len(matches) > 2 {
-			id, err := strconv.ParseInt(matches[2], 10, 64)
-			if err != nil {
-				utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: Invalid mas ID on line %d: %s", lineNum, matches[2]))
+	if classified {
+		for _, entry := range data.Sections[0].Entries {
+			if !supportedEntry(entry) {
 				continue
 			}
-			data.MasApps = append(data.MasApps, types.MasApp{
-				Name: matches[1],
-				ID:   id,
-			})
-			continue
-		}
+			pkgInfo := types.PackageInfo{Name: entry.Name, ID: entry.ID, Options: entry.Options}
+			pkgInfo.Description = meta.Description(entry.Type, pkgInfo.Name)
+			decision := classifier.Classify(pkgInfo.Name, entry.Type, pkgInfo.Description)
+			pkgInfo.Tags = decision.Tags
+
+			group, exists := config.Groups[decision.Group]
+			if !exists {
+				def := classifier.Group(decision.Group)
+				group = types.Group{
+					Description: def.Description,
+					Priority:    def.Priority,
+					Packages:    make(map[string][]types.PackageInfo),
+				}
+			}
+			group.Packages[entry.Type] = append(group.Packages[entry.Type], pkgInfo)
+			config.Groups[decision.Group] = group // Update the map with the modified group
 
-		// Unknown line format
-		if verbose {
-			utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: Unrecognized line format on line %d: %s", lineNum, line))
+			if verbose {
+				utils.PrintStatus(utils.Cyan, fmt.Sprintf("Added %s '%s' to group '%s' with tags: %v", entry.Type, pkgInfo.Name, decision.Group, pkgInfo.Tags))
+			}
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading Brewfile: %w", err)
+	// Profiles annotated by export, or the default profiles for classified packages
+	for _, annotations := range data.Annotations {
+		name, ok := annotations.Get("profile")
+		if !ok {
+			continue
+		}
+		config.Profiles[name] = profileFromAnnotations(annotations)
 	}
-
-	if verbose {
-		utils.PrintStatus(utils.Green, fmt.Sprintf("Parsed %d taps, %d brews, %d casks, %d mas apps", 
-			len(data.Taps), len(data.Brews), len(data.Casks), len(data.MasApps)))
+	if len(config.Profiles) == 0 && classified {
+		config.Profiles = map[string]types.Profile{
+			"minimal": {
+				Description: "Minimal development setup",
+				Groups:      []string{"core"},
+				Tags:        []string{"essential"},
+			},
+			"developer": {
+				Description: "Full development environment",
+				Groups:      []string{"core", "development"},
+				ExcludeTags: []string{"experimental"},
+			},
+			"full": {
+				Description: "Complete setup with all tools",
+				Groups:      []string{"core", "development", "productivity", "creative", "system"},
+			},
+		}
 	}
 
-	return data, nil
+	return config, nil
 }
 
-
-
-// convertToGroupedFormat converts BrewfileData to grouped YAML format
-func convertToGroupedFormat(data *BrewfileData, verbose bool) *types.PackageGrouped {
-	if verbose {
-		utils.PrintStatus(utils.Blue, "Converting to grouped YAML format with auto-detection")
+// supportedEntry reports whether an entry can be converted, warning about entries that cannot be
+// converted and conditions that are dropped
+func supportedEntry(entry brewfile.Entry) bool {
+	switch entry.Type {
+	case "tap", "brew", "cask", "mas", "vscode", "go", "cargo":
+	default:
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: line %d: %s entries are not supported in YAML configuration, skipping %s",
+			entry.Pos.Line, entry.Type, entry.Name))
+		return false
 	}
 
-	config := &types.PackageGrouped{
-		Groups:   make(map[string]types.Group),
-		Profiles: make(map[string]types.Profile),
+	if entry.Condition != "" {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: line %d: %s %s is only installed if %s; the condition is not kept",
+			entry.Pos.Line, entry.Type, entry.Name, entry.Condition))
 	}
+	return true
+}
 
-	// Initialize groups with the new Packages structure
-	initializedGroups := make(map[string]types.Group)
-	groupDefinitions := map[string]struct {
-		description string
-		priority    int
-	}{
-		"core":         {"Essential development tools", 1},
-		"development":  {"Development tools and environments", 2},
-		"productivity": {"Productivity and office applications", 3},
-		"creative":     {"Creative and multimedia tools", 4},
-		"system":       {"System utilities and tools", 5},
-		"optional":     {"Optional and uncategorized tools", 10},
-	}
+// IsBrewfile reports whether a file is a Brewfile by its name: Brewfile, *.Brewfile or *.brewfile
+func IsBrewfile(filePath string) bool {
+	base := filepath.Base(filePath)
+	return base == "Brewfile" || strings.HasSuffix(strings.ToLower(base), ".brewfile")
+}
 
-	for name, def := range groupDefinitions {
-		initializedGroups[name] = types.Group{
-			Description: def.description,
-			Priority:    def.priority,
-			Packages:    make(map[string][]types.PackageInfo), // Initialize the map
+// headingGroupName returns the group name for a heading path, e.g. "tools-usual-tools" for Tools > Usual Tools
+func headingGroupName(categories []string) string {
+	var parts []string
+	for _, category := range categories {
+		if slug := brewfile.Slug(category); slug != "" {
+			parts = append(parts, slug)
 		}
 	}
-
-	// Add taps
-	for _, tapName := range data.Taps {
-		groupName := utils.AutoDetectGroup(tapName, "tap")
-		tags := utils.AutoDetectTags(tapName, "tap")
-		
-		pkgInfo := types.PackageInfo{
-			Name: tapName,
-			Tags: tags,
-		}
-		
-		group := initializedGroups[groupName] // Get the group
-		group.Packages["tap"] = append(group.Packages["tap"], pkgInfo) // Append to the 'tap' type slice
-		initializedGroups[groupName] = group // Update the map with the modified group
-		
-		if verbose {
-			utils.PrintStatus(utils.Cyan, fmt.Sprintf("Added tap '%s' to group '%s' with tags: %v", tapName, groupName, tags))
-		}
+	if len(parts) == 0 {
+		return "uncategorized"
 	}
+	return strings.Join(parts, "-")
+}
 
-	// Add brews
-	for _, brewName := range data.Brews {
-		groupName := utils.AutoDetectGroup(brewName, "brew")
-		tags := utils.AutoDetectTags(brewName, "brew")
-		
-		pkgInfo := types.PackageInfo{
-			Name: brewName,
-			Tags: tags,
-		}
-		
-		group := initializedGroups[groupName]
-		group.Packages["brew"] = append(group.Packages["brew"], pkgInfo)
-		initializedGroups[groupName] = group
-		
-		if verbose {
-			utils.PrintStatus(utils.Cyan, fmt.Sprintf("Added brew '%s' to group '%s' with tags: %v", brewName, groupName, tags))
+// headingTags returns the tags of packages under a heading path: the slug of each heading
+func headingTags(categories []string) []string {
+	var tags []string
+	for _, category := range categories {
+		if slug := brewfile.Slug(category); slug != "" {
+			tags = append(tags, slug)
 		}
 	}
+	return utils.UniqueStrings(tags)
+}
 
-	// Add casks
-	for _, caskName := range data.Casks {
-		groupName := utils.AutoDetectGroup(caskName, "cask")
-		tags := utils.AutoDetectTags(caskName, "cask")
-		
-		pkgInfo := types.PackageInfo{
-			Name: caskName,
-			Tags: tags,
-		}
-		
-		group := initializedGroups[groupName]
-		group.Packages["cask"] = append(group.Packages["cask"], pkgInfo)
-		initializedGroups[groupName] = group
-		
-		if verbose {
-			utils.PrintStatus(utils.Cyan, fmt.Sprintf("Added cask '%s' to group '%s' with tags: %v", caskName, groupName, tags))
-		}
-	}
+// defaultPriority returns the priority of the nth group created from headings, so groups install in file order
+func defaultPriority(n int) int {
+	return min(n, 99)
+}
 
-	// Add mas apps
-	for _, app := range data.MasApps {
-		groupName := utils.AutoDetectGroup(app.Name, "mas")
-		tags := utils.AutoDetectTags(app.Name, "mas")
-		
-		pkgInfo := types.PackageInfo{
-			Name: app.Name,
-			Tags: tags,
-			ID:   app.ID,
-		}
-		
-		group := initializedGroups[groupName]
-		group.Packages["mas"] = append(group.Packages["mas"], pkgInfo)
-		initializedGroups[groupName] = group
-		
-		if verbose {
-			utils.PrintStatus(utils.Cyan, fmt.Sprintf("Added mas app '%s' to group '%s' with tags: %v", app.Name, groupName, tags))
-		}
+// profileFromAnnotations builds a profile from a profile annotation line
+func profileFromAnnotations(annotations brewfile.Annotations) types.Profile {
+	list := func(key string) []string {
+		value, _ := annotations.Get(key)
+		return utils.SplitCommaSeparated(value)
 	}
 
-	config.Groups = initializedGroups // Assign the fully populated groups to the config
-
-	// Add default profiles
-	config.Profiles = map[string]types.Profile{
-		"minimal": {
-			Description: "Minimal development setup",
-			Groups:      []string{"core"},
-			Tags:        []string{"essential"},
-		},
-		"developer": {
-			Description: "Full development environment",
-			Groups:      []string{"core", "development"},
-			ExcludeTags: []string{"experimental"},
-		},
-		"full": {
-			Description: "Complete setup with all tools",
-			Groups:      []string{"core", "development", "productivity", "creative", "system"},
-		},
+	description, _ := annotations.Get("description")
+	return types.Profile{
+		Description:     description,
+		Groups:          list("groups"),
+		Tags:            list("tags"),
+		ExcludeTags:     list("exclude_tags"),
+		Extends:         list("extends"),
+		ExcludeGroups:   list("exclude_groups"),
+		ExcludePackages: list("exclude_packages"),
 	}
-
-	return config
 }
 
 // ValidateBrewfile validates the syntax of a Brewfile
@@ -279,7 +284,7 @@ func ValidateBrewfile(filePath string, verbose bool) error {
 		utils.PrintStatus(utils.Blue, fmt.Sprintf("Validating Brewfile: %s", filePath))
 	}
 
-	_, err := parseBrewfile(filePath, verbose)
+	_, err := brewfile.ParseFile(filePath)
 	if err != nil {
 		utils.PrintStatus(utils.Red, fmt.Sprintf("❌ Invalid Brewfile: %v", err))
 		return err
@@ -0,0 +1,198 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brew"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brewfile"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+// brewfileTypes are the package types a Brewfile can declare; npm packages have no Brewfile entry
+var brewfileTypes = map[string]bool{
+	"tap":    true,
+	"brew":   true,
+	"cask":   true,
+	"mas":    true,
+	"vscode": true,
+	"go":     true,
+	"cargo":  true,
+}
+
+// Unexportable returns the packages that ExportBrewfile leaves out, as "type:name"
+func Unexportable(config *types.PackageGrouped) []string {
+	var names []string
+	for _, group := range config.Groups {
+		for pkgType, pkgInfos := range group.Packages {
+			if brewfileTypes[pkgType] {
+				continue
+			}
+			for _, pkgInfo := range pkgInfos {
+				names = append(names, pkgType+":"+pkgInfo.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExportBrewfile converts grouped YAML configuration to a Brewfile, the reverse of ConvertBrewfileToYAML.
+// Groups become heading sections in priority order. Settings a Brewfile cannot express (group names,
+// descriptions, priorities, tags, versions and profiles) are written as annotations when they differ from
+// what converting the Brewfile would derive, so converting the result back yields the same configuration.
+// npm packages, which a Brewfile cannot declare, are left out.
+func ExportBrewfile(config *types.PackageGrouped) *brewfile.File {
+	f := &brewfile.File{}
+
+	groupNames := make([]string, 0, len(config.Groups))
+	for name := range config.Groups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Slice(groupNames, func(i, j int) bool {
+		gi, gj := config.Groups[groupNames[i]], config.Groups[groupNames[j]]
+		if gi.Priority != gj.Priority {
+			return gi.Priority < gj.Priority
+		}
+		return groupNames[i] < groupNames[j]
+	})
+
+	for i, name := range groupNames {
+		group := config.Groups[name]
+		categories := group.Categories
+		if len(categories) == 0 {
+			categories = []string{name}
+		}
+
+		section := brewfile.Section{Categories: categories}
+		tags := commonTags(group)
+		empty := true
+		for _, pkgType := range brew.InstallOrder {
+			if !brewfileTypes[pkgType] {
+				continue
+			}
+			for _, pkgInfo := range group.Packages[pkgType] {
+				section.Entries = append(section.Entries, exportEntry(pkgType, pkgInfo, tags))
+				empty = false
+			}
+		}
+
+		// Empty groups are kept by naming them explicitly
+		if headingGroupName(categories) != name || empty {
+			section.Annotations = append(section.Annotations, brewfile.Annotation{Key: "group", Value: name})
+		}
+		if group.Description != categories[len(categories)-1] {
+			section.Annotations = append(section.Annotations, brewfile.Annotation{Key: "description", Value: group.Description})
+		}
+		if group.Priority != defaultPriority(i+1) {
+			section.Annotations = append(section.Annotations, brewfile.Annotation{Key: "priority", Value: strconv.Itoa(group.Priority)})
+		}
+		if !empty && strings.Join(tags, ",") != strings.Join(headingTags(categories), ",") {
+			section.Annotations = append(section.Annotations, brewfile.Annotation{Key: "tags", Value: strings.Join(tags, ",")})
+		}
+
+		f.Sections = append(f.Sections, section)
+	}
+
+	profileNames := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		profileNames = append(profileNames, name)
+	}
+	sort.Strings(profileNames)
+
+	for _, name := range profileNames {
+		profile := config.Profiles[name]
+		annotations := brewfile.Annotations{
+			{Key: "profile", Value: name},
+			{Key: "description", Value: profile.Description},
+		}
+		for _, list := range []struct {
+			key    string
+			values []string
+		}{
+			{"groups", profile.Groups},
+			{"tags", profile.Tags},
+			{"exclude_tags", profile.ExcludeTags},
+			{"extends", profile.Extends},
+			{"exclude_groups", profile.ExcludeGroups},
+			{"exclude_packages", profile.ExcludePackages},
+		} {
+			if len(list.values) > 0 {
+				annotations = append(annotations, brewfile.Annotation{Key: list.key, Value: strings.Join(list.values, ",")})
+			}
+		}
+		f.Annotations = append(f.Annotations, annotations)
+	}
+
+	return f
+}
+
+// commonTags returns the most common tag list of a group's packages, written once for the whole section
+func commonTags(group types.Group) []string {
+	counts := make(map[string]int)
+	var best []string
+	bestCount := 0
+	for _, pkgType := range brew.InstallOrder {
+		if !brewfileTypes[pkgType] {
+			continue
+		}
+		for _, pkgInfo := range group.Packages[pkgType] {
+			key := strings.Join(pkgInfo.Tags, ",")
+			counts[key]++
+			if counts[key] > bestCount {
+				best, bestCount = pkgInfo.Tags, counts[key]
+			}
+		}
+	}
+	return best
+}
+
+// exportEntry converts a package to a Brewfile entry, annotating what its section does not imply
+func exportEntry(pkgType string, pkgInfo types.PackageInfo, sectionTags []string) brewfile.Entry {
+	entry := brewfile.Entry{
+		Type:    pkgType,
+		Name:    pkgInfo.Name,
+		ID:      pkgInfo.ID,
+		Options: pkgInfo.Options,
+	}
+
+	if strings.Join(pkgInfo.Tags, ",") != strings.Join(sectionTags, ",") {
+		entry.Annotations = append(entry.Annotations, brewfile.Annotation{Key: "tags", Value: strings.Join(pkgInfo.Tags, ",")})
+	}
+	if pkgInfo.Description != "" {
+		entry.Annotations = append(entry.Annotations, brewfile.Annotation{Key: "description", Value: pkgInfo.Description})
+	}
+	if pkgInfo.Version != "" {
+		entry.Annotations = append(entry.Annotations, brewfile.Annotation{Key: "version", Value: pkgInfo.Version})
+	}
+
+	return entry
+}
+
+// WriteBrewfile exports configuration to a Brewfile at outPath, or to stdout when outPath is empty
+func WriteBrewfile(config *types.PackageGrouped, source string, outPath string) error {
+	header := fmt.Sprintf("Brewfile generated by brew-manager export from %s", source)
+	f := ExportBrewfile(config)
+
+	if outPath == "" {
+		return brewfile.Write(os.Stdout, f, header)
+	}
+
+	if err := utils.EnsureDir(outPath); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	file, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create Brewfile: %w", err)
+	}
+	defer file.Close()
+
+	if err := brewfile.Write(file, f, header); err != nil {
+		return fmt.Errorf("failed to write Brewfile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package convert_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/convert"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+func TestExportBrewfile_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		config *types.PackageGrouped
+	}{
+		{
+			"derived settings",
+			&types.PackageGrouped{
+				Groups: map[string]types.Group{
+					"dev": {Description: "Dev", Priority: 10, Packages: map[string][]types.PackageInfo{
+						"brew": {{Name: "go", Tags: []string{"dev"}}},
+					}},
+					"dev-editors": {Description: "Editors", Priority: 20, Categories: []string{"Dev", "Editors"}, Packages: map[string][]types.PackageInfo{
+						"cask": {{Name: "zed", Tags: []string{"dev", "editors"}}},
+					}},
+				},
+				Profiles: map[string]types.Profile{},
+			},
+		},
+		{
+			"annotated settings",
+			&types.PackageGrouped{
+				Groups: map[string]types.Group{
+					"core": {Description: "Core tools", Priority: 1, Packages: map[string][]types.PackageInfo{
+						"tap":    {{Name: "shiron-dev/tap", Tags: []string{"cli"}}},
+						"brew":   {{Name: "git", Tags: []string{"cli"}, Description: "Distributed revision control system", Version: "2.45.0"}, {Name: "postgresql@16", Tags: []string{"db"}, Options: []string{"restart_service: true"}}},
+						"mas":    {{Name: "Xcode", ID: 497799835, Tags: []string{"cli"}}},
+						"vscode": {{Name: "golang.go", Tags: []string{}}},
+					}},
+					"empty": {Description: "Nothing yet", Priority: 50, Packages: map[string][]types.PackageInfo{}},
+				},
+				Profiles: map[string]types.Profile{
+					"work": {Description: "Work machine", Groups: []string{"core"}, ExcludeTags: []string{"db"}, ExcludePackages: []string{"mas:497799835"}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			brewfilePath := filepath.Join(dir, "Brewfile")
+			yamlPath := filepath.Join(dir, "packages.yaml")
+
+			if err := convert.WriteBrewfile(tt.config, "packages.yaml", brewfilePath); err != nil {
+				t.Fatalf("WriteBrewfile() error = %v", err)
+			}
+			if err := convert.ConvertBrewfileToYAML(brewfilePath, yamlPath, filepath.Join(dir, "classify.yaml"), nil, true, false); err != nil {
+				t.Fatalf("ConvertBrewfileToYAML() error = %v", err)
+			}
+
+			got, err := yamlPkg.LoadGroupedConfig(yamlPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The expected configuration goes through the same save and load, which settle empty lists
+			wantPath := filepath.Join(dir, "want.yaml")
+			yamlPkg.SortPackages(tt.config)
+			if err := yamlPkg.SaveGroupedConfig(tt.config, wantPath); err != nil {
+				t.Fatal(err)
+			}
+			want, err := yamlPkg.LoadGroupedConfig(wantPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ConvertBrewfileToYAML(ExportBrewfile()) = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestUnexportable(t *testing.T) {
+	t.Parallel()
+
+	config := &types.PackageGrouped{Groups: map[string]types.Group{
+		"core": {Packages: map[string][]types.PackageInfo{
+			"brew": {{Name: "git"}},
+			"npm":  {{Name: "typescript"}, {Name: "corepack"}},
+		}},
+	}}
+
+	want := []string{"npm:corepack", "npm:typescript"}
+	if got := convert.Unexportable(config); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexportable() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+package deps
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+)
+
+// Graph is the dependency graph of installed formulae, as reported by `brew deps --installed`,
+// with the formulae installed on request, as reported by `brew list --installed-on-request`.
+// A nil Graph has no edges and counts every formula as requested.
+type Graph struct {
+	deps       map[string][]string // formula -> formulae it depends on
+	dependents map[string][]string // formula -> installed formulae that depend on it
+	requested  map[string]bool     // formulae installed on request; nil when unknown
+}
+
+// Load queries the dependency graph of installed formulae and the formulae installed on request
+func Load(r runner.Runner) (*Graph, error) {
+	output, err := r.RunCommand("brew", "deps", "--installed")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query formula dependencies: %w", err)
+	}
+	g := Parse(output)
+
+	requested, err := r.RunCommand("brew", "list", "--installed-on-request")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query formulae installed on request: %w", err)
+	}
+	g.SetRequested(strings.Fields(requested))
+
+	return g, nil
+}
+
+// Parse parses `brew deps --installed` output, one "formula: dep1 dep2 ..." line per installed formula
+func Parse(output string) *Graph {
+	g := &Graph{
+		deps:       make(map[string][]string),
+		dependents: make(map[string][]string),
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		name, rest, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			continue
+		}
+		for _, dep := range strings.Fields(rest) {
+			g.deps[name] = append(g.deps[name], dep)
+			g.dependents[dep] = append(g.dependents[dep], name)
+		}
+	}
+
+	for _, names := range g.dependents {
+		sort.Strings(names)
+	}
+
+	return g
+}
+
+// Dependencies returns the formulae a formula depends on directly
+func (g *Graph) Dependencies(name string) []string {
+	if g == nil {
+		return nil
+	}
+	return g.deps[name]
+}
+
+// Dependents returns the installed formulae that depend on a formula directly
+func (g *Graph) Dependents(name string) []string {
+	if g == nil {
+		return nil
+	}
+	return g.dependents[name]
+}
+
+// IsDependency reports whether any installed formula depends on a formula
+func (g *Graph) IsDependency(name string) bool {
+	return len(g.Dependents(name)) > 0
+}
+
+// SetRequested records the formulae installed on request, one name per entry of
+// `brew list --installed-on-request` output. Unlike `brew leaves`, this keeps requested formulae
+// that other formulae also depend on.
+func (g *Graph) SetRequested(names []string) {
+	g.requested = make(map[string]bool)
+	for _, name := range names {
+		g.requested[name] = true
+	}
+}
+
+// IsRequested reports whether a formula was installed on request, even if other formulae depend on it.
+// Every formula counts as requested when the requested formulae are unknown.
+func (g *Graph) IsRequested(name string) bool {
+	if g == nil || g.requested == nil {
+		return true
+	}
+	return g.requested[name]
+}
+
+// Required returns every formula that roots depend on, directly or indirectly, excluding the roots.
+// Each one maps to the sorted formulae that need it directly and are themselves roots or required.
+func (g *Graph) Required(roots []string) map[string][]string {
+	required := make(map[string][]string)
+	if g == nil {
+		return required
+	}
+
+	isRoot := make(map[string]bool)
+	for _, root := range roots {
+		isRoot[root] = true
+	}
+
+	visited := make(map[string]bool)
+	queue := append([]string(nil), roots...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+
+		for _, dep := range g.deps[name] {
+			if isRoot[dep] {
+				continue
+			}
+			required[dep] = append(required[dep], name)
+			queue = append(queue, dep)
+		}
+	}
+
+	for dep, by := range required {
+		sort.Strings(by)
+		required[dep] = uniqueSorted(by)
+	}
+
+	return required
+}
+
+// RemovalOrder orders formulae so that each comes before the formulae it depends on,
+// so brew never refuses to uninstall a formula that is still needed by one being removed later.
+// Formulae without an ordering constraint stay alphabetical.
+func (g *Graph) RemovalOrder(names []string) []string {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	if g == nil {
+		return sorted
+	}
+
+	inSet := make(map[string]bool)
+	for _, name := range sorted {
+		inSet[name] = true
+	}
+
+	ordered := []string{}
+	done := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if done[name] {
+			return
+		}
+		done[name] = true
+		// Dependents being removed go first
+		for _, dependent := range g.dependents[name] {
+			if inSet[dependent] {
+				visit(dependent)
+			}
+		}
+		ordered = append(ordered, name)
+	}
+
+	for _, name := range sorted {
+		visit(name)
+	}
+
+	return ordered
+}
+
+// uniqueSorted removes adjacent duplicates from a sorted slice
+func uniqueSorted(names []string) []string {
+	var result []string
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			result = append(result, name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,203 @@
+package deps_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+)
+
+const output = `ca-certificates:
+gettext:
+git: gettext pcre2
+jq: oniguruma
+oniguruma:
+openssl@3: ca-certificates
+pcre2:
+ripgrep: pcre2
+wget: libidn2 openssl@3
+libidn2:
+`
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	g := deps.Parse(output + "\nmalformed line\n: orphan\n")
+
+	tests := []struct {
+		name           string
+		formula        string
+		wantDeps       []string
+		wantDependents []string
+		wantDependency bool
+	}{
+		{"dependencies in listed order", "wget", []string{"libidn2", "openssl@3"}, nil, false},
+		{"sorted dependents", "pcre2", nil, []string{"git", "ripgrep"}, true},
+		{"chain", "openssl@3", []string{"ca-certificates"}, []string{"wget"}, true},
+		{"unknown", "fd", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := g.Dependencies(tt.formula); !reflect.DeepEqual(got, tt.wantDeps) {
+				t.Errorf("Graph.Dependencies() = %v, want %v", got, tt.wantDeps)
+			}
+			if got := g.Dependents(tt.formula); !reflect.DeepEqual(got, tt.wantDependents) {
+				t.Errorf("Graph.Dependents() = %v, want %v", got, tt.wantDependents)
+			}
+			if got := g.IsDependency(tt.formula); got != tt.wantDependency {
+				t.Errorf("Graph.IsDependency() = %v, want %v", got, tt.wantDependency)
+			}
+		})
+	}
+}
+
+func TestGraph_Required(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		graph *deps.Graph
+		roots []string
+		want  map[string][]string
+	}{
+		{"no roots", deps.Parse(output), nil, map[string][]string{}},
+		{
+			"transitive dependencies",
+			deps.Parse(output),
+			[]string{"wget"},
+			map[string][]string{"libidn2": {"wget"}, "openssl@3": {"wget"}, "ca-certificates": {"openssl@3"}},
+		},
+		{
+			"shared dependency",
+			deps.Parse(output),
+			[]string{"git", "ripgrep"},
+			map[string][]string{"gettext": {"git"}, "pcre2": {"git", "ripgrep"}},
+		},
+		{
+			"roots are not required",
+			deps.Parse(output),
+			[]string{"openssl@3", "wget"},
+			map[string][]string{"libidn2": {"wget"}, "ca-certificates": {"openssl@3"}},
+		},
+		{"nil graph", nil, []string{"wget"}, map[string][]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.graph.Required(tt.roots); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Graph.Required() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraph_RemovalOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		graph *deps.Graph
+		names []string
+		want  []string
+	}{
+		{"empty", deps.Parse(output), nil, []string{}},
+		{"dependents first", deps.Parse(output), []string{"ca-certificates", "openssl@3", "wget"}, []string{"wget", "openssl@3", "ca-certificates"}},
+		{"unrelated stay alphabetical", deps.Parse(output), []string{"jq", "gettext", "fd"}, []string{"fd", "gettext", "jq"}},
+		{"dependents outside the set are ignored", deps.Parse(output), []string{"pcre2", "ripgrep"}, []string{"ripgrep", "pcre2"}},
+		{"nil graph", nil, []string{"wget", "openssl@3"}, []string{"openssl@3", "wget"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.graph.RemovalOrder(tt.names); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Graph.RemovalOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraph_IsRequested(t *testing.T) {
+	t.Parallel()
+
+	requested := deps.Parse(output)
+	requested.SetRequested([]string{"git", "jq", "openssl@3", "wget"})
+
+	tests := []struct {
+		name    string
+		graph   *deps.Graph
+		formula string
+		want    bool
+	}{
+		{"requested leaf", requested, "git", true},
+		{"requested dependency", requested, "openssl@3", true},
+		{"dependency", requested, "pcre2", false},
+		{"unknown requested formulae", deps.Parse(output), "pcre2", true},
+		{"nil graph", nil, "pcre2", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.graph.IsRequested(tt.formula); got != tt.want {
+				t.Errorf("Graph.IsRequested() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		scripts map[string]runner.Response
+		wantErr bool
+	}{
+		{"graph and requested formulae", map[string]runner.Response{
+			"deps":      {Output: output},
+			"requested": {Output: "git\njq\nopenssl@3\nripgrep\nwget\n"},
+		}, false},
+		{"failed deps", map[string]runner.Response{
+			"deps":      {ExitCode: 1},
+			"requested": {Output: "git\n"},
+		}, true},
+		{"failed requested formulae", map[string]runner.Response{
+			"deps":      {Output: output},
+			"requested": {ExitCode: 1},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := runner.NewFakeRunner()
+			fake.Script(tt.scripts["deps"], "brew", "deps", "--installed")
+			fake.Script(tt.scripts["requested"], "brew", "list", "--installed-on-request")
+
+			g, err := deps.Load(fake)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !g.IsRequested("openssl@3") || g.IsRequested("pcre2") {
+				t.Errorf("Load() requested openssl@3 = %v, pcre2 = %v, want true, false", g.IsRequested("openssl@3"), g.IsRequested("pcre2"))
+			}
+			if got := g.Dependents("pcre2"); !reflect.DeepEqual(got, []string{"git", "ripgrep"}) {
+				t.Errorf("Load() dependents of pcre2 = %v, want %v", got, []string{"git", "ripgrep"})
+			}
+		})
+	}
+}
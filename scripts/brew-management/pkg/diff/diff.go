@@ -0,0 +1,146 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lock"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/prune"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+)
+
+// Exit statuses of diff, so it can run from a login hook or a cron job
+const (
+	ExitNoDrift = 0
+	ExitDrift   = 1
+	ExitError   = 2
+)
+
+// ErrDrift is returned by Result.Err when the machine differs from the configuration
+var ErrDrift = errors.New("drift found")
+
+// Package is a package present on only one side of the diff
+type Package struct {
+	Type string `json:"type" yaml:"type"`
+	Name string `json:"name" yaml:"name"`
+	ID   int64  `json:"id,omitempty" yaml:"id,omitempty"` // For mas apps
+}
+
+// Result is the drift between the configuration and the machine
+type Result struct {
+	File         string       `json:"file" yaml:"file"`
+	Missing      []Package    `json:"missing" yaml:"missing"`           // Configured but not installed
+	Unconfigured []Package    `json:"unconfigured" yaml:"unconfigured"` // Installed but not configured
+	Versions     []lock.Drift `json:"versions" yaml:"versions"`         // Installed with another version than pinned or locked
+}
+
+// Count returns the number of drifted packages
+func (r *Result) Count() int {
+	return len(r.Missing) + len(r.Unconfigured) + len(r.Versions)
+}
+
+// Err returns nil without drift, and otherwise an error wrapping ErrDrift that counts the drift
+func (r *Result) Err() error {
+	if r.Count() == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d missing, %d unconfigured, %d version mismatches",
+		ErrDrift, len(r.Missing), len(r.Unconfigured), len(r.Versions))
+}
+
+// ExitCode returns the exit status of diff for the error it returned: ExitNoDrift for nil,
+// ExitDrift for drift and ExitError for any other failure, so callers can tell them apart
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitNoDrift
+	case errors.Is(err, ErrDrift):
+		return ExitDrift
+	default:
+		return ExitError
+	}
+}
+
+// Compute compares the filtered packages of config with the installed snapshot.
+// Packages outside the profile, groups and tags of options count as unconfigured, except
+// formulae needed by configured ones according to graph. Versions are compared with the
+// version pins and the lockfile lf, which may be nil, when versions is not nil.
+func Compute(filePath string, config *types.PackageGrouped, filteredPackages []types.FilteredPackage, installed *state.Snapshot,
+	graph *deps.Graph, lf *lock.Lockfile, versions *lock.Versions, options *types.PruneOptions) (*Result, error) {
+
+	result := &Result{File: filePath, Missing: []Package{}, Unconfigured: []Package{}, Versions: []lock.Drift{}}
+
+	for _, pkgType := range types.PackageTypes {
+		for _, pkg := range filteredPackages {
+			if pkg.Type == pkgType && !installed.IsInstalled(pkg.Type, pkg.PackageInfo) {
+				result.Missing = append(result.Missing, Package{Type: pkg.Type, Name: pkg.Name, ID: pkg.ID})
+			}
+		}
+	}
+
+	yamlPackages, err := prune.KeepSet(config, options)
+	if err != nil {
+		return nil, err
+	}
+	prune.KeepDependencies(graph, yamlPackages, installed, options)
+	unconfigured := prune.FindPackagesToRemove(yamlPackages, installed, options)
+	for _, pkgType := range types.PackageTypes {
+		for _, name := range unconfigured[pkgType] {
+			pkgInfo := prune.RemovedPackageInfo(pkgType, name)
+			result.Unconfigured = append(result.Unconfigured, Package{Type: pkgType, Name: pkgInfo.Name, ID: pkgInfo.ID})
+		}
+	}
+
+	if versions != nil {
+		if drifts, _ := lock.CheckDrift(lf, versions, filteredPackages, true); drifts != nil {
+			result.Versions = drifts
+		}
+	}
+
+	return result, nil
+}
+
+// WriteUnified writes the drift as a unified diff from the configuration to the machine,
+// with a hunk per package type
+func WriteUnified(w io.Writer, result *Result) {
+	fmt.Fprintf(w, "--- %s\n", result.File)
+	fmt.Fprintln(w, "+++ installed")
+
+	for _, pkgType := range types.PackageTypes {
+		var lines []string
+		for _, pkg := range result.Missing {
+			if pkg.Type == pkgType {
+				lines = append(lines, "-"+pkg.Label())
+			}
+		}
+		for _, pkg := range result.Unconfigured {
+			if pkg.Type == pkgType {
+				lines = append(lines, "+"+pkg.Label())
+			}
+		}
+		for _, drift := range result.Versions {
+			if drift.Type == pkgType {
+				lines = append(lines, fmt.Sprintf("-%s %s", drift.Name, drift.Expected), fmt.Sprintf("+%s %s", drift.Name, drift.Actual))
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "@@ %s @@\n", pkgType)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// Label returns the name of a package as listed in a diff; mas apps as "ID (Name)"
+func (p Package) Label() string {
+	if p.Type == "mas" {
+		return fmt.Sprintf("%d (%s)", p.ID, p.Name)
+	}
+	return p.Name
+}
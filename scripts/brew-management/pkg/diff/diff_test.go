@@ -0,0 +1,274 @@
+package diff_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/diff"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lock"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+// config pins git to a version other than the installed 2.45.0 and lists fd and firefox,
+// which are not installed
+const config = `groups:
+  core:
+    priority: 1
+    packages:
+      tap:
+        - name: homebrew/bundle
+        - name: shiron-dev/tap
+      brew:
+        - name: git
+          version: 2.46.0
+          tags: [cli]
+        - name: jq
+          tags: [cli]
+        - name: fd
+          tags: [cli]
+      mas:
+        - name: Xcode
+          id: 497799835
+  apps:
+    priority: 2
+    packages:
+      cask:
+        - name: visual-studio-code
+        - name: slack
+        - name: firefox
+      mas:
+        - name: Tailscale
+          id: 1475387142
+      vscode:
+        - name: GitHub.copilot
+        - name: esbenp.prettier-vscode
+      cargo:
+        - name: ripgrep
+        - name: stylua
+      npm:
+        - name: typescript
+profiles:
+  work:
+    groups: [core]
+`
+
+// compute diffs the configuration against the replay fixtures, comparing versions when withVersions is set
+func compute(t *testing.T, lf *lock.Lockfile, withVersions bool, options *types.PruneOptions) *diff.Result {
+	t.Helper()
+
+	fake, err := runner.LoadFixtures(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := state.Load(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := deps.Load(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions *lock.Versions
+	if withVersions {
+		if versions, err = lock.QueryVersions(fake); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filePath := filepath.Join(t.TempDir(), "packages.yaml")
+	if err := os.WriteFile(filePath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	grouped, err := yamlPkg.LoadMergedConfig(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filteredPackages, err := yamlPkg.GetFilteredPackages(grouped, &types.InstallOptions{
+		Profile: options.Profile,
+		Groups:  options.Groups,
+		Tags:    options.Tags,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := diff.Compute(filePath, grouped, filteredPackages, installed, graph, lf, versions, options)
+	if err != nil {
+		t.Fatalf("Compute() error = %v", err)
+	}
+
+	return result
+}
+
+// drift summarizes a result as "-type:label" for missing packages, "+type:label" for unconfigured
+// ones and "~type:name expected actual" for version drift
+func drift(result *diff.Result) []string {
+	got := []string{}
+	for _, pkg := range result.Missing {
+		got = append(got, "-"+pkg.Type+":"+pkg.Label())
+	}
+	for _, pkg := range result.Unconfigured {
+		got = append(got, "+"+pkg.Type+":"+pkg.Label())
+	}
+	for _, d := range result.Versions {
+		got = append(got, fmt.Sprintf("~%s:%s %s %s", d.Type, d.Name, d.Expected, d.Actual))
+	}
+
+	return got
+}
+
+func TestCompute(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		lf           *lock.Lockfile
+		withVersions bool
+		options      *types.PruneOptions
+		want         []string
+	}{
+		{"every package", nil, false, &types.PruneOptions{}, []string{"-brew:fd", "-cask:firefox", "+brew:ca-certificates", "+brew:libidn2", "+brew:openssl@3", "+brew:ripgrep", "+brew:wget"}},
+		{
+			"versions",
+			nil,
+			true,
+			&types.PruneOptions{},
+			[]string{"-brew:fd", "-cask:firefox", "+brew:ca-certificates", "+brew:libidn2", "+brew:openssl@3", "+brew:ripgrep", "+brew:wget", "~brew:git 2.46.0 2.45.0"},
+		},
+		{
+			"lockfile",
+			&lock.Lockfile{Packages: map[string][]lock.LockedPackage{
+				"brew": {{Name: "git", Version: "2.44.0"}, {Name: "jq", Version: "1.6"}},
+				"cask": {{Name: "slack", Version: "4.38.125"}},
+			}},
+			true,
+			&types.PruneOptions{},
+			[]string{"-brew:fd", "-cask:firefox", "+brew:ca-certificates", "+brew:libidn2", "+brew:openssl@3", "+brew:ripgrep", "+brew:wget", "~brew:git 2.46.0 2.45.0", "~brew:jq 1.6 1.7.1"},
+		},
+		{
+			"profile",
+			nil,
+			false,
+			&types.PruneOptions{Profile: "work"},
+			[]string{
+				"-brew:fd", "+brew:ca-certificates", "+brew:libidn2", "+brew:openssl@3", "+brew:ripgrep", "+brew:wget", "+cask:slack", "+cask:visual-studio-code",
+				"+mas:1475387142 (Tailscale)", "+vscode:esbenp.prettier-vscode", "+vscode:github.copilot",
+				"+cargo:ripgrep", "+cargo:stylua", "+npm:typescript",
+			},
+		},
+		{
+			"groups",
+			nil,
+			false,
+			&types.PruneOptions{Groups: []string{"apps"}},
+			[]string{
+				"-cask:firefox", "+tap:homebrew/bundle", "+tap:shiron-dev/tap", "+brew:ca-certificates", "+brew:gettext",
+				"+brew:git", "+brew:jq", "+brew:libidn2", "+brew:oniguruma", "+brew:openssl@3", "+brew:pcre2",
+				"+brew:ripgrep", "+brew:wget", "+mas:497799835 (Xcode)",
+			},
+		},
+		{
+			"tags",
+			nil,
+			true,
+			&types.PruneOptions{Tags: []string{"cli"}},
+			[]string{
+				"-brew:fd", "+tap:homebrew/bundle", "+tap:shiron-dev/tap", "+brew:ca-certificates", "+brew:libidn2", "+brew:openssl@3", "+brew:ripgrep", "+brew:wget", "+cask:slack",
+				"+cask:visual-studio-code", "+mas:497799835 (Xcode)", "+mas:1475387142 (Tailscale)",
+				"+vscode:esbenp.prettier-vscode", "+vscode:github.copilot", "+cargo:ripgrep", "+cargo:stylua",
+				"+npm:typescript", "~brew:git 2.46.0 2.45.0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			result := compute(t, tt.lf, tt.withVersions, tt.options)
+			if got := drift(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compute() = %#v, want %#v", got, tt.want)
+			}
+			if result.Count() != len(tt.want) {
+				t.Errorf("Result.Count() = %d, want %d", result.Count(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestWriteUnified(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		result *diff.Result
+		want   string
+	}{
+		{"no drift", &diff.Result{File: "packages.yaml"}, "--- packages.yaml\n+++ installed\n"},
+		{
+			"hunks in package type order",
+			&diff.Result{
+				File: "packages.yaml",
+				Missing: []diff.Package{
+					{Type: "mas", Name: "Xcode", ID: 497799835},
+					{Type: "brew", Name: "fd"},
+				},
+				Unconfigured: []diff.Package{{Type: "brew", Name: "wget"}},
+				Versions:     []lock.Drift{{Type: "brew", Name: "git", Expected: "2.46.0", Actual: "2.45.0", Pinned: true}},
+			},
+			"--- packages.yaml\n+++ installed\n" +
+				"@@ brew @@\n-fd\n+wget\n-git 2.46.0\n+git 2.45.0\n" +
+				"@@ mas @@\n-497799835 (Xcode)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			diff.WriteUnified(&buf, tt.result)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("WriteUnified() wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	drifted := &diff.Result{Missing: []diff.Package{{Type: "brew", Name: "fd"}}}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"no drift", (&diff.Result{}).Err(), diff.ExitNoDrift},
+		{"drift", drifted.Err(), diff.ExitDrift},
+		{"wrapped drift", fmt.Errorf("diff: %w", drifted.Err()), diff.ExitDrift},
+		{"failure", errors.New("failed to list taps"), diff.ExitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := diff.ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
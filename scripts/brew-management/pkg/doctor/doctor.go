@@ -0,0 +1,378 @@
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/location"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/validate"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+// Status is the outcome of a check
+type Status string
+
+// Check statuses
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// StaleBackupAge is the age after which a .backup file left by sync counts as stale
+const StaleBackupAge = 7 * 24 * time.Hour
+
+// Check is the outcome of one diagnostic
+type Check struct {
+	Name    string `json:"name" yaml:"name"`
+	Status  Status `json:"status" yaml:"status"`
+	Message string `json:"message" yaml:"message"`
+	Hint    string `json:"hint,omitempty" yaml:"hint,omitempty"` // How to fix a warning or failure
+}
+
+// Result is the outcome of all diagnostics
+type Result struct {
+	File   string  `json:"file" yaml:"file"`
+	Checks []Check `json:"checks" yaml:"checks"`
+}
+
+// Counts returns the number of checks for each status
+func (r *Result) Counts() map[Status]int {
+	counts := make(map[Status]int)
+	for _, check := range r.Checks {
+		counts[check.Status]++
+	}
+	return counts
+}
+
+// Failed returns the number of failed checks
+func (r *Result) Failed() int {
+	return r.Counts()[StatusFail]
+}
+
+// BrewPath returns where the Homebrew installer puts brew on goos, as used by dofy, or an empty
+// string for other systems
+func BrewPath(goos string) string {
+	switch goos {
+	case "darwin":
+		return "/opt/homebrew/bin/brew"
+	case "linux":
+		return "/home/linuxbrew/.linuxbrew/bin/brew"
+	}
+	return ""
+}
+
+// Run checks the environment brew-manager runs in and the configuration in yamlFile
+func Run(r runner.Runner, yamlFile string, goos string) *Result {
+	result := &Result{File: yamlFile}
+	add := func(check Check) { result.Checks = append(result.Checks, check) }
+
+	hasBrew := r.CommandExists("brew")
+	add(checkBrew(hasBrew))
+	add(checkBrewPath(r, hasBrew, goos))
+
+	config, check := checkConfig(yamlFile)
+	add(check)
+	add(checkSchema(yamlFile))
+	add(checkMas(r, config, goos))
+	add(checkBackups(yamlFile, time.Now()))
+	add(checkTaps(r, hasBrew, config))
+
+	return result
+}
+
+// checkBrew checks that brew is on the PATH
+func checkBrew(hasBrew bool) Check {
+	check := Check{Name: "brew", Status: StatusPass, Message: "brew is installed"}
+	if !hasBrew {
+		check.Status = StatusFail
+		check.Message = "brew was not found on the PATH"
+		check.Hint = "Install Homebrew from https://brew.sh, or run dofy"
+	}
+	return check
+}
+
+// checkBrewPath checks that the directories `brew shellenv` adds to the PATH are on it, the way
+// dofy sets up the Homebrew environment
+func checkBrewPath(r runner.Runner, hasBrew bool, goos string) Check {
+	check := Check{Name: "homebrew-path", Status: StatusPass}
+	if !hasBrew {
+		if brewPath := BrewPath(goos); brewPath != "" && utils.FileExists(brewPath) {
+			check.Status = StatusFail
+			check.Message = fmt.Sprintf("Homebrew is installed at %s but is not on the PATH", filepath.Dir(filepath.Dir(brewPath)))
+			check.Hint = fmt.Sprintf(`Add eval "$(%s shellenv)" to your shell profile`, brewPath)
+			return check
+		}
+		check.Status = StatusWarn
+		check.Message = "Homebrew prefix not found"
+		check.Hint = "Install Homebrew first"
+		return check
+	}
+
+	output, err := r.RunCommand("brew", "shellenv")
+	if err != nil {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("failed to run brew shellenv: %v", err)
+		check.Hint = "Run 'brew doctor' to check the Homebrew installation"
+		return check
+	}
+
+	dirs := shellenvPath(output)
+	if len(dirs) == 0 {
+		check.Status = StatusWarn
+		check.Message = "brew shellenv printed no PATH"
+		check.Hint = "Run 'brew doctor' to check the Homebrew installation"
+		return check
+	}
+	var missing []string
+	for _, dir := range dirs {
+		if !inPath(dir) {
+			missing = append(missing, dir)
+		}
+	}
+	if len(missing) > 0 {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("not on the PATH: %s", strings.Join(missing, ", "))
+		check.Hint = `Add eval "$(brew shellenv)" to your shell profile`
+		return check
+	}
+	check.Message = fmt.Sprintf("Homebrew directories are on the PATH: %s", strings.Join(dirs, ", "))
+	return check
+}
+
+// shellenvPath returns the directories the PATH line of `brew shellenv` output prepends, such as
+// `export PATH="/opt/homebrew/bin:/opt/homebrew/sbin${PATH+:$PATH}";`
+func shellenvPath(output string) []string {
+	for _, line := range strings.Split(output, "\n") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(line), "export PATH=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSuffix(value, ";"), `"'`)
+		value, _, _ = strings.Cut(value, "$")
+		var dirs []string
+		for _, dir := range strings.Split(value, ":") {
+			if dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+		return dirs
+	}
+	return nil
+}
+
+// inPath reports whether dir is a directory of the PATH
+func inPath(dir string) bool {
+	for _, entry := range filepath.SplitList(os.Getenv("PATH")) {
+		if filepath.Clean(entry) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfig checks that the configuration file exists and loads with its includes and overlays
+func checkConfig(yamlFile string) (*types.PackageGrouped, Check) {
+	check := Check{Name: "config", Status: StatusPass}
+	if !utils.FileExists(yamlFile) {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%s does not exist", yamlFile)
+		check.Hint = "Pass the configuration file as an argument or with --config, or check 'brew-manager config path'"
+		return nil, check
+	}
+
+	config, err := yamlPkg.LoadMergedConfig(yamlFile)
+	if err != nil {
+		check.Status = StatusFail
+		check.Message = err.Error()
+		check.Hint = fmt.Sprintf("Run 'brew-manager validate %s' for details", yamlFile)
+		return nil, check
+	}
+
+	count := 0
+	for _, group := range config.Groups {
+		for _, pkgInfos := range group.Packages {
+			count += len(pkgInfos)
+		}
+	}
+	check.Message = fmt.Sprintf("%s loads with %d groups and %d packages", yamlFile, len(config.Groups), count)
+	return config, check
+}
+
+// checkSchema checks that the built-in schema compiles and that the schema named by the
+// yaml-language-server comment of the configuration file exists
+func checkSchema(yamlFile string) Check {
+	check := Check{Name: "schema", Status: StatusPass}
+	if err := validate.CheckSchema(""); err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("built-in schema: %v", err)
+		check.Hint = "Rebuild brew-manager"
+		return check
+	}
+
+	schemaRef := schemaModeline(yamlFile)
+	switch {
+	case schemaRef == "":
+		check.Message = "built-in schema is available; the configuration names no schema for editors"
+	case strings.HasPrefix(schemaRef, "http://") || strings.HasPrefix(schemaRef, "https://"):
+		check.Message = fmt.Sprintf("built-in schema is available; editor schema %s was not fetched", schemaRef)
+	default:
+		schemaPath := location.ExpandHome(schemaRef)
+		if !filepath.IsAbs(schemaPath) {
+			schemaPath = filepath.Join(filepath.Dir(yamlFile), schemaPath)
+		}
+		if err := validate.CheckSchema(schemaPath); err != nil {
+			check.Status = StatusWarn
+			check.Message = fmt.Sprintf("editor schema %s: %v", schemaRef, err)
+			check.Hint = "Point the yaml-language-server comment at brew-manager's packages.schema.json"
+			return check
+		}
+		check.Message = fmt.Sprintf("built-in schema and editor schema %s are available", schemaPath)
+	}
+	return check
+}
+
+// schemaModeline returns the $schema of the yaml-language-server comment in a file, if any
+func schemaModeline(filePath string) string {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "# yaml-language-server:")
+		if !ok {
+			continue
+		}
+		if _, ref, ok := strings.Cut(rest, "$schema="); ok {
+			return strings.TrimSpace(ref)
+		}
+	}
+	return ""
+}
+
+// checkMas checks that mas is installed and signed in to the App Store when the configuration
+// has Mac App Store apps
+func checkMas(r runner.Runner, config *types.PackageGrouped, goos string) Check {
+	check := Check{Name: "mas", Status: StatusPass}
+	if goos != "darwin" {
+		check.Message = "Mac App Store apps are not available on " + goos
+		return check
+	}
+	if !r.CommandExists("mas") {
+		if hasType(config, "mas") {
+			check.Status = StatusWarn
+			check.Message = "mas is not installed, so Mac App Store apps cannot be installed"
+			check.Hint = "brew install mas"
+			return check
+		}
+		check.Message = "mas is not installed; the configuration has no Mac App Store apps"
+		return check
+	}
+
+	output, err := r.RunCommand("mas", "account")
+	account := strings.TrimSpace(output)
+	// mas account does not work on recent macOS versions, so the sign-in cannot be checked there
+	if strings.Contains(strings.ToLower(account), "not supported") {
+		check.Message = "mas is installed; this macOS version does not let it report the App Store account"
+		check.Hint = "Note: make sure you are signed in with the App Store app"
+		return check
+	}
+	if err != nil || account == "" || strings.Contains(strings.ToLower(account), "not signed in") {
+		check.Status = StatusWarn
+		check.Message = "mas is installed but not signed in to the App Store"
+		if account != "" {
+			check.Message += ": " + account
+		}
+		check.Hint = "Sign in with the App Store app"
+		return check
+	}
+	check.Message = "mas is signed in as " + account
+	return check
+}
+
+// hasType reports whether the configuration has a package of pkgType
+func hasType(config *types.PackageGrouped, pkgType string) bool {
+	if config == nil {
+		return false
+	}
+	for _, group := range config.Groups {
+		if len(group.Packages[pkgType]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBackups looks for .backup files next to the configuration that are older than StaleBackupAge
+func checkBackups(yamlFile string, now time.Time) Check {
+	check := Check{Name: "backups", Status: StatusPass, Message: "no stale .backup files"}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(yamlFile), "*.backup"))
+
+	var stale []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if now.Sub(info.ModTime()) > StaleBackupAge {
+			stale = append(stale, match)
+		}
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("stale backups older than %d days: %s", int(StaleBackupAge.Hours()/24), strings.Join(stale, ", "))
+		check.Hint = "Delete them once the changes they back up are committed"
+	}
+	return check
+}
+
+// checkTaps checks that every configured tap is tapped
+func checkTaps(r runner.Runner, hasBrew bool, config *types.PackageGrouped) Check {
+	check := Check{Name: "taps", Status: StatusPass}
+	if config == nil || !hasBrew {
+		check.Status = StatusWarn
+		check.Message = "skipped: needs brew and a loadable configuration"
+		return check
+	}
+
+	output, err := r.RunCommand("brew", "tap")
+	if err != nil {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("failed to list taps: %v", err)
+		check.Hint = "Run 'brew doctor' to check the Homebrew installation"
+		return check
+	}
+	tapped := make(map[string]bool)
+	for _, tap := range strings.Fields(output) {
+		tapped[strings.ToLower(tap)] = true
+	}
+
+	configured := 0
+	var missing []string
+	for _, group := range config.Groups {
+		for _, pkgInfo := range group.Packages["tap"] {
+			configured++
+			if !tapped[strings.ToLower(pkgInfo.Name)] {
+				missing = append(missing, pkgInfo.Name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		missing = utils.UniqueStrings(missing)
+		sort.Strings(missing)
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("configured but not tapped: %s", strings.Join(missing, ", "))
+		check.Hint = "Run 'brew-manager install' or 'brew tap <name>'"
+		return check
+	}
+	check.Message = fmt.Sprintf("all %d configured taps are tapped", configured)
+	return check
+}
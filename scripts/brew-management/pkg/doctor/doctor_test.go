@@ -0,0 +1,279 @@
+package doctor_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/doctor"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// withPackages returns a configuration with one group holding packages of a single type
+func withPackages(pkgType string, names ...string) *types.PackageGrouped {
+	var pkgInfos []types.PackageInfo
+	for _, name := range names {
+		pkgInfos = append(pkgInfos, types.PackageInfo{Name: name})
+	}
+
+	return &types.PackageGrouped{Groups: map[string]types.Group{
+		"core": {Priority: 1, Packages: map[string][]types.PackageInfo{pkgType: pkgInfos}},
+	}}
+}
+
+func TestShellenvPath(t *testing.T) {
+	t.Parallel()
+
+	fixture, err := os.ReadFile(filepath.Join(fixtureDir, "brew_shellenv.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{"fixture", string(fixture), []string{"/opt/homebrew/bin", "/opt/homebrew/sbin"}},
+		{
+			"linuxbrew, single quotes",
+			"export PATH='/home/linuxbrew/.linuxbrew/bin:/home/linuxbrew/.linuxbrew/sbin:$PATH'\n",
+			[]string{"/home/linuxbrew/.linuxbrew/bin", "/home/linuxbrew/.linuxbrew/sbin"},
+		},
+		{"no PATH line", "export HOMEBREW_PREFIX=\"/opt/homebrew\";\n", nil},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := doctor.ShellenvPath(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("shellenvPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMas(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		account *runner.Response // nil when mas is not installed
+		config  *types.PackageGrouped
+		goos    string
+		want    doctor.Check
+	}{
+		{
+			"not macOS",
+			nil,
+			withPackages("mas", "Xcode"),
+			"linux",
+			doctor.Check{Name: "mas", Status: doctor.StatusPass, Message: "Mac App Store apps are not available on linux"},
+		},
+		{
+			"not installed, no apps",
+			nil,
+			withPackages("brew", "git"),
+			"darwin",
+			doctor.Check{Name: "mas", Status: doctor.StatusPass, Message: "mas is not installed; the configuration has no Mac App Store apps"},
+		},
+		{
+			"not installed, with apps",
+			nil,
+			withPackages("mas", "Xcode"),
+			"darwin",
+			doctor.Check{
+				Name:    "mas",
+				Status:  doctor.StatusWarn,
+				Message: "mas is not installed, so Mac App Store apps cannot be installed",
+				Hint:    "brew install mas",
+			},
+		},
+		{
+			"signed in",
+			&runner.Response{Output: "user@example.com\n"},
+			withPackages("mas", "Xcode"),
+			"darwin",
+			doctor.Check{Name: "mas", Status: doctor.StatusPass, Message: "mas is signed in as user@example.com"},
+		},
+		{
+			"not signed in",
+			&runner.Response{Output: "Not signed in\n", ExitCode: 1},
+			withPackages("mas", "Xcode"),
+			"darwin",
+			doctor.Check{
+				Name:    "mas",
+				Status:  doctor.StatusWarn,
+				Message: "mas is installed but not signed in to the App Store: Not signed in",
+				Hint:    "Sign in with the App Store app",
+			},
+		},
+		{
+			"no account",
+			&runner.Response{ExitCode: 1},
+			withPackages("mas", "Xcode"),
+			"darwin",
+			doctor.Check{
+				Name:    "mas",
+				Status:  doctor.StatusWarn,
+				Message: "mas is installed but not signed in to the App Store",
+				Hint:    "Sign in with the App Store app",
+			},
+		},
+		{
+			"account not supported",
+			&runner.Response{
+				Output:   "Error: This command is not supported on this macOS version due to changes in macOS.\n",
+				ExitCode: 1,
+			},
+			withPackages("mas", "Xcode"),
+			"darwin",
+			doctor.Check{
+				Name:    "mas",
+				Status:  doctor.StatusPass,
+				Message: "mas is installed; this macOS version does not let it report the App Store account",
+				Hint:    "Note: make sure you are signed in with the App Store app",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := runner.NewFakeRunner()
+			if tt.account != nil {
+				fake.Script(*tt.account, "mas", "account")
+			}
+			if got := doctor.CheckMas(fake, tt.config, tt.goos); got != tt.want {
+				t.Errorf("checkMas() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBackups(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		backups map[string]time.Duration // file name -> age
+		want    doctor.Check
+	}{
+		{"none", nil, doctor.Check{Name: "backups", Status: doctor.StatusPass, Message: "no stale .backup files"}},
+		{
+			"recent",
+			map[string]time.Duration{"packages.yaml.backup": 6 * 24 * time.Hour, "notes.txt": 30 * 24 * time.Hour},
+			doctor.Check{Name: "backups", Status: doctor.StatusPass, Message: "no stale .backup files"},
+		},
+		{
+			"stale",
+			map[string]time.Duration{
+				"packages.yaml.backup": 8 * 24 * time.Hour,
+				"extra.yaml.backup":    30 * 24 * time.Hour,
+				"work.yaml.backup":     time.Hour,
+			},
+			doctor.Check{
+				Name:    "backups",
+				Status:  doctor.StatusWarn,
+				Message: "stale backups older than 7 days: {dir}/extra.yaml.backup, {dir}/packages.yaml.backup",
+				Hint:    "Delete them once the changes they back up are committed",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			for name, age := range tt.backups {
+				path := filepath.Join(dir, name)
+				if err := os.WriteFile(path, []byte("groups: {}\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want := tt.want
+			want.Message = strings.ReplaceAll(want.Message, "{dir}", dir)
+			if got := doctor.CheckBackups(filepath.Join(dir, "packages.yaml"), now); got != want {
+				t.Errorf("checkBackups() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckTaps(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		hasBrew bool
+		config  *types.PackageGrouped
+		want    doctor.Check
+	}{
+		{
+			"all tapped, any case",
+			true,
+			withPackages("tap", "Homebrew/Bundle", "shiron-dev/tap"),
+			doctor.Check{Name: "taps", Status: doctor.StatusPass, Message: "all 2 configured taps are tapped"},
+		},
+		{
+			"not tapped",
+			true,
+			withPackages("tap", "shiron-dev/tap", "owner/tools", "hashicorp/tap"),
+			doctor.Check{
+				Name:    "taps",
+				Status:  doctor.StatusWarn,
+				Message: "configured but not tapped: hashicorp/tap, owner/tools",
+				Hint:    "Run 'brew-manager install' or 'brew tap <name>'",
+			},
+		},
+		{
+			"no brew",
+			false,
+			withPackages("tap", "shiron-dev/tap"),
+			doctor.Check{Name: "taps", Status: doctor.StatusWarn, Message: "skipped: needs brew and a loadable configuration"},
+		},
+		{
+			"no configuration",
+			true,
+			nil,
+			doctor.Check{Name: "taps", Status: doctor.StatusWarn, Message: "skipped: needs brew and a loadable configuration"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := doctor.CheckTaps(fake, tt.hasBrew, tt.config); got != tt.want {
+				t.Errorf("checkTaps() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
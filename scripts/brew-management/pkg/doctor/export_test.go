@@ -0,0 +1,9 @@
+package doctor
+
+// Checks exposed to the tests
+var (
+	ShellenvPath = shellenvPath
+	CheckMas     = checkMas
+	CheckBackups = checkBackups
+	CheckTaps    = checkTaps
+)
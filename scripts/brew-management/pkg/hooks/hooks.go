@@ -0,0 +1,136 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+// Hook events
+const (
+	PreInstall  = "pre_install"
+	PostInstall = "post_install"
+	PostRemove  = "post_remove"
+)
+
+// Hook failure policies
+const (
+	FailurePolicyFail = "fail" // The package counts as failed
+	FailurePolicyWarn = "warn" // Only a warning is printed
+)
+
+// DefaultTimeout is how long a hook may run when hook_timeout is not set
+const DefaultTimeout = 5 * time.Minute
+
+// Command returns the hook command configured for an event, or an empty string
+func Command(h types.Hooks, event string) string {
+	switch event {
+	case PreInstall:
+		return h.PreInstall
+	case PostInstall:
+		return h.PostInstall
+	case PostRemove:
+		return h.PostRemove
+	}
+	return ""
+}
+
+// Timeout returns the hook timeout, DefaultTimeout when hook_timeout is not set
+func Timeout(h types.Hooks) (time.Duration, error) {
+	if h.HookTimeout == "" {
+		return DefaultTimeout, nil
+	}
+	timeout, err := time.ParseDuration(h.HookTimeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid hook_timeout %q: expected a positive duration such as 30s or 5m", h.HookTimeout)
+	}
+	return timeout, nil
+}
+
+// Check validates the timeout and failure policy of hooks
+func Check(h types.Hooks) error {
+	if _, err := Timeout(h); err != nil {
+		return err
+	}
+	switch h.HookFailure {
+	case "", FailurePolicyFail, FailurePolicyWarn:
+		return nil
+	}
+	return fmt.Errorf("invalid hook_failure %q: expected %s or %s", h.HookFailure, FailurePolicyFail, FailurePolicyWarn)
+}
+
+// Env returns the environment variables describing the package a hook runs for
+func Env(event string, pkg types.FilteredPackage) []string {
+	env := []string{
+		"BREW_MANAGER_HOOK=" + event,
+		"BREW_MANAGER_PACKAGE_TYPE=" + pkg.Type,
+		"BREW_MANAGER_PACKAGE_NAME=" + pkg.Name,
+		"BREW_MANAGER_GROUP=" + pkg.Group,
+	}
+	if pkg.ID != 0 {
+		env = append(env, "BREW_MANAGER_PACKAGE_ID="+strconv.FormatInt(pkg.ID, 10))
+	}
+	if pkg.Version != "" {
+		env = append(env, "BREW_MANAGER_PACKAGE_VERSION="+pkg.Version)
+	}
+	return env
+}
+
+// Run runs the hook configured for an event of a package with sh, through r, and kills it after
+// the hook timeout. It does nothing when no hook is configured. A failed hook returns an error
+// unless hook_failure is warn, in which case only a warning is printed.
+func Run(r runner.Runner, event string, pkg types.FilteredPackage, dryRun bool, verbose bool) error {
+	command := Command(pkg.Hooks, event)
+	if command == "" {
+		return nil
+	}
+
+	if dryRun {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would run %s hook for %s %s: %s", event, pkg.Type, pkg.Name, command))
+		return nil
+	}
+
+	err := run(r, event, pkg, command)
+	if err == nil {
+		return nil
+	}
+	if pkg.HookFailure == FailurePolicyWarn {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: %v", err))
+		if output := runner.ErrorOutput(err); output != "" && verbose {
+			fmt.Fprintln(utils.Output, output)
+		}
+		return nil
+	}
+	return err
+}
+
+// run runs a hook command and wraps a failure with the event and package
+func run(r runner.Runner, event string, pkg types.FilteredPackage, command string) error {
+	if err := Check(pkg.Hooks); err != nil {
+		return fmt.Errorf("%s hook for %s: %w", event, pkg.Name, err)
+	}
+	timeout, _ := Timeout(pkg.Hooks)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	args := append(Env(event, pkg), "sh", "-c", command)
+	output, err := r.RunCommandContext(ctx, "env", args...)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	return &runner.CommandError{
+		Err:    fmt.Errorf("%s hook for %s failed: %w", event, pkg.Name, err),
+		Output: strings.TrimSpace(output),
+	}
+}
@@ -0,0 +1,278 @@
+package hooks_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/hooks"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// hookRunner records the argv of every command and runs hooks by their shell command:
+// "fail" exits with an error, "sleep" blocks until its context is done and anything else succeeds
+type hookRunner struct {
+	mu    sync.Mutex
+	calls [][]string
+}
+
+func (r *hookRunner) RunCommand(command string, args ...string) (string, error) {
+	return r.RunCommandContext(context.Background(), command, args...)
+}
+
+func (r *hookRunner) RunCommandContext(ctx context.Context, command string, args ...string) (string, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, append([]string{command}, args...))
+	r.mu.Unlock()
+
+	switch args[len(args)-1] {
+	case "fail":
+		return "hook output\n", errors.New("exit status 1")
+	case "sleep":
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return "", nil
+}
+
+func (r *hookRunner) RunCommandSilent(command string, args ...string) error {
+	_, err := r.RunCommand(command, args...)
+	return err
+}
+
+func (r *hookRunner) CommandExists(string) bool {
+	return true
+}
+
+func (r *hookRunner) Calls() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.calls
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	git := types.FilteredPackage{Type: "brew", Group: "core", PackageInfo: types.PackageInfo{Name: "git", Version: "2.45.0"}}
+	xcode := types.FilteredPackage{Type: "mas", Group: "apps", PackageInfo: types.PackageInfo{Name: "Xcode", ID: 497799835}}
+	withHooks := func(pkg types.FilteredPackage, h types.Hooks) types.FilteredPackage {
+		pkg.Hooks = h
+		return pkg
+	}
+
+	tests := []struct {
+		name    string
+		event   string
+		pkg     types.FilteredPackage
+		dryRun  bool
+		want    [][]string
+		wantErr string
+	}{
+		{"no hook", hooks.PreInstall, git, false, nil, ""},
+		{"other event", hooks.PostInstall, withHooks(git, types.Hooks{PreInstall: "echo git"}), false, nil, ""},
+		{
+			"exported variables",
+			hooks.PreInstall,
+			withHooks(git, types.Hooks{PreInstall: "echo git"}),
+			false,
+			[][]string{{
+				"env", "BREW_MANAGER_HOOK=pre_install", "BREW_MANAGER_PACKAGE_TYPE=brew", "BREW_MANAGER_PACKAGE_NAME=git",
+				"BREW_MANAGER_GROUP=core", "BREW_MANAGER_PACKAGE_VERSION=2.45.0", "sh", "-c", "echo git",
+			}},
+			"",
+		},
+		{
+			"mas app ID",
+			hooks.PostRemove,
+			withHooks(xcode, types.Hooks{PostRemove: "rm -rf ~/Library/Developer"}),
+			false,
+			[][]string{{
+				"env", "BREW_MANAGER_HOOK=post_remove", "BREW_MANAGER_PACKAGE_TYPE=mas", "BREW_MANAGER_PACKAGE_NAME=Xcode",
+				"BREW_MANAGER_GROUP=apps", "BREW_MANAGER_PACKAGE_ID=497799835", "sh", "-c", "rm -rf ~/Library/Developer",
+			}},
+			"",
+		},
+		{"dry run", hooks.PostInstall, withHooks(git, types.Hooks{PostInstall: "fail"}), true, nil, ""},
+		{
+			"failure",
+			hooks.PostInstall,
+			withHooks(git, types.Hooks{PostInstall: "fail"}),
+			false,
+			[][]string{{
+				"env", "BREW_MANAGER_HOOK=post_install", "BREW_MANAGER_PACKAGE_TYPE=brew", "BREW_MANAGER_PACKAGE_NAME=git",
+				"BREW_MANAGER_GROUP=core", "BREW_MANAGER_PACKAGE_VERSION=2.45.0", "sh", "-c", "fail",
+			}},
+			"post_install hook for git failed: exit status 1",
+		},
+		{
+			"failure, fail policy",
+			hooks.PostInstall,
+			withHooks(git, types.Hooks{PostInstall: "fail", HookFailure: hooks.FailurePolicyFail}),
+			false,
+			[][]string{{
+				"env", "BREW_MANAGER_HOOK=post_install", "BREW_MANAGER_PACKAGE_TYPE=brew", "BREW_MANAGER_PACKAGE_NAME=git",
+				"BREW_MANAGER_GROUP=core", "BREW_MANAGER_PACKAGE_VERSION=2.45.0", "sh", "-c", "fail",
+			}},
+			"post_install hook for git failed: exit status 1",
+		},
+		{
+			"failure, warn policy",
+			hooks.PostInstall,
+			withHooks(git, types.Hooks{PostInstall: "fail", HookFailure: hooks.FailurePolicyWarn}),
+			false,
+			[][]string{{
+				"env", "BREW_MANAGER_HOOK=post_install", "BREW_MANAGER_PACKAGE_TYPE=brew", "BREW_MANAGER_PACKAGE_NAME=git",
+				"BREW_MANAGER_GROUP=core", "BREW_MANAGER_PACKAGE_VERSION=2.45.0", "sh", "-c", "fail",
+			}},
+			"",
+		},
+		{
+			"invalid timeout",
+			hooks.PreInstall,
+			withHooks(git, types.Hooks{PreInstall: "echo git", HookTimeout: "soon"}),
+			false,
+			nil,
+			`pre_install hook for git: invalid hook_timeout "soon": expected a positive duration such as 30s or 5m`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &hookRunner{}
+			err := hooks.Run(r, tt.event, tt.pkg, tt.dryRun, false)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Run() error = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("Run() error = %v, want %s", err, tt.wantErr)
+			}
+			if got := r.Calls(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Run() ran %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	t.Parallel()
+
+	pkg := types.FilteredPackage{Type: "brew", Group: "core", PackageInfo: types.PackageInfo{Name: "git"}}
+	pkg.Hooks = types.Hooks{PostInstall: "sleep", HookTimeout: "10ms"}
+
+	start := time.Now()
+	err := hooks.Run(&hookRunner{}, hooks.PostInstall, pkg, false, false)
+	if err == nil || err.Error() != "post_install hook for git failed: timed out after 10ms" {
+		t.Errorf("Run() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Minute {
+		t.Errorf("Run() took %s, want about the 10ms hook timeout", elapsed)
+	}
+}
+
+func TestRun_GroupHooks(t *testing.T) {
+	t.Parallel()
+
+	content := `groups:
+  core:
+    priority: 1
+    post_install: echo group
+    hook_timeout: 30s
+    hook_failure: warn
+    packages:
+      brew:
+        - name: git
+        - name: jq
+          post_install: fail
+          hook_failure: fail
+`
+	path := filepath.Join(t.TempDir(), "packages.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := yamlPkg.LoadMergedConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := yamlPkg.GetFilteredPackages(config, &types.InstallOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]types.Hooks)
+	for _, pkg := range pkgs {
+		got[pkg.Name] = pkg.Hooks
+	}
+	want := map[string]types.Hooks{
+		"git": {PostInstall: "echo group", HookTimeout: "30s", HookFailure: hooks.FailurePolicyWarn},
+		"jq":  {PostInstall: "fail", HookTimeout: "30s", HookFailure: hooks.FailurePolicyFail},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFilteredPackages() hooks = %+v, want %+v", got, want)
+	}
+
+	r := &hookRunner{}
+	var failed []string
+	for _, pkg := range pkgs {
+		if err := hooks.Run(r, hooks.PostInstall, pkg, false, false); err != nil {
+			failed = append(failed, pkg.Name)
+		}
+	}
+	var commands []string
+	for _, call := range r.Calls() {
+		commands = append(commands, strings.Join(call[len(call)-3:], " "))
+	}
+	if want := []string{"sh -c echo group", "sh -c fail"}; !reflect.DeepEqual(commands, want) {
+		t.Errorf("Run() ran %q, want %q", commands, want)
+	}
+	if want := []string{"jq"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("Run() failed for %v, want %v", failed, want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		hooks       types.Hooks
+		wantTimeout time.Duration
+		wantErr     bool
+	}{
+		{"defaults", types.Hooks{}, hooks.DefaultTimeout, false},
+		{"timeout", types.Hooks{HookTimeout: "30s"}, 30 * time.Second, false},
+		{"warn", types.Hooks{HookFailure: hooks.FailurePolicyWarn}, hooks.DefaultTimeout, false},
+		{"invalid timeout", types.Hooks{HookTimeout: "soon"}, 0, true},
+		{"negative timeout", types.Hooks{HookTimeout: "-1s"}, 0, true},
+		{"invalid failure policy", types.Hooks{HookFailure: "ignore"}, hooks.DefaultTimeout, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := hooks.Check(tt.hooks); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got, _ := hooks.Timeout(tt.hooks); got != tt.wantTimeout {
+				t.Errorf("Timeout() = %s, want %s", got, tt.wantTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package journal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brew"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lock"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/prune"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/upgrade"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+// entryFile is the name of the entry file in an entry directory
+const entryFile = "entry.json"
+
+// snapshotFile is the name of the configuration snapshot in an entry directory
+const snapshotFile = "snapshot.yaml"
+
+// Package is a package changed by a command
+type Package struct {
+	Type            string `json:"type" yaml:"type"`
+	Name            string `json:"name" yaml:"name"`
+	ID              int64  `json:"id,omitempty" yaml:"id,omitempty"`                             // For mas apps
+	Version         string `json:"version,omitempty" yaml:"version,omitempty"`                   // Installed version, or tap commit
+	PreviousVersion string `json:"previous_version,omitempty" yaml:"previous_version,omitempty"` // Version before an upgrade
+}
+
+// Entry records the changes made by one run of a mutating command
+type Entry struct {
+	ID            string     `json:"id" yaml:"id"`
+	Time          time.Time  `json:"time" yaml:"time"`
+	Command       string     `json:"command" yaml:"command"` // Command line without the program name
+	File          string     `json:"file" yaml:"file"`       // YAML configuration file
+	Installed     []Package  `json:"installed,omitempty" yaml:"installed,omitempty"`
+	Removed       []Package  `json:"removed,omitempty" yaml:"removed,omitempty"`
+	Upgraded      []Package  `json:"upgraded,omitempty" yaml:"upgraded,omitempty"`
+	Added         []Package  `json:"added,omitempty" yaml:"added,omitempty"`         // Packages added to the configuration
+	ConfigChanged bool       `json:"config_changed" yaml:"config_changed"`           // The command edited File
+	Snapshot      bool       `json:"snapshot" yaml:"snapshot"`                       // File before the command is saved with the entry
+	FileHash      string     `json:"file_hash,omitempty" yaml:"file_hash,omitempty"` // SHA-256 of File after the command
+	UndoneBy      string     `json:"undone_by,omitempty" yaml:"undone_by,omitempty"` // Entry of the undo that reversed this one
+	UndoneAt      *time.Time `json:"undone_at,omitempty" yaml:"undone_at,omitempty"`
+}
+
+// Empty reports whether the entry records no change
+func (e *Entry) Empty() bool {
+	return len(e.Installed) == 0 && len(e.Removed) == 0 && len(e.Upgraded) == 0 && !e.ConfigChanged
+}
+
+// Journal is a directory of entries, one subdirectory per entry
+type Journal struct {
+	Dir string
+}
+
+// DefaultDir returns the journal directory in the user config directory
+func DefaultDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "brew-manager", "history")
+}
+
+// ReadSnapshot reads a configuration file to record with an entry; a missing file has no snapshot
+func ReadSnapshot(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s for the history snapshot: %w", filePath, err)
+	}
+	return data, nil
+}
+
+// Record assigns an ID to entry and writes it with the configuration snapshot, which may be nil.
+// It also records the hash of the configuration file as the command left it.
+func (j *Journal) Record(entry *Entry, snapshot []byte) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.File != "" && entry.FileHash == "" {
+		hash, err := hashFile(entry.File)
+		if err != nil {
+			return err
+		}
+		entry.FileHash = hash
+	}
+
+	// IDs sort by time; runs within the same second get a suffix
+	base := entry.Time.Format("20060102-150405")
+	entry.ID = base
+	for n := 2; utils.FileExists(filepath.Join(j.Dir, entry.ID)); n++ {
+		entry.ID = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	dir := filepath.Join(j.Dir, entry.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create history entry: %w", err)
+	}
+	if snapshot != nil {
+		if err := os.WriteFile(filepath.Join(dir, snapshotFile), snapshot, 0644); err != nil {
+			return fmt.Errorf("failed to write history snapshot: %w", err)
+		}
+		entry.Snapshot = true
+	}
+	return j.save(entry)
+}
+
+// hashFile returns the SHA-256 of a file, or an empty string if it does not exist
+func hashFile(filePath string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s for the history entry: %w", filePath, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// save writes the entry file of an entry
+func (j *Journal) save(entry *Entry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(j.Dir, entry.ID, entryFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write history entry: %w", err)
+	}
+	return nil
+}
+
+// List returns every entry, oldest first
+func (j *Journal) List() ([]*Entry, error) {
+	dirs, err := os.ReadDir(j.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []*Entry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	entries := []*Entry{}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		entry, err := j.load(dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].Time.Before(entries[b].Time)
+	})
+	return entries, nil
+}
+
+// Get returns an entry by ID, or the latest entry that was not undone when id is empty
+func (j *Journal) Get(id string) (*Entry, error) {
+	if id != "" {
+		if !utils.FileExists(filepath.Join(j.Dir, id, entryFile)) {
+			return nil, fmt.Errorf("no history entry %s", id)
+		}
+		return j.load(id)
+	}
+
+	entries, err := j.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].UndoneBy == "" {
+			return entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no history entry to undo")
+}
+
+// load reads the entry file of an entry
+func (j *Journal) load(id string) (*Entry, error) {
+	data, err := os.ReadFile(filepath.Join(j.Dir, id, entryFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history entry %s: %w", id, err)
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse history entry %s: %w", id, err)
+	}
+	entry.ID = id
+	return &entry, nil
+}
+
+// ReadEntrySnapshot returns the configuration snapshot recorded with an entry
+func (j *Journal) ReadEntrySnapshot(entry *Entry) ([]byte, error) {
+	if !entry.Snapshot {
+		return nil, fmt.Errorf("history entry %s has no snapshot of %s", entry.ID, entry.File)
+	}
+	data, err := os.ReadFile(filepath.Join(j.Dir, entry.ID, snapshotFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history snapshot: %w", err)
+	}
+	return data, nil
+}
+
+// MarkUndone records that entry was reversed by the undo entry undoneBy
+func (j *Journal) MarkUndone(entry *Entry, undoneBy *Entry) error {
+	entry.UndoneBy = undoneBy.ID
+	entry.UndoneAt = &undoneBy.Time
+	return j.save(entry)
+}
+
+// FromReport adds the packages installed and removed according to rep to entry. Versions of
+// removed packages come from before and those of installed packages from after; either may be nil.
+func FromReport(entry *Entry, rep *report.Report, before *lock.Versions, after *lock.Versions) {
+	for _, result := range rep.Results {
+		pkgInfo := types.PackageInfo{Name: result.Name, ID: result.ID}
+		switch result.Status {
+		case report.StatusInstalled:
+			entry.Installed = append(entry.Installed, newPackage(result.Type, pkgInfo, after))
+		case report.StatusRemoved:
+			// Removals name mas apps as "ID (Name)"
+			if result.Type == "mas" {
+				pkgInfo = prune.RemovedPackageInfo(result.Type, result.Name)
+			}
+			entry.Removed = append(entry.Removed, newPackage(result.Type, pkgInfo, before))
+		}
+	}
+}
+
+// FromUpgrade adds the packages of outdated that rep records as upgraded to entry, with the
+// version they had before the upgrade and the version they were upgraded to
+func FromUpgrade(entry *Entry, rep *report.Report, outdated []upgrade.Package) {
+	for _, result := range rep.Results {
+		if result.Status != report.StatusUpgraded {
+			continue
+		}
+		for _, pkg := range outdated {
+			if pkg.Type == result.Type && pkg.Name == result.Name && pkg.ID == result.ID {
+				entry.Upgraded = append(entry.Upgraded, Package{Type: pkg.Type, Name: pkg.Name, ID: pkg.ID, Version: pkg.Latest, PreviousVersion: pkg.Installed})
+				break
+			}
+		}
+	}
+}
+
+// newPackage converts package info into a journal package
+func newPackage(pkgType string, pkgInfo types.PackageInfo, versions *lock.Versions) Package {
+	pkg := Package{Type: pkgType, Name: pkgInfo.Name, ID: pkgInfo.ID}
+	if versions != nil {
+		pkg.Version, _ = versions.Get(pkgType, pkgInfo)
+	}
+	return pkg
+}
+
+// Undo reverses entry: it reinstalls removed packages, removes installed ones and restores the
+// configuration snapshot if the command edited the configuration. Packages already in the state
+// undo would bring them to are skipped, and so are upgrades, since Homebrew and mas cannot
+// downgrade. Outcomes are recorded in rep.
+//
+// Undo refuses to restore a configuration that changed after the entry, which would discard the
+// later changes, unless options.Force is set. The replaced file is backed up first.
+func (j *Journal) Undo(r runner.Runner, installed *state.Snapshot, rep *report.Report, entry *Entry, options *types.UndoOptions) error {
+	dryRun := options.DryRun
+	var snapshot []byte
+	if entry.ConfigChanged {
+		var err error
+		if snapshot, err = j.ReadEntrySnapshot(entry); err != nil {
+			return err
+		}
+		if err := checkFile(entry, options.Force); err != nil {
+			return err
+		}
+	}
+
+	// Reinstall removed packages, in install order
+	for _, pkgType := range brew.InstallOrder {
+		for _, pkg := range entry.Removed {
+			if pkg.Type != pkgType {
+				continue
+			}
+			pkgInfo := types.PackageInfo{Name: pkg.Name, ID: pkg.ID}
+			result := report.Result{Type: pkg.Type, Name: pkg.Name, ID: pkg.ID, Status: report.StatusInstalled}
+			switch {
+			case installed.IsInstalled(pkg.Type, pkgInfo):
+				result.Status = report.StatusAlreadyPresent
+			case dryRun:
+				utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would reinstall %s: %s", pkg.Type, pkg.Name))
+				result.Status = report.StatusSkipped
+				result.Message = "dry run"
+			default:
+				rep.Add(reinstall(r, installed, pkg, options.Verbose))
+				continue
+			}
+			rep.Add(result)
+		}
+	}
+
+	// Remove installed packages, in removal order
+	for _, pkgType := range prune.RemovalOrder {
+		for _, pkg := range entry.Installed {
+			if pkg.Type != pkgType {
+				continue
+			}
+			pkgInfo := types.PackageInfo{Name: pkg.Name, ID: pkg.ID}
+			result := report.Result{Type: pkg.Type, Name: pkg.Name, ID: pkg.ID, Status: report.StatusRemoved}
+			switch {
+			case !installed.IsInstalled(pkg.Type, pkgInfo):
+				result.Status = report.StatusSkipped
+				result.Message = "not installed"
+			case dryRun:
+				utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would remove %s: %s", pkg.Type, pkg.Name))
+				result.Status = report.StatusSkipped
+				result.Message = "dry run"
+			default:
+				rep.Add(remove(r, installed, pkg))
+				continue
+			}
+			rep.Add(result)
+		}
+	}
+
+	// Upgrades cannot be reversed
+	for _, pkg := range entry.Upgraded {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Cannot downgrade %s: %s to %s", pkg.Type, pkg.Name, pkg.PreviousVersion))
+		rep.Add(report.Result{Type: pkg.Type, Name: pkg.Name, ID: pkg.ID, Status: report.StatusSkipped,
+			Message: fmt.Sprintf("upgrades cannot be undone (was %s)", pkg.PreviousVersion)})
+	}
+
+	if snapshot == nil {
+		return nil
+	}
+	if dryRun {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would restore %s as of %s", entry.File, entry.Time.Local().Format("2006-01-02 15:04:05")))
+		return nil
+	}
+	if err := utils.CreateBackup(entry.File); err != nil {
+		return err
+	}
+	if err := os.WriteFile(entry.File, snapshot, 0644); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", entry.File, err)
+	}
+	utils.PrintStatus(utils.Green, fmt.Sprintf("Restored %s as of %s", entry.File, entry.Time.Local().Format("2006-01-02 15:04:05")))
+	return nil
+}
+
+// checkFile fails if the configuration file changed after entry, unless force is set.
+// Entries recorded without a hash cannot be checked and only produce a warning.
+func checkFile(entry *Entry, force bool) error {
+	if entry.FileHash == "" {
+		utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: history entry %s has no hash of %s, so later changes to it cannot be detected", entry.ID, entry.File))
+		return nil
+	}
+
+	hash, err := hashFile(entry.File)
+	if err != nil {
+		return err
+	}
+	if hash == entry.FileHash {
+		return nil
+	}
+	if !force {
+		return fmt.Errorf("%s changed after history entry %s, and restoring it would discard those changes; use --force to restore it anyway", entry.File, entry.ID)
+	}
+	utils.PrintStatus(utils.Yellow, fmt.Sprintf("Warning: %s changed after history entry %s; restoring it anyway", entry.File, entry.ID))
+	return nil
+}
+
+// reinstall installs a package removed by an entry
+func reinstall(r runner.Runner, installed *state.Snapshot, pkg Package, verbose bool) report.Result {
+	pkgInfo := types.PackageInfo{Name: pkg.Name, ID: pkg.ID}
+	result := report.Result{Type: pkg.Type, Name: pkg.Name, ID: pkg.ID, Status: report.StatusInstalled}
+
+	start := time.Now()
+	err := brew.InstallSinglePackage(r, pkg.Type, pkgInfo, verbose)
+	result.Duration = time.Since(start)
+	if err != nil {
+		utils.PrintStatus(utils.Red, fmt.Sprintf("Failed to reinstall %s: %s - %v", pkg.Type, pkg.Name, err))
+		result.Status = report.StatusFailed
+		result.Error = err.Error()
+		result.Output = runner.ErrorOutput(err)
+		return result
+	}
+
+	installed.MarkInstalled(pkg.Type, pkgInfo)
+	utils.PrintStatus(utils.Green, fmt.Sprintf("Reinstalled %s: %s", pkg.Type, pkg.Name))
+	return result
+}
+
+// remove removes a package installed by an entry
+func remove(r runner.Runner, installed *state.Snapshot, pkg Package) report.Result {
+	pkgInfo := types.PackageInfo{Name: pkg.Name, ID: pkg.ID}
+
+	// Removals name mas apps as "ID (Name)"
+	name := pkg.Name
+	if pkg.Type == "mas" {
+		name = fmt.Sprintf("%d (%s)", pkg.ID, pkg.Name)
+	}
+	result := report.Result{Type: pkg.Type, Name: name, ID: pkg.ID, Status: report.StatusRemoved}
+
+	start := time.Now()
+	err := prune.RemovePackage(r, pkg.Type, name)
+	result.Duration = time.Since(start)
+	if err != nil {
+		utils.PrintStatus(utils.Red, fmt.Sprintf("Failed to remove %s: %s - %v", pkg.Type, pkg.Name, err))
+		result.Status = report.StatusFailed
+		result.Error = err.Error()
+		result.Output = runner.ErrorOutput(err)
+		return result
+	}
+
+	installed.MarkRemoved(pkg.Type, pkgInfo)
+	utils.PrintStatus(utils.Green, fmt.Sprintf("Removed %s: %s", pkg.Type, pkg.Name))
+	return result
+}
@@ -0,0 +1,506 @@
+package journal_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/journal"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lock"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/upgrade"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+func TestJournal(t *testing.T) {
+	t.Parallel()
+
+	j := &journal.Journal{Dir: filepath.Join(t.TempDir(), "history")}
+	at := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+
+	if entries, err := j.List(); err != nil || len(entries) != 0 {
+		t.Fatalf("List() of a new journal = %v, %v, want no entries", entries, err)
+	}
+	if _, err := j.Get(""); err == nil {
+		t.Error("Get(\"\") of a new journal error = nil, want an error")
+	}
+
+	first := &journal.Entry{Time: at, Command: "install", File: "packages.yaml", ConfigChanged: true}
+	if err := j.Record(first, []byte("groups: {}\n")); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	second := &journal.Entry{Time: at, Command: "prune", File: "packages.yaml"}
+	if err := j.Record(second, nil); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	third := &journal.Entry{Time: at.Add(time.Minute), Command: "sync"}
+	if err := j.Record(third, nil); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	if first.ID != "20261018-093000" || second.ID != "20261018-093000-2" || third.ID != "20261018-093100" {
+		t.Errorf("Record() IDs = %s, %s, %s, want 20261018-093000, 20261018-093000-2, 20261018-093100", first.ID, second.ID, third.ID)
+	}
+	if !first.Snapshot || second.Snapshot {
+		t.Errorf("Record() snapshots = %v, %v, want true, false", first.Snapshot, second.Snapshot)
+	}
+
+	entries, err := j.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	if want := []string{first.ID, second.ID, third.ID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("List() = %v, want %v", ids, want)
+	}
+
+	snapshot, err := j.ReadEntrySnapshot(entries[0])
+	if err != nil || string(snapshot) != "groups: {}\n" {
+		t.Errorf("ReadEntrySnapshot() = %q, %v, want %q", snapshot, err, "groups: {}\n")
+	}
+	if _, err := j.ReadEntrySnapshot(entries[1]); err == nil {
+		t.Error("ReadEntrySnapshot() of an entry without a snapshot error = nil, want an error")
+	}
+
+	undo := &journal.Entry{Time: at.Add(2 * time.Minute), Command: "undo"}
+	if err := j.Record(undo, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []*journal.Entry{undo, third} {
+		if err := j.MarkUndone(entry, undo); err != nil {
+			t.Fatalf("MarkUndone() error = %v", err)
+		}
+	}
+
+	latest, err := j.Get("")
+	if err != nil || latest.ID != second.ID {
+		t.Errorf("Get(\"\") = %v, %v, want entry %s", latest, err, second.ID)
+	}
+	got, err := j.Get(third.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.UndoneBy != undo.ID || got.UndoneAt == nil || !got.UndoneAt.Equal(undo.Time) {
+		t.Errorf("Get() undone by %s at %v, want %s at %v", got.UndoneBy, got.UndoneAt, undo.ID, undo.Time)
+	}
+	if _, err := j.Get("20200101-000000"); err == nil {
+		t.Error("Get() of a missing entry error = nil, want an error")
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "packages.yaml")
+	if err := os.WriteFile(filePath, []byte("groups: {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		filePath string
+		want     []byte
+		wantErr  bool
+	}{
+		{"existing file", filePath, []byte("groups: {}\n"), false},
+		{"missing file", filepath.Join(dir, "missing.yaml"), nil, false},
+		{"directory", dir, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := journal.ReadSnapshot(tt.filePath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadSnapshot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadSnapshot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntry_Empty(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		entry journal.Entry
+		want  bool
+	}{
+		{"no changes", journal.Entry{Command: "install", Snapshot: true}, true},
+		{"installed", journal.Entry{Installed: []journal.Package{{Type: "brew", Name: "git"}}}, false},
+		{"removed", journal.Entry{Removed: []journal.Package{{Type: "brew", Name: "git"}}}, false},
+		{"upgraded", journal.Entry{Upgraded: []journal.Package{{Type: "brew", Name: "git"}}}, false},
+		{"configuration changed", journal.Entry{ConfigChanged: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.entry.Empty(); got != tt.want {
+				t.Errorf("Entry.Empty() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromReport(t *testing.T) {
+	t.Parallel()
+
+	fake, err := runner.LoadFixtures(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := lock.QueryVersions(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep := report.New("install")
+	rep.Add(report.Result{Type: "brew", Name: "jq", Status: report.StatusInstalled})
+	rep.Add(report.Result{Type: "brew", Name: "git", Status: report.StatusAlreadyPresent})
+	rep.Add(report.Result{Type: "cask", Name: "firefox", Status: report.StatusFailed})
+	rep.Add(report.Result{Type: "brew", Name: "fd", Status: report.StatusRemoved})
+	rep.Add(report.Result{Type: "mas", Name: "1475387142 (Tailscale)", ID: 1475387142, Status: report.StatusRemoved})
+
+	tests := []struct {
+		name          string
+		before        *lock.Versions
+		after         *lock.Versions
+		wantInstalled []journal.Package
+		wantRemoved   []journal.Package
+	}{
+		{
+			"with versions",
+			versions,
+			versions,
+			[]journal.Package{{Type: "brew", Name: "jq", Version: "1.7.1"}},
+			[]journal.Package{{Type: "brew", Name: "fd"}, {Type: "mas", Name: "Tailscale", ID: 1475387142, Version: "1.66.4"}},
+		},
+		{
+			"without versions",
+			nil,
+			nil,
+			[]journal.Package{{Type: "brew", Name: "jq"}},
+			[]journal.Package{{Type: "brew", Name: "fd"}, {Type: "mas", Name: "Tailscale", ID: 1475387142}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			entry := &journal.Entry{}
+			journal.FromReport(entry, rep, tt.before, tt.after)
+			if !reflect.DeepEqual(entry.Installed, tt.wantInstalled) {
+				t.Errorf("FromReport() installed = %+v, want %+v", entry.Installed, tt.wantInstalled)
+			}
+			if !reflect.DeepEqual(entry.Removed, tt.wantRemoved) {
+				t.Errorf("FromReport() removed = %+v, want %+v", entry.Removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestFromUpgrade(t *testing.T) {
+	t.Parallel()
+
+	outdated := []upgrade.Package{
+		{Type: "brew", Name: "git", Installed: "2.45.0", Latest: "2.46.0"},
+		{Type: "brew", Name: "jq", Installed: "1.7.0", Latest: "1.7.1", Pinned: true},
+		{Type: "cask", Name: "google-chrome", Installed: "126.0.6478.127", Latest: "127.0.6533.73"},
+		{Type: "mas", Name: "Xcode", ID: 497799835, Installed: "15.4", Latest: "16.0"},
+	}
+	rep := report.New("upgrade")
+	rep.Add(report.Result{Type: "brew", Name: "git", Status: report.StatusUpgraded})
+	rep.Add(report.Result{Type: "brew", Name: "jq", Status: report.StatusSkipped})
+	rep.Add(report.Result{Type: "cask", Name: "google-chrome", Status: report.StatusFailed})
+	rep.Add(report.Result{Type: "mas", Name: "Xcode", ID: 497799835, Status: report.StatusUpgraded})
+
+	entry := &journal.Entry{}
+	journal.FromUpgrade(entry, rep, outdated)
+
+	want := []journal.Package{
+		{Type: "brew", Name: "git", Version: "2.46.0", PreviousVersion: "2.45.0"},
+		{Type: "mas", Name: "Xcode", ID: 497799835, Version: "16.0", PreviousVersion: "15.4"},
+	}
+	if !reflect.DeepEqual(entry.Upgraded, want) {
+		t.Errorf("FromUpgrade() upgraded = %+v, want %+v", entry.Upgraded, want)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		dryRun      bool
+		failing     []string
+		want        []string
+		statuses    map[string]report.Status
+		wantRestore bool
+	}{
+		{
+			"reverses the entry",
+			false,
+			nil,
+			[]string{"brew install fd", "mas install 1000000001", "brew uninstall --cask slack", "brew uninstall jq"},
+			map[string]report.Status{
+				"brew:fd":      report.StatusInstalled,
+				"brew:git":     report.StatusAlreadyPresent,
+				"mas:Pages":    report.StatusInstalled,
+				"cask:slack":   report.StatusRemoved,
+				"brew:jq":      report.StatusRemoved,
+				"cask:firefox": report.StatusSkipped,
+				"brew:wget":    report.StatusSkipped,
+			},
+			true,
+		},
+		{
+			"dry run",
+			true,
+			nil,
+			[]string{},
+			map[string]report.Status{
+				"brew:fd":      report.StatusSkipped,
+				"brew:git":     report.StatusAlreadyPresent,
+				"mas:Pages":    report.StatusSkipped,
+				"cask:slack":   report.StatusSkipped,
+				"brew:jq":      report.StatusSkipped,
+				"cask:firefox": report.StatusSkipped,
+				"brew:wget":    report.StatusSkipped,
+			},
+			false,
+		},
+		{
+			"failed commands",
+			false,
+			[]string{"brew install fd", "brew uninstall jq"},
+			[]string{"brew install fd", "mas install 1000000001", "brew uninstall --cask slack", "brew uninstall jq"},
+			map[string]report.Status{
+				"brew:fd":      report.StatusFailed,
+				"brew:git":     report.StatusAlreadyPresent,
+				"mas:Pages":    report.StatusInstalled,
+				"cask:slack":   report.StatusRemoved,
+				"brew:jq":      report.StatusFailed,
+				"cask:firefox": report.StatusSkipped,
+				"brew:wget":    report.StatusSkipped,
+			},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fixtures, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			commands := [][]string{
+				{"brew", "install", "fd"},
+				{"mas", "install", "1000000001"},
+				{"brew", "uninstall", "--cask", "slack"},
+				{"brew", "uninstall", "jq"},
+			}
+			for _, argv := range commands {
+				exitCode := 0
+				for _, failing := range tt.failing {
+					if runner.CommandKey(argv[0], argv[1:]...) == failing {
+						exitCode = 1
+					}
+				}
+				fake.Script(runner.Response{ExitCode: exitCode}, argv[0], argv[1:]...)
+			}
+			installed, err := state.Load(fake)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			j := &journal.Journal{Dir: filepath.Join(dir, "history")}
+			filePath := filepath.Join(dir, "packages.yaml")
+			if err := os.WriteFile(filePath, []byte("groups:\n  core: {}\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			entry := &journal.Entry{
+				Command:       "sync --add",
+				File:          filePath,
+				ConfigChanged: true,
+				Installed: []journal.Package{
+					{Type: "brew", Name: "jq"},
+					{Type: "cask", Name: "slack"},
+					{Type: "cask", Name: "firefox"},
+				},
+				Removed: []journal.Package{
+					{Type: "mas", Name: "Pages", ID: 1000000001},
+					{Type: "brew", Name: "git"},
+					{Type: "brew", Name: "fd"},
+				},
+				Upgraded: []journal.Package{{Type: "brew", Name: "wget", Version: "1.24.5", PreviousVersion: "1.21.4"}},
+			}
+			if err := j.Record(entry, []byte("groups: {}\n")); err != nil {
+				t.Fatal(err)
+			}
+
+			rep := report.New("undo")
+			if err := j.Undo(fake, installed, rep, entry, &types.UndoOptions{DryRun: tt.dryRun}); err != nil {
+				t.Fatalf("Undo() error = %v", err)
+			}
+
+			calls := []string{}
+			for _, call := range fake.Calls() {
+				if _, ok := fixtures.Responses[call]; !ok {
+					calls = append(calls, call)
+				}
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("Undo() ran %q, want %q", calls, tt.want)
+			}
+
+			got := make(map[string]report.Status)
+			for _, result := range rep.Results {
+				got[result.Type+":"+result.Name] = result.Status
+			}
+			if !reflect.DeepEqual(got, tt.statuses) {
+				t.Errorf("Undo() statuses = %v, want %v", got, tt.statuses)
+			}
+
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored := string(data) == "groups: {}\n"; restored != tt.wantRestore {
+				t.Errorf("Undo() restored the configuration = %v, want %v", restored, tt.wantRestore)
+			}
+		})
+	}
+}
+
+func TestUndo_MissingSnapshot(t *testing.T) {
+	t.Parallel()
+
+	fake, err := runner.LoadFixtures(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := &journal.Journal{Dir: filepath.Join(t.TempDir(), "history")}
+	entry := &journal.Entry{Command: "sync --add", File: "packages.yaml", ConfigChanged: true, Installed: []journal.Package{{Type: "brew", Name: "jq"}}}
+	if err := j.Record(entry, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rep := report.New("undo")
+	if err := j.Undo(fake, state.NewSnapshot(), rep, entry, &types.UndoOptions{}); err == nil {
+		t.Error("Undo() error = nil, want an error")
+	}
+	if len(rep.Results) != 0 || len(fake.Calls()) != 0 {
+		t.Errorf("Undo() changed packages before failing: results %v, calls %v", rep.Results, fake.Calls())
+	}
+}
+
+func TestUndo_ChangedFile(t *testing.T) {
+	t.Parallel()
+
+	const before = "groups: {}\n"
+	const after = "groups:\n  core: {}\n"
+	const edited = "groups:\n  core: {}\n  media: {}\n"
+
+	tests := []struct {
+		name        string
+		recorded    bool // The file exists when the entry is recorded, so the entry has a hash
+		content     string
+		force       bool
+		wantErr     bool
+		wantContent string
+		wantBackup  bool
+	}{
+		{"unchanged", true, after, false, false, before, true},
+		{"changed", true, edited, false, true, edited, false},
+		{"changed, forced", true, edited, true, false, before, true},
+		{"entry without a hash", false, edited, false, false, before, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			j := &journal.Journal{Dir: filepath.Join(dir, "history")}
+			filePath := filepath.Join(dir, "packages.yaml")
+			if tt.recorded {
+				if err := os.WriteFile(filePath, []byte(after), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			entry := &journal.Entry{Command: "sync --add", File: filePath, ConfigChanged: true, Installed: []journal.Package{{Type: "brew", Name: "fd"}}}
+			if err := j.Record(entry, []byte(before)); err != nil {
+				t.Fatal(err)
+			}
+			if (entry.FileHash != "") != tt.recorded {
+				t.Fatalf("Record() file hash = %q, want one: %v", entry.FileHash, tt.recorded)
+			}
+			if err := os.WriteFile(filePath, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			fake := runner.NewFakeRunner()
+			rep := report.New("undo")
+			err := j.Undo(fake, state.NewSnapshot(), rep, entry, &types.UndoOptions{Force: tt.force})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Undo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && len(rep.Results) != 0 {
+				t.Errorf("Undo() changed packages before refusing: %v", rep.Results)
+			}
+
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.wantContent {
+				t.Errorf("Undo() left %q, want %q", data, tt.wantContent)
+			}
+
+			backups, err := filepath.Glob(filePath + ".*.backup")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(backups) == 1) != tt.wantBackup {
+				t.Fatalf("Undo() backups = %v, want one: %v", backups, tt.wantBackup)
+			}
+			if tt.wantBackup {
+				if backup, err := os.ReadFile(backups[0]); err != nil || string(backup) != tt.content {
+					t.Errorf("Undo() backup = %q, %v, want %q", backup, err, tt.content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,515 @@
+package lint
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/metadata"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity is how serious a finding is: errors fail lint, warnings do not
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Rule is a lint check with an ID used in output and in ignore comments
+type Rule struct {
+	ID          string   `json:"id" yaml:"id"`
+	Severity    Severity `json:"severity" yaml:"severity"`
+	Description string   `json:"description" yaml:"description"`
+	Fixable     bool     `json:"fixable" yaml:"fixable"` // Findings of this rule can be fixed with lint --fix
+	check       func(c *checkContext) []Finding
+}
+
+// Finding is a problem found by a rule, positioned in the linted file
+type Finding struct {
+	Rule    *Rule
+	Path    []string // Location in the configuration, e.g. ["groups", "core", "packages", "brew", "2"]
+	Line    int
+	Column  int
+	Message string
+
+	fix func(config *types.PackageGrouped)
+}
+
+// Fixable reports whether lint --fix can fix the finding
+func (f Finding) Fixable() bool {
+	return f.fix != nil
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%d:%d: %s %s: %s", f.Line, f.Column, f.Rule.Severity, f.Rule.ID, f.Message)
+}
+
+// Result is the outcome of linting one file
+type Result struct {
+	File     string
+	Findings []Finding // Findings that are not silenced, in file order
+	Silenced int       // Number of findings silenced by ignore comments
+}
+
+// Errors returns the number of findings with error severity
+func (r *Result) Errors() int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Rule.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+// Fixable returns the findings that lint --fix can fix
+func (r *Result) Fixable() []Finding {
+	var fixable []Finding
+	for _, f := range r.Findings {
+		if f.Fixable() {
+			fixable = append(fixable, f)
+		}
+	}
+	return fixable
+}
+
+// checkContext is what rules check: the file itself, the file merged with its includes and
+// overlays for references that may be defined elsewhere, and the metadata cache
+type checkContext struct {
+	config *types.PackageGrouped
+	merged *types.PackageGrouped
+	meta   *metadata.Cache
+}
+
+// Rules are the lint rules, in the order they run
+var Rules = []*Rule{
+	{ID: "duplicate-package", Severity: SeverityError, Fixable: true, check: checkDuplicatePackages,
+		Description: "A package is listed more than once; later entries are removed by --fix"},
+	{ID: "duplicate-mas-id", Severity: SeverityError, check: checkDuplicateMasIDs,
+		Description: "The same Mac App Store ID is listed under different names"},
+	{ID: "unknown-group", Severity: SeverityError, check: checkProfileGroups,
+		Description: "A profile includes or excludes a group that does not exist"},
+	{ID: "unused-tag", Severity: SeverityWarning, check: checkProfileTags,
+		Description: "A profile includes or excludes a tag that no package has"},
+	{ID: "cask-as-brew", Severity: SeverityError, Fixable: true, check: checkCasksAsBrews,
+		Description: "A cask is listed under brew (uses the metadata cache); --fix moves it to cask"},
+	{ID: "undeclared-tap", Severity: SeverityWarning, Fixable: true, check: checkUndeclaredTaps,
+		Description: "A tap-qualified formula or cask comes from a tap that is not listed; --fix adds the tap to its group"},
+	{ID: "duplicate-priority", Severity: SeverityWarning, check: checkDuplicatePriorities,
+		Description: "Groups share a priority, so they install in name order"},
+	{ID: "unsorted-packages", Severity: SeverityWarning, Fixable: true, check: checkUnsortedPackages,
+		Description: "A package list is not sorted by name; --fix sorts it"},
+}
+
+// ignorePattern matches ignore comments such as "# lint:ignore duplicate-package, unsorted-packages"
+var ignorePattern = regexp.MustCompile(`#\s*lint:ignore\s+([a-z-]+(?:\s*,\s*[a-z-]+)*)`)
+
+// Lint checks a YAML configuration file with every rule. cask-as-brew looks packages up in meta,
+// which may be nil. Findings on a line with an ignore comment naming their rule (or "all"), or on the
+// line after a comment-only line with one, are silenced.
+func Lint(filePath string, meta *metadata.Cache) (*Result, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read YAML file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	var config types.PackageGrouped
+	if err := root.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	merged, err := yamlPkg.LoadMergedConfig(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge configuration (run validate for details): %w", err)
+	}
+
+	c := &checkContext{config: &config, merged: merged, meta: meta}
+	ignores := ignoreComments(string(data))
+	result := &Result{File: filePath}
+	for _, rule := range Rules {
+		for _, f := range rule.check(c) {
+			f.Rule = rule
+			node, _ := yamlPkg.Locate(&root, f.Path)
+			f.Line, f.Column = node.Line, node.Column
+			if ignored(ignores, f) {
+				result.Silenced++
+				continue
+			}
+			result.Findings = append(result.Findings, f)
+		}
+	}
+
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		fi, fj := result.Findings[i], result.Findings[j]
+		if fi.Line != fj.Line {
+			return fi.Line < fj.Line
+		}
+		return fi.Column < fj.Column
+	})
+	return result, nil
+}
+
+// Fix applies the fixes of findings to the file and saves it, returning the number of fixes applied
+func Fix(filePath string, findings []Finding) (int, error) {
+	config, err := yamlPkg.LoadGroupedConfig(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	fixed := 0
+	for _, f := range findings {
+		if f.Fixable() {
+			f.fix(config)
+			fixed++
+		}
+	}
+	if fixed == 0 {
+		return 0, nil
+	}
+
+	if err := yamlPkg.SaveGroupedConfig(config, filePath); err != nil {
+		return 0, err
+	}
+	return fixed, nil
+}
+
+// ignoreComments returns the rule IDs named by ignore comments, by line number. Comment-only
+// lines are recorded as negative line numbers, as they silence the line after them.
+func ignoreComments(content string) map[int][]string {
+	ignores := make(map[int][]string)
+	for i, line := range strings.Split(content, "\n") {
+		match := ignorePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		ids := strings.Split(match[1], ",")
+		for j := range ids {
+			ids[j] = strings.TrimSpace(ids[j])
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			ignores[-(i + 1)] = ids
+		} else {
+			ignores[i+1] = ids
+		}
+	}
+	return ignores
+}
+
+// ignored reports whether an ignore comment silences a finding
+func ignored(ignores map[int][]string, f Finding) bool {
+	for _, ids := range [][]string{ignores[f.Line], ignores[-(f.Line - 1)]} {
+		for _, id := range ids {
+			if id == f.Rule.ID || id == "all" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// groupOrder returns the group names of a configuration in install order: by priority, then by name
+func groupOrder(config *types.PackageGrouped) []string {
+	names := make([]string, 0, len(config.Groups))
+	for name := range config.Groups {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, pj := config.Groups[names[i]].Priority, config.Groups[names[j]].Priority
+		if pi != pj {
+			return pi < pj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// packagePath returns the location of the ith package of a type in a group
+func packagePath(groupName, pkgType string, i int) []string {
+	return []string{"groups", groupName, "packages", pkgType, strconv.Itoa(i)}
+}
+
+// removeLast removes the last package of a type in a group whose key is key
+func removeLast(config *types.PackageGrouped, groupName, pkgType, key string) {
+	pkgs := config.Groups[groupName].Packages[pkgType]
+	for i := len(pkgs) - 1; i >= 0; i-- {
+		if yamlPkg.PackageKey(pkgType, pkgs[i]) == key {
+			config.Groups[groupName].Packages[pkgType] = append(pkgs[:i:i], pkgs[i+1:]...)
+			return
+		}
+	}
+}
+
+// addPackage adds a package of a type to a group unless the group already has it
+func addPackage(config *types.PackageGrouped, groupName, pkgType string, pkgInfo types.PackageInfo) {
+	group := config.Groups[groupName]
+	if group.Packages == nil {
+		group.Packages = make(map[string][]types.PackageInfo)
+	}
+	key := yamlPkg.PackageKey(pkgType, pkgInfo)
+	for _, existing := range group.Packages[pkgType] {
+		if yamlPkg.PackageKey(pkgType, existing) == key {
+			return
+		}
+	}
+	group.Packages[pkgType] = yamlPkg.InsertPackage(group.Packages[pkgType], pkgInfo)
+	config.Groups[groupName] = group
+}
+
+// checkDuplicatePackages finds packages listed again after their first entry in install order
+func checkDuplicatePackages(c *checkContext) []Finding {
+	type entry struct {
+		group string
+		name  string
+	}
+
+	var findings []Finding
+	seen := make(map[string]entry)
+	for _, groupName := range groupOrder(c.config) {
+		for _, pkgType := range types.PackageTypes {
+			for i, pkgInfo := range c.config.Groups[groupName].Packages[pkgType] {
+				key := yamlPkg.PackageKey(pkgType, pkgInfo)
+				first, ok := seen[key]
+				if !ok {
+					seen[key] = entry{groupName, pkgInfo.Name}
+					continue
+				}
+				// The same mas ID under another name is reported by duplicate-mas-id
+				if pkgType == "mas" && pkgInfo.Name != first.name {
+					continue
+				}
+
+				groupName := groupName
+				findings = append(findings, Finding{
+					Path:    packagePath(groupName, pkgType, i),
+					Message: fmt.Sprintf("%s %s is already in group %s", pkgType, pkgInfo.Name, first.group),
+					fix: func(config *types.PackageGrouped) {
+						removeLast(config, groupName, pkgType, key)
+					},
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// checkDuplicateMasIDs finds Mac App Store IDs listed under more than one name
+func checkDuplicateMasIDs(c *checkContext) []Finding {
+	type entry struct {
+		group string
+		name  string
+	}
+
+	var findings []Finding
+	seen := make(map[int64]entry)
+	for _, groupName := range groupOrder(c.config) {
+		for i, pkgInfo := range c.config.Groups[groupName].Packages["mas"] {
+			if pkgInfo.ID == 0 {
+				continue
+			}
+			first, ok := seen[pkgInfo.ID]
+			if !ok {
+				seen[pkgInfo.ID] = entry{groupName, pkgInfo.Name}
+				continue
+			}
+			if pkgInfo.Name != first.name {
+				findings = append(findings, Finding{
+					Path: packagePath(groupName, "mas", i),
+					Message: fmt.Sprintf("mas app %d is named %q here and %q in group %s",
+						pkgInfo.ID, pkgInfo.Name, first.name, first.group),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// profileLists calls fn for every entry of the named lists of every profile, in name order
+func profileLists(config *types.PackageGrouped, lists map[string]func(types.Profile) []string, fn func(profile, list string, i int, value string)) {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	listNames := make([]string, 0, len(lists))
+	for name := range lists {
+		listNames = append(listNames, name)
+	}
+	sort.Strings(listNames)
+
+	for _, name := range names {
+		for _, list := range listNames {
+			for i, value := range lists[list](config.Profiles[name]) {
+				fn(name, list, i, value)
+			}
+		}
+	}
+}
+
+// checkProfileGroups finds profile groups and excluded groups that are not defined
+func checkProfileGroups(c *checkContext) []Finding {
+	var findings []Finding
+	profileLists(c.config, map[string]func(types.Profile) []string{
+		"groups":         func(p types.Profile) []string { return p.Groups },
+		"exclude_groups": func(p types.Profile) []string { return p.ExcludeGroups },
+	}, func(profile, list string, i int, group string) {
+		if _, ok := c.merged.Groups[group]; !ok {
+			findings = append(findings, Finding{
+				Path:    []string{"profiles", profile, list, strconv.Itoa(i)},
+				Message: fmt.Sprintf("profile %s references undefined group %s", profile, group),
+			})
+		}
+	})
+	return findings
+}
+
+// checkProfileTags finds profile tags and excluded tags that no package has
+func checkProfileTags(c *checkContext) []Finding {
+	used := make(map[string]bool)
+	for _, group := range c.merged.Groups {
+		for _, pkgInfos := range group.Packages {
+			for _, pkgInfo := range pkgInfos {
+				for _, tag := range pkgInfo.Tags {
+					used[tag] = true
+				}
+			}
+		}
+	}
+
+	var findings []Finding
+	profileLists(c.config, map[string]func(types.Profile) []string{
+		"tags":         func(p types.Profile) []string { return p.Tags },
+		"exclude_tags": func(p types.Profile) []string { return p.ExcludeTags },
+	}, func(profile, list string, i int, tag string) {
+		if !used[tag] {
+			findings = append(findings, Finding{
+				Path:    []string{"profiles", profile, list, strconv.Itoa(i)},
+				Message: fmt.Sprintf("profile %s uses tag %s, which no package has", profile, tag),
+			})
+		}
+	})
+	return findings
+}
+
+// checkCasksAsBrews finds brew entries that the metadata cache knows only as casks
+func checkCasksAsBrews(c *checkContext) []Finding {
+	var findings []Finding
+	for _, groupName := range groupOrder(c.config) {
+		for i, pkgInfo := range c.config.Groups[groupName].Packages["brew"] {
+			if _, ok := c.meta.Lookup("brew", pkgInfo.Name); ok {
+				continue
+			}
+			if _, ok := c.meta.Lookup("cask", pkgInfo.Name); !ok {
+				continue
+			}
+
+			groupName, pkgInfo := groupName, pkgInfo
+			findings = append(findings, Finding{
+				Path:    packagePath(groupName, "brew", i),
+				Message: fmt.Sprintf("%s is a cask, not a formula", pkgInfo.Name),
+				fix: func(config *types.PackageGrouped) {
+					removeLast(config, groupName, "brew", yamlPkg.PackageKey("brew", pkgInfo))
+					addPackage(config, groupName, "cask", pkgInfo)
+				},
+			})
+		}
+	}
+	return findings
+}
+
+// checkUndeclaredTaps finds tap-qualified formulae and casks such as owner/tap/name whose tap
+// is not listed. The homebrew/core and homebrew/cask taps are always available.
+func checkUndeclaredTaps(c *checkContext) []Finding {
+	declared := map[string]bool{"homebrew/core": true, "homebrew/cask": true}
+	for _, group := range c.merged.Groups {
+		for _, tap := range group.Packages["tap"] {
+			declared[strings.ToLower(tap.Name)] = true
+		}
+	}
+
+	var findings []Finding
+	for _, groupName := range groupOrder(c.config) {
+		for _, pkgType := range []string{"brew", "cask"} {
+			for i, pkgInfo := range c.config.Groups[groupName].Packages[pkgType] {
+				parts := strings.Split(pkgInfo.Name, "/")
+				if len(parts) != 3 {
+					continue
+				}
+				tap := strings.ToLower(parts[0] + "/" + parts[1])
+				if declared[tap] {
+					continue
+				}
+
+				groupName := groupName
+				findings = append(findings, Finding{
+					Path:    packagePath(groupName, pkgType, i),
+					Message: fmt.Sprintf("%s %s comes from tap %s, which is not listed", pkgType, pkgInfo.Name, tap),
+					fix: func(config *types.PackageGrouped) {
+						addPackage(config, groupName, "tap", types.PackageInfo{Name: tap})
+					},
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// checkDuplicatePriorities finds groups with the priority of an earlier group
+func checkDuplicatePriorities(c *checkContext) []Finding {
+	var findings []Finding
+	first := make(map[int]string)
+	for _, groupName := range groupOrder(c.config) {
+		priority := c.config.Groups[groupName].Priority
+		if priority == 0 {
+			continue
+		}
+		if other, ok := first[priority]; ok {
+			findings = append(findings, Finding{
+				Path:    []string{"groups", groupName, "priority"},
+				Message: fmt.Sprintf("group %s has the same priority (%d) as group %s, so they install in name order", groupName, priority, other),
+			})
+			continue
+		}
+		first[priority] = groupName
+	}
+	return findings
+}
+
+// checkUnsortedPackages finds package lists that are not sorted by name
+func checkUnsortedPackages(c *checkContext) []Finding {
+	var findings []Finding
+	for _, groupName := range groupOrder(c.config) {
+		for _, pkgType := range types.PackageTypes {
+			pkgs := c.config.Groups[groupName].Packages[pkgType]
+			for i := 1; i < len(pkgs); i++ {
+				if pkgs[i].Name >= pkgs[i-1].Name {
+					continue
+				}
+
+				groupName, pkgType := groupName, pkgType
+				findings = append(findings, Finding{
+					Path:    []string{"groups", groupName, "packages", pkgType},
+					Message: fmt.Sprintf("%s packages of group %s are not sorted by name (%s after %s)", pkgType, groupName, pkgs[i].Name, pkgs[i-1].Name),
+					fix: func(config *types.PackageGrouped) {
+						pkgs := config.Groups[groupName].Packages[pkgType]
+						sort.SliceStable(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+					},
+				})
+				break
+			}
+		}
+	}
+	return findings
+}
@@ -0,0 +1,262 @@
+package lint_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lint"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/metadata"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+// meta knows iterm2 only as a cask
+var meta = &metadata.Cache{Packages: map[string]map[string]metadata.Package{
+	"brew": {"git": {Name: "git"}},
+	"cask": {"iterm2": {Name: "iterm2"}},
+}}
+
+const config = `groups:
+  core:
+    description: Core
+    priority: 1
+    packages:
+      brew:
+        - name: jq
+          tags: [cli]
+        - name: git
+          tags: [cli]
+        - name: iterm2
+          tags: [cli]
+        - name: owner/tap/tool
+          tags: [cli]
+      mas:
+        - name: Xcode
+          id: 497799835
+  extra:
+    description: Extra
+    priority: 1
+    packages:
+      brew:
+        - name: git
+          tags: [cli]
+      mas:
+        - name: Xcode Beta
+          id: 497799835
+profiles:
+  work:
+    description: Work
+    groups: [core, missing]
+    tags: [cli, nothing]
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "packages.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func findings(result *lint.Result) []string {
+	var got []string
+	for _, f := range result.Findings {
+		got = append(got, f.String())
+	}
+
+	return got
+}
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		content      string
+		meta         *metadata.Cache
+		want         []string
+		wantSilenced int
+	}{
+		{
+			"every rule",
+			config,
+			meta,
+			[]string{
+				"7:9: warning unsorted-packages: brew packages of group core are not sorted by name (git after jq)",
+				"11:11: error cask-as-brew: iterm2 is a cask, not a formula",
+				"13:11: warning undeclared-tap: brew owner/tap/tool comes from tap owner/tap, which is not listed",
+				"20:15: warning duplicate-priority: group extra has the same priority (1) as group core, so they install in name order",
+				"23:11: error duplicate-package: brew git is already in group core",
+				"26:11: error duplicate-mas-id: mas app 497799835 is named \"Xcode Beta\" here and \"Xcode\" in group core",
+				"31:20: error unknown-group: profile work references undefined group missing",
+				"32:17: warning unused-tag: profile work uses tag nothing, which no package has",
+			},
+			0,
+		},
+		{
+			"no metadata cache",
+			"groups:\n  core:\n    packages:\n      brew:\n        - name: iterm2\n",
+			nil,
+			nil,
+			0,
+		},
+		{
+			"declared taps",
+			"groups:\n  core:\n    packages:\n      tap:\n        - name: Owner/Tap\n      brew:\n        - name: homebrew/core/git\n        - name: owner/tap/tool\n",
+			nil,
+			nil,
+			0,
+		},
+		{
+			"ignore comments",
+			"groups:\n  core:\n    packages:\n      brew:\n        - name: jq # lint:ignore unsorted-packages\n        - name: git\n        - name: ripgrep\n" +
+				"  extra:\n    packages:\n      brew:\n        # lint:ignore duplicate-package\n        - name: git\n        - name: jq # lint:ignore all\n" +
+				"        - name: ripgrep # lint:ignore unsorted-packages\n",
+			nil,
+			[]string{"14:11: error duplicate-package: brew ripgrep is already in group core"},
+			3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := lint.Lint(writeConfig(t, tt.content), tt.meta)
+			if err != nil {
+				t.Fatalf("Lint() error = %v", err)
+			}
+			if got := findings(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() findings = %q, want %q", got, tt.want)
+			}
+			if result.Silenced != tt.wantSilenced {
+				t.Errorf("Lint() silenced = %d, want %d", result.Silenced, tt.wantSilenced)
+			}
+		})
+	}
+}
+
+func TestLint_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"invalid YAML", "groups: [\n"},
+		{"merge error", "include: [missing.yaml]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := lint.Lint(writeConfig(t, tt.content), nil); err == nil {
+				t.Error("Lint() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	t.Parallel()
+
+	result, err := lint.Lint(writeConfig(t, config), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := result.Errors(); got != 4 {
+		t.Errorf("Result.Errors() = %d, want 4", got)
+	}
+
+	var fixable []string
+	for _, f := range result.Fixable() {
+		fixable = append(fixable, f.Rule.ID)
+	}
+	want := []string{"unsorted-packages", "cask-as-brew", "undeclared-tap", "duplicate-package"}
+	if !reflect.DeepEqual(fixable, want) {
+		t.Errorf("Result.Fixable() = %v, want %v", fixable, want)
+	}
+}
+
+func TestFix(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfig(t, config)
+	result, err := lint.Lint(path, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixed, err := lint.Fix(path, result.Findings)
+	if err != nil {
+		t.Fatalf("Fix() error = %v", err)
+	}
+	if fixed != 4 {
+		t.Errorf("Fix() = %d, want 4", fixed)
+	}
+
+	result, err = lint.Lint(path, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var remaining []string
+	for _, f := range result.Findings {
+		remaining = append(remaining, f.Rule.ID)
+	}
+	want := []string{"duplicate-priority", "duplicate-mas-id", "unknown-group", "unused-tag"}
+	if !reflect.DeepEqual(remaining, want) {
+		t.Errorf("Lint() after Fix() = %v, want %v", remaining, want)
+	}
+
+	grouped, err := yamlPkg.LoadGroupedConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packages := make(map[string][]string)
+	for pkgType, pkgs := range grouped.Groups["core"].Packages {
+		for _, pkg := range pkgs {
+			packages[pkgType] = append(packages[pkgType], pkg.Name)
+		}
+	}
+	wantPackages := map[string][]string{
+		"tap":  {"owner/tap"},
+		"brew": {"git", "jq", "owner/tap/tool"},
+		"cask": {"iterm2"},
+		"mas":  {"Xcode"},
+	}
+	if !reflect.DeepEqual(packages, wantPackages) {
+		t.Errorf("Fix() core packages = %v, want %v", packages, wantPackages)
+	}
+	if got := grouped.Groups["extra"].Packages["brew"]; len(got) != 0 {
+		t.Errorf("Fix() extra brew packages = %v, want none", got)
+	}
+}
+
+func TestFix_NothingFixable(t *testing.T) {
+	t.Parallel()
+
+	content := "groups:\n  core:\n    priority: 1\n  extra:\n    priority: 1\n"
+	path := writeConfig(t, content)
+	result, err := lint.Lint(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixed, err := lint.Fix(path, result.Findings)
+	if err != nil || fixed != 0 {
+		t.Errorf("Fix() = %d, %v, want 0, nil", fixed, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("Fix() rewrote the file to %q", data)
+	}
+}
@@ -0,0 +1,189 @@
+package location
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source is where a resolved location came from
+type Source string
+
+// Location sources, in resolution order
+const (
+	SourceFlag       Source = "flag"
+	SourceEnv        Source = "env"
+	SourceConfigFile Source = "config-file"
+	SourceSearch     Source = "search"
+	SourceDefault    Source = "default"
+)
+
+// Environment variables naming the dotfiles directory or the YAML configuration
+const (
+	EnvBrewManagerConfig = "BREW_MANAGER_CONFIG"
+	EnvDofyHome          = "DOFY_HOME"
+)
+
+// Marker is the file, relative to the dotfiles directory, that marks a dotfiles checkout.
+// It is also the YAML configuration of brew-manager.
+const Marker = "data/brew/packages.yaml"
+
+// DefaultDir is the dotfiles directory, relative to the home directory, used when nothing else is configured
+const DefaultDir = "projects/github.com/shiron-dev/dotfiles"
+
+// Location is a resolved dotfiles directory and the brew-manager YAML configuration in it
+type Location struct {
+	Dir    string `json:"dir" yaml:"dir"`
+	File   string `json:"file" yaml:"file"`
+	Source Source `json:"source" yaml:"source"`
+	Origin string `json:"origin,omitempty" yaml:"origin,omitempty"` // Flag, variable, file or directory the location came from
+}
+
+// Options controls location resolution
+type Options struct {
+	Flag     string // Value of a --config flag; empty when not given
+	FlagName string // Flag name shown as the origin, e.g. "--config"
+	WorkDir  string // Directory the upward search starts from; the working directory when empty
+}
+
+// fileConfig is the XDG config file
+type fileConfig struct {
+	Path string `yaml:"path"` // Dotfiles directory or YAML configuration, relative to the config file
+}
+
+// Resolve finds the dotfiles directory: the flag in options, then $BREW_MANAGER_CONFIG and
+// $DOFY_HOME, then the path in ConfigFile, then the nearest directory above the working
+// directory containing Marker, and finally DefaultDir in the home directory.
+//
+// The flag, the variables and the config file may name either the dotfiles directory or a
+// YAML configuration file.
+func Resolve(options Options) (*Location, error) {
+	if options.Flag != "" {
+		return fromPath(options.Flag, SourceFlag, options.FlagName)
+	}
+
+	for _, name := range []string{EnvBrewManagerConfig, EnvDofyHome} {
+		if value := os.Getenv(name); value != "" {
+			return fromPath(value, SourceEnv, name)
+		}
+	}
+
+	if configFile, err := ConfigFile(); err == nil {
+		loc, err := fromConfigFile(configFile)
+		if err != nil || loc != nil {
+			return loc, err
+		}
+	}
+
+	workDir := options.WorkDir
+	if workDir == "" {
+		var err error
+		if workDir, err = os.Getwd(); err != nil {
+			return nil, fmt.Errorf("failed to get working directory: %w", err)
+		}
+	}
+	if dir, ok := search(workDir); ok {
+		return &Location{Dir: dir, File: filepath.Join(dir, Marker), Source: SourceSearch, Origin: workDir}, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	dir := filepath.Join(home, DefaultDir)
+	return &Location{Dir: dir, File: filepath.Join(dir, Marker), Source: SourceDefault}, nil
+}
+
+// ConfigFile returns the path of the config file shared by brew-manager and dofy:
+// dotfiles/config.yaml in $XDG_CONFIG_HOME, or in ~/.config when it is not set
+func ConfigFile() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "dotfiles", "config.yaml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "dotfiles", "config.yaml"), nil
+}
+
+// fromConfigFile reads the location from the config file. It returns nil when the file does not
+// exist or sets no path.
+func fromConfigFile(configFile string) (*Location, error) {
+	data, err := os.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", configFile, err)
+	}
+
+	var config fileConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", configFile, err)
+	}
+	if config.Path == "" {
+		return nil, nil
+	}
+
+	path := ExpandHome(config.Path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(configFile), path)
+	}
+	return fromPath(path, SourceConfigFile, configFile)
+}
+
+// fromPath builds a location from a dotfiles directory or a YAML configuration file. A path that
+// does not exist is a file if it has a YAML extension. The dotfiles directory of a file in
+// data/brew is the directory above data/brew.
+func fromPath(path string, source Source, origin string) (*Location, error) {
+	path, err := filepath.Abs(ExpandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+
+	info, err := os.Stat(path)
+	ext := strings.ToLower(filepath.Ext(path))
+	if (err == nil && info.IsDir()) || (err != nil && ext != ".yaml" && ext != ".yml") {
+		return &Location{Dir: path, File: filepath.Join(path, Marker), Source: source, Origin: origin}, nil
+	}
+
+	dir := filepath.Dir(path)
+	if markerDir := filepath.FromSlash(filepath.Dir(Marker)); strings.HasSuffix(dir, string(filepath.Separator)+markerDir) {
+		dir = strings.TrimSuffix(dir, string(filepath.Separator)+markerDir)
+	}
+	return &Location{Dir: dir, File: path, Source: source, Origin: origin}, nil
+}
+
+// search returns the nearest directory at or above dir that contains Marker
+func search(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		if info, err := os.Stat(filepath.Join(dir, Marker)); err == nil && !info.IsDir() {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// ExpandHome replaces a leading ~ with the home directory
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
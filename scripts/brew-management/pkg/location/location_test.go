@@ -0,0 +1,233 @@
+package location_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/location"
+)
+
+// setup creates a home directory, a dotfiles checkout with its marker and an unrelated directory
+// under a temporary root, points the home and XDG config directories into it and clears the
+// location variables. It returns the root.
+func setup(t *testing.T, configFile string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for _, dir := range []string{"home", "dotfiles/data/brew", "dotfiles/scripts/deep", "other", "xdg/dotfiles"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "dotfiles", location.Marker), []byte("groups: {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if configFile != "" {
+		if err := os.WriteFile(filepath.Join(root, "xdg", "dotfiles", "config.yaml"), []byte(configFile), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("HOME", filepath.Join(root, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "xdg"))
+	t.Setenv(location.EnvBrewManagerConfig, "")
+	t.Setenv(location.EnvDofyHome, "")
+
+	return root
+}
+
+//nolint:paralleltest // t.Setenv cannot be used in parallel tests
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		configFile string
+		options    location.Options
+		want       func(root string) *location.Location
+		wantErr    bool
+	}{
+		{
+			"flag naming the dotfiles directory",
+			map[string]string{location.EnvDofyHome: "/elsewhere"},
+			"",
+			location.Options{Flag: "dotfiles", FlagName: "--config"},
+			func(root string) *location.Location {
+				dir := filepath.Join(root, "dotfiles")
+				return &location.Location{Dir: dir, File: filepath.Join(dir, location.Marker), Source: location.SourceFlag, Origin: "--config"}
+			},
+			false,
+		},
+		{
+			"flag naming the marker file",
+			nil,
+			"",
+			location.Options{Flag: "dotfiles/data/brew/packages.yaml", FlagName: "--config"},
+			func(root string) *location.Location {
+				return &location.Location{Dir: filepath.Join(root, "dotfiles"), File: filepath.Join(root, "dotfiles", location.Marker), Source: location.SourceFlag, Origin: "--config"}
+			},
+			false,
+		},
+		{
+			"flag naming a new YAML file",
+			nil,
+			"",
+			location.Options{Flag: "other/work.yml", FlagName: "--config"},
+			func(root string) *location.Location {
+				return &location.Location{Dir: filepath.Join(root, "other"), File: filepath.Join(root, "other", "work.yml"), Source: location.SourceFlag, Origin: "--config"}
+			},
+			false,
+		},
+		{
+			"flag naming a new directory under home",
+			nil,
+			"",
+			location.Options{Flag: "~/new", FlagName: "--config"},
+			func(root string) *location.Location {
+				dir := filepath.Join(root, "home", "new")
+				return &location.Location{Dir: dir, File: filepath.Join(dir, location.Marker), Source: location.SourceFlag, Origin: "--config"}
+			},
+			false,
+		},
+		{
+			"brew-manager variable before dofy",
+			map[string]string{location.EnvBrewManagerConfig: "other/packages.yaml", location.EnvDofyHome: "dotfiles"},
+			"path: dotfiles",
+			location.Options{},
+			func(root string) *location.Location {
+				return &location.Location{Dir: filepath.Join(root, "other"), File: filepath.Join(root, "other", "packages.yaml"), Source: location.SourceEnv, Origin: location.EnvBrewManagerConfig}
+			},
+			false,
+		},
+		{
+			"dofy variable",
+			map[string]string{location.EnvDofyHome: "other"},
+			"path: dotfiles",
+			location.Options{},
+			func(root string) *location.Location {
+				dir := filepath.Join(root, "other")
+				return &location.Location{Dir: dir, File: filepath.Join(dir, location.Marker), Source: location.SourceEnv, Origin: location.EnvDofyHome}
+			},
+			false,
+		},
+		{
+			"config file path relative to the file",
+			nil,
+			"path: ../../other\n",
+			location.Options{WorkDir: "dotfiles/scripts/deep"},
+			func(root string) *location.Location {
+				dir := filepath.Join(root, "other")
+				return &location.Location{Dir: dir, File: filepath.Join(dir, location.Marker), Source: location.SourceConfigFile, Origin: filepath.Join(root, "xdg", "dotfiles", "config.yaml")}
+			},
+			false,
+		},
+		{
+			"config file without a path",
+			nil,
+			"editor: vim\n",
+			location.Options{WorkDir: "dotfiles/scripts/deep"},
+			func(root string) *location.Location {
+				dir := filepath.Join(root, "dotfiles")
+				return &location.Location{Dir: dir, File: filepath.Join(dir, location.Marker), Source: location.SourceSearch, Origin: filepath.Join(root, "dotfiles", "scripts", "deep")}
+			},
+			false,
+		},
+		{"invalid config file", nil, "path: [\n", location.Options{}, nil, true},
+		{
+			"default outside a checkout",
+			nil,
+			"",
+			location.Options{WorkDir: "other"},
+			func(root string) *location.Location {
+				dir := filepath.Join(root, "home", location.DefaultDir)
+				return &location.Location{Dir: dir, File: filepath.Join(dir, location.Marker), Source: location.SourceDefault}
+			},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setup(t, tt.configFile)
+			for name, value := range tt.env {
+				if !filepath.IsAbs(value) {
+					value = filepath.Join(root, value)
+				}
+				t.Setenv(name, value)
+			}
+			options := tt.options
+			if options.Flag != "" && options.Flag[0] != '~' {
+				options.Flag = filepath.Join(root, options.Flag)
+			}
+			if options.WorkDir != "" {
+				options.WorkDir = filepath.Join(root, options.WorkDir)
+			}
+
+			got, err := location.Resolve(options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if want := tt.want(root); !reflect.DeepEqual(got, want) {
+				t.Errorf("Resolve() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // t.Setenv cannot be used in parallel tests
+func TestConfigFile(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+
+	tests := []struct {
+		name string
+		xdg  string
+		want string
+	}{
+		{"XDG config directory", "/xdg", "/xdg/dotfiles/config.yaml"},
+		{"home directory", "", "/home/user/.config/dotfiles/config.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", tt.xdg)
+
+			got, err := location.ConfigFile()
+			if err != nil {
+				t.Fatalf("ConfigFile() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ConfigFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // t.Setenv cannot be used in parallel tests
+func TestExpandHome(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"home", "~", "/home/user"},
+		{"under home", "~/dotfiles", "/home/user/dotfiles"},
+		{"other user", "~other/dotfiles", "~other/dotfiles"},
+		{"absolute", "/opt/dotfiles", "/opt/dotfiles"},
+		{"relative", "dotfiles/~", "dotfiles/~"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := location.ExpandHome(tt.path); got != tt.want {
+				t.Errorf("ExpandHome() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package lock
+
+// VersionMatches exposes versionMatches to the tests
+var VersionMatches = versionMatches
+
+// ParseListVersions exposes parseListVersions to the tests
+var ParseListVersions = parseListVersions
@@ -0,0 +1,341 @@
+package lock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+
+	"gopkg.in/yaml.v3"
+)
+
+// header is written at the top of every lockfile
+const header = "# Generated by brew-manager lock. Do not edit by hand.\n\n"
+
+// LockedPackage is the recorded state of one installed package
+type LockedPackage struct {
+	Name    string `json:"name" yaml:"name"`
+	ID      int64  `json:"id,omitempty" yaml:"id,omitempty"`           // For mas apps
+	Version string `json:"version,omitempty" yaml:"version,omitempty"` // Installed version of formulae, casks and mas apps
+	Commit  string `json:"commit,omitempty" yaml:"commit,omitempty"`   // Checked out commit of taps
+}
+
+// Lockfile records the installed versions of configured packages, keyed by package type.
+// It holds no timestamp, so locking an unchanged machine leaves the file unchanged.
+type Lockfile struct {
+	Packages map[string][]LockedPackage `json:"packages" yaml:"packages"`
+}
+
+// Drift is a package whose installed version differs from the expected one
+type Drift struct {
+	Type     string `json:"type" yaml:"type"`
+	Name     string `json:"name" yaml:"name"`
+	Expected string `json:"expected" yaml:"expected"`
+	Actual   string `json:"actual" yaml:"actual"` // Empty when the package is not installed
+	Pinned   bool   `json:"pinned" yaml:"pinned"` // The expected version comes from a version field in the YAML
+}
+
+// DefaultPath returns the lockfile path for a YAML configuration, e.g. packages.lock.yaml for packages.yaml
+func DefaultPath(yamlFile string) string {
+	ext := filepath.Ext(yamlFile)
+	return strings.TrimSuffix(yamlFile, ext) + ".lock" + ext
+}
+
+// Load reads a lockfile
+func Load(filePath string) (*Lockfile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+
+	var lf Lockfile
+	if err := yaml.Unmarshal(data, &lf); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile: %w", err)
+	}
+	if lf.Packages == nil {
+		lf.Packages = make(map[string][]LockedPackage)
+	}
+
+	return &lf, nil
+}
+
+// Save writes a lockfile
+func Save(lf *Lockfile, filePath string) error {
+	data, err := yaml.Marshal(lf)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lockfile: %w", err)
+	}
+
+	if err := utils.EnsureDir(filePath); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(filePath, append([]byte(header), data...), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+
+	return nil
+}
+
+// Generate records the installed version of every package in pkgs.
+// Packages that are not installed are returned separately and left out of the lockfile.
+func Generate(versions *Versions, pkgs []types.FilteredPackage) (*Lockfile, []types.FilteredPackage) {
+	lf := &Lockfile{
+		Packages: make(map[string][]LockedPackage),
+	}
+	var missing []types.FilteredPackage
+
+	seen := make(map[string]bool)
+	for _, pkg := range pkgs {
+		key := fmt.Sprintf("%s:%s:%d", pkg.Type, pkg.Name, pkg.ID)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		version, ok := versions.Get(pkg.Type, pkg.PackageInfo)
+		if !ok {
+			missing = append(missing, pkg)
+			continue
+		}
+
+		locked := LockedPackage{Name: pkg.Name, ID: pkg.ID}
+		if pkg.Type == "tap" {
+			locked.Commit = version
+		} else {
+			locked.Version = version
+		}
+		lf.Packages[pkg.Type] = append(lf.Packages[pkg.Type], locked)
+	}
+
+	for pkgType := range lf.Packages {
+		entries := lf.Packages[pkgType]
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name < entries[j].Name
+		})
+	}
+
+	return lf, missing
+}
+
+// Find returns the locked entry for a package
+func (lf *Lockfile) Find(pkgType string, pkgInfo types.PackageInfo) (LockedPackage, bool) {
+	for _, locked := range lf.Packages[pkgType] {
+		if pkgType == "mas" && locked.ID == pkgInfo.ID {
+			return locked, true
+		}
+		if pkgType != "mas" && locked.Name == pkgInfo.Name {
+			return locked, true
+		}
+	}
+	return LockedPackage{}, false
+}
+
+// Expected returns the version a package is expected to have: its version field
+// in the YAML if set, otherwise the version (or tap commit) recorded in the lockfile
+func Expected(lf *Lockfile, pkg types.FilteredPackage) (version string, pinned bool, ok bool) {
+	if pkg.Version != "" {
+		return pkg.Version, true, true
+	}
+	if lf == nil {
+		return "", false, false
+	}
+
+	locked, found := lf.Find(pkg.Type, pkg.PackageInfo)
+	if !found {
+		return "", false, false
+	}
+	if pkg.Type == "tap" {
+		return locked.Commit, false, locked.Commit != ""
+	}
+	return locked.Version, false, locked.Version != ""
+}
+
+// CheckDrift compares installed versions with the expected versions of pkgs.
+// When onlyInstalled is set, packages that are not installed are not reported.
+// It also returns the packages that have neither a version field nor a lockfile entry.
+func CheckDrift(lf *Lockfile, versions *Versions, pkgs []types.FilteredPackage, onlyInstalled bool) ([]Drift, []types.FilteredPackage) {
+	var drifts []Drift
+	var unlocked []types.FilteredPackage
+
+	for _, pkg := range pkgs {
+		expected, pinned, ok := Expected(lf, pkg)
+		if !ok {
+			unlocked = append(unlocked, pkg)
+			continue
+		}
+
+		actual, installed := versions.Get(pkg.Type, pkg.PackageInfo)
+		if !installed && onlyInstalled {
+			continue
+		}
+		if installed && versionMatches(pkg.Type, expected, actual) {
+			continue
+		}
+
+		drifts = append(drifts, Drift{
+			Type:     pkg.Type,
+			Name:     pkg.Name,
+			Expected: expected,
+			Actual:   actual,
+			Pinned:   pinned,
+		})
+	}
+
+	return drifts, unlocked
+}
+
+// versionMatches compares versions; tap commits may be abbreviated in the YAML
+func versionMatches(pkgType, expected, actual string) bool {
+	if pkgType == "tap" && len(expected) >= 7 {
+		return strings.HasPrefix(actual, expected)
+	}
+	return expected == actual
+}
+
+// Versions holds the installed versions of packages, queried from brew, mas and the other package tools
+type Versions struct {
+	r        runner.Runner
+	packages map[string]map[string]string // package type -> name -> version
+	masApps  map[int64]string             // mas app ID -> version
+	taps     map[string]bool              // installed taps
+}
+
+// QueryVersions queries the installed versions of formulae, casks, mas apps, VS Code extensions
+// and Go, Cargo and npm packages.
+// Tap commits are looked up on demand, since each one needs its own git call.
+func QueryVersions(r runner.Runner) (*Versions, error) {
+	v := &Versions{
+		r: r,
+		packages: map[string]map[string]string{
+			"tap":  make(map[string]string),
+			"brew": make(map[string]string),
+			"cask": make(map[string]string),
+		},
+		masApps: make(map[int64]string),
+		taps:    make(map[string]bool),
+	}
+
+	output, err := r.RunCommand("brew", "tap")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list taps: %w", err)
+	}
+	for _, name := range strings.Fields(output) {
+		v.taps[name] = true
+	}
+
+	for _, pkgType := range []string{"brew", "cask"} {
+		flag := "--formula"
+		if pkgType == "cask" {
+			flag = "--cask"
+		}
+		output, err := r.RunCommand("brew", "list", flag, "--versions")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s versions: %w", pkgType, err)
+		}
+		for name, version := range parseListVersions(output) {
+			v.packages[pkgType][name] = version
+		}
+	}
+
+	if r.CommandExists("mas") {
+		if output, err := r.RunCommand("mas", "list"); err == nil {
+			for _, app := range yamlPkg.ParseMasList(output) {
+				v.masApps[app.ID] = app.Version
+			}
+		}
+	}
+
+	for _, pkgType := range yamlPkg.ToolTypes {
+		versions, err := yamlPkg.ToolVersions(r, pkgType)
+		if err != nil {
+			return nil, err
+		}
+		v.packages[pkgType] = versions
+	}
+
+	return v, nil
+}
+
+// parseListVersions parses `brew list --versions` output ("name v1 v2 ..."), keeping the newest version
+func parseListVersions(output string) map[string]string {
+	versions := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		versions[fields[0]] = fields[len(fields)-1]
+	}
+	return versions
+}
+
+// Get returns the installed version of a package (the commit for taps) and whether it is installed
+func (v *Versions) Get(pkgType string, pkgInfo types.PackageInfo) (string, bool) {
+	switch pkgType {
+	case "tap":
+		if !v.taps[pkgInfo.Name] {
+			return "", false
+		}
+		commit, ok := v.packages["tap"][pkgInfo.Name]
+		if !ok {
+			commit = v.tapCommit(pkgInfo.Name)
+			v.packages["tap"][pkgInfo.Name] = commit
+		}
+		return commit, true
+	case "mas":
+		version, ok := v.masApps[pkgInfo.ID]
+		return version, ok
+	case "brew":
+		if version, ok := v.packages["brew"][pkgInfo.Name]; ok {
+			return version, true
+		}
+		// Tap-qualified formulae are listed under their short name
+		if i := strings.LastIndex(pkgInfo.Name, "/"); i >= 0 {
+			version, ok := v.packages["brew"][pkgInfo.Name[i+1:]]
+			return version, ok
+		}
+		return "", false
+	default:
+		version, ok := v.packages[pkgType][yamlPkg.NormalizeName(pkgType, pkgInfo.Name)]
+		return version, ok
+	}
+}
+
+// tapCommit returns the checked out commit of a tap, or an empty string if it cannot be determined
+func (v *Versions) tapCommit(name string) string {
+	path, err := v.r.RunCommand("brew", "--repository", name)
+	if err != nil || strings.TrimSpace(path) == "" {
+		return ""
+	}
+
+	commit, err := v.r.RunCommand("git", "-C", strings.TrimSpace(path), "rev-parse", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(commit)
+}
+
+// PrintDrift prints version drift as a table
+func PrintDrift(drifts []Drift) {
+	w := tabwriter.NewWriter(utils.Output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  TYPE\tNAME\tEXPECTED\tINSTALLED")
+	for _, drift := range drifts {
+		expected := drift.Expected
+		if drift.Pinned {
+			expected += " (pinned)"
+		}
+		actual := drift.Actual
+		if actual == "" {
+			actual = "unknown"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", drift.Type, drift.Name, expected, actual)
+	}
+	w.Flush()
+}
@@ -0,0 +1,258 @@
+package lock_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/lock"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+// tapCommit is the checked out commit of shiron-dev/tap in the replay fixtures
+const tapCommit = "3f1c2a9d8e7b6a5c4d3e2f1a0b9c8d7e6f5a4b3c"
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// query returns the fixture runner and the versions it reports
+func query(t *testing.T) (*runner.FakeRunner, *lock.Versions) {
+	t.Helper()
+
+	fake, err := runner.LoadFixtures(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := lock.QueryVersions(fake)
+	if err != nil {
+		t.Fatalf("QueryVersions() error = %v", err)
+	}
+
+	return fake, versions
+}
+
+func pkg(pkgType, name string, id int64, version string) types.FilteredPackage {
+	return types.FilteredPackage{Type: pkgType, PackageInfo: types.PackageInfo{Name: name, ID: id, Version: version}}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	fake, versions := query(t)
+	pkgs := []types.FilteredPackage{
+		pkg("tap", "shiron-dev/tap", 0, ""),
+		pkg("tap", "homebrew/bundle", 0, ""),
+		pkg("brew", "jq", 0, ""),
+		pkg("brew", "git", 0, "2.46.0"),
+		pkg("brew", "git", 0, ""),
+		pkg("brew", "shiron-dev/tap/ripgrep", 0, ""),
+		pkg("brew", "fd", 0, ""),
+		pkg("cask", "slack", 0, ""),
+		pkg("mas", "Xcode", 497799835, ""),
+		pkg("vscode", "GitHub.copilot", 0, ""),
+		pkg("cargo", "stylua", 0, ""),
+		pkg("npm", "typescript", 0, ""),
+	}
+
+	lf, missing := lock.Generate(versions, pkgs)
+
+	want := map[string][]lock.LockedPackage{
+		"tap": {{Name: "homebrew/bundle"}, {Name: "shiron-dev/tap", Commit: tapCommit}},
+		"brew": {
+			{Name: "git", Version: "2.45.0"},
+			{Name: "jq", Version: "1.7.1"},
+			{Name: "shiron-dev/tap/ripgrep", Version: "14.1.0"},
+		},
+		"cask":   {{Name: "slack", Version: "4.38.125"}},
+		"mas":    {{Name: "Xcode", ID: 497799835, Version: "15.4"}},
+		"vscode": {{Name: "GitHub.copilot", Version: "1.150.0"}},
+		"cargo":  {{Name: "stylua", Version: "0.20.0"}},
+		"npm":    {{Name: "typescript", Version: "5.4.5"}},
+	}
+	if !reflect.DeepEqual(lf.Packages, want) {
+		t.Errorf("Generate() = %+v, want %+v", lf.Packages, want)
+	}
+	if len(missing) != 1 || missing[0].Name != "fd" {
+		t.Errorf("Generate() missing = %+v, want fd", missing)
+	}
+
+	// Tap commits are looked up with git in the tap repository; homebrew/bundle has none in the fixtures
+	var tapCalls []string
+	for _, call := range fake.Calls() {
+		if strings.HasPrefix(call, "brew --repository") || strings.HasPrefix(call, "git ") {
+			tapCalls = append(tapCalls, call)
+		}
+	}
+	wantCalls := []string{
+		"brew --repository shiron-dev/tap",
+		"git -C /opt/homebrew/Library/Taps/shiron-dev/homebrew-tap rev-parse HEAD",
+		"brew --repository homebrew/bundle",
+	}
+	if !reflect.DeepEqual(tapCalls, wantCalls) {
+		t.Errorf("Generate() ran %q, want %q", tapCalls, wantCalls)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	lf := &lock.Lockfile{Packages: map[string][]lock.LockedPackage{
+		"tap":  {{Name: "shiron-dev/tap", Commit: tapCommit}},
+		"brew": {{Name: "git", Version: "2.45.0"}},
+		"mas":  {{Name: "Xcode", ID: 497799835, Version: "15.4"}},
+	}}
+	path := filepath.Join(t.TempDir(), "packages.lock.yaml")
+	if err := lock.Save(lf, path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := lock.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, lf) {
+		t.Errorf("Load() = %+v, want %+v", got, lf)
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	t.Parallel()
+
+	lf := &lock.Lockfile{Packages: map[string][]lock.LockedPackage{
+		"tap":  {{Name: "shiron-dev/tap", Commit: "3f1c2a9"}, {Name: "homebrew/bundle", Commit: "0123456789"}},
+		"brew": {{Name: "git", Version: "2.44.0"}, {Name: "jq", Version: "1.7.1"}, {Name: "fd", Version: "10.1.0"}},
+		"mas":  {{Name: "Xcode", ID: 497799835, Version: "15.3"}},
+	}}
+	pkgs := []types.FilteredPackage{
+		pkg("tap", "shiron-dev/tap", 0, ""),
+		pkg("tap", "homebrew/bundle", 0, ""),
+		pkg("brew", "git", 0, "2.45.0"),
+		pkg("brew", "jq", 0, ""),
+		pkg("brew", "fd", 0, ""),
+		pkg("brew", "wget", 0, ""),
+		pkg("cask", "slack", 0, "4.37.0"),
+		pkg("mas", "Xcode Beta", 497799835, ""),
+	}
+
+	tests := []struct {
+		name          string
+		lf            *lock.Lockfile
+		onlyInstalled bool
+		want          []lock.Drift
+		wantUnlocked  []string
+	}{
+		{
+			"lockfile and pins",
+			lf,
+			false,
+			[]lock.Drift{
+				{Type: "tap", Name: "homebrew/bundle", Expected: "0123456789", Actual: ""},
+				{Type: "brew", Name: "fd", Expected: "10.1.0", Actual: ""},
+				{Type: "cask", Name: "slack", Expected: "4.37.0", Actual: "4.38.125", Pinned: true},
+				{Type: "mas", Name: "Xcode Beta", Expected: "15.3", Actual: "15.4"},
+			},
+			[]string{"wget"},
+		},
+		{
+			"only installed",
+			lf,
+			true,
+			[]lock.Drift{
+				{Type: "tap", Name: "homebrew/bundle", Expected: "0123456789", Actual: ""},
+				{Type: "cask", Name: "slack", Expected: "4.37.0", Actual: "4.38.125", Pinned: true},
+				{Type: "mas", Name: "Xcode Beta", Expected: "15.3", Actual: "15.4"},
+			},
+			[]string{"wget"},
+		},
+		{
+			"pins only",
+			nil,
+			false,
+			[]lock.Drift{{Type: "cask", Name: "slack", Expected: "4.37.0", Actual: "4.38.125", Pinned: true}},
+			[]string{"shiron-dev/tap", "homebrew/bundle", "jq", "fd", "wget", "Xcode Beta"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, versions := query(t)
+			got, unlocked := lock.CheckDrift(tt.lf, versions, pkgs, tt.onlyInstalled)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckDrift() = %+v, want %+v", got, tt.want)
+			}
+			var gotUnlocked []string
+			for _, pkg := range unlocked {
+				gotUnlocked = append(gotUnlocked, pkg.Name)
+			}
+			if !reflect.DeepEqual(gotUnlocked, tt.wantUnlocked) {
+				t.Errorf("CheckDrift() unlocked = %v, want %v", gotUnlocked, tt.wantUnlocked)
+			}
+		})
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		pkgType  string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"same version", "brew", "2.45.0", "2.45.0", true},
+		{"other version", "brew", "2.45.0", "2.45.1", false},
+		{"version prefix", "brew", "2.45", "2.45.0", false},
+		{"full commit", "tap", tapCommit, tapCommit, true},
+		{"abbreviated commit", "tap", "3f1c2a9", tapCommit, true},
+		{"too short commit", "tap", "3f1c2a", tapCommit, false},
+		{"other commit", "tap", "0123456", tapCommit, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := lock.VersionMatches(tt.pkgType, tt.expected, tt.actual); got != tt.want {
+				t.Errorf("versionMatches(%q, %q, %q) = %v, want %v", tt.pkgType, tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseListVersions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		output string
+		want   map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"one version each", "git 2.45.0\njq 1.7.1\n", map[string]string{"git": "2.45.0", "jq": "1.7.1"}},
+		{"several versions keep the newest", "python@3.12 3.12.3 3.12.4\n", map[string]string{"python@3.12": "3.12.4"}},
+		{"lines without a version", "git\n\n  \nwget 1.24.5\n", map[string]string{"wget": "1.24.5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := lock.ParseListVersions(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseListVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
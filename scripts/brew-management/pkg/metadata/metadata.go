@@ -0,0 +1,178 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+// Package is the cached metadata of one installed formula or cask
+type Package struct {
+	Name         string   `json:"name" yaml:"name"`
+	FullName     string   `json:"full_name,omitempty" yaml:"full_name,omitempty"` // Tap-qualified name, e.g. shiron-dev/tap/tool
+	Description  string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Homepage     string   `json:"homepage,omitempty" yaml:"homepage,omitempty"`
+	Tap          string   `json:"tap,omitempty" yaml:"tap,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty" yaml:"dependencies,omitempty"` // Direct formula dependencies
+}
+
+// Cache is the metadata of installed formulae and casks, keyed by package type ("brew" or "cask") and name.
+// A nil Cache has no entries.
+type Cache struct {
+	GeneratedAt time.Time                     `json:"generated_at"`
+	Packages    map[string]map[string]Package `json:"packages"`
+}
+
+// brewInfo is the part of `brew info --json=v2` output that is cached
+type brewInfo struct {
+	Formulae []struct {
+		Name         string   `json:"name"`
+		FullName     string   `json:"full_name"`
+		Tap          string   `json:"tap"`
+		Desc         string   `json:"desc"`
+		Homepage     string   `json:"homepage"`
+		Dependencies []string `json:"dependencies"`
+	} `json:"formulae"`
+	Casks []struct {
+		Token     string `json:"token"`
+		FullToken string `json:"full_token"`
+		Tap       string `json:"tap"`
+		Desc      string `json:"desc"`
+		Homepage  string `json:"homepage"`
+		DependsOn struct {
+			Formula []string `json:"formula"`
+		} `json:"depends_on"`
+	} `json:"casks"`
+}
+
+// DefaultPath returns the cache path in the user cache directory
+func DefaultPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+	return filepath.Join(dir, "brew-manager", "metadata.json")
+}
+
+// Refresh queries the metadata of every installed formula and cask
+func Refresh(r runner.Runner) (*Cache, error) {
+	output, err := r.RunCommand("brew", "info", "--json=v2", "--installed")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query package metadata: %w", err)
+	}
+	return Parse([]byte(output))
+}
+
+// Parse builds a cache from `brew info --json=v2` output
+func Parse(data []byte) (*Cache, error) {
+	var info brewInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse brew info output: %w", err)
+	}
+
+	c := &Cache{
+		GeneratedAt: time.Now().UTC(),
+		Packages:    map[string]map[string]Package{"brew": {}, "cask": {}},
+	}
+	for _, f := range info.Formulae {
+		c.Packages["brew"][f.Name] = Package{
+			Name:         f.Name,
+			FullName:     f.FullName,
+			Description:  f.Desc,
+			Homepage:     f.Homepage,
+			Tap:          f.Tap,
+			Dependencies: f.Dependencies,
+		}
+	}
+	for _, cask := range info.Casks {
+		c.Packages["cask"][cask.Token] = Package{
+			Name:         cask.Token,
+			FullName:     cask.FullToken,
+			Description:  cask.Desc,
+			Homepage:     cask.Homepage,
+			Tap:          cask.Tap,
+			Dependencies: cask.DependsOn.Formula,
+		}
+	}
+
+	return c, nil
+}
+
+// Load reads a cache written by Save. A missing file yields an empty cache.
+func Load(filePath string) (*Cache, error) {
+	if !utils.FileExists(filePath) {
+		return &Cache{Packages: make(map[string]map[string]Package)}, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata cache: %w", err)
+	}
+
+	var c Cache
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata cache %s: %w", filePath, err)
+	}
+	if c.Packages == nil {
+		c.Packages = make(map[string]map[string]Package)
+	}
+
+	return &c, nil
+}
+
+// Save writes the cache as indented JSON
+func Save(c *Cache, filePath string) error {
+	if err := utils.EnsureDir(filePath); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata cache: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write metadata cache: %w", err)
+	}
+
+	return nil
+}
+
+// Lookup returns the cached metadata of a package by name or tap-qualified name
+func (c *Cache) Lookup(pkgType, name string) (Package, bool) {
+	if c == nil {
+		return Package{}, false
+	}
+	if pkg, ok := c.Packages[pkgType][name]; ok {
+		return pkg, true
+	}
+	for _, pkg := range c.Packages[pkgType] {
+		if pkg.FullName == name {
+			return pkg, true
+		}
+	}
+	return Package{}, false
+}
+
+// Description returns the cached description of a package, or "" when it is not cached
+func (c *Cache) Description(pkgType, name string) string {
+	pkg, _ := c.Lookup(pkgType, name)
+	return pkg.Description
+}
+
+// Len returns the number of cached packages
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	n := 0
+	for _, pkgs := range c.Packages {
+		n += len(pkgs)
+	}
+	return n
+}
@@ -0,0 +1,227 @@
+package metadata_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/metadata"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// tapped is brew info output for a formula from a third-party tap
+const tapped = `{"formulae":[{"name":"tool","full_name":"shiron-dev/tap/tool","tap":"shiron-dev/tap","desc":"A tool","homepage":"https://example.com/tool","dependencies":["jq"]}],"casks":[]}`
+
+func load(t *testing.T) *metadata.Cache {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(fixtureDir, "brew_info_--json=v2_--installed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := metadata.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	extra, err := metadata.Parse([]byte(tapped))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	c.Packages["brew"]["tool"] = extra.Packages["brew"]["tool"]
+
+	return c
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	c := load(t)
+	if got := c.Len(); got != 13 {
+		t.Errorf("Parse() cached %d packages, want 13", got)
+	}
+	if c.GeneratedAt.IsZero() {
+		t.Error("Parse() GeneratedAt is zero")
+	}
+
+	if _, err := metadata.Parse([]byte("Error: not JSON")); err == nil {
+		t.Error("Parse() of invalid output error = nil, want an error")
+	}
+}
+
+func TestCache_Lookup(t *testing.T) {
+	t.Parallel()
+
+	c := load(t)
+
+	tests := []struct {
+		name    string
+		cache   *metadata.Cache
+		pkgType string
+		pkgName string
+		want    metadata.Package
+		wantOK  bool
+	}{
+		{
+			"formula by name",
+			c,
+			"brew",
+			"git",
+			metadata.Package{
+				Name:         "git",
+				FullName:     "git",
+				Description:  "Distributed revision control system",
+				Homepage:     "https://git-scm.com",
+				Tap:          "homebrew/core",
+				Dependencies: []string{"gettext", "pcre2"},
+			},
+			true,
+		},
+		{
+			"formula by full name",
+			c,
+			"brew",
+			"shiron-dev/tap/tool",
+			metadata.Package{
+				Name:         "tool",
+				FullName:     "shiron-dev/tap/tool",
+				Description:  "A tool",
+				Homepage:     "https://example.com/tool",
+				Tap:          "shiron-dev/tap",
+				Dependencies: []string{"jq"},
+			},
+			true,
+		},
+		{
+			"cask",
+			c,
+			"cask",
+			"slack",
+			metadata.Package{
+				Name:        "slack",
+				FullName:    "slack",
+				Description: "Team communication and collaboration software",
+				Homepage:    "https://slack.com/",
+				Tap:         "homebrew/cask",
+			},
+			true,
+		},
+		{"cask looked up as a formula", c, "brew", "slack", metadata.Package{}, false},
+		{"not installed", c, "brew", "fd", metadata.Package{}, false},
+		{"nil cache", nil, "brew", "git", metadata.Package{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := tt.cache.Lookup(tt.pkgType, tt.pkgName)
+			if ok != tt.wantOK {
+				t.Fatalf("Cache.Lookup() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Cache.Lookup() = %+v, want %+v", got, tt.want)
+			}
+			if got := tt.cache.Description(tt.pkgType, tt.pkgName); got != tt.want.Description {
+				t.Errorf("Cache.Description() = %q, want %q", got, tt.want.Description)
+			}
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	c := load(t)
+	filePath := filepath.Join(t.TempDir(), "cache", "metadata.json")
+	if err := metadata.Save(c, filePath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := metadata.Load(filePath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !got.GeneratedAt.Equal(c.GeneratedAt) || got.Len() != c.Len() {
+		t.Errorf("Load() generated at %v with %d packages, want %v with %d", got.GeneratedAt, got.Len(), c.GeneratedAt, c.Len())
+	}
+	for _, name := range []string{"git", "tool"} {
+		pkg, _ := got.Lookup("brew", name)
+		if want, _ := c.Lookup("brew", name); !reflect.DeepEqual(pkg, want) {
+			t.Errorf("Load() %s = %+v, want %+v", name, pkg, want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.json")
+	if err := os.WriteFile(empty, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		filePath string
+		wantErr  bool
+	}{
+		{"missing file", filepath.Join(dir, "missing.json"), false},
+		{"no packages", empty, false},
+		{"invalid file", invalid, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := metadata.Load(tt.filePath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if c.Packages == nil || c.Len() != 0 {
+				t.Errorf("Load() = %+v, want an empty cache", c)
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	t.Parallel()
+
+	fake, err := runner.LoadFixtures(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := metadata.Refresh(fake)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got := c.Description("cask", "visual-studio-code"); got != "Open-source code editor" {
+		t.Errorf("Refresh() description of visual-studio-code = %q, want %q", got, "Open-source code editor")
+	}
+
+	if _, err := metadata.Refresh(runner.NewFakeRunner()); err == nil {
+		t.Error("Refresh() with a failing brew error = nil, want an error")
+	}
+}
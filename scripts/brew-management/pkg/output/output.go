@@ -0,0 +1,45 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is how commands print their results, selected with --output
+type Format string
+
+const (
+	Text Format = "text" // Coloured, human-readable output
+	JSON Format = "json"
+	YAML Format = "yaml"
+)
+
+// ParseFormat returns the format named s
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(s); format {
+	case Text, JSON, YAML:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid output format %q: must be text, json or yaml", s)
+}
+
+// Write writes a result to w as indented JSON or as YAML
+func Write(w io.Writer, format Format, result any) error {
+	switch format {
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case YAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(4)
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	return fmt.Errorf("results cannot be written as %s", format)
+}
@@ -0,0 +1,115 @@
+package output_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/output"
+)
+
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		s       string
+		want    output.Format
+		wantErr bool
+	}{
+		{"text", "text", output.Text, false},
+		{"json", "json", output.JSON, false},
+		{"yaml", "yaml", output.YAML, false},
+		{"empty", "", "", true},
+		{"upper case", "JSON", "", true},
+		{"yml", "yml", "", true},
+		{"junit", "junit", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := output.ParseFormat(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormat(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFormat(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	type pkg struct {
+		Type string `json:"type" yaml:"type"`
+		Name string `json:"name" yaml:"name"`
+		ID   int64  `json:"id,omitempty" yaml:"id,omitempty"`
+	}
+	result := struct {
+		File     string `json:"file" yaml:"file"`
+		Packages []pkg  `json:"packages" yaml:"packages"`
+	}{
+		File:     "packages.yaml",
+		Packages: []pkg{{Type: "brew", Name: "git"}, {Type: "mas", Name: "Xcode", ID: 497799835}},
+	}
+
+	tests := []struct {
+		name    string
+		format  output.Format
+		want    string
+		wantErr bool
+	}{
+		{
+			"json",
+			output.JSON,
+			`{
+  "file": "packages.yaml",
+  "packages": [
+    {
+      "type": "brew",
+      "name": "git"
+    },
+    {
+      "type": "mas",
+      "name": "Xcode",
+      "id": 497799835
+    }
+  ]
+}
+`,
+			false,
+		},
+		{
+			"yaml",
+			output.YAML,
+			`file: packages.yaml
+packages:
+    - type: brew
+      name: git
+    - type: mas
+      name: Xcode
+      id: 497799835
+`,
+			false,
+		},
+		{"text", output.Text, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			err := output.Write(&buf, tt.format, result)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Write() wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brew"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/hooks"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/prune"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+// FormatVersion is the version of the plan file format
+const FormatVersion = 1
+
+// Plan actions
+const (
+	ActionInstall = "install"
+	ActionSkip    = "skip"
+	ActionRemove  = "remove"
+)
+
+// Step is a single planned action on a package, with the hooks of the package if it is configured
+type Step struct {
+	Action      string `json:"action" yaml:"action"`
+	Type        string `json:"type" yaml:"type"`
+	Name        string `json:"name" yaml:"name"`
+	ID          int64  `json:"id,omitempty" yaml:"id,omitempty"`
+	Version     string `json:"version,omitempty" yaml:"version,omitempty"` // Pinned version to install
+	Group       string `json:"group,omitempty" yaml:"group,omitempty"`
+	Reason      string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	types.Hooks `yaml:",inline"`
+}
+
+// Package returns the package a step acts on, as the hooks see it
+func (s Step) Package() types.FilteredPackage {
+	pkgInfo := types.PackageInfo{Name: s.Name, ID: s.ID, Version: s.Version, Hooks: s.Hooks}
+	if s.Action == ActionRemove {
+		pkgInfo = prune.RemovedPackageInfo(s.Type, s.Name)
+		pkgInfo.Hooks = s.Hooks
+	}
+	return types.FilteredPackage{PackageInfo: pkgInfo, Type: s.Type, Group: s.Group}
+}
+
+// Plan is a serializable execution plan produced by `brew-manager plan`
+type Plan struct {
+	Version    int       `json:"version" yaml:"version"`
+	CreatedAt  time.Time `json:"created_at" yaml:"created_at"`
+	ConfigFile string    `json:"config_file" yaml:"config_file"`
+	StateHash  string    `json:"state_hash" yaml:"state_hash"`
+	Steps      []Step    `json:"steps" yaml:"steps"`
+}
+
+// BuildPlan computes installs, skips and removals for the filtered packages against the installed snapshot.
+// Install steps follow the group priority order of brew.InstallPackages.
+// Removals are only planned when pruneOptions is not nil; formulae needed by kept formulae according
+// to graph are never removed, and formulae are removed before their dependencies.
+func BuildPlan(installed *state.Snapshot, graph *deps.Graph, configFile string, config *types.PackageGrouped, filteredPackages []types.FilteredPackage,
+	installOptions *types.InstallOptions, pruneOptions *types.PruneOptions) (*Plan, error) {
+
+	p := &Plan{
+		Version:    FormatVersion,
+		CreatedAt:  time.Now().UTC(),
+		ConfigFile: configFile,
+		StateHash:  installed.Hash(),
+		Steps:      []Step{},
+	}
+
+	// Installs and skips, in the order install uses
+	for _, pkg := range brew.OrderForInstall(filteredPackages) {
+		if brew.ShouldSkipType(pkg.Type, installOptions) {
+			continue
+		}
+		step := Step{Action: ActionInstall, Type: pkg.Type, Name: pkg.Name, ID: pkg.ID, Version: pkg.Version, Group: pkg.Group, Hooks: pkg.Hooks}
+		if installed.IsInstalled(pkg.Type, pkg.PackageInfo) {
+			step.Action = ActionSkip
+			step.Reason = "already installed"
+			step.Version = ""
+			step.Hooks = types.Hooks{}
+		}
+		p.Steps = append(p.Steps, step)
+	}
+
+	// Removals, in removal order
+	if pruneOptions != nil {
+		yamlPackages, err := prune.KeepSet(config, pruneOptions)
+		if err != nil {
+			return nil, err
+		}
+		prune.KeepDependencies(graph, yamlPackages, installed, pruneOptions)
+		packagesToRemove := prune.FindPackagesToRemove(yamlPackages, installed, pruneOptions)
+		reason := "not defined in YAML configuration"
+		if pruneOptions.Profile != "" {
+			reason = fmt.Sprintf("not in profile %s", pruneOptions.Profile)
+		} else if len(pruneOptions.Groups) > 0 || len(pruneOptions.Tags) > 0 {
+			reason = "not selected by --groups/--tags"
+		}
+		configured := prune.ConfiguredPackages(config)
+		for _, pkgType := range prune.RemovalOrder {
+			names := append([]string(nil), packagesToRemove[pkgType]...)
+			sort.Strings(names)
+			if pkgType == "brew" {
+				names = graph.RemovalOrder(names)
+			}
+			for _, name := range names {
+				configuredPkg := prune.ConfiguredPackage(configured, pkgType, name)
+				step := Step{Action: ActionRemove, Type: pkgType, Name: name, Group: configuredPkg.Group, Reason: reason}
+				if pkgType == "mas" {
+					step.ID = prune.RemovedPackageInfo(pkgType, name).ID
+				}
+				// Only the post_remove hook runs for a removal
+				step.PostRemove = configuredPkg.PostRemove
+				step.HookTimeout = configuredPkg.HookTimeout
+				step.HookFailure = configuredPkg.HookFailure
+				p.Steps = append(p.Steps, step)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// Counts returns the number of steps for each action
+func (p *Plan) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, step := range p.Steps {
+		counts[step.Action]++
+	}
+	return counts
+}
+
+// Save writes the plan as indented JSON
+func Save(p *Plan, filePath string) error {
+	if err := utils.EnsureDir(filePath); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write plan file: %w", err)
+	}
+
+	return nil
+}
+
+// Load reads a plan file written by Save
+func Load(filePath string) (*Plan, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan file: %w", err)
+	}
+
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse plan file: %w", err)
+	}
+
+	if p.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported plan version %d (expected %d)", p.Version, FormatVersion)
+	}
+
+	return &p, nil
+}
+
+// CheckDrift verifies that the installed state still matches the state the plan was computed from
+func CheckDrift(installed *state.Snapshot, p *Plan) error {
+	if current := installed.Hash(); current != p.StateHash {
+		return fmt.Errorf("installed packages have changed since the plan was created at %s; run plan again",
+			p.CreatedAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// Apply executes exactly the install and remove steps of a plan and records each step in rep.
+// Skipped steps are reported but not executed.
+func Apply(r runner.Runner, installed *state.Snapshot, rep *report.Report, p *Plan, dryRun bool, verbose bool) error {
+	if err := CheckDrift(installed, p); err != nil {
+		return err
+	}
+
+	for _, step := range p.Steps {
+		result := report.Result{Type: step.Type, Name: step.Name, ID: step.ID, Group: step.Group}
+		pre, post := stepHooks(step)
+
+		switch step.Action {
+		case ActionSkip:
+			if verbose {
+				utils.PrintStatus(utils.Yellow, fmt.Sprintf("Skipping %s: %s (%s)", step.Type, step.Name, step.Reason))
+			}
+			result.Status = report.StatusAlreadyPresent
+			rep.Add(result)
+			continue
+		case ActionInstall, ActionRemove:
+		default:
+			return fmt.Errorf("unknown plan action %q for %s: %s", step.Action, step.Type, step.Name)
+		}
+
+		if dryRun {
+			hooks.Run(r, pre, step.Package(), true, verbose)
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would %s %s: %s", step.Action, step.Type, step.Name))
+			hooks.Run(r, post, step.Package(), true, verbose)
+			result.Status = report.StatusSkipped
+			result.Message = "dry run"
+			rep.Add(result)
+			continue
+		}
+
+		start := time.Now()
+		err := hooks.Run(r, pre, step.Package(), false, verbose)
+		if err == nil {
+			err = applyStep(r, step, verbose)
+		}
+		result.Duration = time.Since(start)
+		if err != nil {
+			utils.PrintStatus(utils.Red, fmt.Sprintf("Failed to %s %s: %s - %v", step.Action, step.Type, step.Name, err))
+			result.Status = report.StatusFailed
+			result.Error = err.Error()
+			result.Output = runner.ErrorOutput(err)
+			rep.Add(result)
+			continue
+		}
+
+		if step.Action == ActionInstall {
+			installed.MarkInstalled(step.Type, types.PackageInfo{Name: step.Name, ID: step.ID})
+			utils.PrintStatus(utils.Green, fmt.Sprintf("Installed %s: %s", step.Type, step.Name))
+			result.Status = report.StatusInstalled
+		} else {
+			installed.MarkRemoved(step.Type, prune.RemovedPackageInfo(step.Type, step.Name))
+			utils.PrintStatus(utils.Green, fmt.Sprintf("Removed %s: %s", step.Type, step.Name))
+			result.Status = report.StatusRemoved
+		}
+
+		if err := hooks.Run(r, post, step.Package(), false, verbose); err != nil {
+			utils.PrintStatus(utils.Red, fmt.Sprintf("%s %s: %s but %v", utils.Capitalize(string(result.Status)), step.Type, step.Name, err))
+			result.Status = report.StatusFailed
+			result.Error = err.Error()
+			result.Output = runner.ErrorOutput(err)
+		}
+		result.Duration = time.Since(start)
+		rep.Add(result)
+	}
+
+	return nil
+}
+
+// stepHooks returns the hook events that run before and after a step. An install has pre_install
+// and post_install hooks and a removal only a post_remove hook.
+func stepHooks(step Step) (string, string) {
+	if step.Action == ActionRemove {
+		return "", hooks.PostRemove
+	}
+	return hooks.PreInstall, hooks.PostInstall
+}
+
+// applyStep executes a single install or remove step
+func applyStep(r runner.Runner, step Step, verbose bool) error {
+	if step.Action == ActionRemove {
+		return prune.RemovePackage(r, step.Type, step.Name)
+	}
+
+	pkgInfo := types.PackageInfo{Name: step.Name, ID: step.ID, Version: step.Version}
+	return brew.InstallSinglePackage(r, step.Type, pkgInfo, verbose)
+}
@@ -0,0 +1,394 @@
+package plan_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/hooks"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/plan"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+// config lists the apps group before core, which has the lower priority and is installed first
+const config = `groups:
+  apps:
+    priority: 2
+    packages:
+      brew:
+        - name: fd
+      cask:
+        - name: visual-studio-code
+          post_remove: rm -rf ~/.vscode
+        - name: firefox
+          pre_install: echo firefox
+  core:
+    priority: 1
+    packages:
+      tap:
+        - name: shiron-dev/tap
+      brew:
+        - name: git
+        - name: jq
+      mas:
+        - name: Xcode
+          id: 497799835
+      vscode:
+        - name: GitHub.copilot
+        - name: esbenp.prettier-vscode
+      cargo:
+        - name: ripgrep
+        - name: stylua
+      npm:
+        - name: typescript
+profiles:
+  work:
+    groups: [core]
+`
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// load returns the replay fixtures with the state, dependency graph and configuration to plan from
+func load(t *testing.T) (*runner.FakeRunner, *state.Snapshot, *deps.Graph, *types.PackageGrouped) {
+	t.Helper()
+
+	fake, err := runner.LoadFixtures(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := state.Load(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := deps.Load(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := filepath.Join(t.TempDir(), "packages.yaml")
+	if err := os.WriteFile(filePath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	grouped, err := yamlPkg.LoadMergedConfig(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fake, installed, graph, grouped
+}
+
+// build plans the configuration against the replay fixtures
+func build(t *testing.T, installOptions *types.InstallOptions, pruneOptions *types.PruneOptions) (*runner.FakeRunner, *state.Snapshot, *plan.Plan) {
+	t.Helper()
+
+	fake, installed, graph, grouped := load(t)
+	filteredPackages, err := yamlPkg.GetFilteredPackages(grouped, installOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := plan.BuildPlan(installed, graph, "packages.yaml", grouped, filteredPackages, installOptions, pruneOptions)
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+
+	return fake, installed, p
+}
+
+// steps summarizes plan steps as "action type:name", followed by the reason and any post_remove hook
+func steps(p *plan.Plan) []string {
+	got := []string{}
+	for _, step := range p.Steps {
+		s := step.Action + " " + step.Type + ":" + step.Name
+		if step.Reason != "" {
+			s += " (" + step.Reason + ")"
+		}
+		if step.PostRemove != "" {
+			s += " post_remove=" + step.PostRemove
+		}
+		got = append(got, s)
+	}
+
+	return got
+}
+
+func TestBuildPlan(t *testing.T) {
+	t.Parallel()
+
+	installs := []string{
+		"skip tap:shiron-dev/tap (already installed)",
+		"skip brew:git (already installed)",
+		"skip brew:jq (already installed)",
+		"skip mas:Xcode (already installed)",
+		"skip vscode:GitHub.copilot (already installed)",
+		"skip vscode:esbenp.prettier-vscode (already installed)",
+		"skip cargo:ripgrep (already installed)",
+		"skip cargo:stylua (already installed)",
+		"skip npm:typescript (already installed)",
+		"install brew:fd",
+		"install cask:firefox",
+		"skip cask:visual-studio-code (already installed)",
+	}
+
+	tests := []struct {
+		name           string
+		installOptions types.InstallOptions
+		pruneOptions   *types.PruneOptions
+		want           []string
+	}{
+		{"installs and skips in group priority order", types.InstallOptions{}, nil, installs},
+		{
+			"prune removals",
+			types.InstallOptions{},
+			&types.PruneOptions{},
+			append(append([]string{}, installs...),
+				"remove mas:1475387142 (Tailscale) (not defined in YAML configuration)",
+				"remove cask:slack (not defined in YAML configuration)",
+				"remove brew:wget (not defined in YAML configuration)",
+				"remove brew:openssl@3 (not defined in YAML configuration)",
+				"remove brew:ca-certificates (not defined in YAML configuration)",
+				"remove brew:libidn2 (not defined in YAML configuration)",
+				"remove brew:ripgrep (not defined in YAML configuration)",
+				"remove tap:homebrew/bundle (not defined in YAML configuration)",
+			),
+		},
+		{
+			"removals outside a profile keep their hooks",
+			types.InstallOptions{Profile: "work", SkipVSCode: true, SkipCargo: true, SkipNpm: true},
+			&types.PruneOptions{Profile: "work", SkipTaps: true, SkipBrews: true, SkipMas: true, SkipVSCode: true, SkipCargo: true, SkipNpm: true},
+			[]string{
+				"skip tap:shiron-dev/tap (already installed)",
+				"skip brew:git (already installed)",
+				"skip brew:jq (already installed)",
+				"skip mas:Xcode (already installed)",
+				"remove cask:slack (not in profile work)",
+				"remove cask:visual-studio-code (not in profile work) post_remove=rm -rf ~/.vscode",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, installed, p := build(t, &tt.installOptions, tt.pruneOptions)
+			if got := steps(p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BuildPlan() steps =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if p.Version != plan.FormatVersion || p.ConfigFile != "packages.yaml" || p.StateHash != installed.Hash() {
+				t.Errorf("BuildPlan() = version %d, config %s, hash %s, want %d, packages.yaml, %s", p.Version, p.ConfigFile, p.StateHash, plan.FormatVersion, installed.Hash())
+			}
+		})
+	}
+}
+
+// applyOptions plan installs and removals of formulae, casks and mas apps only
+var applyOptions = struct {
+	install types.InstallOptions
+	prune   types.PruneOptions
+}{
+	types.InstallOptions{SkipVSCode: true, SkipCargo: true, SkipNpm: true},
+	types.PruneOptions{SkipTaps: true, SkipBrews: true, SkipVSCode: true, SkipCargo: true, SkipNpm: true},
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		dryRun   bool
+		want     []string
+		statuses map[string]report.Status
+	}{
+		{
+			"applies install and remove steps",
+			false,
+			[]string{"brew install fd", "hook echo firefox", "brew install --cask firefox", "mas uninstall 1475387142", "brew uninstall --cask slack"},
+			map[string]report.Status{
+				"tap:shiron-dev/tap":         report.StatusAlreadyPresent,
+				"brew:git":                   report.StatusAlreadyPresent,
+				"brew:jq":                    report.StatusAlreadyPresent,
+				"mas:Xcode":                  report.StatusAlreadyPresent,
+				"brew:fd":                    report.StatusInstalled,
+				"cask:firefox":               report.StatusInstalled,
+				"cask:visual-studio-code":    report.StatusAlreadyPresent,
+				"mas:1475387142 (Tailscale)": report.StatusRemoved,
+				"cask:slack":                 report.StatusRemoved,
+			},
+		},
+		{
+			"dry run",
+			true,
+			[]string{},
+			map[string]report.Status{
+				"tap:shiron-dev/tap":         report.StatusAlreadyPresent,
+				"brew:git":                   report.StatusAlreadyPresent,
+				"brew:jq":                    report.StatusAlreadyPresent,
+				"mas:Xcode":                  report.StatusAlreadyPresent,
+				"brew:fd":                    report.StatusSkipped,
+				"cask:firefox":               report.StatusSkipped,
+				"cask:visual-studio-code":    report.StatusAlreadyPresent,
+				"mas:1475387142 (Tailscale)": report.StatusSkipped,
+				"cask:slack":                 report.StatusSkipped,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, installed, p := build(t, &applyOptions.install, &applyOptions.prune)
+			fixtures, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, argv := range [][]string{
+				{"brew", "install", "fd"},
+				{"brew", "install", "--cask", "firefox"},
+				{"mas", "uninstall", "1475387142"},
+				{"brew", "uninstall", "--cask", "slack"},
+			} {
+				fake.Script(runner.Response{}, argv[0], argv[1:]...)
+			}
+			for _, step := range p.Steps {
+				if step.PreInstall != "" {
+					fake.Script(runner.Response{}, "env", append(hooks.Env(hooks.PreInstall, step.Package()), "sh", "-c", step.PreInstall)...)
+				}
+			}
+
+			rep := report.New("apply")
+			if err := plan.Apply(fake, installed, rep, p, tt.dryRun, false); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			calls := []string{}
+			for _, call := range fake.Calls() {
+				if _, ok := fixtures.Responses[call]; ok {
+					continue
+				}
+				// Hook calls pass the package in the environment; keep the hook command only
+				if strings.HasPrefix(call, "env ") {
+					call = "hook " + call[strings.LastIndex(call, "sh -c ")+len("sh -c "):]
+				}
+				calls = append(calls, call)
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("Apply() ran %q, want %q", calls, tt.want)
+			}
+
+			got := make(map[string]report.Status)
+			for _, result := range rep.Results {
+				got[result.Type+":"+result.Name] = result.Status
+			}
+			if !reflect.DeepEqual(got, tt.statuses) {
+				t.Errorf("Apply() statuses = %v, want %v", got, tt.statuses)
+			}
+		})
+	}
+}
+
+func TestApply_Refuses(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		modify func(installed *state.Snapshot, p *plan.Plan)
+	}{
+		{
+			"installed packages changed",
+			func(installed *state.Snapshot, _ *plan.Plan) {
+				installed.MarkInstalled("brew", types.PackageInfo{Name: "fd"})
+			},
+		},
+		{
+			"unknown action",
+			func(_ *state.Snapshot, p *plan.Plan) {
+				p.Steps[0].Action = "upgrade"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, installed, p := build(t, &applyOptions.install, &applyOptions.prune)
+			tt.modify(installed, p)
+			calls := len(fake.Calls())
+
+			rep := report.New("apply")
+			if err := plan.Apply(fake, installed, rep, p, false, false); err == nil {
+				t.Fatal("Apply() error = nil, want an error")
+			}
+			if len(rep.Results) != 0 || len(fake.Calls()) != calls {
+				t.Errorf("Apply() acted before refusing: results %v, calls %v", rep.Results, fake.Calls()[calls:])
+			}
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	_, _, p := build(t, &applyOptions.install, &applyOptions.prune)
+	filePath := filepath.Join(t.TempDir(), "plans", "plan.json")
+	if err := plan.Save(p, filePath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := plan.Load(filePath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !got.CreatedAt.Equal(p.CreatedAt) || got.StateHash != p.StateHash || !reflect.DeepEqual(got.Steps, p.Steps) {
+		t.Errorf("Load() = %+v, want %+v", got, p)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unknown version", `{"version": 2, "steps": []}`},
+		{"no version", `{"steps": []}`},
+		{"invalid JSON", `{"version": 1,`},
+		{"missing file", ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			filePath := filepath.Join(dir, fmt.Sprintf("plan%d.json", i))
+			if tt.content != "" {
+				if err := os.WriteFile(filePath, []byte(tt.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, err := plan.Load(filePath); err == nil {
+				t.Error("Load() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package prune
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/hooks"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+// RemovalOrder is the order in which package types are removed, the reverse of the install order:
+// npm, Cargo and Go packages and VS Code extensions, then mas, casks, brews, taps
+var RemovalOrder = []string{"npm", "cargo", "go", "vscode", "mas", "cask", "brew", "tap"}
+
+// GetAllPackagesFromConfig extracts all packages from the configuration
+func GetAllPackagesFromConfig(config *types.PackageGrouped) map[string]map[string]bool {
+	var pkgs []types.FilteredPackage
+	for _, group := range config.Groups {
+		for pkgType, pkgInfos := range group.Packages { // Iterate over package types (brew, cask, etc.)
+			for _, pkgInfo := range pkgInfos { // Iterate over packages of that type
+				pkgs = append(pkgs, types.FilteredPackage{PackageInfo: pkgInfo, Type: pkgType})
+			}
+		}
+	}
+
+	return PackagesToKeep(pkgs)
+}
+
+// ConfiguredPackages returns every package of the configuration with the hooks it inherits from
+// its group, keyed by yamlPkg.PackageKey
+func ConfiguredPackages(config *types.PackageGrouped) map[string]types.FilteredPackage {
+	result := make(map[string]types.FilteredPackage)
+	pkgs, _ := yamlPkg.GetFilteredPackages(config, &types.InstallOptions{}) // Only a profile can fail
+	for _, pkg := range pkgs {
+		result[yamlPkg.PackageKey(pkg.Type, pkg.PackageInfo)] = pkg
+	}
+	return result
+}
+
+// ConfiguredPackage returns the configured package matching an entry of a removal set, or the
+// entry without group and hooks when it is not configured
+func ConfiguredPackage(configured map[string]types.FilteredPackage, pkgType string, pkg string) types.FilteredPackage {
+	pkgInfo := RemovedPackageInfo(pkgType, pkg)
+	if configuredPkg, ok := configured[yamlPkg.PackageKey(pkgType, pkgInfo)]; ok {
+		return configuredPkg
+	}
+	return types.FilteredPackage{PackageInfo: pkgInfo, Type: pkgType}
+}
+
+// KeepSet returns the packages prune must keep: those selected by the profile, groups and tags
+// in options, filtered the same way as for install, or every package in the configuration
+func KeepSet(config *types.PackageGrouped, options *types.PruneOptions) (map[string]map[string]bool, error) {
+	if options.Profile == "" && len(options.Groups) == 0 && len(options.Tags) == 0 {
+		return GetAllPackagesFromConfig(config), nil
+	}
+
+	pkgs, err := yamlPkg.GetFilteredPackages(config, &types.InstallOptions{
+		Profile: options.Profile,
+		Groups:  options.Groups,
+		Tags:    options.Tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return PackagesToKeep(pkgs), nil
+}
+
+// PackagesToKeep builds a keep set, keyed by package type and then by normalized name (or ID for mas apps)
+func PackagesToKeep(pkgs []types.FilteredPackage) map[string]map[string]bool {
+	result := make(map[string]map[string]bool)
+	for _, pkgType := range types.PackageTypes {
+		result[pkgType] = make(map[string]bool) // MAS uses ID as string key
+	}
+
+	for _, pkg := range pkgs {
+		switch pkg.Type {
+		case "tap", "cask":
+			result[pkg.Type][pkg.Name] = true
+		case "brew":
+			result["brew"][pkg.Name] = true
+			// brew lists tap-qualified formulae such as "owner/tap/name" under their short name
+			if i := strings.LastIndex(pkg.Name, "/"); i >= 0 {
+				result["brew"][pkg.Name[i+1:]] = true
+			}
+		case "mas":
+			if pkg.ID != 0 { // Ensure ID is present for MAS apps
+				result["mas"][fmt.Sprintf("%d", pkg.ID)] = true
+			}
+		default:
+			if result[pkg.Type] != nil {
+				result[pkg.Type][yamlPkg.NormalizeName(pkg.Type, pkg.Name)] = true
+			}
+		}
+	}
+
+	return result
+}
+
+// FindPackagesToRemove identifies installed packages that are not in the YAML configuration.
+// The result is keyed by package type; mas entries are formatted as "ID (Name)".
+func FindPackagesToRemove(yamlPackages map[string]map[string]bool, installed *state.Snapshot,
+	options *types.PruneOptions) map[string][]string {
+
+	result := make(map[string][]string)
+	for _, pkgType := range types.PackageTypes {
+		result[pkgType] = []string{}
+	}
+
+	// Check taps
+	if !options.SkipTaps {
+		for _, name := range installed.Names("tap") {
+			if !yamlPackages["tap"][name] && !IsKept(options.Keep, "tap", name, 0) {
+				result["tap"] = append(result["tap"], name)
+			}
+		}
+	}
+
+	// Check brews
+	if !options.SkipBrews {
+		for _, name := range installed.Names("brew") {
+			if !yamlPackages["brew"][name] && !IsKept(options.Keep, "brew", name, 0) {
+				result["brew"] = append(result["brew"], name)
+			}
+		}
+	}
+
+	// Check casks
+	if !options.SkipCasks {
+		for _, name := range installed.Names("cask") {
+			if !yamlPackages["cask"][name] && !IsKept(options.Keep, "cask", name, 0) {
+				result["cask"] = append(result["cask"], name)
+			}
+		}
+	}
+
+	// Check mas apps
+	if !options.SkipMas {
+		for _, app := range installed.MasApps() {
+			idStr := fmt.Sprintf("%d", app.ID)
+			if !yamlPackages["mas"][idStr] && !IsKept(options.Keep, "mas", app.Name, app.ID) {
+				result["mas"] = append(result["mas"], fmt.Sprintf("%d (%s)", app.ID, app.Name))
+			}
+		}
+	}
+
+	// Check VS Code extensions and Go, Cargo and npm packages
+	for _, pkgType := range yamlPkg.ToolTypes {
+		if skipsType(pkgType, options) {
+			continue
+		}
+		for _, name := range installed.Names(pkgType) {
+			if !yamlPackages[pkgType][name] && !IsKept(options.Keep, pkgType, name, 0) {
+				result[pkgType] = append(result[pkgType], name)
+			}
+		}
+	}
+
+	return result
+}
+
+// skipsType reports whether prune options skip a VS Code, Go, Cargo or npm package type
+func skipsType(pkgType string, options *types.PruneOptions) bool {
+	switch pkgType {
+	case "vscode":
+		return options.SkipVSCode
+	case "go":
+		return options.SkipGo
+	case "cargo":
+		return options.SkipCargo
+	case "npm":
+		return options.SkipNpm
+	}
+	return false
+}
+
+// KeepDependencies adds every installed formula needed by a kept formula to the keep set.
+// Kept formulae are the installed ones that are configured or match a --keep pattern.
+// It returns, for each formula kept only as a dependency, the formulae that need it.
+func KeepDependencies(graph *deps.Graph, yamlPackages map[string]map[string]bool, installed *state.Snapshot, options *types.PruneOptions) map[string][]string {
+	var roots []string
+	for _, name := range installed.Names("brew") {
+		if yamlPackages["brew"][name] || IsKept(options.Keep, "brew", name, 0) {
+			roots = append(roots, name)
+		}
+	}
+
+	required := graph.Required(roots)
+	for name := range required {
+		yamlPackages["brew"][name] = true
+	}
+	return required
+}
+
+// IsKept reports whether an installed package matches any --keep pattern.
+// Patterns are shell globs (see path.Match) against the name, optionally prefixed with
+// "type:" to match one package type only; mas apps also match by ID.
+func IsKept(patterns []string, pkgType string, name string, id int64) bool {
+	for _, pattern := range patterns {
+		if i := strings.Index(pattern, ":"); i >= 0 {
+			if prefix := pattern[:i]; types.IsPackageType(prefix) {
+				if prefix != pkgType {
+					continue
+				}
+				pattern = pattern[i+1:]
+			}
+		}
+
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if pkgType == "mas" && pattern == strconv.FormatInt(id, 10) {
+			return true
+		}
+	}
+	return false
+}
+
+// CountPackages returns the total number of packages in a removal set
+func CountPackages(packagesToRemove map[string][]string) int {
+	count := 0
+	for _, pkgs := range packagesToRemove {
+		count += len(pkgs)
+	}
+	return count
+}
+
+// RemovePackagesByType removes packages of a specific type, updates the installed snapshot
+// and records the outcome for every package in rep. The post_remove hook of a removed package
+// that is still in configured, outside the kept profile, groups or tags, runs after its removal.
+func RemovePackagesByType(r runner.Runner, installed *state.Snapshot, rep *report.Report, pkgType string, packages []string,
+	configured map[string]types.FilteredPackage, options *types.PruneOptions) error {
+	if len(packages) == 0 {
+		return nil
+	}
+
+	utils.PrintStatus(utils.Blue, fmt.Sprintf("Removing %s packages...", pkgType))
+
+	for _, pkg := range packages {
+		if options.Verbose {
+			utils.PrintStatus(utils.Cyan, fmt.Sprintf("Processing %s: %s", pkgType, pkg))
+		}
+
+		pkgInfo := RemovedPackageInfo(pkgType, pkg)
+		configuredPkg := ConfiguredPackage(configured, pkgType, pkg)
+		result := report.Result{Type: pkgType, Name: pkg, ID: pkgInfo.ID, Group: configuredPkg.Group, Status: report.StatusRemoved}
+
+		start := time.Now()
+		err := RemovePackage(r, pkgType, pkg)
+		result.Duration = time.Since(start)
+		if err != nil {
+			utils.PrintStatus(utils.Red, fmt.Sprintf("Failed to remove %s: %s - %v", pkgType, pkg, err))
+			result.Status = report.StatusFailed
+			result.Error = err.Error()
+			result.Output = runner.ErrorOutput(err)
+			rep.Add(result)
+			continue
+		}
+
+		installed.MarkRemoved(pkgType, pkgInfo)
+		utils.PrintStatus(utils.Green, fmt.Sprintf("Removed %s: %s", pkgType, pkg))
+
+		if err := hooks.Run(r, hooks.PostRemove, configuredPkg, false, options.Verbose); err != nil {
+			utils.PrintStatus(utils.Red, fmt.Sprintf("Removed %s: %s but %v", pkgType, pkg, err))
+			result.Status = report.StatusFailed
+			result.Error = err.Error()
+			result.Output = runner.ErrorOutput(err)
+		}
+		result.Duration = time.Since(start)
+		rep.Add(result)
+	}
+
+	return nil
+}
+
+// RemovedPackageInfo converts an entry of a removal set back into package info
+func RemovedPackageInfo(pkgType string, pkg string) types.PackageInfo {
+	if pkgType != "mas" {
+		return types.PackageInfo{Name: pkg}
+	}
+
+	// Extract ID and name from "ID (Name)" format
+	parts := strings.SplitN(pkg, " ", 2)
+	id, _ := strconv.ParseInt(parts[0], 10, 64)
+	name := ""
+	if len(parts) > 1 {
+		name = strings.TrimSuffix(strings.TrimPrefix(parts[1], "("), ")")
+	}
+	return types.PackageInfo{Name: name, ID: id}
+}
+
+// RemovePackage removes a single package
+func RemovePackage(r runner.Runner, pkgType string, pkg string) error {
+	switch pkgType {
+	case "tap":
+		return removeTap(r, pkg)
+	case "brew":
+		return removeBrew(r, pkg)
+	case "cask":
+		return removeCask(r, pkg)
+	case "mas":
+		// Extract ID from "ID (Name)" format
+		parts := strings.SplitN(pkg, " ", 2)
+		if len(parts) > 0 {
+			return removeMas(r, parts[0])
+		}
+		return fmt.Errorf("invalid mas package format: %s", pkg)
+	case "vscode":
+		return removeVSCode(r, pkg)
+	case "go":
+		return removeGo(r, pkg)
+	case "cargo":
+		return removeCargo(r, pkg)
+	case "npm":
+		return removeNpm(r, pkg)
+	default:
+		return fmt.Errorf("unknown package type: %s", pkgType)
+	}
+}
+
+// removeTap removes a tap
+func removeTap(r runner.Runner, name string) error {
+	return runner.Run(r, "brew", "untap", name)
+}
+
+// removeBrew removes a brew formula
+func removeBrew(r runner.Runner, name string) error {
+	return runner.Run(r, "brew", "uninstall", name)
+}
+
+// removeCask removes a cask
+func removeCask(r runner.Runner, name string) error {
+	return runner.Run(r, "brew", "uninstall", "--cask", name)
+}
+
+// removeMas removes a Mac App Store app
+func removeMas(r runner.Runner, id string) error {
+	if !r.CommandExists("mas") {
+		return fmt.Errorf("mas is not installed, cannot remove Mac App Store apps")
+	}
+	return runner.Run(r, "mas", "uninstall", id)
+}
+
+// removeVSCode removes a VS Code extension
+func removeVSCode(r runner.Runner, id string) error {
+	return runner.Run(r, "code", "--uninstall-extension", id)
+}
+
+// removeGo removes a Go program by deleting the binary that go install built from the package path
+func removeGo(r runner.Runner, path string) error {
+	binaries, err := yamlPkg.GoBinaries(r)
+	if err != nil {
+		return err
+	}
+	for _, binary := range binaries {
+		if binary.Path == path {
+			return runner.Run(r, "rm", "-f", binary.File)
+		}
+	}
+	return fmt.Errorf("no binary installed by go install for %s", path)
+}
+
+// removeCargo removes a Rust crate
+func removeCargo(r runner.Runner, name string) error {
+	return runner.Run(r, "cargo", "uninstall", name)
+}
+
+// removeNpm removes a global npm package
+func removeNpm(r runner.Runner, name string) error {
+	return runner.Run(r, "npm", "uninstall", "--global", name)
+}
@@ -0,0 +1,337 @@
+package prune_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/prune"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+const config = `groups:
+  core:
+    priority: 1
+    packages:
+      tap:
+        - name: shiron-dev/tap
+      brew:
+        - name: git
+          tags: [cli]
+        - name: jq
+          tags: [cli]
+      cask:
+        - name: visual-studio-code
+      mas:
+        - name: Xcode
+          id: 497799835
+      vscode:
+        - name: GitHub.copilot
+      cargo:
+        - name: ripgrep
+      npm:
+        - name: corepack
+        - name: npm
+  net:
+    priority: 2
+    packages:
+      brew:
+        - name: wget
+`
+
+// removals are the removal commands of every installed package the configuration can leave out
+var removals = []string{
+	"brew untap homebrew/bundle",
+	"brew uninstall ripgrep",
+	"brew uninstall wget",
+	"brew uninstall libidn2",
+	"brew uninstall openssl@3",
+	"brew uninstall ca-certificates",
+	"brew uninstall --cask slack",
+	"mas uninstall 1475387142",
+	"code --uninstall-extension esbenp.prettier-vscode",
+	"cargo uninstall stylua",
+	"npm uninstall --global typescript",
+}
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// prunePackages runs prune the way the prune command does, without asking for confirmation
+func prunePackages(t *testing.T, fake *runner.FakeRunner, options *types.PruneOptions) *report.Report {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "packages.yaml")
+	if err := os.WriteFile(filePath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	grouped, err := yamlPkg.LoadMergedConfig(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlPackages, err := prune.KeepSet(grouped, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := state.Load(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var graph *deps.Graph
+	if !options.SkipBrews {
+		if graph, err = deps.Load(fake); err != nil {
+			t.Fatal(err)
+		}
+		prune.KeepDependencies(graph, yamlPackages, installed, options)
+	}
+
+	packagesToRemove := prune.FindPackagesToRemove(yamlPackages, installed, options)
+	packagesToRemove["brew"] = graph.RemovalOrder(packagesToRemove["brew"])
+
+	rep := report.New("prune")
+	configured := prune.ConfiguredPackages(grouped)
+	for _, pkgType := range prune.RemovalOrder {
+		if err := prune.RemovePackagesByType(fake, installed, rep, pkgType, packagesToRemove[pkgType], configured, options); err != nil {
+			t.Fatalf("RemovePackagesByType() error = %v", err)
+		}
+	}
+
+	return rep
+}
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		options  types.PruneOptions
+		fail     []string
+		want     []string
+		statuses map[string]report.Status
+	}{
+		{
+			"unconfigured packages",
+			types.PruneOptions{ConfirmAll: true},
+			nil,
+			[]string{
+				"npm uninstall --global typescript",
+				"cargo uninstall stylua",
+				"code --uninstall-extension esbenp.prettier-vscode",
+				"mas uninstall 1475387142",
+				"brew uninstall --cask slack",
+				"brew uninstall ripgrep",
+				"brew untap homebrew/bundle",
+			},
+			map[string]report.Status{
+				"npm:typescript":                report.StatusRemoved,
+				"cargo:stylua":                  report.StatusRemoved,
+				"vscode:esbenp.prettier-vscode": report.StatusRemoved,
+				"mas:1475387142 (Tailscale)":    report.StatusRemoved,
+				"cask:slack":                    report.StatusRemoved,
+				"brew:ripgrep":                  report.StatusRemoved,
+				"tap:homebrew/bundle":           report.StatusRemoved,
+			},
+		},
+		{
+			"groups remove other groups and their dependencies",
+			types.PruneOptions{ConfirmAll: true, Groups: []string{"core"}, SkipTaps: true, SkipCasks: true, SkipMas: true, SkipVSCode: true, SkipCargo: true, SkipNpm: true},
+			nil,
+			[]string{
+				"brew uninstall wget",
+				"brew uninstall openssl@3",
+				"brew uninstall ca-certificates",
+				"brew uninstall libidn2",
+				"brew uninstall ripgrep",
+			},
+			map[string]report.Status{
+				"brew:ripgrep":         report.StatusRemoved,
+				"brew:wget":            report.StatusRemoved,
+				"brew:libidn2":         report.StatusRemoved,
+				"brew:openssl@3":       report.StatusRemoved,
+				"brew:ca-certificates": report.StatusRemoved,
+			},
+		},
+		{
+			"keep patterns",
+			types.PruneOptions{ConfirmAll: true, Keep: []string{"brew:rip*", "Tailscale", "npm:*", "homebrew/*"}},
+			nil,
+			[]string{
+				"cargo uninstall stylua",
+				"code --uninstall-extension esbenp.prettier-vscode",
+				"brew uninstall --cask slack",
+			},
+			map[string]report.Status{
+				"cargo:stylua":                  report.StatusRemoved,
+				"vscode:esbenp.prettier-vscode": report.StatusRemoved,
+				"cask:slack":                    report.StatusRemoved,
+			},
+		},
+		{
+			"failed removal",
+			types.PruneOptions{ConfirmAll: true, SkipBrews: true, SkipMas: true, SkipVSCode: true, SkipCargo: true, SkipNpm: true},
+			[]string{"brew uninstall --cask slack"},
+			[]string{
+				"brew uninstall --cask slack",
+				"brew untap homebrew/bundle",
+			},
+			map[string]report.Status{
+				"cask:slack":          report.StatusFailed,
+				"tap:homebrew/bundle": report.StatusRemoved,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fixtures, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fake, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, removal := range removals {
+				resp := runner.Response{}
+				if utils.ContainsString(tt.fail, removal) {
+					resp.ExitCode = 1
+				}
+				argv := strings.Fields(removal)
+				fake.Script(resp, argv[0], argv[1:]...)
+			}
+
+			rep := prunePackages(t, fake, &tt.options)
+
+			calls := []string{}
+			for _, call := range fake.Calls() {
+				if _, ok := fixtures.Responses[call]; !ok {
+					calls = append(calls, call)
+				}
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("prune calls = %v, want %v", calls, tt.want)
+			}
+
+			got := make(map[string]report.Status)
+			for _, result := range rep.Results {
+				got[result.Type+":"+result.Name] = result.Status
+			}
+			if !reflect.DeepEqual(got, tt.statuses) {
+				t.Errorf("prune statuses = %v, want %v", got, tt.statuses)
+			}
+		})
+	}
+}
+
+func TestIsKept(t *testing.T) {
+	t.Parallel()
+
+	type args struct {
+		patterns []string
+		pkgType  string
+		name     string
+		id       int64
+	}
+
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"no patterns", args{nil, "brew", "git", 0}, false},
+		{"exact name", args{[]string{"git"}, "brew", "git", 0}, true},
+		{"glob", args{[]string{"python@*"}, "brew", "python@3.12", 0}, true},
+		{"typed glob", args{[]string{"brew:lib*"}, "brew", "libidn2", 0}, true},
+		{"typed glob of another type", args{[]string{"cask:lib*"}, "brew", "libidn2", 0}, false},
+		{"slash in a tap name", args{[]string{"homebrew/*"}, "tap", "homebrew/bundle", 0}, true},
+		{"mas by ID", args{[]string{"mas:1475387142"}, "mas", "Tailscale", 1475387142}, true},
+		{"mas by name", args{[]string{"Tail*"}, "mas", "Tailscale", 1475387142}, true},
+		{"ID of another type", args{[]string{"1475387142"}, "brew", "git", 0}, false},
+		{"colon not naming a type", args{[]string{"owner:name"}, "brew", "owner:name", 0}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := prune.IsKept(tt.args.patterns, tt.args.pkgType, tt.args.name, tt.args.id); got != tt.want {
+				t.Errorf("IsKept() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepSet(t *testing.T) {
+	t.Parallel()
+
+	grouped := &types.PackageGrouped{
+		Groups: map[string]types.Group{
+			"core": {Priority: 1, Packages: map[string][]types.PackageInfo{
+				"brew": {{Name: "git", Tags: []string{"cli"}}, {Name: "owner/tap/tool"}},
+				"mas":  {{Name: "Xcode", ID: 497799835}},
+			}},
+			"dev": {Priority: 2, Packages: map[string][]types.PackageInfo{
+				"brew":   {{Name: "go", Tags: []string{"lang"}}},
+				"vscode": {{Name: "GitHub.copilot", Tags: []string{"cli"}}},
+			}},
+		},
+		Profiles: map[string]types.Profile{
+			"minimal": {Description: "Minimal", Groups: []string{"core"}, ExcludeTags: []string{"cli"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		options types.PruneOptions
+		want    []string
+		wantErr bool
+	}{
+		{"whole configuration", types.PruneOptions{}, []string{"brew:git", "brew:go", "brew:owner/tap/tool", "brew:tool", "mas:497799835", "vscode:github.copilot"}, false},
+		{"groups", types.PruneOptions{Groups: []string{"dev"}}, []string{"brew:go", "vscode:github.copilot"}, false},
+		{"tags", types.PruneOptions{Tags: []string{"cli"}}, []string{"brew:git", "vscode:github.copilot"}, false},
+		{"profile", types.PruneOptions{Profile: "minimal"}, []string{"brew:owner/tap/tool", "brew:tool", "mas:497799835"}, false},
+		{"unknown profile", types.PruneOptions{Profile: "missing"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			keep, err := prune.KeepSet(grouped, &tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("KeepSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got []string
+			for _, pkgType := range types.PackageTypes {
+				var names []string
+				for name := range keep[pkgType] {
+					names = append(names, pkgType+":"+name)
+				}
+				sort.Strings(names)
+				got = append(got, names...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("KeepSet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+// Status is the outcome of an operation on a single package
+type Status string
+
+// Package result statuses
+const (
+	StatusInstalled      Status = "installed"
+	StatusRemoved        Status = "removed"
+	StatusUpgraded       Status = "upgraded"
+	StatusAlreadyPresent Status = "already_present"
+	StatusSkipped        Status = "skipped"
+	StatusFailed         Status = "failed"
+)
+
+// statusOrder is the order in which statuses are summarized
+var statusOrder = []Status{StatusInstalled, StatusRemoved, StatusUpgraded, StatusAlreadyPresent, StatusSkipped, StatusFailed}
+
+// maxOutputLines limits how much command output is kept for a failed package
+const maxOutputLines = 20
+
+// Result is the outcome of an operation on a single package
+type Result struct {
+	Type     string        `json:"type" yaml:"type"`
+	Name     string        `json:"name" yaml:"name"`
+	ID       int64         `json:"id,omitempty" yaml:"id,omitempty"`
+	Group    string        `json:"group,omitempty" yaml:"group,omitempty"`
+	Status   Status        `json:"status" yaml:"status"`
+	Message  string        `json:"message,omitempty" yaml:"message,omitempty"`
+	Error    string        `json:"error,omitempty" yaml:"error,omitempty"`
+	Output   string        `json:"output,omitempty" yaml:"output,omitempty"` // Command output of a failed package
+	Duration time.Duration `json:"duration_ns,omitempty" yaml:"duration,omitempty"`
+}
+
+// Report collects per-package results of an install, prune, apply, upgrade or undo run
+type Report struct {
+	Command    string    `json:"command" yaml:"command"`
+	StartedAt  time.Time `json:"started_at" yaml:"started_at"`
+	FinishedAt time.Time `json:"finished_at" yaml:"finished_at"`
+	Results    []Result  `json:"results" yaml:"results"`
+
+	mu sync.Mutex
+}
+
+// New creates an empty report for a command
+func New(command string) *Report {
+	return &Report{
+		Command:   command,
+		StartedAt: time.Now(),
+		Results:   []Result{},
+	}
+}
+
+// Add records a result. It is safe to call from multiple goroutines.
+func (r *Report) Add(result Result) {
+	if result.Output != "" {
+		result.Output = tailLines(result.Output, maxOutputLines)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Results = append(r.Results, result)
+}
+
+// Finish marks the end of the run
+func (r *Report) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.FinishedAt = time.Now()
+}
+
+// Counts returns the number of results for each status
+func (r *Report) Counts() map[Status]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := make(map[Status]int)
+	for _, result := range r.Results {
+		counts[result.Status]++
+	}
+	return counts
+}
+
+// Failed returns the number of failed packages
+func (r *Report) Failed() int {
+	return r.Counts()[StatusFailed]
+}
+
+// PrintSummary prints the result counts and a table of packages that changed, were skipped or failed.
+// Packages that were already present are only listed in verbose mode.
+func (r *Report) PrintSummary(verbose bool) {
+	counts := r.Counts()
+
+	var parts []string
+	for _, status := range statusOrder {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], strings.ReplaceAll(string(status), "_", " ")))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "no packages processed")
+	}
+
+	utils.PrintStatus(utils.Cyan, fmt.Sprintf("Summary: %s", strings.Join(parts, ", ")))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w := tabwriter.NewWriter(utils.Output, 0, 0, 2, ' ', 0)
+	rows := 0
+	for _, result := range r.Results {
+		if result.Status == StatusAlreadyPresent && !verbose {
+			continue
+		}
+		if rows == 0 {
+			fmt.Fprintln(w, "  TYPE\tNAME\tSTATUS\tDETAIL")
+		}
+		detail := result.Message
+		if result.Error != "" {
+			detail = result.Error
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", result.Type, result.Name, result.Status, detail)
+		rows++
+	}
+	w.Flush()
+}
+
+// Write saves the report to a file. The format is "json" or "junit";
+// when empty it is inferred from the file extension (.xml for JUnit, JSON otherwise).
+func (r *Report) Write(filePath string, format string) error {
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(filePath), ".xml") {
+			format = "junit"
+		}
+	}
+
+	var data []byte
+	var err error
+	switch format {
+	case "json":
+		data, err = r.marshalJSON()
+	case "junit":
+		data, err = r.marshalJUnit()
+	default:
+		return fmt.Errorf("unknown report format: %s (expected json or junit)", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	if err := utils.EnsureDir(filePath); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Report) marshalJSON() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// JUnit XML structures, as understood by common CI systems
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+func (r *Report) marshalJUnit() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	suite := junitTestSuite{
+		Name:      "brew-manager " + r.Command,
+		Tests:     len(r.Results),
+		Time:      fmt.Sprintf("%.3f", r.FinishedAt.Sub(r.StartedAt).Seconds()),
+		Timestamp: r.StartedAt.Format(time.RFC3339),
+	}
+
+	for _, result := range r.Results {
+		tc := junitTestCase{
+			ClassName: result.Type,
+			Name:      result.Name,
+			Time:      fmt.Sprintf("%.3f", result.Duration.Seconds()),
+		}
+		switch result.Status {
+		case StatusFailed:
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: result.Error, Text: result.Output}
+		case StatusSkipped:
+			suite.Skipped++
+			tc.Skipped = &junitSkipped{Message: result.Message}
+		default:
+			tc.SystemOut = string(result.Status)
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// tailLines returns the last n lines of s
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,197 @@
+package report_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+)
+
+// newReport returns an install report with fixed times and one result of each kind
+func newReport() *report.Report {
+	started := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	rep := &report.Report{
+		Command:    "install",
+		StartedAt:  started,
+		FinishedAt: started.Add(2500 * time.Millisecond),
+		Results:    []report.Result{},
+	}
+	rep.Add(report.Result{Type: "brew", Name: "git", Group: "core", Status: report.StatusInstalled, Duration: 1500 * time.Millisecond})
+	rep.Add(report.Result{Type: "brew", Name: "jq", Group: "core", Status: report.StatusAlreadyPresent})
+	rep.Add(report.Result{Type: "cask", Name: "firefox", Group: "apps", Status: report.StatusSkipped, Message: "excluded by --exclude"})
+	rep.Add(report.Result{
+		Type:     "mas",
+		Name:     "Xcode",
+		ID:       497799835,
+		Group:    "apps",
+		Status:   report.StatusFailed,
+		Error:    "mas install failed: exit status 1",
+		Output:   "Error: not signed in\n",
+		Duration: 250 * time.Millisecond,
+	})
+
+	return rep
+}
+
+func TestReport_Write(t *testing.T) {
+	t.Parallel()
+
+	wantJSON := `{
+  "command": "install",
+  "started_at": "2024-06-15T12:00:00Z",
+  "finished_at": "2024-06-15T12:00:02.5Z",
+  "results": [
+    {
+      "type": "brew",
+      "name": "git",
+      "group": "core",
+      "status": "installed",
+      "duration_ns": 1500000000
+    },
+    {
+      "type": "brew",
+      "name": "jq",
+      "group": "core",
+      "status": "already_present"
+    },
+    {
+      "type": "cask",
+      "name": "firefox",
+      "group": "apps",
+      "status": "skipped",
+      "message": "excluded by --exclude"
+    },
+    {
+      "type": "mas",
+      "name": "Xcode",
+      "id": 497799835,
+      "group": "apps",
+      "status": "failed",
+      "error": "mas install failed: exit status 1",
+      "output": "Error: not signed in",
+      "duration_ns": 250000000
+    }
+  ]
+}
+`
+	wantJUnit := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="brew-manager install" tests="4" failures="1" skipped="1" time="2.500" timestamp="2024-06-15T12:00:00Z">
+    <testcase classname="brew" name="git" time="1.500">
+      <system-out>installed</system-out>
+    </testcase>
+    <testcase classname="brew" name="jq" time="0.000">
+      <system-out>already_present</system-out>
+    </testcase>
+    <testcase classname="cask" name="firefox" time="0.000">
+      <skipped message="excluded by --exclude"></skipped>
+    </testcase>
+    <testcase classname="mas" name="Xcode" time="0.250">
+      <failure message="mas install failed: exit status 1">Error: not signed in</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+
+	tests := []struct {
+		name   string
+		file   string
+		format string
+		want   string
+	}{
+		{"JSON by extension", "report.json", "", wantJSON},
+		{"JUnit by extension", "report.XML", "", wantJUnit},
+		{"other extension", "report.txt", "", wantJSON},
+		{"JSON format", "report.xml", "json", wantJSON},
+		{"JUnit format", "reports/install.out", "junit", wantJUnit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := newReport().Write(path, tt.format); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(data); got != tt.want {
+				t.Errorf("Write() wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport_Write_UnknownFormat(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := newReport().Write(path, "yaml"); err == nil {
+		t.Error("Write() error = nil, want an unknown format error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Write() created %s for an unknown format", path)
+	}
+}
+
+func TestReport_Add(t *testing.T) {
+	t.Parallel()
+
+	var lines []string
+	for i := 1; i <= 25; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"no output", "", ""},
+		{"short output", "line 1\nline 2\n", "line 1\nline 2"},
+		{"long output keeps the last 20 lines", strings.Join(lines, "\n") + "\n", strings.Join(lines[5:], "\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rep := report.New("install")
+			rep.Add(report.Result{Type: "brew", Name: "git", Status: report.StatusFailed, Output: tt.output})
+			if got := rep.Results[0].Output; got != tt.want {
+				t.Errorf("Add() output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport_Counts(t *testing.T) {
+	t.Parallel()
+
+	rep := newReport()
+	counts := rep.Counts()
+	want := map[report.Status]int{
+		report.StatusInstalled:      1,
+		report.StatusAlreadyPresent: 1,
+		report.StatusSkipped:        1,
+		report.StatusFailed:         1,
+	}
+	for status, n := range want {
+		if counts[status] != n {
+			t.Errorf("Counts()[%s] = %d, want %d", status, counts[status], n)
+		}
+	}
+	if len(counts) != len(want) {
+		t.Errorf("Counts() = %v, want %v", counts, want)
+	}
+	if got := rep.Failed(); got != 1 {
+		t.Errorf("Failed() = %d, want 1", got)
+	}
+}
@@ -0,0 +1,152 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Response is a canned result for a command executed by a FakeRunner
+type Response struct {
+	Output   string
+	ExitCode int
+}
+
+// ErrNoFixture is returned by a FakeRunner for a command without a scripted response
+var ErrNoFixture = errors.New("no fixture for command")
+
+// FakeRunner replays canned responses instead of executing commands.
+// Commands without a scripted response fail with ErrNoFixture.
+type FakeRunner struct {
+	Responses map[string]Response
+	Available map[string]bool
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// NewFakeRunner creates an empty scripted runner
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{
+		Responses: make(map[string]Response),
+		Available: make(map[string]bool),
+	}
+}
+
+// ManifestFile is the name of the manifest in a fixture directory
+const ManifestFile = "fixtures.yaml"
+
+// Manifest lists the commands scripted by a fixture directory
+type Manifest struct {
+	Available []string         `yaml:"available,omitempty"` // Commands treated as installed besides the scripted ones
+	Commands  []FixtureCommand `yaml:"commands"`
+}
+
+// FixtureCommand is the canned result of one command line
+type FixtureCommand struct {
+	Argv     []string `yaml:"argv"`
+	File     string   `yaml:"file,omitempty"`   // File holding the output, relative to the fixture directory
+	Output   string   `yaml:"output,omitempty"` // Inline output, used when File is empty
+	ExitCode int      `yaml:"exit_code,omitempty"`
+}
+
+// LoadFixtures creates a FakeRunner from the fixtures.yaml manifest of a fixture directory.
+//
+// Each manifest command gives the exact argv it answers and its output, either inline or in
+// a file next to the manifest, and optionally a non-zero exit code. Every command named by a
+// fixture is treated as available, as is every command listed under available.
+func LoadFixtures(dir string) (*FakeRunner, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture manifest: %w", err)
+	}
+
+	fake := NewFakeRunner()
+	for _, command := range manifest.Available {
+		fake.Available[command] = true
+	}
+
+	for i, fixture := range manifest.Commands {
+		if len(fixture.Argv) == 0 {
+			return nil, fmt.Errorf("fixture %d has no argv", i+1)
+		}
+
+		resp := Response{Output: fixture.Output, ExitCode: fixture.ExitCode}
+		if fixture.File != "" {
+			output, err := os.ReadFile(filepath.Join(dir, fixture.File))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read fixture %s: %w", fixture.File, err)
+			}
+			resp.Output = string(output)
+		}
+
+		fake.Script(resp, fixture.Argv[0], fixture.Argv[1:]...)
+	}
+
+	return fake, nil
+}
+
+// Script registers a canned response for a command line
+func (f *FakeRunner) Script(resp Response, command string, args ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Responses[CommandKey(command, args...)] = resp
+	f.Available[command] = true
+}
+
+// RunCommand returns the scripted output for the command
+func (f *FakeRunner) RunCommand(command string, args ...string) (string, error) {
+	resp, ok := f.lookup(command, args)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNoFixture, CommandKey(command, args...))
+	}
+	if resp.ExitCode != 0 {
+		return resp.Output, &ExitError{Code: resp.ExitCode, Output: resp.Output}
+	}
+	return resp.Output, nil
+}
+
+// RunCommandContext returns the scripted output for the command; scripted commands never time out
+func (f *FakeRunner) RunCommandContext(ctx context.Context, command string, args ...string) (string, error) {
+	return f.RunCommand(command, args...)
+}
+
+// RunCommandSilent returns the scripted exit status for the command
+func (f *FakeRunner) RunCommandSilent(command string, args ...string) error {
+	_, err := f.RunCommand(command, args...)
+	return err
+}
+
+// CommandExists reports whether the command was marked as available
+func (f *FakeRunner) CommandExists(command string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Available[command]
+}
+
+// Calls returns every command line executed so far
+func (f *FakeRunner) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *FakeRunner) lookup(command string, args []string) (Response, bool) {
+	key := CommandKey(command, args...)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, key)
+	resp, ok := f.Responses[key]
+	return resp, ok
+}
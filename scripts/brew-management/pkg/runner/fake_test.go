@@ -0,0 +1,160 @@
+package runner_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+func writeManifest(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestLoadFixtures(t *testing.T) {
+	t.Parallel()
+
+	type args struct {
+		command string
+		args    []string
+	}
+
+	tests := []struct {
+		name       string
+		args       args
+		want       string
+		wantErr    error
+		wantOutput bool
+	}{
+		{"file fixture", args{"brew", []string{"tap"}}, "homebrew/bundle\nshiron-dev/tap\n", nil, true},
+		{"underscores and equals in argv", args{"npm", []string{"ls", "--global", "--depth=0", "--json"}}, "", nil, false},
+		{"inline output", args{"brew", []string{"--repository", "shiron-dev/tap"}}, "/opt/homebrew/Library/Taps/shiron-dev/homebrew-tap", nil, true},
+		{"unscripted command", args{"brew", []string{"install", "jq"}}, "", runner.ErrNoFixture, true},
+		{"unscripted arguments", args{"brew", []string{"list"}}, "", runner.ErrNoFixture, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := fake.RunCommand(tt.args.command, tt.args.args...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("FakeRunner.RunCommand() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("FakeRunner.RunCommand() error = %v, want nil", err)
+			}
+
+			if tt.wantOutput && got != tt.want {
+				t.Errorf("FakeRunner.RunCommand() = %q, want %q", got, tt.want)
+			}
+			if !tt.wantOutput && got == "" {
+				t.Errorf("FakeRunner.RunCommand() = %q, want fixture output", got)
+			}
+
+			wantCalls := []string{runner.CommandKey(tt.args.command, tt.args.args...)}
+			if calls := fake.Calls(); !reflect.DeepEqual(calls, wantCalls) {
+				t.Errorf("FakeRunner.Calls() = %v, want %v", calls, wantCalls)
+			}
+		})
+	}
+}
+
+func TestLoadFixtures_Available(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		command string
+		want    bool
+	}{
+		{"listed as available", "yq", true},
+		{"named by a fixture", "cargo", true},
+		{"unknown", "go", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := fake.CommandExists(tt.command); got != tt.want {
+				t.Errorf("FakeRunner.CommandExists(%q) = %v, want %v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFixtures_ExitCode(t *testing.T) {
+	t.Parallel()
+
+	dir := writeManifest(t, map[string]string{
+		runner.ManifestFile: `commands:
+  - argv: [brew, install, missing]
+    output: "Error: No available formula with the name \"missing\"."
+    exit_code: 1
+`,
+	})
+
+	fake, err := runner.LoadFixtures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runner.Run(fake, "brew", "install", "missing")
+	if got := runner.ExitCode(err); got != 1 {
+		t.Errorf("ExitCode() = %v, want %v", got, 1)
+	}
+	if got := runner.ErrorOutput(err); !strings.Contains(got, "No available formula") {
+		t.Errorf("ErrorOutput() = %q, want the fixture output", got)
+	}
+}
+
+func TestLoadFixtures_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"no manifest", map[string]string{"brew_tap.txt": "homebrew/core\n"}},
+		{"malformed manifest", map[string]string{runner.ManifestFile: "commands: [argv: {"}},
+		{"empty argv", map[string]string{runner.ManifestFile: "commands:\n  - output: x\n"}},
+		{"missing output file", map[string]string{runner.ManifestFile: "commands:\n  - argv: [brew, tap]\n    file: brew_tap.txt\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := runner.LoadFixtures(writeManifest(t, tt.files)); err == nil {
+				t.Errorf("LoadFixtures() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Record describes a single command executed through a RecordingRunner
+type Record struct {
+	Argv      []string      `json:"argv"`
+	Silent    bool          `json:"silent,omitempty"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration_ns"`
+	ExitCode  int           `json:"exit_code"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// RecordingRunner wraps another runner and records every command it executes
+type RecordingRunner struct {
+	inner   Runner
+	out     io.Writer
+	mu      sync.Mutex
+	records []Record
+}
+
+// NewRecordingRunner creates a runner that delegates to inner and records each call.
+// If out is not nil, every record is also written to it as a JSON line.
+func NewRecordingRunner(inner Runner, out io.Writer) *RecordingRunner {
+	return &RecordingRunner{inner: inner, out: out}
+}
+
+// RunCommand executes a command through the wrapped runner and records it
+func (r *RecordingRunner) RunCommand(command string, args ...string) (string, error) {
+	start := time.Now()
+	output, err := r.inner.RunCommand(command, args...)
+	r.record(command, args, false, start, err)
+	return output, err
+}
+
+// RunCommandContext executes a command through the wrapped runner and records it
+func (r *RecordingRunner) RunCommandContext(ctx context.Context, command string, args ...string) (string, error) {
+	start := time.Now()
+	output, err := r.inner.RunCommandContext(ctx, command, args...)
+	r.record(command, args, false, start, err)
+	return output, err
+}
+
+// RunCommandSilent executes a command through the wrapped runner and records it
+func (r *RecordingRunner) RunCommandSilent(command string, args ...string) error {
+	start := time.Now()
+	err := r.inner.RunCommandSilent(command, args...)
+	r.record(command, args, true, start, err)
+	return err
+}
+
+// CommandExists delegates to the wrapped runner
+func (r *RecordingRunner) CommandExists(command string) bool {
+	return r.inner.CommandExists(command)
+}
+
+// Records returns a copy of all commands recorded so far
+func (r *RecordingRunner) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Record(nil), r.records...)
+}
+
+func (r *RecordingRunner) record(command string, args []string, silent bool, start time.Time, err error) {
+	rec := Record{
+		Argv:      append([]string{command}, args...),
+		Silent:    silent,
+		StartedAt: start,
+		Duration:  time.Since(start),
+		ExitCode:  ExitCode(err),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, rec)
+	if r.out != nil {
+		if data, err := json.Marshal(rec); err == nil {
+			r.out.Write(append(data, '\n'))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Runner executes external commands such as brew and mas
+type Runner interface {
+	// RunCommand executes a command and returns its combined output
+	RunCommand(command string, args ...string) (string, error)
+	// RunCommandContext executes a command that is killed when ctx is done and returns its combined output
+	RunCommandContext(ctx context.Context, command string, args ...string) (string, error)
+	// RunCommandSilent executes a command without capturing output
+	RunCommandSilent(command string, args ...string) error
+	// CommandExists checks if a command is available
+	CommandExists(command string) bool
+}
+
+// ExecRunner runs commands on the local machine via os/exec
+type ExecRunner struct{}
+
+// NewExecRunner creates a runner that executes real commands
+func NewExecRunner() *ExecRunner {
+	return &ExecRunner{}
+}
+
+// RunCommand executes a command and returns the output
+func (r *ExecRunner) RunCommand(command string, args ...string) (string, error) {
+	cmd := exec.Command(command, args...)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// RunCommandContext executes a command that is killed when ctx is done and returns the output
+func (r *ExecRunner) RunCommandContext(ctx context.Context, command string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, command, args...)
+	// Children that keep the output open must not block the return after the command is killed
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// RunCommandSilent executes a command without capturing output
+func (r *ExecRunner) RunCommandSilent(command string, args ...string) error {
+	cmd := exec.Command(command, args...)
+	return cmd.Run()
+}
+
+// CommandExists checks if a command is available in the system PATH
+func (r *ExecRunner) CommandExists(command string) bool {
+	_, err := exec.LookPath(command)
+	return err == nil
+}
+
+// ExitError is returned by non-exec runners when a command exits non-zero
+type ExitError struct {
+	Code   int
+	Output string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code carried by the error
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// ExitCode extracts the exit code from an error returned by a Runner.
+// It returns 0 for a nil error and -1 when the command could not be started.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var coded interface{ ExitCode() int }
+	if errors.As(err, &coded) {
+		return coded.ExitCode()
+	}
+	return -1
+}
+
+// CommandKey returns the canonical string form of a command line
+func CommandKey(command string, args ...string) string {
+	return strings.Join(append([]string{command}, args...), " ")
+}
+
+// CommandError is returned by Run when a command fails and keeps its output
+type CommandError struct {
+	Err    error
+	Output string
+}
+
+func (e *CommandError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Run executes a command and, if it fails, returns a *CommandError holding the command output
+func Run(r Runner, command string, args ...string) error {
+	output, err := r.RunCommand(command, args...)
+	if err != nil {
+		return &CommandError{Err: err, Output: strings.TrimSpace(output)}
+	}
+	return nil
+}
+
+// ErrorOutput returns the command output carried by an error returned from a Runner, if any
+func ErrorOutput(err error) string {
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Output
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return strings.TrimSpace(exitErr.Output)
+	}
+	return ""
+}
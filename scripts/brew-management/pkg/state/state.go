@@ -0,0 +1,175 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+// Snapshot is the installed state of the machine, queried once per run
+// and updated in place as packages are installed or removed
+type Snapshot struct {
+	mu       sync.RWMutex
+	packages map[string]map[string]bool // package type -> normalized name -> installed
+	masApps  map[int64]string           // mas app ID -> name
+}
+
+// NewSnapshot creates an empty snapshot
+func NewSnapshot() *Snapshot {
+	s := &Snapshot{
+		packages: make(map[string]map[string]bool),
+		masApps:  make(map[int64]string),
+	}
+	for _, pkgType := range types.PackageTypes {
+		if pkgType != "mas" {
+			s.packages[pkgType] = make(map[string]bool)
+		}
+	}
+	return s
+}
+
+// Load queries the installed packages once and returns them as a snapshot
+func Load(r runner.Runner) (*Snapshot, error) {
+	installedPackages, installedMasApps, err := yamlPkg.GetInstalledPackages(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get installed packages: %w", err)
+	}
+
+	s := NewSnapshot()
+	for _, name := range installedPackages["taps"] {
+		s.packages["tap"][name] = true
+	}
+	for _, name := range installedPackages["brews"] {
+		s.packages["brew"][name] = true
+	}
+	for _, name := range installedPackages["casks"] {
+		s.packages["cask"][name] = true
+	}
+	for _, pkgType := range yamlPkg.ToolTypes {
+		for _, name := range installedPackages[pkgType] {
+			s.packages[pkgType][yamlPkg.NormalizeName(pkgType, name)] = true
+		}
+	}
+	for _, app := range installedMasApps {
+		s.masApps[app.ID] = app.Name
+	}
+
+	return s, nil
+}
+
+// Reload queries the installed packages again and replaces the snapshot contents
+func (s *Snapshot) Reload(r runner.Runner) error {
+	fresh, err := Load(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.packages = fresh.packages
+	s.masApps = fresh.masApps
+	return nil
+}
+
+// IsInstalled checks whether a configured package is installed.
+// Mas apps are matched by ID; tap-qualified formulae such as "owner/tap/name" match on their short name,
+// and VS Code extension IDs match regardless of case.
+func (s *Snapshot) IsInstalled(pkgType string, pkgInfo types.PackageInfo) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch pkgType {
+	case "mas":
+		_, ok := s.masApps[pkgInfo.ID]
+		return ok
+	case "brew":
+		if s.packages["brew"][pkgInfo.Name] {
+			return true
+		}
+		if i := strings.LastIndex(pkgInfo.Name, "/"); i >= 0 {
+			return s.packages["brew"][pkgInfo.Name[i+1:]]
+		}
+		return false
+	default:
+		return s.packages[pkgType][yamlPkg.NormalizeName(pkgType, pkgInfo.Name)]
+	}
+}
+
+// MarkInstalled records that a package has been installed
+func (s *Snapshot) MarkInstalled(pkgType string, pkgInfo types.PackageInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pkgType == "mas" {
+		s.masApps[pkgInfo.ID] = pkgInfo.Name
+		return
+	}
+	if s.packages[pkgType] == nil {
+		s.packages[pkgType] = make(map[string]bool)
+	}
+	s.packages[pkgType][yamlPkg.NormalizeName(pkgType, pkgInfo.Name)] = true
+}
+
+// MarkRemoved records that a package has been removed
+func (s *Snapshot) MarkRemoved(pkgType string, pkgInfo types.PackageInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pkgType == "mas" {
+		delete(s.masApps, pkgInfo.ID)
+		return
+	}
+	delete(s.packages[pkgType], yamlPkg.NormalizeName(pkgType, pkgInfo.Name))
+}
+
+// Names returns the sorted names of installed packages of any type but mas
+func (s *Snapshot) Names(pkgType string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.packages[pkgType]))
+	for name := range s.packages[pkgType] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MasApps returns the installed Mac App Store apps sorted by ID
+func (s *Snapshot) MasApps() []types.MasApp {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	apps := make([]types.MasApp, 0, len(s.masApps))
+	for id, name := range s.masApps {
+		apps = append(apps, types.MasApp{ID: id, Name: name})
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].ID < apps[j].ID
+	})
+	return apps
+}
+
+// Hash returns a fingerprint of the installed packages, independent of listing order
+func (s *Snapshot) Hash() string {
+	var lines []string
+	for _, pkgType := range types.PackageTypes {
+		for _, name := range s.Names(pkgType) {
+			lines = append(lines, pkgType+":"+name)
+		}
+	}
+	for _, app := range s.MasApps() {
+		lines = append(lines, fmt.Sprintf("mas:%d", app.ID))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,173 @@
+package state_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+func load(t *testing.T) (*runner.FakeRunner, *state.Snapshot) {
+	t.Helper()
+
+	fake, err := runner.LoadFixtures(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := state.Load(fake)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	return fake, s
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	_, s := load(t)
+
+	want := map[string][]string{
+		"tap":  {"homebrew/bundle", "shiron-dev/tap"},
+		"brew": {"ca-certificates", "gettext", "git", "jq", "libidn2", "oniguruma", "openssl@3", "pcre2", "ripgrep", "wget"},
+		"cask": {"slack", "visual-studio-code"},
+		"npm":  {"typescript"},
+	}
+	for pkgType, names := range want {
+		if got := s.Names(pkgType); !reflect.DeepEqual(got, names) {
+			t.Errorf("Names(%q) = %v, want %v", pkgType, got, names)
+		}
+	}
+	wantApps := []types.MasApp{{ID: 497799835, Name: "Xcode"}, {ID: 1475387142, Name: "Tailscale"}}
+	if got := s.MasApps(); !reflect.DeepEqual(got, wantApps) {
+		t.Errorf("MasApps() = %+v, want %+v", got, wantApps)
+	}
+}
+
+func TestSnapshot_IsInstalled(t *testing.T) {
+	t.Parallel()
+
+	_, s := load(t)
+
+	tests := []struct {
+		name    string
+		pkgType string
+		pkgInfo types.PackageInfo
+		want    bool
+	}{
+		{"tap", "tap", types.PackageInfo{Name: "shiron-dev/tap"}, true},
+		{"formula", "brew", types.PackageInfo{Name: "git"}, true},
+		{"missing formula", "brew", types.PackageInfo{Name: "fd"}, false},
+		{"tap-qualified formula", "brew", types.PackageInfo{Name: "shiron-dev/tap/ripgrep"}, true},
+		{"cask", "cask", types.PackageInfo{Name: "slack"}, true},
+		{"formula is not a cask", "cask", types.PackageInfo{Name: "git"}, false},
+		{"mas app by ID", "mas", types.PackageInfo{Name: "Xcode Beta", ID: 497799835}, true},
+		{"mas app with another ID", "mas", types.PackageInfo{Name: "Xcode", ID: 1}, false},
+		{"VS Code extension in any case", "vscode", types.PackageInfo{Name: "github.Copilot"}, true},
+		{"cargo crate", "cargo", types.PackageInfo{Name: "stylua"}, true},
+		{"npm package", "npm", types.PackageInfo{Name: "typescript"}, true},
+		{"bundled npm package", "npm", types.PackageInfo{Name: "corepack"}, false},
+		{"unknown type", "apt", types.PackageInfo{Name: "git"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := s.IsInstalled(tt.pkgType, tt.pkgInfo); got != tt.want {
+				t.Errorf("IsInstalled(%q, %q) = %v, want %v", tt.pkgType, tt.pkgInfo.Name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshot_Mark(t *testing.T) {
+	t.Parallel()
+
+	_, s := load(t)
+	fd := types.PackageInfo{Name: "fd"}
+	xcode := types.PackageInfo{Name: "Xcode", ID: 497799835}
+
+	s.MarkInstalled("brew", fd)
+	s.MarkRemoved("mas", xcode)
+	s.MarkRemoved("vscode", types.PackageInfo{Name: "GITHUB.COPILOT"})
+
+	if !s.IsInstalled("brew", fd) {
+		t.Error("IsInstalled(brew fd) = false after MarkInstalled()")
+	}
+	if s.IsInstalled("mas", xcode) {
+		t.Error("IsInstalled(mas Xcode) = true after MarkRemoved()")
+	}
+	if got, want := s.Names("vscode"), []string{"esbenp.prettier-vscode"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names(vscode) = %v after MarkRemoved(), want %v", got, want)
+	}
+}
+
+func TestSnapshot_Reload(t *testing.T) {
+	t.Parallel()
+
+	fake, s := load(t)
+	before := s.Hash()
+	s.MarkInstalled("brew", types.PackageInfo{Name: "fd"})
+
+	if err := s.Reload(fake); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if s.IsInstalled("brew", types.PackageInfo{Name: "fd"}) {
+		t.Error("IsInstalled(brew fd) = true after Reload(), want the queried state")
+	}
+	if got := s.Hash(); got != before {
+		t.Errorf("Hash() = %s after Reload(), want %s", got, before)
+	}
+}
+
+func TestSnapshot_Hash(t *testing.T) {
+	t.Parallel()
+
+	type mark struct {
+		pkgType string
+		pkgInfo types.PackageInfo
+	}
+	snapshot := func(marks ...mark) *state.Snapshot {
+		s := state.NewSnapshot()
+		for _, m := range marks {
+			s.MarkInstalled(m.pkgType, m.pkgInfo)
+		}
+		return s
+	}
+	git := mark{"brew", types.PackageInfo{Name: "git"}}
+	jq := mark{"brew", types.PackageInfo{Name: "jq"}}
+	jqCask := mark{"cask", types.PackageInfo{Name: "jq"}}
+	xcode := mark{"mas", types.PackageInfo{Name: "Xcode", ID: 497799835}}
+	xcodeRenamed := mark{"mas", types.PackageInfo{Name: "Xcode 16", ID: 497799835}}
+	copilot := mark{"vscode", types.PackageInfo{Name: "GitHub.copilot"}}
+	copilotLower := mark{"vscode", types.PackageInfo{Name: "github.copilot"}}
+
+	tests := []struct {
+		name string
+		a, b *state.Snapshot
+		want bool
+	}{
+		{"empty", snapshot(), snapshot(), true},
+		{"listing order", snapshot(git, jq, xcode), snapshot(xcode, jq, git), true},
+		{"mas app name", snapshot(xcode), snapshot(xcodeRenamed), true},
+		{"extension case", snapshot(copilot), snapshot(copilotLower), true},
+		{"added package", snapshot(git), snapshot(git, jq), false},
+		{"package type", snapshot(jq), snapshot(jqCask), false},
+		{"empty and one package", snapshot(), snapshot(git), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.a.Hash() == tt.b.Hash(); got != tt.want {
+				t.Errorf("Hash() equal = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,128 +5,143 @@ import (
 	"sort"
 	"strings"
 
-	"brew-manager/pkg/types"
-	"brew-manager/pkg/utils"
-	yamlPkg "brew-manager/pkg/yaml"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/classify"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/metadata"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
 
 	"github.com/AlecAivazis/survey/v2"
 )
 
-// SyncGroupedPackages synchronizes installed packages with grouped YAML config
-func SyncGroupedPackages(filePath string, options *types.SyncOptions) error {
+// Result is the outcome of a sync
+type Result struct {
+	File     string           `json:"file" yaml:"file"`
+	Packages []MissingPackage `json:"packages" yaml:"packages"` // Installed packages missing from the configuration
+	Added    bool             `json:"added" yaml:"added"`       // Whether they were added, not only shown
+}
+
+// SyncGroupedPackages synchronizes installed packages with grouped YAML config.
+// Formulae that are dependencies of other installed formulae according to graph are not added.
+// New packages get their description from meta, which may be nil.
+func SyncGroupedPackages(installed *state.Snapshot, graph *deps.Graph, meta *metadata.Cache, filePath string, options *types.SyncOptions) (*Result, error) {
 	// Check if file exists before backup
 	fileExists := utils.FileExists(filePath)
-	
+
 	if options.Backup && fileExists {
 		if err := utils.CreateBackup(filePath); err != nil {
-			return fmt.Errorf("failed to create backup: %w", err)
+			return nil, fmt.Errorf("failed to create backup: %w", err)
 		}
 	}
 
-	// Load existing config
+	// Load existing config. New packages are added to this file only, but packages
+	// defined by its includes or overlays (even ones removed on this host) count as configured.
 	config, err := yamlPkg.LoadGroupedConfig(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to load grouped config: %w", err)
+		return nil, fmt.Errorf("failed to load grouped config: %w", err)
+	}
+	comp, err := yamlPkg.Compose(filePath, yamlPkg.CurrentHost())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load grouped config: %w", err)
 	}
-	
+
 	// Notify if we're starting with an empty configuration
 	if !fileExists || len(config.Groups) == 0 {
 		utils.PrintStatus(utils.Yellow, "Starting with empty configuration. All installed packages will be added.")
 	}
 
-	// Get currently installed packages
-	installedPackagesMap, installedMasApps, err := yamlPkg.GetInstalledPackages()
-	if err != nil {
-		return fmt.Errorf("failed to get installed packages: %w", err)
-	}
-
 	// Find missing packages
-	missingPackages := findMissingPackages(config, installedPackagesMap, installedMasApps)
-	
+	missingPackages := findMissingPackages(comp, installed, graph)
+	result := &Result{File: filePath, Packages: missingPackages}
+
 	if len(missingPackages) == 0 {
 		utils.PrintStatus(utils.Green, "No new packages found. Configuration is up to date.")
-		return nil
+		return result, nil
 	}
 
 	utils.PrintStatus(utils.Cyan, fmt.Sprintf("Found %d new packages", len(missingPackages)))
 
 	if options.ShowOnly {
 		showMissingPackages(missingPackages)
-		return nil
+		return result, nil
 	}
 
 	if options.DryRun {
 		utils.PrintStatus(utils.Yellow, "[DRY RUN] Would add the following packages:")
 		showMissingPackages(missingPackages)
-		return nil
+		return result, nil
+	}
+
+	// Load classification rules for auto-detection
+	var classifier *classify.Classifier
+	if options.AutoDetect {
+		if classifier, err = classify.Load(options.RulesFile); err != nil {
+			return nil, fmt.Errorf("failed to load classification rules: %w", err)
+		}
+		if options.Verbose {
+			utils.PrintStatus(utils.Blue, fmt.Sprintf("Classifying new packages with %s", classifier.Source))
+		}
 	}
 
 	// Add missing packages to config
-	if err := addMissingPackagesToGrouped(config, missingPackages, options); err != nil {
-		return fmt.Errorf("failed to add missing packages: %w", err)
+	if err := addMissingPackagesToGrouped(config, missingPackages, classifier, meta, options); err != nil {
+		return nil, fmt.Errorf("failed to add missing packages: %w", err)
 	}
 
 	// Sort packages if requested
 	if options.Sort {
-		sortGroupedPackages(config)
+		yamlPkg.SortPackages(config)
 	}
 
 	// Save updated config
 	if err := yamlPkg.SaveGroupedConfig(config, filePath); err != nil {
-		return fmt.Errorf("failed to save config: %w", err)
+		return nil, fmt.Errorf("failed to save config: %w", err)
 	}
 
 	utils.PrintStatus(utils.Green, fmt.Sprintf("Successfully synchronized %d new packages", len(missingPackages)))
-	return nil
+	result.Added = true
+	return result, nil
 }
 
-
-
 // MissingPackage represents a package that is installed but not in config
 type MissingPackage struct {
-	Name string
-	Type string
-	ID   int64 // For mas apps
+	Name  string   `json:"name" yaml:"name"`
+	Type  string   `json:"type" yaml:"type"`
+	ID    int64    `json:"id,omitempty" yaml:"id,omitempty"`       // For mas apps
+	Group string   `json:"group,omitempty" yaml:"group,omitempty"` // Group the package was added to
+	Tags  []string `json:"tags,omitempty" yaml:"tags,omitempty"`   // Tags the package was added with
 }
 
 // findMissingPackages finds packages that are installed but not in the config
-func findMissingPackages(config *types.PackageGrouped, installedPackagesMap map[string][]string, installedMasApps []types.MasApp) []MissingPackage {
-	var missing []MissingPackage
+func findMissingPackages(comp *yamlPkg.Composition, installed *state.Snapshot, graph *deps.Graph) []MissingPackage {
+	missing := []MissingPackage{}
 
 	// Get all packages from config
 	configPackages := make(map[string]bool) // Stores "type:name" or "mas:id"
-	for _, group := range config.Groups {
-		for pkgType, pkgInfos := range group.Packages {
-			for _, pkgInfo := range pkgInfos {
-				var key string
-				if pkgType == "mas" {
-					key = fmt.Sprintf("mas:%d", pkgInfo.ID)
-				} else {
-					key = fmt.Sprintf("%s:%s", pkgType, pkgInfo.Name)
-				}
-				configPackages[key] = true
-			}
-		}
+	for _, key := range comp.Keys() {
+		configPackages[key] = true
 	}
 
 	// Check taps
-	for _, tap := range installedPackagesMap["taps"] {
+	for _, tap := range installed.Names("tap") {
 		key := fmt.Sprintf("tap:%s", tap)
 		if !configPackages[key] {
 			missing = append(missing, MissingPackage{Name: tap, Type: "tap"})
 		}
 	}
 
-	// Check brews
-	for _, brew := range installedPackagesMap["brews"] {
+	// Check brews; only formulae installed on request are proposed, not formulae pulled in as dependencies
+	for _, brew := range installed.Names("brew") {
 		key := fmt.Sprintf("brew:%s", brew)
-		if !configPackages[key] {
+		if !configPackages[key] && graph.IsRequested(brew) {
 			missing = append(missing, MissingPackage{Name: brew, Type: "brew"})
 		}
 	}
 
 	// Check casks
-	for _, cask := range installedPackagesMap["casks"] {
+	for _, cask := range installed.Names("cask") {
 		key := fmt.Sprintf("cask:%s", cask)
 		if !configPackages[key] {
 			missing = append(missing, MissingPackage{Name: cask, Type: "cask"})
@@ -134,13 +149,23 @@ func findMissingPackages(config *types.PackageGrouped, installedPackagesMap map[
 	}
 
 	// Check mas apps
-	for _, app := range installedMasApps {
+	for _, app := range installed.MasApps() {
 		key := fmt.Sprintf("mas:%d", app.ID)
 		if !configPackages[key] {
 			missing = append(missing, MissingPackage{Name: app.Name, Type: "mas", ID: app.ID})
 		}
 	}
 
+	// Check VS Code extensions and Go, Cargo and npm packages
+	for _, pkgType := range yamlPkg.ToolTypes {
+		for _, name := range installed.Names(pkgType) {
+			key := yamlPkg.PackageKey(pkgType, types.PackageInfo{Name: name})
+			if !configPackages[key] {
+				missing = append(missing, MissingPackage{Name: name, Type: pkgType})
+			}
+		}
+	}
+
 	return missing
 }
 
@@ -160,23 +185,25 @@ func showMissingPackages(packages []MissingPackage) {
 
 	for _, pkgType := range sortedTypes {
 		pkgs := packagesByType[pkgType]
-		utils.PrintStatus(utils.Cyan, fmt.Sprintf("%s packages:", strings.Title(pkgType)))
+		utils.PrintStatus(utils.Cyan, fmt.Sprintf("%s packages:", utils.Capitalize(pkgType)))
 		// Sort packages within each type by name for consistent output
 		sort.Slice(pkgs, func(i, j int) bool {
 			return pkgs[i].Name < pkgs[j].Name
 		})
 		for _, pkg := range pkgs {
 			if pkg.Type == "mas" {
-				fmt.Printf("  - %s (ID: %d)\n", pkg.Name, pkg.ID)
+				fmt.Fprintf(utils.Output, "  - %s (ID: %d)\n", pkg.Name, pkg.ID)
 			} else {
-				fmt.Printf("  - %s\n", pkg.Name)
+				fmt.Fprintf(utils.Output, "  - %s\n", pkg.Name)
 			}
 		}
 	}
 }
 
-// addMissingPackagesToGrouped adds missing packages to grouped config
-func addMissingPackagesToGrouped(config *types.PackageGrouped, missing []MissingPackage, options *types.SyncOptions) error {
+// addMissingPackagesToGrouped adds missing packages to grouped config, with their cached descriptions,
+// and records the group and tags of each in missing.
+// When classifier is not nil, it assigns groups and tags, or suggests them in interactive mode.
+func addMissingPackagesToGrouped(config *types.PackageGrouped, missing []MissingPackage, classifier *classify.Classifier, meta *metadata.Cache, options *types.SyncOptions) error {
 	defaultGroup := options.DefaultGroup
 	if defaultGroup == "" {
 		defaultGroup = "uncategorized"
@@ -198,21 +225,24 @@ func addMissingPackagesToGrouped(config *types.PackageGrouped, missing []Missing
 		}
 	}
 
-
-	for _, pkg := range missing {
+	for i, pkg := range missing {
 		targetGroup := defaultGroup
 		tags := options.DefaultTags // Use default tags from options
-
-		if options.Interactive {
-			// Auto-detect group and tags for suggestion if AutoDetect is true
-			suggestedGroup := targetGroup
-			suggestedTags := tags
-			if options.AutoDetect {
-				suggestedGroup = utils.AutoDetectGroup(pkg.Name, pkg.Type)
-				suggestedTags = utils.AutoDetectTags(pkg.Name, pkg.Type)
+		description := meta.Description(pkg.Type, pkg.Name)
+
+		// Auto-detect group and tags with the classification rules
+		if classifier != nil {
+			decision := classifier.Classify(pkg.Name, pkg.Type, description)
+			targetGroup = decision.Group
+			tags = decision.Tags
+			if options.Verbose {
+				utils.PrintStatus(utils.Cyan, fmt.Sprintf("Classified %s '%s' as %s %v (rules: %s)",
+					pkg.Type, pkg.Name, decision.Group, decision.Tags, strings.Join(decision.Matched, ", ")))
 			}
+		}
 
-			response, err := promptForPackageAssignment(pkg, suggestedGroup, suggestedTags)
+		if options.Interactive {
+			response, err := promptForPackageAssignment(pkg, targetGroup, tags)
 			if err != nil {
 				return fmt.Errorf("interactive prompt failed: %w", err)
 			}
@@ -222,9 +252,16 @@ func addMissingPackagesToGrouped(config *types.PackageGrouped, missing []Missing
 
 		// Ensure target group exists and has Packages map initialized
 		if _, exists := config.Groups[targetGroup]; !exists {
-			config.Groups[targetGroup] = types.Group{
+			def := classify.GroupDefinition{
 				Description: fmt.Sprintf("Auto-created group for %s", targetGroup),
 				Priority:    5, // Default priority for auto-created groups
+			}
+			if classifier != nil {
+				def = classifier.Group(targetGroup)
+			}
+			config.Groups[targetGroup] = types.Group{
+				Description: def.Description,
+				Priority:    def.Priority,
 				Packages:    make(map[string][]types.PackageInfo),
 			}
 		} else {
@@ -235,11 +272,11 @@ func addMissingPackagesToGrouped(config *types.PackageGrouped, missing []Missing
 			}
 		}
 
-
 		// Create PackageInfo
 		newPackageInfo := types.PackageInfo{
-			Name: pkg.Name,
-			Tags: tags,
+			Name:        pkg.Name,
+			Description: description,
+			Tags:        tags,
 		}
 
 		if pkg.Type == "mas" {
@@ -248,8 +285,9 @@ func addMissingPackagesToGrouped(config *types.PackageGrouped, missing []Missing
 
 		// Add to group
 		group := config.Groups[targetGroup]
-		group.Packages[pkg.Type] = append(group.Packages[pkg.Type], newPackageInfo)
+		group.Packages[pkg.Type] = yamlPkg.InsertPackage(group.Packages[pkg.Type], newPackageInfo)
 		config.Groups[targetGroup] = group // Update the map with the modified group
+		missing[i].Group, missing[i].Tags = targetGroup, tags
 
 		utils.PrintStatus(utils.Green, fmt.Sprintf("Added %s '%s' to group '%s'", pkg.Type, pkg.Name, targetGroup))
 	}
@@ -290,23 +328,8 @@ func promptForPackageAssignment(pkg MissingPackage, suggestedGroup string, sugge
 		tags = []string{}
 	}
 
-
 	return &PackageAssignment{
 		Group: group,
 		Tags:  tags,
 	}, nil
 }
-
-// sortGroupedPackages sorts packages within each group by type and then by name
-func sortGroupedPackages(config *types.PackageGrouped) {
-	for groupName, group := range config.Groups {
-		for pkgType, pkgInfos := range group.Packages {
-			sort.Slice(pkgInfos, func(i, j int) bool {
-				return pkgInfos[i].Name < pkgInfos[j].Name
-			})
-			group.Packages[pkgType] = pkgInfos // Update the slice in the map
-		}
-		// Note: Map keys (package types) are not sorted here, but yaml.v3 usually sorts them.
-		config.Groups[groupName] = group
-	}
-}
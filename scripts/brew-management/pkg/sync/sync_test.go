@@ -0,0 +1,150 @@
+package sync_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/deps"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/state"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/sync"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+const config = `groups:
+  core:
+    priority: 1
+    packages:
+      tap:
+        - name: homebrew/bundle
+        - name: shiron-dev/tap
+      brew:
+        - name: git
+        - name: jq
+      cask:
+        - name: visual-studio-code
+      mas:
+        - name: Xcode
+          id: 497799835
+      vscode:
+        - name: GitHub.copilot
+        - name: esbenp.prettier-vscode
+      cargo:
+        - name: ripgrep
+        - name: stylua
+      npm:
+        - name: corepack
+        - name: npm
+`
+
+// missing are the installed packages of the replay fixtures that config does not list.
+// Formulae only pulled in as dependencies are not proposed, but openssl@3 was installed on request.
+var missing = []string{"brew:openssl@3", "brew:ripgrep", "brew:wget", "cask:slack", "mas:Tailscale", "npm:typescript"}
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+func keys(packages []sync.MissingPackage) []string {
+	got := []string{}
+	for _, pkg := range packages {
+		got = append(got, pkg.Type+":"+pkg.Name)
+	}
+
+	return got
+}
+
+func TestSyncGroupedPackages(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		options   types.SyncOptions
+		wantAdded bool
+		wantGroup string
+	}{
+		{"show only", types.SyncOptions{ShowOnly: true}, false, ""},
+		{"dry run", types.SyncOptions{DryRun: true}, false, ""},
+		{"default group", types.SyncOptions{}, true, "uncategorized"},
+		{"named group", types.SyncOptions{DefaultGroup: "new", DefaultTags: []string{"synced"}}, true, "new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			installed, err := state.Load(fake)
+			if err != nil {
+				t.Fatal(err)
+			}
+			graph, err := deps.Load(fake)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filePath := filepath.Join(t.TempDir(), "packages.yaml")
+			if err := os.WriteFile(filePath, []byte(config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := sync.SyncGroupedPackages(installed, graph, nil, filePath, &tt.options)
+			if err != nil {
+				t.Fatalf("SyncGroupedPackages() error = %v", err)
+			}
+
+			if got := keys(result.Packages); !reflect.DeepEqual(got, missing) {
+				t.Errorf("SyncGroupedPackages() packages = %v, want %v", got, missing)
+			}
+			if result.Added != tt.wantAdded {
+				t.Errorf("SyncGroupedPackages() added = %v, want %v", result.Added, tt.wantAdded)
+			}
+
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantAdded {
+				if string(data) != config {
+					t.Errorf("SyncGroupedPackages() changed the file:\n%s", data)
+				}
+
+				return
+			}
+
+			saved, err := yamlPkg.LoadGroupedConfig(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			group := saved.Groups[tt.wantGroup]
+			var got []string
+			for _, pkgType := range types.PackageTypes {
+				for _, pkg := range group.Packages[pkgType] {
+					got = append(got, pkgType+":"+pkg.Name)
+					if !reflect.DeepEqual(pkg.Tags, tt.options.DefaultTags) {
+						t.Errorf("SyncGroupedPackages() tags of %s = %v, want %v", pkg.Name, pkg.Tags, tt.options.DefaultTags)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, missing) {
+				t.Errorf("SyncGroupedPackages() group %s = %v, want %v", tt.wantGroup, got, missing)
+			}
+			for _, pkg := range result.Packages {
+				if pkg.Group != tt.wantGroup {
+					t.Errorf("SyncGroupedPackages() group of %s = %q, want %q", pkg.Name, pkg.Group, tt.wantGroup)
+				}
+			}
+		})
+	}
+}
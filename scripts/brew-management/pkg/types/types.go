@@ -1,57 +1,150 @@
 package types
 
+// PackageTypes are the package types of Group.Packages, in install order: Homebrew taps, formulae,
+// casks and Mac App Store apps first, then the tools they provide: VS Code extensions and global
+// Go, Cargo and npm packages
+var PackageTypes = []string{"tap", "brew", "cask", "mas", "vscode", "go", "cargo", "npm"}
+
+// IsPackageType reports whether s is a known package type
+func IsPackageType(s string) bool {
+	for _, pkgType := range PackageTypes {
+		if s == pkgType {
+			return true
+		}
+	}
+	return false
+}
+
 // PackageGrouped represents the grouped YAML configuration format
 type PackageGrouped struct {
-	Groups   map[string]Group  `yaml:"groups" json:"groups" jsonschema:"title=Package Groups,description=Package groups definition,required"`
-	Profiles map[string]Profile `yaml:"profiles" json:"profiles" jsonschema:"title=Installation Profiles,description=Installation profiles - predefined combinations"`
+	Groups   map[string]Group    `yaml:"groups" json:"groups" jsonschema:"title=Package Groups,description=Package groups definition"`
+	Profiles map[string]Profile  `yaml:"profiles" json:"profiles" jsonschema:"title=Installation Profiles,description=Installation profiles - predefined combinations"`
+	Include  []string            `yaml:"include,omitempty" json:"include,omitempty" jsonschema:"title=Include,description=Other YAML files merged into this one (relative to this file)"`
+	Overlays []Overlay           `yaml:"overlays,omitempty" json:"overlays,omitempty" jsonschema:"title=Overlays,description=Files merged only on matching hosts or architectures"`
+	Remove   map[string][]string `yaml:"remove,omitempty" json:"remove,omitempty" jsonschema:"title=Remove,description=Packages removed from earlier files by type (overlay files only)"`
+}
+
+// Overlay is a file merged into the configuration only on machines matching all of its conditions
+type Overlay struct {
+	Hostname string `yaml:"hostname,omitempty" json:"hostname,omitempty" jsonschema:"title=Hostname,description=Short hostname this overlay applies to"`
+	Arch     string `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"title=Architecture,description=Architecture this overlay applies to (arm64 or amd64),enum=arm64,enum=amd64,enum=x86_64,enum=aarch64"`
+	File     string `yaml:"file" json:"file" jsonschema:"title=File,description=Overlay YAML file (relative to this file),required,minLength=1"`
 }
 
 // Group represents a package group with description and priority
 type Group struct {
-	Description string                       `yaml:"description" json:"description" jsonschema:"title=Description,description=Human-readable description of the group,required,minLength=1"`
-	Priority    int                          `yaml:"priority" json:"priority" jsonschema:"title=Priority,description=Installation priority (lower numbers install first),required,minimum=1,maximum=99"`
+	Description string                   `yaml:"description" json:"description" jsonschema:"title=Description,description=Human-readable description of the group,required,minLength=1"`
+	Priority    int                      `yaml:"priority" json:"priority" jsonschema:"title=Priority,description=Installation priority (lower numbers install first),required,minimum=1,maximum=99"`
 	Packages    map[string][]PackageInfo `yaml:"packages" json:"packages" jsonschema:"title=Packages,description=Packages in this group,required"`
+	Categories  []string                 `yaml:"categories,omitempty" json:"categories,omitempty" jsonschema:"title=Categories,description=Brewfile heading path of this group (outermost first)"`
+	Hooks       `yaml:",inline"`
 }
 
 // PackageInfo represents a single package with metadata, where the type is determined by the map key in Group.Packages
 type PackageInfo struct {
-	Name        string   `yaml:"name" json:"name" jsonschema:"title=Package Name,description=Package name,required,minLength=1"`
+	Name        string   `yaml:"name" json:"name" jsonschema:"title=Package Name,description=Package name: extension ID for vscode and package path for go,required,minLength=1"`
 	Tags        []string `yaml:"tags,omitempty" json:"tags,omitempty" jsonschema:"title=Tags,description=Tags for categorization and filtering,uniqueItems"`
 	Description string   `yaml:"description,omitempty" json:"description,omitempty" jsonschema:"title=Description,description=Optional description of the package,minLength=1"`
 	ID          int64    `yaml:"id,omitempty" json:"id,omitempty" jsonschema:"title=App Store ID,description=Mac App Store ID (required for mas type),minimum=1"` // For mas apps
+	Version     string   `yaml:"version,omitempty" json:"version,omitempty" jsonschema:"title=Version,description=Expected installed version (a commit for taps); checked by install --locked,minLength=1"`
+	Pinned      bool     `yaml:"pinned,omitempty" json:"pinned,omitempty" jsonschema:"title=Pinned,description=Never upgrade this package with brew-manager upgrade"`
+	Options     []string `yaml:"options,omitempty" json:"options,omitempty" jsonschema:"title=Brewfile Options,description=Brewfile arguments written after the name such as restart_service: true"`
+	Hooks       `yaml:",inline"`
+}
+
+// Hooks are shell commands run around installing and removing a package. Hooks set on a group
+// apply to each of its packages that does not set the same field itself.
+type Hooks struct {
+	PreInstall  string `yaml:"pre_install,omitempty" json:"pre_install,omitempty" jsonschema:"title=Pre-install Hook,description=Shell command run before installing the package; the package is not installed if it fails,minLength=1"`
+	PostInstall string `yaml:"post_install,omitempty" json:"post_install,omitempty" jsonschema:"title=Post-install Hook,description=Shell command run after installing the package,minLength=1"`
+	PostRemove  string `yaml:"post_remove,omitempty" json:"post_remove,omitempty" jsonschema:"title=Post-remove Hook,description=Shell command run after removing the package,minLength=1"`
+	HookTimeout string `yaml:"hook_timeout,omitempty" json:"hook_timeout,omitempty" jsonschema:"title=Hook Timeout,description=Maximum run time of each hook such as 30s or 5m (default 5m),minLength=1"`
+	HookFailure string `yaml:"hook_failure,omitempty" json:"hook_failure,omitempty" jsonschema:"title=Hook Failure Policy,description=fail to count the package as failed when a hook fails (default) or warn to only print a warning,enum=fail,enum=warn"`
+}
+
+// Inherit returns the hooks with every unset field taken from group
+func (h Hooks) Inherit(group Hooks) Hooks {
+	if h.PreInstall == "" {
+		h.PreInstall = group.PreInstall
+	}
+	if h.PostInstall == "" {
+		h.PostInstall = group.PostInstall
+	}
+	if h.PostRemove == "" {
+		h.PostRemove = group.PostRemove
+	}
+	if h.HookTimeout == "" {
+		h.HookTimeout = group.HookTimeout
+	}
+	if h.HookFailure == "" {
+		h.HookFailure = group.HookFailure
+	}
+	return h
 }
 
 // Profile represents an installation profile
 type Profile struct {
-	Description  string   `yaml:"description" json:"description" jsonschema:"title=Description,description=Human-readable description of the profile,required,minLength=1"`
-	Groups       []string `yaml:"groups,omitempty" json:"groups,omitempty" jsonschema:"title=Groups,description=Groups to include in this profile,uniqueItems"`
-	Tags         []string `yaml:"tags,omitempty" json:"tags,omitempty" jsonschema:"title=Tags,description=Tags to include in this profile,uniqueItems"`
-	ExcludeTags  []string `yaml:"exclude_tags,omitempty" json:"exclude_tags,omitempty" jsonschema:"title=Exclude Tags,description=Tags to exclude from this profile,uniqueItems"`
+	Description     string   `yaml:"description" json:"description" jsonschema:"title=Description,description=Human-readable description of the profile,required,minLength=1"`
+	Groups          []string `yaml:"groups,omitempty" json:"groups,omitempty" jsonschema:"title=Groups,description=Groups to include in this profile,uniqueItems"`
+	Tags            []string `yaml:"tags,omitempty" json:"tags,omitempty" jsonschema:"title=Tags,description=Tags to include in this profile,uniqueItems"`
+	ExcludeTags     []string `yaml:"exclude_tags,omitempty" json:"exclude_tags,omitempty" jsonschema:"title=Exclude Tags,description=Tags to exclude from this profile,uniqueItems"`
+	Extends         []string `yaml:"extends,omitempty" json:"extends,omitempty" jsonschema:"title=Extends,description=Profiles to inherit groups and tags and exclusions from,uniqueItems"`
+	ExcludeGroups   []string `yaml:"exclude_groups,omitempty" json:"exclude_groups,omitempty" jsonschema:"title=Exclude Groups,description=Groups to exclude from this profile,uniqueItems"`
+	ExcludePackages []string `yaml:"exclude_packages,omitempty" json:"exclude_packages,omitempty" jsonschema:"title=Exclude Packages,description=Packages to exclude from this profile as name or type:name,uniqueItems"`
 }
 
 // FilteredPackage represents a package with its type, used for filtering results
 type FilteredPackage struct {
 	PackageInfo
-	Type string
+	Type     string
+	Group    string
+	Priority int
 }
 
 // MasApp represents a Mac App Store application
 type MasApp struct {
-	Name string `yaml:"name"`
-	ID   int64  `yaml:"id"`
+	Name    string `yaml:"name"`
+	ID      int64  `yaml:"id"`
+	Version string `yaml:"version,omitempty"`
 }
 
 // InstallOptions represents installation configuration
 type InstallOptions struct {
-	DryRun         bool
-	Verbose        bool
-	Groups         []string
-	Tags           []string
-	Profile        string
-	SkipTaps       bool
-	SkipBrews      bool
-	SkipCasks      bool
-	SkipMas        bool
+	DryRun          bool
+	Verbose         bool
+	Groups          []string
+	Tags            []string
+	ExcludeTags     []string
+	ExcludeGroups   []string
+	ExcludePackages []string // Package names or type:name
+	Profile         string
+	SkipTaps        bool
+	SkipBrews       bool
+	SkipCasks       bool
+	SkipMas         bool
+	SkipVSCode      bool
+	SkipGo          bool
+	SkipCargo       bool
+	SkipNpm         bool
+	Batch           bool   // Install missing formulae and casks with one brew invocation per group
+	BatchSize       int    // Maximum packages per batched brew invocation (0 for no limit)
+	Jobs            int    // Maximum concurrent tap and mas installs
+	Locked          bool   // Check installed versions against the lockfile
+	AllowDrift      bool   // Report version drift instead of refusing to install
+	LockFile        string // Lockfile path used with Locked
+}
+
+// UpgradeOptions represents outdated and upgrade configuration
+type UpgradeOptions struct {
+	DryRun    bool
+	Verbose   bool
+	Groups    []string
+	Tags      []string
+	Profile   string
+	Greedy    bool // Include casks that update themselves or have no version
+	SkipBrews bool
+	SkipCasks bool
+	SkipMas   bool
 }
 
 // SyncOptions represents synchronization configuration
@@ -64,7 +157,8 @@ type SyncOptions struct {
 	DefaultGroup string
 	DefaultTags  []string
 	Interactive  bool
-	AutoDetect   bool
+	AutoDetect   bool   // Assign groups and tags with the classification rules
+	RulesFile    string // Classification rules file (built-in rules when missing)
 }
 
 // ValidateOptions represents validation configuration
@@ -72,15 +166,33 @@ type ValidateOptions struct {
 	Verbose    bool
 	All        bool
 	SchemaFile string
+	Explain    bool   // Print which file each package came from
+	Hostname   string // Match overlays against this hostname instead of the local one
+	Arch       string // Match overlays against this architecture instead of the local one
 }
 
 // PruneOptions represents prune configuration
 type PruneOptions struct {
 	DryRun     bool
 	Verbose    bool
+	Profile    string   // Keep only the packages of this profile
+	Groups     []string // Keep only the packages of these groups
+	Tags       []string // Keep only the packages with these tags
+	Keep       []string // Glob patterns of installed packages that are never removed
 	SkipTaps   bool
 	SkipBrews  bool
 	SkipCasks  bool
 	SkipMas    bool
+	SkipVSCode bool
+	SkipGo     bool
+	SkipCargo  bool
+	SkipNpm    bool
 	ConfirmAll bool
-} 
+}
+
+// UndoOptions represents undo configuration
+type UndoOptions struct {
+	DryRun  bool
+	Verbose bool
+	Force   bool // Restore the configuration even if it changed after the entry
+}
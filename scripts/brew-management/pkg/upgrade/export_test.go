@@ -0,0 +1,31 @@
+package upgrade
+
+import "fmt"
+
+// ParseBrewOutdated exposes parseBrewOutdated to the tests, with versions formatted by format
+func ParseBrewOutdated(output string) (map[string]string, map[string]string, error) {
+	formulae, casks, err := parseBrewOutdated(output)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return format(formulae), format(casks), nil
+}
+
+// ParseMasOutdated exposes parseMasOutdated to the tests, with versions formatted by format
+func ParseMasOutdated(output string) map[string]string {
+	return format(parseMasOutdated(output))
+}
+
+// format formats outdated versions as "installed -> latest", marking pinned formulae
+func format(outdated map[string]outdatedVersions) map[string]string {
+	formatted := make(map[string]string)
+	for name, versions := range outdated {
+		formatted[name] = fmt.Sprintf("%s -> %s", versions.installed, versions.latest)
+		if versions.pinned {
+			formatted[name] += " (pinned)"
+		}
+	}
+
+	return formatted
+}
@@ -0,0 +1,250 @@
+package upgrade
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+// Types is the order in which package types are checked and upgraded
+var Types = []string{"brew", "cask", "mas"}
+
+// Package is a configured package with a newer version available
+type Package struct {
+	Type      string `json:"type" yaml:"type"`
+	Name      string `json:"name" yaml:"name"`
+	ID        int64  `json:"id,omitempty" yaml:"id,omitempty"` // For mas apps
+	Group     string `json:"group,omitempty" yaml:"group,omitempty"`
+	Installed string `json:"installed" yaml:"installed"`
+	Latest    string `json:"latest" yaml:"latest"`
+	Pinned    bool   `json:"pinned,omitempty" yaml:"pinned,omitempty"` // Pinned in the YAML or with brew pin
+}
+
+// brewOutdated is the output of `brew outdated --json=v2`
+type brewOutdated struct {
+	Formulae []struct {
+		Name              string   `json:"name"`
+		InstalledVersions []string `json:"installed_versions"`
+		CurrentVersion    string   `json:"current_version"`
+		Pinned            bool     `json:"pinned"`
+	} `json:"formulae"`
+	Casks []struct {
+		Name              string   `json:"name"`
+		InstalledVersions []string `json:"installed_versions"`
+		CurrentVersion    string   `json:"current_version"`
+	} `json:"casks"`
+}
+
+// outdatedVersions is the installed and latest version of an outdated package
+type outdatedVersions struct {
+	installed string
+	latest    string
+	pinned    bool
+}
+
+// FindOutdated returns the packages of pkgs with a newer version available, in Types order.
+// Formulae and casks are queried with brew outdated, mas apps with mas outdated.
+func FindOutdated(r runner.Runner, pkgs []types.FilteredPackage, options *types.UpgradeOptions) ([]Package, error) {
+	outdated := map[string]map[string]outdatedVersions{}
+
+	if !options.SkipBrews || !options.SkipCasks {
+		args := []string{"outdated", "--json=v2"}
+		if options.Greedy {
+			args = append(args, "--greedy")
+		}
+		output, err := r.RunCommand("brew", args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query outdated packages: %w", err)
+		}
+		if outdated["brew"], outdated["cask"], err = parseBrewOutdated(output); err != nil {
+			return nil, err
+		}
+	}
+
+	if !options.SkipMas && hasType(pkgs, "mas") && r.CommandExists("mas") {
+		output, err := r.RunCommand("mas", "outdated")
+		if err != nil {
+			return nil, fmt.Errorf("failed to query outdated Mac App Store apps: %w", err)
+		}
+		outdated["mas"] = parseMasOutdated(output)
+	}
+
+	result := []Package{}
+	for _, pkgType := range Types {
+		if skipsType(pkgType, options) {
+			continue
+		}
+		for _, pkg := range pkgs {
+			if pkg.Type != pkgType {
+				continue
+			}
+			versions, ok := lookup(outdated[pkgType], pkg)
+			if !ok {
+				continue
+			}
+			result = append(result, Package{
+				Type:      pkg.Type,
+				Name:      pkg.Name,
+				ID:        pkg.ID,
+				Group:     pkg.Group,
+				Installed: versions.installed,
+				Latest:    versions.latest,
+				Pinned:    pkg.Pinned || versions.pinned,
+			})
+		}
+	}
+	return result, nil
+}
+
+// parseBrewOutdated parses `brew outdated --json=v2` output into outdated formulae and casks by name.
+// Empty output means nothing is outdated.
+func parseBrewOutdated(output string) (map[string]outdatedVersions, map[string]outdatedVersions, error) {
+	formulae := map[string]outdatedVersions{}
+	casks := map[string]outdatedVersions{}
+	if strings.TrimSpace(output) == "" {
+		return formulae, casks, nil
+	}
+
+	var parsed brewOutdated
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse brew outdated output: %w", err)
+	}
+	for _, f := range parsed.Formulae {
+		formulae[f.Name] = outdatedVersions{installed: strings.Join(f.InstalledVersions, ", "), latest: f.CurrentVersion, pinned: f.Pinned}
+	}
+	for _, c := range parsed.Casks {
+		casks[c.Name] = outdatedVersions{installed: strings.Join(c.InstalledVersions, ", "), latest: c.CurrentVersion}
+	}
+	return formulae, casks, nil
+}
+
+// masOutdatedLine matches a line of `mas outdated` output: "<id> <name> (<installed> -> <latest>)"
+var masOutdatedLine = regexp.MustCompile(`^(\d+)\s+(.*?)\s+\(([^()]*?)\s+->\s+([^()]*)\)$`)
+
+// parseMasOutdated parses `mas outdated` output into outdated apps by ID
+func parseMasOutdated(output string) map[string]outdatedVersions {
+	apps := map[string]outdatedVersions{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		m := masOutdatedLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		apps[m[1]] = outdatedVersions{installed: m[3], latest: m[4]}
+	}
+	return apps
+}
+
+// lookup finds a configured package among outdated ones. Mas apps are matched by ID and
+// tap-qualified formulae such as "owner/tap/name" by their short name.
+func lookup(outdated map[string]outdatedVersions, pkg types.FilteredPackage) (outdatedVersions, bool) {
+	switch pkg.Type {
+	case "mas":
+		versions, ok := outdated[strconv.FormatInt(pkg.ID, 10)]
+		return versions, ok
+	case "brew":
+		if versions, ok := outdated[pkg.Name]; ok {
+			return versions, true
+		}
+		if i := strings.LastIndex(pkg.Name, "/"); i >= 0 {
+			versions, ok := outdated[pkg.Name[i+1:]]
+			return versions, ok
+		}
+		return outdatedVersions{}, false
+	default:
+		versions, ok := outdated[pkg.Name]
+		return versions, ok
+	}
+}
+
+// hasType reports whether any package is of pkgType
+func hasType(pkgs []types.FilteredPackage, pkgType string) bool {
+	for _, pkg := range pkgs {
+		if pkg.Type == pkgType {
+			return true
+		}
+	}
+	return false
+}
+
+// skipsType reports whether upgrade options skip a package type
+func skipsType(pkgType string, options *types.UpgradeOptions) bool {
+	switch pkgType {
+	case "brew":
+		return options.SkipBrews
+	case "cask":
+		return options.SkipCasks
+	case "mas":
+		return options.SkipMas
+	}
+	return false
+}
+
+// UpgradePackages upgrades outdated packages one at a time and records the outcome for every
+// package in rep. Pinned packages are skipped.
+func UpgradePackages(r runner.Runner, rep *report.Report, outdated []Package, options *types.UpgradeOptions) {
+	for _, pkg := range outdated {
+		result := report.Result{Type: pkg.Type, Name: pkg.Name, ID: pkg.ID, Group: pkg.Group, Status: report.StatusUpgraded,
+			Message: fmt.Sprintf("%s -> %s", pkg.Installed, pkg.Latest)}
+
+		if pkg.Pinned {
+			if options.Verbose {
+				utils.PrintStatus(utils.Yellow, fmt.Sprintf("Skipping pinned %s: %s", pkg.Type, pkg.Name))
+			}
+			result.Status = report.StatusSkipped
+			result.Message = "pinned"
+			rep.Add(result)
+			continue
+		}
+
+		if options.DryRun {
+			utils.PrintStatus(utils.Yellow, fmt.Sprintf("[DRY RUN] Would upgrade %s: %s %s -> %s", pkg.Type, pkg.Name, pkg.Installed, pkg.Latest))
+			result.Status = report.StatusSkipped
+			result.Message = "dry run"
+			rep.Add(result)
+			continue
+		}
+
+		start := time.Now()
+		err := upgradePackage(r, pkg, options)
+		result.Duration = time.Since(start)
+		if err != nil {
+			utils.PrintStatus(utils.Red, fmt.Sprintf("Failed to upgrade %s: %s - %v", pkg.Type, pkg.Name, err))
+			result.Status = report.StatusFailed
+			result.Error = err.Error()
+			result.Output = runner.ErrorOutput(err)
+			rep.Add(result)
+			continue
+		}
+
+		utils.PrintStatus(utils.Green, fmt.Sprintf("Upgraded %s: %s %s -> %s", pkg.Type, pkg.Name, pkg.Installed, pkg.Latest))
+		rep.Add(result)
+	}
+}
+
+// upgradePackage upgrades a single package
+func upgradePackage(r runner.Runner, pkg Package, options *types.UpgradeOptions) error {
+	switch pkg.Type {
+	case "brew":
+		return runner.Run(r, "brew", "upgrade", "--formula", pkg.Name)
+	case "cask":
+		if options.Greedy {
+			return runner.Run(r, "brew", "upgrade", "--cask", "--greedy", pkg.Name)
+		}
+		return runner.Run(r, "brew", "upgrade", "--cask", pkg.Name)
+	case "mas":
+		if !r.CommandExists("mas") {
+			return fmt.Errorf("mas is not installed, cannot upgrade Mac App Store apps")
+		}
+		return runner.Run(r, "mas", "upgrade", strconv.FormatInt(pkg.ID, 10))
+	default:
+		return fmt.Errorf("upgrading %s packages is not supported", pkg.Type)
+	}
+}
@@ -0,0 +1,267 @@
+package upgrade_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/report"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/upgrade"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+const fixtureDir = "../../testdata/replay/basic"
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(fixtureDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestParseBrewOutdated(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		output       string
+		wantFormulae map[string]string
+		wantCasks    map[string]string
+		wantErr      bool
+	}{
+		{
+			"fixture",
+			fixture(t, "brew_outdated_--json=v2.txt"),
+			map[string]string{"git": "2.45.0 -> 2.46.0"},
+			map[string]string{"google-chrome": "126.0.6478.127 -> 127.0.6533.73"},
+			false,
+		},
+		{
+			"pinned formula and several installed versions",
+			`{"formulae":[{"name":"node","installed_versions":["20.1.0","20.2.0"],"current_version":"22.0.0","pinned":true}],"casks":[]}`,
+			map[string]string{"node": "20.1.0, 20.2.0 -> 22.0.0 (pinned)"},
+			map[string]string{},
+			false,
+		},
+		{"nothing outdated", "\n", map[string]string{}, map[string]string{}, false},
+		{"invalid JSON", "Error: not JSON", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			formulae, casks, err := upgrade.ParseBrewOutdated(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBrewOutdated() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(formulae, tt.wantFormulae) {
+				t.Errorf("parseBrewOutdated() formulae = %v, want %v", formulae, tt.wantFormulae)
+			}
+			if !reflect.DeepEqual(casks, tt.wantCasks) {
+				t.Errorf("parseBrewOutdated() casks = %v, want %v", casks, tt.wantCasks)
+			}
+		})
+	}
+}
+
+func TestParseMasOutdated(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		output string
+		want   map[string]string
+	}{
+		{"fixture", fixture(t, "mas_outdated.txt"), map[string]string{"497799835": "15.4 -> 16.0"}},
+		{
+			"names with spaces and parentheses",
+			"1475387142 Tailscale (1.66.4 -> 1.68.0)\n409201541  Pages (Beta)  (14.0 -> 14.1)\n",
+			map[string]string{"1475387142": "1.66.4 -> 1.68.0", "409201541": "14.0 -> 14.1"},
+		},
+		{"other lines", "Warning: something\n\n", map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := upgrade.ParseMasOutdated(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMasOutdated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func pkg(pkgType string, name string, id int64, pinned bool) types.FilteredPackage {
+	return types.FilteredPackage{PackageInfo: types.PackageInfo{Name: name, ID: id, Pinned: pinned}, Type: pkgType, Group: "core"}
+}
+
+func TestFindOutdated(t *testing.T) {
+	t.Parallel()
+
+	pkgs := []types.FilteredPackage{
+		pkg("mas", "Xcode", 497799835, false),
+		pkg("cask", "google-chrome", 0, false),
+		pkg("brew", "homebrew/core/git", 0, true),
+		pkg("brew", "jq", 0, false),
+	}
+
+	tests := []struct {
+		name    string
+		options types.UpgradeOptions
+		want    []upgrade.Package
+	}{
+		{
+			"every type",
+			types.UpgradeOptions{},
+			[]upgrade.Package{
+				{Type: "brew", Name: "homebrew/core/git", Group: "core", Installed: "2.45.0", Latest: "2.46.0", Pinned: true},
+				{Type: "cask", Name: "google-chrome", Group: "core", Installed: "126.0.6478.127", Latest: "127.0.6533.73"},
+				{Type: "mas", Name: "Xcode", ID: 497799835, Group: "core", Installed: "15.4", Latest: "16.0"},
+			},
+		},
+		{
+			"greedy",
+			types.UpgradeOptions{Greedy: true, SkipMas: true},
+			[]upgrade.Package{
+				{Type: "brew", Name: "homebrew/core/git", Group: "core", Installed: "2.45.0", Latest: "2.46.0", Pinned: true},
+				{Type: "cask", Name: "google-chrome", Group: "core", Installed: "126.0.6478.127", Latest: "127.0.6533.73"},
+				{Type: "cask", Name: "docker", Group: "core", Installed: "latest", Latest: "latest"},
+			},
+		},
+		{
+			"skipped types",
+			types.UpgradeOptions{SkipBrews: true, SkipCasks: true},
+			[]upgrade.Package{
+				{Type: "mas", Name: "Xcode", ID: 497799835, Group: "core", Installed: "15.4", Latest: "16.0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, err := runner.LoadFixtures(fixtureDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Only --greedy lists docker, which updates itself
+			fake.Script(runner.Response{Output: `{"formulae":[{"name":"git","installed_versions":["2.45.0"],"current_version":"2.46.0"}],` +
+				`"casks":[{"name":"google-chrome","installed_versions":["126.0.6478.127"],"current_version":"127.0.6533.73"},` +
+				`{"name":"docker","installed_versions":["latest"],"current_version":"latest"}]}`}, "brew", "outdated", "--json=v2", "--greedy")
+
+			selected := pkgs
+			if tt.options.Greedy {
+				selected = append(append([]types.FilteredPackage{}, pkgs...), pkg("cask", "docker", 0, false))
+			}
+			got, err := upgrade.FindOutdated(fake, selected, &tt.options)
+			if err != nil {
+				t.Fatalf("FindOutdated() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindOutdated() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradePackages(t *testing.T) {
+	t.Parallel()
+
+	outdated := []upgrade.Package{
+		{Type: "brew", Name: "git", Installed: "2.45.0", Latest: "2.46.0", Pinned: true},
+		{Type: "brew", Name: "jq", Installed: "1.7.0", Latest: "1.7.1"},
+		{Type: "cask", Name: "google-chrome", Installed: "126.0.6478.127", Latest: "127.0.6533.73"},
+		{Type: "mas", Name: "Xcode", ID: 497799835, Installed: "15.4", Latest: "16.0"},
+	}
+
+	tests := []struct {
+		name     string
+		options  types.UpgradeOptions
+		failing  string
+		want     []string
+		statuses map[string]report.Status
+	}{
+		{
+			"upgrades all but pinned packages",
+			types.UpgradeOptions{},
+			"",
+			[]string{"brew upgrade --formula jq", "brew upgrade --cask google-chrome", "mas upgrade 497799835"},
+			map[string]report.Status{"brew:git": report.StatusSkipped, "brew:jq": report.StatusUpgraded, "cask:google-chrome": report.StatusUpgraded, "mas:Xcode": report.StatusUpgraded},
+		},
+		{
+			"greedy casks",
+			types.UpgradeOptions{Greedy: true},
+			"",
+			[]string{"brew upgrade --formula jq", "brew upgrade --cask --greedy google-chrome", "mas upgrade 497799835"},
+			map[string]report.Status{"brew:git": report.StatusSkipped, "brew:jq": report.StatusUpgraded, "cask:google-chrome": report.StatusUpgraded, "mas:Xcode": report.StatusUpgraded},
+		},
+		{
+			"failure does not stop the others",
+			types.UpgradeOptions{},
+			"brew upgrade --formula jq",
+			[]string{"brew upgrade --formula jq", "brew upgrade --cask google-chrome", "mas upgrade 497799835"},
+			map[string]report.Status{"brew:git": report.StatusSkipped, "brew:jq": report.StatusFailed, "cask:google-chrome": report.StatusUpgraded, "mas:Xcode": report.StatusUpgraded},
+		},
+		{
+			"dry run",
+			types.UpgradeOptions{DryRun: true},
+			"",
+			nil,
+			map[string]report.Status{"brew:git": report.StatusSkipped, "brew:jq": report.StatusSkipped, "cask:google-chrome": report.StatusSkipped, "mas:Xcode": report.StatusSkipped},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := runner.NewFakeRunner()
+			for _, argv := range [][]string{
+				{"brew", "upgrade", "--formula", "jq"},
+				{"brew", "upgrade", "--cask", "google-chrome"},
+				{"brew", "upgrade", "--cask", "--greedy", "google-chrome"},
+				{"mas", "upgrade", "497799835"},
+			} {
+				exitCode := 0
+				if runner.CommandKey(argv[0], argv[1:]...) == tt.failing {
+					exitCode = 1
+				}
+				fake.Script(runner.Response{ExitCode: exitCode}, argv[0], argv[1:]...)
+			}
+
+			rep := report.New("upgrade")
+			upgrade.UpgradePackages(fake, rep, outdated, &tt.options)
+
+			if got := fake.Calls(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UpgradePackages() ran %q, want %q", got, tt.want)
+			}
+			got := make(map[string]report.Status)
+			for _, result := range rep.Results {
+				got[result.Type+":"+result.Name] = result.Status
+			}
+			if !reflect.DeepEqual(got, tt.statuses) {
+				t.Errorf("UpgradePackages() statuses = %v, want %v", got, tt.statuses)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package validate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSchema is the JSON Schema of the YAML configuration used when no --schema is given.
+// The main package sets it to the embedded packages.schema.json.
+var DefaultSchema []byte
+
+// compiledSchemas caches compiled schemas by file, "" being DefaultSchema
+var (
+	compiledMu      sync.Mutex
+	compiledSchemas = make(map[string]*jsonschema.Schema)
+)
+
+// loadSchema compiles the schema in schemaFile, or DefaultSchema when schemaFile is empty
+func loadSchema(schemaFile string) (*jsonschema.Schema, error) {
+	compiledMu.Lock()
+	defer compiledMu.Unlock()
+
+	if schema, ok := compiledSchemas[schemaFile]; ok {
+		return schema, nil
+	}
+
+	data := DefaultSchema
+	url := "packages.schema.json"
+	if schemaFile != "" {
+		var err error
+		if data, err = os.ReadFile(schemaFile); err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+		url = schemaFile
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no schema available")
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, doc); err != nil {
+		return nil, fmt.Errorf("failed to load schema: %w", err)
+	}
+	schema, err := compiler.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema: %w", err)
+	}
+
+	compiledSchemas[schemaFile] = schema
+	return schema, nil
+}
+
+// problem is a validation error, positioned in the validated file when its location is known
+type problem struct {
+	Path    []string // Location in the configuration, e.g. ["groups", "core", "priority"]
+	Line    int      // 0 when the location is not in this file
+	Column  int
+	Message string
+
+	schemaRule bool // Semantic check that the schema also enforces
+}
+
+func (p problem) String() string {
+	if p.Line == 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, p.Message)
+}
+
+// sortProblems orders problems by position, the ones without a position last
+func sortProblems(problems []problem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		pi, pj := problems[i], problems[j]
+		if (pi.Line == 0) != (pj.Line == 0) {
+			return pj.Line == 0
+		}
+		if pi.Line != pj.Line {
+			return pi.Line < pj.Line
+		}
+		return pi.Column < pj.Column
+	})
+}
+
+// position sets the line and column of a problem from the node at its path.
+// Missing locations point at their closest existing parent, but locations in groups or
+// profiles that come from other files, such as includes, are left without a position.
+func (p *problem) position(root *yaml.Node) {
+	if root == nil {
+		return
+	}
+	if _, found := yamlPkg.Locate(root, p.Path[:min(len(p.Path), 2)]); !found {
+		return
+	}
+	node, _ := yamlPkg.Locate(root, p.Path)
+	p.Line, p.Column = node.Line, node.Column
+}
+
+// schemaProblems validates a parsed YAML document against the schema.
+// Fragments may leave out required group fields that another file provides.
+func schemaProblems(root *yaml.Node, schemaFile string, fragment bool) ([]problem, error) {
+	schema, err := loadSchema(schemaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if err := root.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to decode YAML: %w", err)
+	}
+
+	err = schema.Validate(jsonValue(value))
+	if err == nil {
+		return nil, nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, fmt.Errorf("schema validation failed: %w", err)
+	}
+
+	printer := message.NewPrinter(language.English)
+	var problems []problem
+	for _, leaf := range leafErrors(validationErr) {
+		if _, required := leaf.ErrorKind.(*kind.Required); required && fragment && len(leaf.InstanceLocation) == 2 {
+			continue
+		}
+		p := problem{
+			Path:    leaf.InstanceLocation,
+			Message: fmt.Sprintf("%s (at %s)", leaf.ErrorKind.LocalizedString(printer), yamlPkg.Pointer(leaf.InstanceLocation)),
+		}
+		p.position(root)
+		problems = append(problems, p)
+	}
+	return problems, nil
+}
+
+// leafErrors returns the innermost causes of a validation error
+func leafErrors(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		leaves = append(leaves, leafErrors(cause)...)
+	}
+	return leaves
+}
+
+// jsonValue converts a value decoded from YAML to the types of decoded JSON:
+// map keys become strings and timestamps are kept as text
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+		return v
+	case map[any]any:
+		converted := make(map[string]any, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return converted
+	case []any:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return v
+	}
+}
+
+// CheckSchema reports whether the schema in schemaFile, or DefaultSchema when schemaFile is
+// empty, can be read and compiled
+func CheckSchema(schemaFile string) error {
+	_, err := loadSchema(schemaFile)
+	return err
+}
@@ -0,0 +1,185 @@
+package validate_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/validate"
+)
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+
+	schema, err := os.ReadFile("../../packages.schema.json")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	validate.DefaultSchema = schema
+
+	os.Exit(m.Run())
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// formatErrors formats validation errors as "line:column path: message"
+func formatErrors(result *validate.FileResult) []string {
+	got := []string{}
+	for _, e := range result.Errors {
+		got = append(got, fmt.Sprintf("%d:%d %s: %s", e.Line, e.Column, e.Path, e.Message))
+	}
+
+	return got
+}
+
+func TestValidateYAMLFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			"valid",
+			"groups:\n  core:\n    description: Core\n    priority: 1\n    packages:\n      brew:\n        - name: git\n",
+			[]string{},
+		},
+		{
+			"wrong type",
+			"groups:\n  core:\n    description: Core\n    priority: high\n    packages: {}\n",
+			[]string{
+				"1:1 : Failed to parse as grouped format: yaml: unmarshal errors:\n  line 4: cannot unmarshal !!str `high` into int",
+				"4:15 /groups/core/priority: got string, want integer (at /groups/core/priority)",
+			},
+		},
+		{
+			"unknown property and package type",
+			"groups:\n  core:\n    description: Core\n    priority: 1\n    packages:\n      brews:\n        - name: git\n    colour: red\n",
+			[]string{
+				"3:5 /groups/core: additional properties 'colour' not allowed (at /groups/core)",
+				"6:7 /groups/core/packages: additional properties 'brews' not allowed (at /groups/core/packages)",
+			},
+		},
+		{
+			"schema and semantic errors merged by position",
+			"groups:\n  core:\n    priority: 1\n    packages:\n      mas:\n        - name: Xcode\n" +
+				"profiles:\n  work:\n    description: Work\n    groups: [core, missing]\n",
+			[]string{
+				"3:5 /groups/core: missing property 'description' (at /groups/core)",
+				"6:11 /groups/core/packages/mas/0: Missing ID for mas app in group core, package Xcode",
+			},
+		},
+		{
+			"missing location at its closest parent",
+			"groups:\n  core:\n    description: Core\n    priority: 1\n    packages:\n      brew:\n        - tags: [cli]\n",
+			[]string{"7:11 /groups/core/packages/brew/0: missing property 'name' (at /groups/core/packages/brew/0)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := writeFile(t, t.TempDir(), "packages.yaml", tt.content)
+			result, err := validate.ValidateYAMLFile(path, &types.ValidateOptions{})
+			if (err != nil) != (len(tt.want) > 0) {
+				t.Errorf("ValidateYAMLFile() error = %v, want an error: %v", err, len(tt.want) > 0)
+			}
+			if result == nil {
+				t.Fatal("ValidateYAMLFile() result = nil")
+			}
+			if got := formatErrors(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateYAMLFile() errors = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateYAMLFile_SchemaOverride(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	content := "groups:\n  core:\n    description: Core\n    priority: 1\n    colour: red\n    packages: {}\n"
+	path := writeFile(t, dir, "packages.yaml", content)
+
+	tests := []struct {
+		name   string
+		schema string
+		want   []string
+	}{
+		{"default schema", "", []string{"3:5 /groups/core: additional properties 'colour' not allowed (at /groups/core)"}},
+		{"permissive schema", `{"type": "object"}`, []string{}},
+		{
+			"stricter schema",
+			`{"type": "object", "required": ["profiles"], "properties": {"groups": {"maxProperties": 0}}}`,
+			[]string{
+				"1:1 : missing property 'profiles' (at /)",
+				"2:3 /groups: maxProperties: got 1, want 0 (at /groups)",
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			options := &types.ValidateOptions{}
+			if tt.schema != "" {
+				options.SchemaFile = writeFile(t, dir, fmt.Sprintf("schema%d.json", i), tt.schema)
+			}
+			result, err := validate.ValidateYAMLFile(path, options)
+			if (err != nil) != (len(tt.want) > 0) {
+				t.Errorf("ValidateYAMLFile() error = %v, want an error: %v", err, len(tt.want) > 0)
+			}
+			if result == nil {
+				t.Fatal("ValidateYAMLFile() result = nil")
+			}
+			if got := formatErrors(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateYAMLFile() errors = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tests := []struct {
+		name       string
+		schemaFile string
+		wantErr    bool
+	}{
+		{"default schema", "", false},
+		{"custom schema", writeFile(t, dir, "valid.json", `{"type": "object"}`), false},
+		{"missing file", filepath.Join(dir, "missing.json"), true},
+		{"invalid JSON", writeFile(t, dir, "invalid.json", `{"type": `), true},
+		{"invalid schema", writeFile(t, dir, "wrong.json", `{"type": 1}`), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := validate.CheckSchema(tt.schemaFile); (err != nil) != tt.wantErr {
+				t.Errorf("CheckSchema() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
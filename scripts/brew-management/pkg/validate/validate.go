@@ -4,99 +4,233 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
-	"brew-manager/pkg/types"
-	"brew-manager/pkg/utils"
-	yamlPkg "brew-manager/pkg/yaml"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/hooks"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
 
 	"gopkg.in/yaml.v3"
 )
 
-// ValidateYAMLFile validates a YAML file against its schema
-func ValidateYAMLFile(filePath string, options *types.ValidateOptions) error {
+// FileResult is the outcome of validating one file
+type FileResult struct {
+	File   string  `json:"file" yaml:"file"`
+	Valid  bool    `json:"valid" yaml:"valid"`
+	Errors []Error `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// Error is a validation error. Path is a JSON pointer into the configuration; Line and Column
+// are 0 when the error has no position in the file.
+type Error struct {
+	Path    string `json:"path,omitempty" yaml:"path,omitempty"`
+	Line    int    `json:"line,omitempty" yaml:"line,omitempty"`
+	Column  int    `json:"column,omitempty" yaml:"column,omitempty"`
+	Message string `json:"message" yaml:"message"`
+}
+
+// ValidateYAMLFile validates a YAML file against its JSON Schema (the embedded one unless
+// options.SchemaFile is set) and checks the configuration merged from its includes and matching overlays.
+// The result is returned also when the file is invalid.
+func ValidateYAMLFile(filePath string, options *types.ValidateOptions) (*FileResult, error) {
+	if _, err := loadSchema(options.SchemaFile); err != nil {
+		return nil, err
+	}
+	return validateFile(filePath, options, false)
+}
+
+// validateFile validates a YAML file. Fragments are files included by or overlaid on another file;
+// their groups may be incomplete on their own, so only their packages are checked.
+func validateFile(filePath string, options *types.ValidateOptions, fragment bool) (*FileResult, error) {
 	if !utils.FileExists(filePath) {
-		return fmt.Errorf("YAML file not found: %s", filePath)
+		return nil, fmt.Errorf("YAML file not found: %s", filePath)
 	}
+	result := &FileResult{File: filePath}
 
 	if options.Verbose {
 		utils.PrintStatus(utils.Blue, fmt.Sprintf("Validating: %s", filePath))
 	}
 
-	// Read and clean YAML content
+	// Read YAML content
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read YAML file: %w", err)
+		return nil, fmt.Errorf("failed to read YAML file: %w", err)
 	}
-
-	// Remove yaml-language-server comment
 	content := string(data)
-	lines := strings.Split(content, "\n")
-	var filteredLines []string
-	for _, line := range lines {
-		if !strings.HasPrefix(strings.TrimSpace(line), "# yaml-language-server:") {
-			filteredLines = append(filteredLines, line)
-		}
-	}
-	cleanContent := strings.Join(filteredLines, "\n")
 
-	// Basic YAML syntax check
-	var tempYAML interface{}
-	if err := yaml.Unmarshal([]byte(cleanContent), &tempYAML); err != nil {
+	// Basic YAML syntax check; the node tree gives the positions of validation errors
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
 		utils.PrintStatus(utils.Red, fmt.Sprintf("❌ Invalid: %s - YAML syntax error", filepath.Base(filePath)))
 		if options.Verbose {
 			utils.PrintStatus(utils.Yellow, fmt.Sprintf("YAML syntax errors: %v", err))
 		}
-		return err
+		result.Errors = append(result.Errors, Error{Message: err.Error()})
+		return result, err
 	}
 
 	// Determine file type and validate structure
 	filename := filepath.Base(filePath)
-	var validationErrors []string
+	var validationErrors []problem
 
 	switch {
 	case strings.Contains(filename, "grouped"):
-		validationErrors = validateGroupedYAML(cleanContent, options.Verbose)
+		validationErrors = validateGroupedYAML(filePath, &root, options, fragment)
 	// case strings.Contains(filename, "packages"): // This specific case might be too broad
 	//	validationErrors = append(validationErrors, "Simple YAML format is no longer supported")
 	default:
 		// Try to detect format by content
-		if strings.Contains(cleanContent, "groups:") { // "groups:"があれば grouped として扱う
-			validationErrors = validateGroupedYAML(cleanContent, options.Verbose)
+		if isGroupedContent(content) { // "groups:"などがあれば grouped として扱う
+			validationErrors = validateGroupedYAML(filePath, &root, options, fragment)
 		} else if strings.Contains(filename, "packages") { // "groups:" がなく、ファイル名に "packages" が含まれる場合
-			validationErrors = append(validationErrors, "Simple YAML format (without 'groups:' structure) is no longer supported")
+			validationErrors = append(validationErrors, problem{Message: "Simple YAML format (without 'groups:' structure) is no longer supported"})
 		} else { // それ以外（groupedでもなく、packagesでもないファイル名で、groups: もない場合）
-			validationErrors = append(validationErrors, fmt.Sprintf("Unknown YAML format for file: %s", filename))
+			validationErrors = append(validationErrors, problem{Message: fmt.Sprintf("Unknown YAML format for file: %s", filename)})
 		}
 	}
 
+	for _, p := range validationErrors {
+		e := Error{Line: p.Line, Column: p.Column, Message: p.Message}
+		if len(p.Path) > 0 {
+			e.Path = yamlPkg.Pointer(p.Path)
+		}
+		result.Errors = append(result.Errors, e)
+	}
+
 	// Report validation results
 	if len(validationErrors) == 0 {
+		result.Valid = true
 		utils.PrintStatus(utils.Green, fmt.Sprintf("✅ Valid: %s", filepath.Base(filePath)))
-		return nil
+		return result, nil
 	} else {
 		utils.PrintStatus(utils.Red, fmt.Sprintf("❌ Invalid: %s", filepath.Base(filePath)))
 		if options.Verbose {
 			utils.PrintStatus(utils.Yellow, "Validation errors:")
 			for _, error := range validationErrors {
-				fmt.Printf("  - %s\n", error)
+				fmt.Fprintf(utils.Output, "  - %s\n", error.String())
 			}
 		}
-		return fmt.Errorf("validation failed with %d errors", len(validationErrors))
+		return result, fmt.Errorf("validation failed with %d errors", len(validationErrors))
+	}
+}
+
+// isGroupedContent reports whether content looks like a grouped configuration, an include or an overlay
+func isGroupedContent(content string) bool {
+	for _, key := range []string{"groups:", "include:", "overlays:", "remove:"} {
+		if strings.Contains(content, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateGroupedYAML validates grouped YAML format: the file against the JSON Schema, then the configuration
+// merged from its includes and overlays (or the file alone if it is a fragment) with the semantic checks.
+// Errors are positioned in the file where possible; semantic errors repeating a schema error are dropped.
+func validateGroupedYAML(filePath string, root *yaml.Node, options *types.ValidateOptions, fragment bool) []problem {
+	// Groups of a file with includes or overlays may be completed by the other files
+	partial := fragment || hasMergedFiles(root)
+	errors, err := schemaProblems(root, options.SchemaFile, partial)
+	if err != nil {
+		return []problem{{Message: err.Error()}}
+	}
+
+	semantic := validateMergedYAML(filePath, root, options, fragment)
+	for _, p := range semantic {
+		p.position(root)
+		if !duplicates(p, errors) {
+			errors = append(errors, p)
+		}
 	}
+
+	sortProblems(errors)
+	return errors
 }
 
-// validateGroupedYAML validates grouped YAML format
-func validateGroupedYAML(content string, verbose bool) []string {
-	var errors []string
+// hasMergedFiles reports whether a configuration document has includes or overlays
+func hasMergedFiles(root *yaml.Node) bool {
+	for _, key := range []string{"include", "overlays"} {
+		if _, found := yamlPkg.Locate(root, []string{key}); found {
+			return true
+		}
+	}
+	return false
+}
+
+// duplicates reports whether a semantic problem restates a schema problem at the same position
+func duplicates(p problem, schemaErrors []problem) bool {
+	if p.Line == 0 || !p.schemaRule {
+		return false
+	}
+	for _, e := range schemaErrors {
+		if e.Line == p.Line && e.Column == p.Column {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMergedYAML runs the semantic checks.
+// Unless the file is a fragment, the configuration merged from its includes and overlays is validated.
+func validateMergedYAML(filePath string, root *yaml.Node, options *types.ValidateOptions, fragment bool) []problem {
+	var errors []problem
 
 	// Try to parse as grouped config
 	var config types.PackageGrouped
-	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
-		errors = append(errors, fmt.Sprintf("Failed to parse as grouped format: %v", err))
+	if err := root.Decode(&config); err != nil {
+		errors = append(errors, problem{Message: fmt.Sprintf("Failed to parse as grouped format: %v", err)})
 		return errors
 	}
 
+	if fragment {
+		return validateGroupedConfig(&config, true)
+	}
+
+	host := yamlPkg.CurrentHost()
+	if options.Hostname != "" {
+		host.Hostname = options.Hostname
+	}
+	if options.Arch != "" {
+		host.Arch = options.Arch
+	}
+
+	comp, err := yamlPkg.Compose(filePath, host)
+	if err != nil {
+		return append(errors, problem{Message: err.Error()})
+	}
+
+	if options.Verbose && len(comp.Files) > 1 {
+		utils.PrintStatus(utils.Blue, fmt.Sprintf("Merged %d files for %s (%s): %s",
+			len(comp.Files), host.Hostname, host.Arch, strings.Join(comp.Files, ", ")))
+	}
+	if options.Explain {
+		explainSources(comp)
+	}
+
+	return validateGroupedConfig(comp.Config, false)
+}
+
+// explainSources prints which file each package came from, and which overlay removed it
+func explainSources(comp *yamlPkg.Composition) {
+	utils.PrintStatus(utils.Cyan, "Package sources:")
+	for _, key := range comp.Keys() {
+		fmt.Fprintf(utils.Output, "  %s\n", key)
+		for _, source := range comp.Sources[key] {
+			if source.Removed {
+				fmt.Fprintf(utils.Output, "    - removed from %s by %s\n", source.Group, source.File)
+			} else {
+				fmt.Fprintf(utils.Output, "    - %s (%s)\n", source.Group, source.File)
+			}
+		}
+	}
+}
+
+// validateGroupedConfig validates a parsed grouped configuration
+func validateGroupedConfig(config *types.PackageGrouped, fragment bool) []problem {
+	var errors []problem
+
 	// Check required fields
 	if len(config.Groups) == 0 {
 		// Allow empty groups for a valid file, but might be a warning if desired.
@@ -105,33 +239,44 @@ func validateGroupedYAML(content string, verbose bool) []string {
 
 	// Validate groups
 	for groupName, group := range config.Groups {
-		if group.Description == "" {
-			errors = append(errors, fmt.Sprintf("Missing description in group: %s", groupName))
+		groupPath := []string{"groups", groupName}
+		if group.Description == "" && !fragment {
+			errors = append(errors, schemaRule(append(groupPath, "description"), "Missing description in group: %s", groupName))
 		}
-		if group.Priority == 0 {
-			errors = append(errors, fmt.Sprintf("Missing or zero priority in group: %s", groupName))
+		if group.Priority == 0 && !fragment {
+			errors = append(errors, schemaRule(append(groupPath, "priority"), "Missing or zero priority in group: %s", groupName))
+		}
+		if _, err := hooks.Timeout(group.Hooks); err != nil {
+			errors = append(errors, problem{Path: append(groupPath, "hook_timeout"), Message: fmt.Sprintf("Invalid hooks in group %s: %v", groupName, err)})
 		}
 		if group.Packages == nil { // Check if Packages map itself is nil
-			errors = append(errors, fmt.Sprintf("Missing packages map in group: %s", groupName))
+			if !fragment {
+				errors = append(errors, schemaRule(append(groupPath, "packages"), "Missing packages map in group: %s", groupName))
+			}
 			continue // Skip further package validation for this group
 		}
 
 		// Validate packages in group
 		for pkgType, pkgInfos := range group.Packages {
+			packagesPath := []string{"groups", groupName, "packages"}
 			if pkgType == "" { // Should not happen if map key is used, but good check
-				errors = append(errors, fmt.Sprintf("Empty package type key in group %s", groupName))
+				errors = append(errors, schemaRule(packagesPath, "Empty package type key in group %s", groupName))
 				continue
 			}
 			if !isValidPackageType(pkgType) { // Validate pkgType against known types
-				errors = append(errors, fmt.Sprintf("Invalid package type '%s' in group %s", pkgType, groupName))
+				errors = append(errors, schemaRule(packagesPath, "Invalid package type '%s' in group %s", pkgType, groupName))
 			}
 			for i, pkgInfo := range pkgInfos {
+				pkgPath := []string{"groups", groupName, "packages", pkgType, strconv.Itoa(i)}
 				if pkgInfo.Name == "" {
-					errors = append(errors, fmt.Sprintf("Missing name in group %s, type %s, package index %d", groupName, pkgType, i))
+					errors = append(errors, schemaRule(append(pkgPath, "name"), "Missing name in group %s, type %s, package index %d", groupName, pkgType, i))
 				}
 				// Type is now the key, so no need to check pkgInfo.Type
 				if pkgType == "mas" && pkgInfo.ID == 0 {
-					errors = append(errors, fmt.Sprintf("Missing ID for mas app in group %s, package %s", groupName, pkgInfo.Name))
+					errors = append(errors, problem{Path: pkgPath, Message: fmt.Sprintf("Missing ID for mas app in group %s, package %s", groupName, pkgInfo.Name)})
+				}
+				if _, err := hooks.Timeout(pkgInfo.Hooks); err != nil {
+					errors = append(errors, problem{Path: append(pkgPath, "hook_timeout"), Message: fmt.Sprintf("Invalid hooks in group %s, package %s: %v", groupName, pkgInfo.Name, err)})
 				}
 			}
 		}
@@ -139,33 +284,45 @@ func validateGroupedYAML(content string, verbose bool) []string {
 
 	// Validate profiles if present
 	for profileName, profile := range config.Profiles {
+		profilePath := []string{"profiles", profileName}
 		if profile.Description == "" {
-			errors = append(errors, fmt.Sprintf("Missing description in profile: %s", profileName))
+			errors = append(errors, schemaRule(append(profilePath, "description"), "Missing description in profile: %s", profileName))
+		}
+		if !fragment {
+			if _, err := yamlPkg.ResolveProfile(config, profileName); err != nil {
+				errors = append(errors, problem{Path: profilePath, Message: err.Error()})
+			}
 		}
 	}
 
 	return errors
 }
 
+// schemaRule creates a problem for a semantic check that the JSON Schema also enforces
+func schemaRule(path []string, format string, args ...any) problem {
+	return problem{Path: path, Message: fmt.Sprintf(format, args...), schemaRule: true}
+}
+
 // isValidPackageType checks if the given type string is a valid package type.
 func isValidPackageType(pkgType string) bool {
-	switch pkgType {
-	case "tap", "brew", "cask", "mas":
-		return true
-	default:
-		return false
-	}
+	return types.IsPackageType(pkgType)
 }
 
-// ValidateAllYAMLFiles validates all YAML files in the data directory
-func ValidateAllYAMLFiles(dataDir string, options *types.ValidateOptions) error {
+// ValidateAllYAMLFiles validates all YAML files in the data directory, returning the result of
+// every file also when some are invalid
+func ValidateAllYAMLFiles(dataDir string, options *types.ValidateOptions) ([]*FileResult, error) {
 	if !utils.FileExists(dataDir) {
-		return fmt.Errorf("data directory not found: %s", dataDir)
+		return nil, fmt.Errorf("data directory not found: %s", dataDir)
 	}
 
 	utils.PrintStatus(utils.Blue, fmt.Sprintf("Validating all YAML files in: %s", dataDir))
 
+	if _, err := loadSchema(options.SchemaFile); err != nil {
+		return nil, err
+	}
+
 	var hasErrors bool
+	var files []string
 
 	// Walk through directory and find YAML files
 	err := filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
@@ -175,29 +332,59 @@ func ValidateAllYAMLFiles(dataDir string, options *types.ValidateOptions) error
 
 		// Check if file is a YAML file
 		if !info.IsDir() && (strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".yaml")) {
-			// Skip schema files
-			if strings.Contains(path, "schema") {
+			// Skip schema files and lockfiles
+			if strings.Contains(path, "schema") || strings.Contains(filepath.Base(path), ".lock.") {
 				return nil
 			}
-
-			if err := ValidateYAMLFile(path, options); err != nil {
-				hasErrors = true
-			}
+			files = append(files, path)
 		}
 
 		return nil
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to walk directory: %w", err)
+		return nil, fmt.Errorf("failed to walk directory: %w", err)
+	}
+
+	// Files included by or overlaid on another file are validated as part of that file
+	fragments := referencedFiles(files)
+	var results []*FileResult
+	for _, path := range files {
+		result, err := validateFile(path, options, fragments[filepath.Clean(path)])
+		if err != nil {
+			hasErrors = true
+		}
+		if result != nil {
+			results = append(results, result)
+		}
 	}
 
 	if hasErrors {
-		return fmt.Errorf("validation failed for one or more files")
+		return results, fmt.Errorf("validation failed for one or more files")
 	}
 
 	utils.PrintStatus(utils.Green, "All YAML files are valid!")
-	return nil
+	return results, nil
+}
+
+// referencedFiles returns the files named by the include or overlays sections of any of files,
+// regardless of whether the overlays match this host
+func referencedFiles(files []string) map[string]bool {
+	referenced := make(map[string]bool)
+	for _, path := range files {
+		config, err := yamlPkg.LoadGroupedConfig(path)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Dir(path)
+		for _, include := range config.Include {
+			referenced[filepath.Clean(yamlPkg.ResolvePath(dir, include))] = true
+		}
+		for _, overlay := range config.Overlays {
+			referenced[filepath.Clean(yamlPkg.ResolvePath(dir, overlay.File))] = true
+		}
+	}
+	return referenced
 }
 
 // TestYAMLLoad tests loading YAML files
@@ -0,0 +1,353 @@
+package yaml
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+// Host identifies the machine that overlays are matched against
+type Host struct {
+	Hostname string
+	Arch     string
+}
+
+// CurrentHost returns the short hostname and architecture of this machine
+func CurrentHost() Host {
+	hostname, _ := os.Hostname()
+	if i := strings.Index(hostname, "."); i >= 0 {
+		hostname = hostname[:i]
+	}
+	return Host{Hostname: hostname, Arch: runtime.GOARCH}
+}
+
+// archAliases maps uname-style architecture names to Go ones
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+}
+
+// normalizeArch lower-cases an architecture name and maps aliases to Go names
+func normalizeArch(arch string) string {
+	arch = strings.ToLower(arch)
+	if alias, ok := archAliases[arch]; ok {
+		return alias
+	}
+	return arch
+}
+
+// matches reports whether an overlay applies to the host. Every condition that is set must match.
+func (h Host) matches(overlay types.Overlay) bool {
+	if overlay.Hostname != "" {
+		hostname := strings.ToLower(h.Hostname)
+		want := strings.ToLower(overlay.Hostname)
+		if want != hostname && strings.SplitN(want, ".", 2)[0] != hostname {
+			return false
+		}
+	}
+	if overlay.Arch != "" {
+		if normalizeArch(overlay.Arch) != normalizeArch(h.Arch) {
+			return false
+		}
+	}
+	return true
+}
+
+// Source records where a package was defined, or which overlay removed it
+type Source struct {
+	File    string
+	Group   string
+	Removed bool
+}
+
+// Composition is a configuration merged from a root file, its includes and matching overlays
+type Composition struct {
+	Config *types.PackageGrouped
+	// Files lists the loaded files in merge order
+	Files []string
+	// Sources maps a package key (see PackageKey) to the files that defined or removed it, in merge order
+	Sources map[string][]Source
+
+	host    Host
+	loading map[string]bool
+	loaded  map[string]bool
+	first   map[string]definition // package key -> first definition, for conflict checks
+	groups  map[string]string     // group name -> file that first set its description and priority
+	prof    map[string]string     // profile name -> file that defined it
+}
+
+// definition is where a package was first defined and with which tags
+type definition struct {
+	Source
+	Tags []string
+}
+
+// PackageKey returns the key that identifies a package across groups and files:
+// "type:name", or "mas:<id>" for Mac App Store apps; VS Code extension IDs are lowercased
+func PackageKey(pkgType string, pkgInfo types.PackageInfo) string {
+	if pkgType == "mas" {
+		return fmt.Sprintf("mas:%d", pkgInfo.ID)
+	}
+	return pkgType + ":" + NormalizeName(pkgType, pkgInfo.Name)
+}
+
+// LoadMergedConfig loads a configuration file together with its includes and the overlays matching this machine
+func LoadMergedConfig(filePath string) (*types.PackageGrouped, error) {
+	comp, err := Compose(filePath, CurrentHost())
+	if err != nil {
+		return nil, err
+	}
+	return comp.Config, nil
+}
+
+// Compose merges a configuration file with its includes and the overlays matching host.
+//
+// Files are merged depth first in a fixed order: the file itself, then its includes in the order
+// listed, then its matching overlays in the order listed. Include and overlay paths are relative
+// to the file that names them. A file reached twice is merged once; include cycles are an error.
+//
+// Groups with the same name are merged, but their description and priority must agree when set
+// in more than one file. A package may appear in several groups only with the same tags.
+// Profiles may not be defined in more than one file. Overlays may also remove packages.
+func Compose(filePath string, host Host) (*Composition, error) {
+	comp := &Composition{
+		Config:  createDefaultGroupedConfig(),
+		Sources: make(map[string][]Source),
+		host:    host,
+		loading: make(map[string]bool),
+		loaded:  make(map[string]bool),
+		first:   make(map[string]definition),
+		groups:  make(map[string]string),
+		prof:    make(map[string]string),
+	}
+
+	if err := comp.mergeFile(filePath, false); err != nil {
+		return nil, err
+	}
+
+	return comp, nil
+}
+
+// Keys returns the sorted keys of every package defined in any file, including removed ones
+func (c *Composition) Keys() []string {
+	keys := make([]string, 0, len(c.Sources))
+	for key := range c.Sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mergeFile merges one file and, recursively, the files it includes and its matching overlays
+func (c *Composition) mergeFile(filePath string, isOverlay bool) error {
+	filePath = filepath.Clean(filePath)
+	if c.loading[filePath] {
+		return fmt.Errorf("include cycle: %s is included again by one of its own includes", filePath)
+	}
+	if c.loaded[filePath] {
+		return nil
+	}
+	if len(c.Files) > 0 && !utils.FileExists(filePath) {
+		return fmt.Errorf("included file not found: %s", filePath)
+	}
+
+	config, err := LoadGroupedConfig(filePath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	c.loading[filePath] = true
+	defer delete(c.loading, filePath)
+	c.loaded[filePath] = true
+	c.Files = append(c.Files, filePath)
+
+	if len(config.Remove) > 0 && !isOverlay {
+		return fmt.Errorf("%s: 'remove' is only allowed in overlay files", filePath)
+	}
+
+	// Removals apply before the overlay's own groups, so an overlay can move a package to another group
+	if err := c.applyRemovals(filePath, config.Remove); err != nil {
+		return err
+	}
+
+	if err := c.mergeConfig(filePath, config); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(filePath)
+	for _, include := range config.Include {
+		if err := c.mergeFile(ResolvePath(dir, include), false); err != nil {
+			return err
+		}
+	}
+
+	for i, overlay := range config.Overlays {
+		if overlay.File == "" {
+			return fmt.Errorf("%s: overlay %d has no file", filePath, i+1)
+		}
+		if !c.host.matches(overlay) {
+			continue
+		}
+		if err := c.mergeFile(ResolvePath(dir, overlay.File), true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeConfig merges the groups and profiles of one file into the composition
+func (c *Composition) mergeConfig(filePath string, config *types.PackageGrouped) error {
+	groupNames := make([]string, 0, len(config.Groups))
+	for name := range config.Groups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+
+	for _, groupName := range groupNames {
+		group := config.Groups[groupName]
+		merged, exists := c.Config.Groups[groupName]
+		if !exists {
+			merged = types.Group{Packages: make(map[string][]types.PackageInfo)}
+		}
+
+		if group.Description != "" || group.Priority != 0 {
+			if owner, ok := c.groups[groupName]; ok {
+				if (group.Description != "" && group.Description != merged.Description) ||
+					(group.Priority != 0 && group.Priority != merged.Priority) {
+					return fmt.Errorf("group %s is defined differently in %s and %s (description or priority)", groupName, owner, filePath)
+				}
+			} else {
+				c.groups[groupName] = filePath
+				merged.Description = group.Description
+				merged.Priority = group.Priority
+				merged.Categories = group.Categories
+			}
+		}
+		// Group hooks may come from any file; the first file setting a field wins
+		merged.Hooks = merged.Hooks.Inherit(group.Hooks)
+
+		for _, pkgType := range sortedTypes(group.Packages) {
+			for _, pkgInfo := range group.Packages[pkgType] {
+				add, err := c.trackPackage(filePath, groupName, pkgType, pkgInfo, merged.Packages[pkgType])
+				if err != nil {
+					return err
+				}
+				if add {
+					merged.Packages[pkgType] = append(merged.Packages[pkgType], pkgInfo)
+				}
+			}
+		}
+
+		c.Config.Groups[groupName] = merged
+	}
+
+	for name, profile := range config.Profiles {
+		if owner, ok := c.prof[name]; ok {
+			return fmt.Errorf("profile %s is defined in both %s and %s", name, owner, filePath)
+		}
+		c.prof[name] = filePath
+		c.Config.Profiles[name] = profile
+	}
+
+	return nil
+}
+
+// trackPackage records where a package was defined and reports whether it should be added to the group.
+// A package that is already in the group is not added again.
+func (c *Composition) trackPackage(filePath, groupName, pkgType string, pkgInfo types.PackageInfo, existing []types.PackageInfo) (bool, error) {
+	key := PackageKey(pkgType, pkgInfo)
+	source := Source{File: filePath, Group: groupName}
+
+	if first, ok := c.first[key]; ok {
+		if !sameTags(first.Tags, pkgInfo.Tags) {
+			return false, fmt.Errorf("package %s has different tags in %s (group %s) %v and %s (group %s) %v",
+				key, first.File, first.Group, first.Tags, filePath, groupName, pkgInfo.Tags)
+		}
+	} else {
+		c.first[key] = definition{Source: source, Tags: pkgInfo.Tags}
+	}
+	c.Sources[key] = append(c.Sources[key], source)
+
+	for _, other := range existing {
+		if PackageKey(pkgType, other) == key {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// applyRemovals removes the packages listed in an overlay's remove section from every group
+func (c *Composition) applyRemovals(filePath string, remove map[string][]string) error {
+	for _, pkgType := range sortedTypes(remove) {
+		for _, name := range remove[pkgType] {
+			removed := false
+			for groupName, group := range c.Config.Groups {
+				kept := group.Packages[pkgType][:0]
+				for _, pkgInfo := range group.Packages[pkgType] {
+					if NormalizeName(pkgType, pkgInfo.Name) == NormalizeName(pkgType, name) || (pkgType == "mas" && strconv.FormatInt(pkgInfo.ID, 10) == name) {
+						key := PackageKey(pkgType, pkgInfo)
+						c.Sources[key] = append(c.Sources[key], Source{File: filePath, Group: groupName, Removed: true})
+						delete(c.first, key)
+						removed = true
+						continue
+					}
+					kept = append(kept, pkgInfo)
+				}
+				group.Packages[pkgType] = kept
+			}
+			if !removed {
+				return fmt.Errorf("%s: cannot remove %s %s: it is not defined by any earlier file", filePath, pkgType, name)
+			}
+		}
+	}
+	return nil
+}
+
+// ResolvePath resolves a path relative to the directory of the file that names it
+func ResolvePath(dir, path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// sortedTypes returns the keys of a map keyed by package type in sorted order
+func sortedTypes[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sameTags compares tags regardless of order
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, tag := range a {
+		seen[tag]++
+	}
+	for _, tag := range b {
+		if seen[tag] == 0 {
+			return false
+		}
+		seen[tag]--
+	}
+	return true
+}
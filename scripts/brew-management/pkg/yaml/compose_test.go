@@ -0,0 +1,265 @@
+package yaml_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+// writeFiles writes configuration files into a temporary directory and returns it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// groupKeys returns the package keys of every group in merge order
+func groupKeys(config *types.PackageGrouped) map[string][]string {
+	got := make(map[string][]string)
+	for name, group := range config.Groups {
+		got[name] = []string{}
+		for _, pkgType := range types.PackageTypes {
+			for _, pkgInfo := range group.Packages[pkgType] {
+				got[name] = append(got[name], yamlPkg.PackageKey(pkgType, pkgInfo))
+			}
+		}
+	}
+
+	return got
+}
+
+func TestCompose(t *testing.T) {
+	t.Parallel()
+
+	host := yamlPkg.Host{Hostname: "work-mbp", Arch: "amd64"}
+
+	tests := []struct {
+		name      string
+		files     map[string]string
+		want      map[string][]string
+		wantFiles []string
+		wantErr   bool
+	}{
+		{
+			"includes merge groups",
+			map[string]string{
+				"packages.yaml": `include: [common/cli.yaml]
+groups:
+  core:
+    priority: 1
+    packages:
+      brew: [{name: git}]
+`,
+				"common/cli.yaml": `groups:
+  core:
+    packages:
+      brew: [{name: jq}, {name: git}]
+  dev:
+    priority: 2
+    packages:
+      go: [{name: golang.org/x/tools/gopls}]
+`,
+			},
+			map[string][]string{
+				"core": {"brew:git", "brew:jq"},
+				"dev":  {"go:golang.org/x/tools/gopls"},
+			},
+			[]string{"packages.yaml", "common/cli.yaml"},
+			false,
+		},
+		{
+			"matching overlays add and remove packages",
+			map[string]string{
+				"packages.yaml": `overlays:
+  - hostname: work-mbp.local
+    file: hosts/work.yaml
+  - hostname: home-mini
+    file: hosts/home.yaml
+  - arch: x86_64
+    file: arch/intel.yaml
+groups:
+  core:
+    priority: 1
+    packages:
+      brew: [{name: git}, {name: jq}]
+      cask: [{name: slack}]
+`,
+				"hosts/work.yaml": `remove:
+  cask: [slack]
+groups:
+  work:
+    priority: 3
+    packages:
+      brew: [{name: awscli}]
+`,
+				"hosts/home.yaml": `groups:
+  home:
+    packages:
+      cask: [{name: steam}]
+`,
+				"arch/intel.yaml": `remove:
+  brew: [jq]
+groups:
+  core:
+    packages:
+      brew: [{name: rosetta-free}]
+`,
+			},
+			map[string][]string{
+				"core": {"brew:git", "brew:rosetta-free"},
+				"work": {"brew:awscli"},
+			},
+			[]string{"packages.yaml", "hosts/work.yaml", "arch/intel.yaml"},
+			false,
+		},
+		{
+			"file reached twice is merged once",
+			map[string]string{
+				"packages.yaml": "include: [a.yaml, b.yaml]\n",
+				"a.yaml":        "include: [b.yaml]\ngroups:\n  core:\n    packages:\n      brew: [{name: git, tags: [cli]}]\n",
+				"b.yaml":        "groups:\n  core:\n    packages:\n      brew: [{name: git, tags: [cli]}]\n",
+			},
+			map[string][]string{
+				"core": {"brew:git"},
+			},
+			[]string{"packages.yaml", "a.yaml", "b.yaml"},
+			false,
+		},
+		{
+			"include cycle",
+			map[string]string{
+				"packages.yaml": "include: [a.yaml]\n",
+				"a.yaml":        "include: [packages.yaml]\n",
+			},
+			nil, nil, true,
+		},
+		{
+			"missing include",
+			map[string]string{
+				"packages.yaml": "include: [missing.yaml]\n",
+			},
+			nil, nil, true,
+		},
+		{
+			"remove outside an overlay",
+			map[string]string{
+				"packages.yaml": "include: [a.yaml]\n",
+				"a.yaml":        "remove:\n  brew: [git]\n",
+			},
+			nil, nil, true,
+		},
+		{
+			"remove of an undefined package",
+			map[string]string{
+				"packages.yaml": "overlays:\n  - arch: amd64\n    file: a.yaml\n",
+				"a.yaml":        "remove:\n  brew: [git]\n",
+			},
+			nil, nil, true,
+		},
+		{
+			"conflicting group priority",
+			map[string]string{
+				"packages.yaml": "include: [a.yaml]\ngroups:\n  core:\n    priority: 1\n",
+				"a.yaml":        "groups:\n  core:\n    priority: 2\n",
+			},
+			nil, nil, true,
+		},
+		{
+			"conflicting tags",
+			map[string]string{
+				"packages.yaml": "include: [a.yaml]\ngroups:\n  core:\n    packages:\n      brew: [{name: git, tags: [cli]}]\n",
+				"a.yaml":        "groups:\n  dev:\n    packages:\n      brew: [{name: git, tags: [vcs]}]\n",
+			},
+			nil, nil, true,
+		},
+		{
+			"profile defined twice",
+			map[string]string{
+				"packages.yaml": "include: [a.yaml]\nprofiles:\n  work:\n    description: Work\n",
+				"a.yaml":        "profiles:\n  work:\n    description: Work again\n",
+			},
+			nil, nil, true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeFiles(t, tt.files)
+
+			comp, err := yamlPkg.Compose(filepath.Join(dir, "packages.yaml"), host)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Compose() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := groupKeys(comp.Config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compose() groups = %v, want %v", got, tt.want)
+			}
+
+			var files []string
+			for _, file := range comp.Files {
+				rel, err := filepath.Rel(dir, file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				files = append(files, filepath.ToSlash(rel))
+			}
+			if !reflect.DeepEqual(files, tt.wantFiles) {
+				t.Errorf("Compose() files = %v, want %v", files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestCompose_Sources(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"packages.yaml": "include: [a.yaml]\noverlays:\n  - arch: arm64\n    file: b.yaml\ngroups:\n  core:\n    packages:\n      brew: [{name: git}]\n",
+		"a.yaml":        "groups:\n  dev:\n    packages:\n      brew: [{name: git}]\n",
+		"b.yaml":        "remove:\n  brew: [git]\n",
+	})
+
+	comp, err := yamlPkg.Compose(filepath.Join(dir, "packages.yaml"), yamlPkg.Host{Hostname: "mini", Arch: "aarch64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []yamlPkg.Source{
+		{File: filepath.Join(dir, "packages.yaml"), Group: "core"},
+		{File: filepath.Join(dir, "a.yaml"), Group: "dev"},
+		{File: filepath.Join(dir, "b.yaml"), Group: "core", Removed: true},
+		{File: filepath.Join(dir, "b.yaml"), Group: "dev", Removed: true},
+	}
+
+	got := comp.Sources["brew:git"]
+	// Removals from several groups are recorded in map order
+	if len(got) == len(want) && got[2].Group == "dev" {
+		got[2], got[3] = got[3], got[2]
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Compose() sources = %v, want %v", got, want)
+	}
+	if keys := comp.Keys(); !reflect.DeepEqual(keys, []string{"brew:git"}) {
+		t.Errorf("Composition.Keys() = %v, want %v", keys, []string{"brew:git"})
+	}
+}
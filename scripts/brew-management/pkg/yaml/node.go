@@ -0,0 +1,407 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Locate returns the node at path in a YAML document, or the deepest existing ancestor
+// when the path does not exist (such as a missing property), and whether the whole path exists.
+// Path tokens are mapping keys and sequence indexes.
+func Locate(root *yaml.Node, path []string) (*yaml.Node, bool) {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, token := range path {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == token {
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+		if next == nil {
+			return node, false
+		}
+		node = next
+	}
+	return node, true
+}
+
+// Pointer formats a location as a JSON pointer such as /groups/core/priority
+func Pointer(path []string) string {
+	if len(path) == 0 {
+		return "/"
+	}
+	escaped := make([]string, len(path))
+	for i, token := range path {
+		escaped[i] = strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+// schemaHeader is the comment that points editors at the JSON Schema of the configuration
+const schemaHeader = "# yaml-language-server: $schema=~/github.com/shiron-dev/dotfiles/scripts/brew-management/packages.schema.json"
+
+// writeDocument writes value to a YAML file by merging it into the document already in the file,
+// so that comments, key order, blank lines and indentation written by hand survive. New files are
+// written with groups in priority order and package types in install order.
+func writeDocument(filePath string, value any) ([]byte, error) {
+	var src yaml.Node
+	if err := src.Encode(value); err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+
+	var doc yaml.Node
+	var original []byte
+	if utils.FileExists(filePath) {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read YAML file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+		original = data
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+		original = nil
+	}
+
+	m := &merger{blanks: blankLinesBefore(&doc, original)}
+	m.merge(doc.Content[0], &src, nil)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(detectIndent(original))
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+
+	content, err := restoreBlankLines(&doc, buf.Bytes(), m.blanks)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(content, []byte("# yaml-language-server:")) {
+		content = append([]byte(schemaHeader+"\n\n"), content...)
+	}
+	return content, nil
+}
+
+// merger merges values into an existing document
+type merger struct {
+	blanks map[*yaml.Node]bool // Entry nodes that follow a blank line
+}
+
+// merge updates dst, a node of an existing document, to the value of src. Comments and styles
+// of dst are kept, mapping entries keep their order and new ones are placed with entryBefore, and
+// sequence items follow the order of src but keep the nodes they match in dst (see identity).
+// New entries are separated by a blank line when the other entries are. path is the location of dst.
+func (m *merger) merge(dst, src *yaml.Node, path []string) {
+	if dst.Kind != src.Kind {
+		fresh := m.build(src, path)
+		dst.Kind, dst.Tag, dst.Value, dst.Content, dst.Style = fresh.Kind, fresh.Tag, fresh.Value, fresh.Content, fresh.Style
+		return
+	}
+
+	switch dst.Kind {
+	case yaml.ScalarNode:
+		if dst.Value != src.Value || dst.ShortTag() != src.ShortTag() {
+			dst.Tag, dst.Value, dst.Style = src.Tag, src.Value, src.Style
+		}
+
+	case yaml.MappingNode:
+		values := make(map[string]*yaml.Node, len(src.Content)/2)
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			values[src.Content[i].Value] = src.Content[i+1]
+		}
+
+		var content []*yaml.Node
+		present := make(map[string]bool)
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			key := dst.Content[i].Value
+			value, ok := values[key]
+			if !ok {
+				continue
+			}
+			m.merge(dst.Content[i+1], value, append(path[:len(path):len(path)], key))
+			content = append(content, dst.Content[i], dst.Content[i+1])
+			present[key] = true
+		}
+
+		separated := m.separated(dst, 2)
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key := src.Content[i]
+			if present[key.Value] {
+				continue
+			}
+			value := m.build(src.Content[i+1], append(path[:len(path):len(path)], key.Value))
+			if separated {
+				m.blanks[key] = true
+			}
+			at := len(content)
+			for j := 0; j+1 < len(content); j += 2 {
+				if entryBefore(path, src, key, value, content[j], content[j+1]) {
+					at = j
+					break
+				}
+			}
+			content = append(content[:at], append([]*yaml.Node{key, value}, content[at:]...)...)
+		}
+
+		if len(dst.Content) == 0 && len(content) > 0 {
+			dst.Style &^= yaml.FlowStyle
+		}
+		m.unseparateFirst(content, path)
+		dst.Content = content
+
+	case yaml.SequenceNode:
+		separated := m.separated(dst, 1)
+		used := make([]bool, len(dst.Content))
+		content := make([]*yaml.Node, 0, len(src.Content))
+		for i, item := range src.Content {
+			itemPath := append(path[:len(path):len(path)], strconv.Itoa(i))
+			id := identity(item)
+			match := -1
+			for j, existing := range dst.Content {
+				if !used[j] && identity(existing) == id && (id != "" || i == j) {
+					match = j
+					break
+				}
+			}
+			if match < 0 {
+				item = m.build(item, itemPath)
+				if separated {
+					m.blanks[item] = true
+				}
+				content = append(content, item)
+				continue
+			}
+			used[match] = true
+			m.merge(dst.Content[match], item, itemPath)
+			content = append(content, dst.Content[match])
+		}
+
+		if len(dst.Content) == 0 && len(content) > 0 {
+			dst.Style &^= yaml.FlowStyle
+		}
+		m.unseparateFirst(content, path)
+		dst.Content = content
+	}
+}
+
+// build returns a new node for src at path, with its entries placed as if merged into an empty node
+func (m *merger) build(src *yaml.Node, path []string) *yaml.Node {
+	if src.Kind != yaml.MappingNode && src.Kind != yaml.SequenceNode {
+		return src
+	}
+	node := &yaml.Node{Kind: src.Kind, Tag: src.Tag, Style: src.Style}
+	m.merge(node, src, path)
+	return node
+}
+
+// unseparateFirst drops the blank line before the first entry of a nested mapping or sequence,
+// which an entry that was not first before may carry
+func (m *merger) unseparateFirst(content []*yaml.Node, path []string) {
+	if len(content) > 0 && len(path) > 0 {
+		delete(m.blanks, content[0])
+	}
+}
+
+// separated reports whether the entries of a block mapping or sequence after the first are
+// separated by blank lines, step being the number of nodes per entry
+func (m *merger) separated(node *yaml.Node, step int) bool {
+	if node.Style&yaml.FlowStyle != 0 || len(node.Content) < 2*step {
+		return false
+	}
+	for i := step; i < len(node.Content); i += step {
+		if !m.blanks[node.Content[i]] {
+			return false
+		}
+	}
+	return true
+}
+
+// identity returns what identifies a sequence item across versions of a document: the value of
+// a scalar, or the id, name or file of a mapping (packages, overlays). Other items have no identity
+// and match by position.
+func identity(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return "=" + node.Value
+	case yaml.MappingNode:
+		for _, field := range []string{"id", "name", "file"} {
+			if value, ok := Locate(node, []string{field}); ok && value.Kind == yaml.ScalarNode {
+				return field + "=" + value.Value
+			}
+		}
+	}
+	return ""
+}
+
+// entryBefore reports whether a new mapping entry belongs before an existing one at path:
+// groups by priority, package types in install order, and other entries in the order of src
+func entryBefore(path []string, src, newKey, newValue, key, value *yaml.Node) bool {
+	switch {
+	case len(path) == 1 && path[0] == "groups":
+		return priority(newValue) < priority(value)
+	case len(path) == 3 && path[0] == "groups" && path[2] == "packages":
+		return typeIndex(newKey.Value) < typeIndex(key.Value)
+	}
+	return keyIndex(src, newKey.Value) < keyIndex(src, key.Value)
+}
+
+// priority returns the priority of a group node, 0 when it has none
+func priority(group *yaml.Node) int {
+	node, ok := Locate(group, []string{"priority"})
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.Atoi(node.Value)
+	return n
+}
+
+// typeIndex returns the position of a package type in the install order, unknown types last
+func typeIndex(pkgType string) int {
+	for i, t := range types.PackageTypes {
+		if t == pkgType {
+			return i
+		}
+	}
+	return len(types.PackageTypes)
+}
+
+// keyIndex returns the position of a key in a mapping node, or -1
+func keyIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i / 2
+		}
+	}
+	return -1
+}
+
+// detectIndent returns the indentation of a YAML document: that of its first indented line, or 4
+func detectIndent(data []byte) int {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indent := len(line) - len(trimmed); indent >= 2 && indent <= 8 {
+			return indent
+		}
+		break
+	}
+	return 4
+}
+
+// startLine returns the first line of a node, including its head comment
+func startLine(node *yaml.Node) int {
+	if node.HeadComment == "" {
+		return node.Line
+	}
+	return node.Line - strings.Count(node.HeadComment, "\n") - 1
+}
+
+// entryNodes calls fn for the nodes that start the entries of a block mapping (its keys) or block
+// sequence (its items), then for their descendants, in document order
+func entryNodes(node *yaml.Node, fn func(entry *yaml.Node)) {
+	if node.Style&yaml.FlowStyle != 0 {
+		return
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			entryNodes(child, fn)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			fn(node.Content[i])
+			entryNodes(node.Content[i+1], fn)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			fn(item)
+			entryNodes(item, fn)
+		}
+	}
+}
+
+// blankLinesBefore returns the entry nodes of a parsed document that follow a blank line in data
+func blankLinesBefore(doc *yaml.Node, data []byte) map[*yaml.Node]bool {
+	blanks := make(map[*yaml.Node]bool)
+	if data == nil {
+		return blanks
+	}
+
+	lines := strings.Split(string(data), "\n")
+	entryNodes(doc, func(entry *yaml.Node) {
+		if line := startLine(entry); line >= 2 && line-2 < len(lines) && strings.TrimSpace(lines[line-2]) == "" {
+			blanks[entry] = true
+		}
+	})
+	return blanks
+}
+
+// restoreBlankLines inserts a blank line before the entries of doc in blanks, where content is doc
+// encoded, so blank lines separating entries survive encoding
+func restoreBlankLines(doc *yaml.Node, content []byte, blanks map[*yaml.Node]bool) ([]byte, error) {
+	if len(blanks) == 0 {
+		return content, nil
+	}
+
+	var encoded yaml.Node
+	if err := yaml.Unmarshal(content, &encoded); err != nil {
+		return nil, fmt.Errorf("failed to parse written YAML: %w", err)
+	}
+
+	var entries, encodedEntries []*yaml.Node
+	entryNodes(doc, func(entry *yaml.Node) { entries = append(entries, entry) })
+	entryNodes(&encoded, func(entry *yaml.Node) { encodedEntries = append(encodedEntries, entry) })
+	if len(entries) != len(encodedEntries) {
+		return content, nil
+	}
+
+	before := make(map[int]bool)
+	for i, entry := range entries {
+		if blanks[entry] {
+			before[startLine(encodedEntries[i])] = true
+		}
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	var out strings.Builder
+	for i, line := range lines {
+		if before[i+1] && i > 0 && strings.TrimSpace(lines[i-1]) != "" {
+			out.WriteString("\n")
+		}
+		out.WriteString(line)
+	}
+	return []byte(out.String()), nil
+}
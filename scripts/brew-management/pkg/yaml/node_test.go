@@ -0,0 +1,332 @@
+package yaml_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+func TestMain(m *testing.M) {
+	utils.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+const handWritten = `# yaml-language-server: $schema=./packages.schema.json
+
+# Machines I use every day
+groups:
+  core:
+    description: Core tools # keep first
+    priority: 1
+    packages:
+      brew:
+        - name: git
+          tags: [cli]
+
+        # Shell
+        - name: zsh
+          tags: [shell]
+
+        - name: jq
+          tags: [cli]
+      cask:
+        - name: iterm2
+          tags: [gui]
+
+  media:
+    description: Media
+    priority: 30
+    packages:
+      cask:
+        - name: vlc
+          tags: [media]
+
+profiles:
+  # Laptop
+  work:
+    description: Work
+    groups: [core]
+`
+
+func TestSaveGroupedConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		modify func(config *types.PackageGrouped)
+		want   string
+	}{
+		{"unchanged", func(*types.PackageGrouped) {}, handWritten},
+		{
+			"changed values",
+			func(config *types.PackageGrouped) {
+				core := config.Groups["core"]
+				core.Description = "Everyday tools"
+				core.Packages["brew"][1].Tags = []string{"shell", "cli"}
+				config.Groups["core"] = core
+			},
+			`# yaml-language-server: $schema=./packages.schema.json
+
+# Machines I use every day
+groups:
+  core:
+    description: Everyday tools # keep first
+    priority: 1
+    packages:
+      brew:
+        - name: git
+          tags: [cli]
+
+        # Shell
+        - name: zsh
+          tags: [shell, cli]
+
+        - name: jq
+          tags: [cli]
+      cask:
+        - name: iterm2
+          tags: [gui]
+
+  media:
+    description: Media
+    priority: 30
+    packages:
+      cask:
+        - name: vlc
+          tags: [media]
+
+profiles:
+  # Laptop
+  work:
+    description: Work
+    groups: [core]
+`,
+		},
+		{
+			"added and removed packages",
+			func(config *types.PackageGrouped) {
+				core := config.Groups["core"]
+				core.Packages["brew"] = append(core.Packages["brew"][1:], types.PackageInfo{Name: "ripgrep", Tags: []string{"cli"}})
+				core.Packages["tap"] = []types.PackageInfo{{Name: "shiron-dev/tap", Tags: []string{}}}
+				config.Groups["core"] = core
+			},
+			`# yaml-language-server: $schema=./packages.schema.json
+
+# Machines I use every day
+groups:
+  core:
+    description: Core tools # keep first
+    priority: 1
+    packages:
+      tap:
+        - name: shiron-dev/tap
+      brew:
+        # Shell
+        - name: zsh
+          tags: [shell]
+
+        - name: jq
+          tags: [cli]
+
+        - name: ripgrep
+          tags:
+            - cli
+      cask:
+        - name: iterm2
+          tags: [gui]
+
+  media:
+    description: Media
+    priority: 30
+    packages:
+      cask:
+        - name: vlc
+          tags: [media]
+
+profiles:
+  # Laptop
+  work:
+    description: Work
+    groups: [core]
+`,
+		},
+		{
+			"new groups by priority",
+			func(config *types.PackageGrouped) {
+				config.Groups["dev"] = types.Group{Description: "Development", Priority: 20, Packages: map[string][]types.PackageInfo{
+					"brew": {{Name: "go", Tags: []string{"dev"}}},
+				}}
+				config.Groups["late"] = types.Group{Description: "Late", Priority: 40}
+			},
+			`# yaml-language-server: $schema=./packages.schema.json
+
+# Machines I use every day
+groups:
+  core:
+    description: Core tools # keep first
+    priority: 1
+    packages:
+      brew:
+        - name: git
+          tags: [cli]
+
+        # Shell
+        - name: zsh
+          tags: [shell]
+
+        - name: jq
+          tags: [cli]
+      cask:
+        - name: iterm2
+          tags: [gui]
+
+  dev:
+    description: Development
+    priority: 20
+    packages:
+      brew:
+        - name: go
+          tags:
+            - dev
+
+  media:
+    description: Media
+    priority: 30
+    packages:
+      cask:
+        - name: vlc
+          tags: [media]
+
+  late:
+    description: Late
+    priority: 40
+    packages: {}
+
+profiles:
+  # Laptop
+  work:
+    description: Work
+    groups: [core]
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "packages.yaml")
+			if err := os.WriteFile(path, []byte(handWritten), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := yamlPkg.LoadGroupedConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(config)
+
+			if err := yamlPkg.SaveGroupedConfig(config, path); err != nil {
+				t.Fatalf("SaveGroupedConfig() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(data); got != tt.want {
+				t.Errorf("SaveGroupedConfig() wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveGroupedConfig_NewFile(t *testing.T) {
+	t.Parallel()
+
+	config := &types.PackageGrouped{Groups: map[string]types.Group{
+		"media": {Description: "Media", Priority: 30, Packages: map[string][]types.PackageInfo{
+			"cask": {{Name: "vlc", Tags: []string{"media"}}},
+		}},
+		"core": {Description: "Core", Priority: 1, Packages: map[string][]types.PackageInfo{
+			"mas":  {{Name: "Xcode", ID: 497799835, Tags: []string{}}},
+			"brew": {{Name: "git", Tags: []string{"cli"}}},
+		}},
+	}}
+
+	path := filepath.Join(t.TempDir(), "config", "packages.yaml")
+	if err := yamlPkg.SaveGroupedConfig(config, path); err != nil {
+		t.Fatalf("SaveGroupedConfig() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# yaml-language-server: $schema=~/github.com/shiron-dev/dotfiles/scripts/brew-management/packages.schema.json
+
+groups:
+    core:
+        description: Core
+        priority: 1
+        packages:
+            brew:
+                - name: git
+                  tags:
+                    - cli
+            mas:
+                - name: Xcode
+                  id: 497799835
+    media:
+        description: Media
+        priority: 30
+        packages:
+            cask:
+                - name: vlc
+                  tags:
+                    - media
+profiles: {}
+`
+	if got := string(data); got != want {
+		t.Errorf("SaveGroupedConfig() wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestInsertPackage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		pkgs []string
+		add  string
+		want []string
+	}{
+		{"empty", nil, "git", []string{"git"}},
+		{"sorted", []string{"git", "zsh"}, "jq", []string{"git", "jq", "zsh"}},
+		{"sorted, first", []string{"git", "zsh"}, "bat", []string{"bat", "git", "zsh"}},
+		{"unsorted", []string{"zsh", "git"}, "jq", []string{"zsh", "git", "jq"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var pkgInfos []types.PackageInfo
+			for _, name := range tt.pkgs {
+				pkgInfos = append(pkgInfos, types.PackageInfo{Name: name})
+			}
+
+			var got []string
+			for _, pkgInfo := range yamlPkg.InsertPackage(pkgInfos, types.PackageInfo{Name: tt.add}) {
+				got = append(got, pkgInfo.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("InsertPackage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
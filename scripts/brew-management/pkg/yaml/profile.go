@@ -0,0 +1,94 @@
+package yaml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
+)
+
+// ResolvedProfile is a profile with everything it extends merged in
+type ResolvedProfile struct {
+	Name            string
+	Description     string
+	Chain           []string // Profiles merged into this one, parents first, ending with the profile itself
+	Groups          []string
+	Tags            []string
+	ExcludeTags     []string
+	ExcludeGroups   []string
+	ExcludePackages []string
+}
+
+// ResolveProfile resolves a profile and the profiles it extends.
+// Lists are merged parents first, in the order listed in extends; exclusions always win over inclusions.
+func ResolveProfile(config *types.PackageGrouped, name string) (*ResolvedProfile, error) {
+	resolved := &ResolvedProfile{Name: name}
+	if err := resolveProfileInto(config, name, resolved, nil, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+
+	resolved.Description = config.Profiles[name].Description
+	resolved.Groups = utils.UniqueStrings(resolved.Groups)
+	resolved.Tags = utils.UniqueStrings(resolved.Tags)
+	resolved.ExcludeTags = utils.UniqueStrings(resolved.ExcludeTags)
+	resolved.ExcludeGroups = utils.UniqueStrings(resolved.ExcludeGroups)
+	resolved.ExcludePackages = utils.UniqueStrings(resolved.ExcludePackages)
+
+	return resolved, nil
+}
+
+// resolveProfileInto merges a profile and its parents into resolved, depth first.
+// path holds the profiles currently being resolved, to detect cycles; a profile reached twice is merged once.
+func resolveProfileInto(config *types.PackageGrouped, name string, resolved *ResolvedProfile, path []string, done map[string]bool) error {
+	for _, parent := range path {
+		if parent == name {
+			return fmt.Errorf("profile inheritance cycle: %s -> %s", strings.Join(path, " -> "), name)
+		}
+	}
+	if done[name] {
+		return nil
+	}
+
+	profile, exists := config.Profiles[name]
+	if !exists {
+		if len(path) > 0 {
+			return fmt.Errorf("profile %s extends unknown profile: %s", path[len(path)-1], name)
+		}
+		return fmt.Errorf("unknown profile: %s", name)
+	}
+
+	for _, parent := range profile.Extends {
+		if err := resolveProfileInto(config, parent, resolved, append(path, name), done); err != nil {
+			return err
+		}
+	}
+
+	done[name] = true
+	resolved.Chain = append(resolved.Chain, name)
+	resolved.Groups = append(resolved.Groups, profile.Groups...)
+	resolved.Tags = append(resolved.Tags, profile.Tags...)
+	resolved.ExcludeTags = append(resolved.ExcludeTags, profile.ExcludeTags...)
+	resolved.ExcludeGroups = append(resolved.ExcludeGroups, profile.ExcludeGroups...)
+	resolved.ExcludePackages = append(resolved.ExcludePackages, profile.ExcludePackages...)
+
+	return nil
+}
+
+// MatchesPackage reports whether an exclude_packages entry matches a package.
+// Entries are "name" for any type, or "type:name"; mas apps also match by ID.
+func MatchesPackage(pattern string, pkgType string, pkgInfo types.PackageInfo) bool {
+	name := pattern
+	if i := strings.Index(pattern, ":"); i >= 0 && types.IsPackageType(pattern[:i]) {
+		if pattern[:i] != pkgType {
+			return false
+		}
+		name = pattern[i+1:]
+	}
+
+	if NormalizeName(pkgType, name) == NormalizeName(pkgType, pkgInfo.Name) {
+		return true
+	}
+	return pkgType == "mas" && name == strconv.FormatInt(pkgInfo.ID, 10)
+}
@@ -0,0 +1,179 @@
+package yaml_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	yamlPkg "github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/yaml"
+)
+
+func profileConfig() *types.PackageGrouped {
+	return &types.PackageGrouped{
+		Groups: map[string]types.Group{
+			"core": {Priority: 1, Packages: map[string][]types.PackageInfo{
+				"brew": {{Name: "git", Tags: []string{"cli"}}, {Name: "jq", Tags: []string{"cli"}}},
+				"mas":  {{Name: "Xcode", ID: 497799835, Tags: []string{"dev"}}},
+			}},
+			"dev": {Priority: 2, Packages: map[string][]types.PackageInfo{
+				"brew": {{Name: "go", Tags: []string{"dev"}}, {Name: "node", Tags: []string{"dev", "heavy"}}},
+				"cask": {{Name: "docker", Tags: []string{"dev", "heavy"}}},
+			}},
+			"media": {Priority: 3, Packages: map[string][]types.PackageInfo{
+				"cask": {{Name: "vlc", Tags: []string{"media"}}},
+			}},
+		},
+		Profiles: map[string]types.Profile{
+			"base":   {Description: "Base", Groups: []string{"core"}},
+			"dev":    {Description: "Developer", Extends: []string{"base"}, Groups: []string{"dev"}},
+			"light":  {Description: "Light developer", Extends: []string{"dev"}, ExcludeTags: []string{"heavy"}, ExcludePackages: []string{"mas:497799835"}},
+			"media":  {Description: "Media", Extends: []string{"base"}, Groups: []string{"media"}, Tags: []string{"media"}},
+			"all":    {Description: "Everything", Extends: []string{"dev", "media"}, ExcludeGroups: []string{"media"}},
+			"loop-a": {Description: "Loop", Extends: []string{"loop-b"}},
+			"loop-b": {Description: "Loop", Extends: []string{"loop-a"}},
+			"orphan": {Description: "Orphan", Extends: []string{"missing"}},
+		},
+	}
+}
+
+func TestResolveProfile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		profile string
+		want    *yamlPkg.ResolvedProfile
+		wantErr bool
+	}{
+		{
+			"no parents",
+			"base",
+			&yamlPkg.ResolvedProfile{Name: "base", Description: "Base", Chain: []string{"base"}, Groups: []string{"core"}},
+			false,
+		},
+		{
+			"parents first",
+			"light",
+			&yamlPkg.ResolvedProfile{
+				Name:            "light",
+				Description:     "Light developer",
+				Chain:           []string{"base", "dev", "light"},
+				Groups:          []string{"core", "dev"},
+				ExcludeTags:     []string{"heavy"},
+				ExcludePackages: []string{"mas:497799835"},
+			},
+			false,
+		},
+		{
+			"shared parent merged once",
+			"all",
+			&yamlPkg.ResolvedProfile{
+				Name:          "all",
+				Description:   "Everything",
+				Chain:         []string{"base", "dev", "media", "all"},
+				Groups:        []string{"core", "dev", "media"},
+				Tags:          []string{"media"},
+				ExcludeGroups: []string{"media"},
+			},
+			false,
+		},
+		{"cycle", "loop-a", nil, true},
+		{"unknown parent", "orphan", nil, true},
+		{"unknown profile", "missing", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := yamlPkg.ResolveProfile(profileConfig(), tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// Lists the profiles leave empty may be nil or empty
+			for _, list := range []*[]string{&got.Groups, &got.Tags, &got.ExcludeTags, &got.ExcludeGroups, &got.ExcludePackages} {
+				if len(*list) == 0 {
+					*list = nil
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveProfile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesPackage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		pattern string
+		pkgType string
+		pkgInfo types.PackageInfo
+		want    bool
+	}{
+		{"name of any type", "docker", "cask", types.PackageInfo{Name: "docker"}, true},
+		{"typed name", "cask:docker", "cask", types.PackageInfo{Name: "docker"}, true},
+		{"other type", "brew:docker", "cask", types.PackageInfo{Name: "docker"}, false},
+		{"mas by ID", "mas:497799835", "mas", types.PackageInfo{Name: "Xcode", ID: 497799835}, true},
+		{"vscode ignores case", "vscode:github.copilot", "vscode", types.PackageInfo{Name: "GitHub.copilot"}, true},
+		{"colon in a name", "owner/tap:name", "brew", types.PackageInfo{Name: "owner/tap:name"}, true},
+		{"different name", "git", "brew", types.PackageInfo{Name: "git-lfs"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := yamlPkg.MatchesPackage(tt.pattern, tt.pkgType, tt.pkgInfo); got != tt.want {
+				t.Errorf("MatchesPackage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFilteredPackages_Profile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options types.InstallOptions
+		want    []string
+		wantErr bool
+	}{
+		{"extended groups", types.InstallOptions{Profile: "dev"}, []string{"brew:git", "brew:go", "brew:jq", "brew:node", "cask:docker", "mas:Xcode"}, false},
+		{"exclusions win", types.InstallOptions{Profile: "light"}, []string{"brew:git", "brew:go", "brew:jq"}, false},
+		{"excluded group", types.InstallOptions{Profile: "all", Tags: []string{"cli"}}, []string{"brew:git", "brew:jq"}, false},
+		{"options merged with the profile", types.InstallOptions{Profile: "base", Groups: []string{"media"}, ExcludePackages: []string{"jq"}}, []string{"brew:git", "cask:vlc", "mas:Xcode"}, false},
+		{"unknown profile", types.InstallOptions{Profile: "missing"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			options := tt.options
+			got, err := yamlPkg.GetFilteredPackages(profileConfig(), &options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetFilteredPackages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var keys []string
+			for _, pkg := range got {
+				keys = append(keys, pkg.Type+":"+pkg.Name)
+			}
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("GetFilteredPackages() = %v, want %v", keys, tt.want)
+			}
+
+			if !reflect.DeepEqual(options, tt.options) {
+				t.Errorf("GetFilteredPackages() changed the options to %+v, want %+v", options, tt.options)
+			}
+		})
+	}
+}
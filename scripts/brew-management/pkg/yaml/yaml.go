@@ -1,13 +1,18 @@
 package yaml
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
-	"brew-manager/pkg/types"
-	"brew-manager/pkg/utils"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/runner"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/utils"
 
 	"gopkg.in/yaml.v3"
 )
@@ -76,74 +81,74 @@ func createDefaultGroupedConfig() *types.PackageGrouped {
 	}
 }
 
-// SaveGroupedConfig saves a grouped configuration to YAML file
+// SaveGroupedConfig saves a grouped configuration to a YAML file. An existing file is edited in place:
+// its comments, blank lines, indentation and the order of its groups, packages and other entries are
+// kept, new groups are placed by priority and new package types in install order. Package lists are
+// written in the order of config; use InsertPackage and SortPackages to keep them sorted.
 func SaveGroupedConfig(config *types.PackageGrouped, filePath string) error {
 	// Create directory if it doesn't exist
 	if err := utils.EnsureDir(filePath); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Sort groups by priority
-	type groupEntry struct {
-		name  string
-		group types.Group
-	}
-	var sortedGroups []groupEntry
-	for name, group := range config.Groups {
-		// Sort packages within each group by type and then by name
-		for pkgType, pkgInfos := range group.Packages {
-			sort.Slice(pkgInfos, func(i, j int) bool {
-				return pkgInfos[i].Name < pkgInfos[j].Name
-			})
-			group.Packages[pkgType] = pkgInfos
-		}
-		// Sort package types (keys of the map)
-		// This part is tricky as map keys are not ordered in Go serialization directly.
-		// For consistent YAML output, we might need a custom Marshal or a structure that preserves order.
-		// However, yaml.v3 generally tries to sort map keys alphabetically by default.
-		sortedGroups = append(sortedGroups, groupEntry{name, group})
+	content, err := writeDocument(filePath, config)
+	if err != nil {
+		return err
 	}
-	sort.Slice(sortedGroups, func(i, j int) bool {
-		return sortedGroups[i].group.Priority < sortedGroups[j].group.Priority
-	})
 
-	// Recreate the groups map in sorted order for top-level groups
-	orderedGroups := make(map[string]types.Group)
-	for _, entry := range sortedGroups {
-		orderedGroups[entry.name] = entry.group
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write YAML file: %w", err)
 	}
-	config.Groups = orderedGroups
 
-	data, err := yaml.Marshal(config)
-	if err != nil {
-		return fmt.Errorf("failed to marshal YAML: %w", err)
-	}
+	return nil
+}
 
-	// Add yaml-language-server comment
-	// TODO: Update the schema path if it's hosted or standardized
-	content := "# yaml-language-server: $schema=~/github.com/shiron-dev/dotfiles/scripts/brew-management/packages.schema.json\n\n"
-	content += string(data)
+// SortPackages sorts the packages of every type in every group by name
+func SortPackages(config *types.PackageGrouped) {
+	for _, group := range config.Groups {
+		for _, pkgInfos := range group.Packages {
+			sort.SliceStable(pkgInfos, func(i, j int) bool {
+				return pkgInfos[i].Name < pkgInfos[j].Name
+			})
+		}
+	}
+}
 
-	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
-		return fmt.Errorf("failed to write YAML file: %w", err)
+// InsertPackage adds a package to a list: at its place by name when the list is sorted by name,
+// at the end otherwise
+func InsertPackage(pkgInfos []types.PackageInfo, pkgInfo types.PackageInfo) []types.PackageInfo {
+	sorted := sort.SliceIsSorted(pkgInfos, func(i, j int) bool {
+		return pkgInfos[i].Name < pkgInfos[j].Name
+	})
+	if !sorted {
+		return append(pkgInfos, pkgInfo)
 	}
 
-	return nil
+	at := sort.Search(len(pkgInfos), func(i int) bool {
+		return pkgInfos[i].Name > pkgInfo.Name
+	})
+	return append(pkgInfos[:at], append([]types.PackageInfo{pkgInfo}, pkgInfos[at:]...)...)
 }
 
-// GetFilteredPackages returns packages filtered by groups, tags, and exclusions
-func GetFilteredPackages(config *types.PackageGrouped, options *types.InstallOptions) []types.FilteredPackage {
+// GetFilteredPackages returns packages filtered by groups, tags, and exclusions.
+// A profile in the options is resolved with ResolveProfile and merged into a copy of the filters;
+// the caller's options are left unchanged, so they still hold only what the caller passed.
+func GetFilteredPackages(config *types.PackageGrouped, callerOptions *types.InstallOptions) ([]types.FilteredPackage, error) {
 	var allPackages []types.FilteredPackage
 
 	// Apply profile first if specified
+	options := *callerOptions
 	if options.Profile != "" {
-		profile, exists := config.Profiles[options.Profile]
-		if exists {
-			// Deduplicate groups and tags
-			options.Groups = utils.UniqueStrings(append(options.Groups, profile.Groups...))
-			options.Tags = utils.UniqueStrings(append(options.Tags, profile.Tags...))
-			// TODO: Handle profile.ExcludeTags
+		profile, err := ResolveProfile(config, options.Profile)
+		if err != nil {
+			return nil, err
 		}
+		// Deduplicate groups and tags
+		options.Groups = mergeStrings(options.Groups, profile.Groups)
+		options.Tags = mergeStrings(options.Tags, profile.Tags)
+		options.ExcludeTags = mergeStrings(options.ExcludeTags, profile.ExcludeTags)
+		options.ExcludeGroups = mergeStrings(options.ExcludeGroups, profile.ExcludeGroups)
+		options.ExcludePackages = mergeStrings(options.ExcludePackages, profile.ExcludePackages)
 	}
 
 	groupsToProcess := options.Groups
@@ -156,7 +161,7 @@ func GetFilteredPackages(config *types.PackageGrouped, options *types.InstallOpt
 
 	for _, groupName := range groupsToProcess {
 		group, exists := config.Groups[groupName]
-		if !exists {
+		if !exists || utils.ContainsString(options.ExcludeGroups, groupName) {
 			continue
 		}
 
@@ -166,11 +171,19 @@ func GetFilteredPackages(config *types.PackageGrouped, options *types.InstallOpt
 				if len(options.Tags) > 0 && !utils.HasIntersection(pkgInfo.Tags, options.Tags) {
 					continue
 				}
-				// TODO: Apply options.ExcludeTags if implemented
+				if utils.HasIntersection(pkgInfo.Tags, options.ExcludeTags) {
+					continue
+				}
+				if isExcludedPackage(options.ExcludePackages, pkgType, pkgInfo) {
+					continue
+				}
+				pkgInfo.Hooks = pkgInfo.Hooks.Inherit(group.Hooks)
 
 				allPackages = append(allPackages, types.FilteredPackage{
 					PackageInfo: pkgInfo,
 					Type:        pkgType,
+					Group:       groupName,
+					Priority:    group.Priority,
 				})
 			}
 		}
@@ -184,50 +197,282 @@ func GetFilteredPackages(config *types.PackageGrouped, options *types.InstallOpt
 		return allPackages[i].Name < allPackages[j].Name
 	})
 
-	return allPackages
+	return allPackages, nil
+}
+
+// mergeStrings returns the unique strings of a followed by b in a new slice
+func mergeStrings(a, b []string) []string {
+	return utils.UniqueStrings(append(append([]string(nil), a...), b...))
+}
+
+// isExcludedPackage reports whether any exclude_packages entry matches a package
+func isExcludedPackage(patterns []string, pkgType string, pkgInfo types.PackageInfo) bool {
+	for _, pattern := range patterns {
+		if MatchesPackage(pattern, pkgType, pkgInfo) {
+			return true
+		}
+	}
+	return false
 }
 
 // GetInstalledPackages retrieves currently installed brew packages
-func GetInstalledPackages() (map[string][]string, []types.MasApp, error) {
+func GetInstalledPackages(r runner.Runner) (map[string][]string, []types.MasApp, error) {
 	result := make(map[string][]string)
 	var masApps []types.MasApp
 
 	// Get taps
-	if tapsOutput, err := utils.RunCommand("brew", "tap"); err == nil {
+	if tapsOutput, err := r.RunCommand("brew", "tap"); err == nil {
 		result["taps"] = strings.Fields(strings.TrimSpace(tapsOutput))
 	}
 
 	// Get formulae
-	if brewsOutput, err := utils.RunCommand("brew", "list", "--formula"); err == nil {
+	if brewsOutput, err := r.RunCommand("brew", "list", "--formula"); err == nil {
 		result["brews"] = strings.Fields(strings.TrimSpace(brewsOutput))
 	}
 
 	// Get casks
-	if casksOutput, err := utils.RunCommand("brew", "list", "--cask"); err == nil {
+	if casksOutput, err := r.RunCommand("brew", "list", "--cask"); err == nil {
 		result["casks"] = strings.Fields(strings.TrimSpace(casksOutput))
 	}
 
 	// Get mas apps if mas is available
-	if utils.CommandExists("mas") {
-		if masOutput, err := utils.RunCommand("mas", "list"); err == nil {
-			lines := strings.Split(strings.TrimSpace(masOutput), "\n")
-			for _, line := range lines {
-				if line == "" {
-					continue
-				}
-				parts := strings.SplitN(line, " ", 2)
-				if len(parts) >= 2 {
-					var id int64
-					if _, err := fmt.Sscanf(parts[0], "%d", &id); err == nil {
-						masApps = append(masApps, types.MasApp{
-							Name: strings.TrimSpace(parts[1]),
-							ID:   id,
-						})
-					}
-				}
+	if r.CommandExists("mas") {
+		if masOutput, err := r.RunCommand("mas", "list"); err == nil {
+			masApps = ParseMasList(masOutput)
+		}
+	}
+
+	// Get VS Code extensions and Go, Cargo and npm packages, keyed by their type, if the tools are available
+	for _, pkgType := range ToolTypes {
+		if versions, err := ToolVersions(r, pkgType); err == nil {
+			for name := range versions {
+				result[pkgType] = append(result[pkgType], name)
 			}
+			sort.Strings(result[pkgType])
 		}
 	}
 
 	return result, masApps, nil
 }
+
+// ToolTypes are the package types managed by tools other than brew and mas
+var ToolTypes = []string{"vscode", "go", "cargo", "npm"}
+
+// ToolCommand returns the command that manages a tool package type
+func ToolCommand(pkgType string) string {
+	if pkgType == "vscode" {
+		return "code"
+	}
+	return pkgType
+}
+
+// NormalizeName returns the name a package is compared by: VS Code extension IDs are case-insensitive
+func NormalizeName(pkgType string, name string) string {
+	if pkgType == "vscode" {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// ToolVersions returns the installed packages of a tool package type with their versions.
+// It returns no packages when the tool is not installed.
+func ToolVersions(r runner.Runner, pkgType string) (map[string]string, error) {
+	if !r.CommandExists(ToolCommand(pkgType)) {
+		return map[string]string{}, nil
+	}
+
+	switch pkgType {
+	case "vscode":
+		output, err := r.RunCommand("code", "--list-extensions", "--show-versions")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list VS Code extensions: %w", err)
+		}
+		return ParseVSCodeExtensions(output), nil
+	case "go":
+		binaries, err := GoBinaries(r)
+		if err != nil {
+			return nil, err
+		}
+		versions := make(map[string]string)
+		for _, binary := range binaries {
+			versions[binary.Path] = binary.Version
+		}
+		return versions, nil
+	case "cargo":
+		output, err := r.RunCommand("cargo", "install", "--list")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cargo packages: %w", err)
+		}
+		return ParseCargoList(output), nil
+	case "npm":
+		// npm ls exits non-zero for problems such as extraneous packages but still prints the tree
+		output, err := r.RunCommand("npm", "ls", "--global", "--depth=0", "--json")
+		if err != nil && strings.TrimSpace(output) == "" {
+			return nil, fmt.Errorf("failed to list npm packages: %w", err)
+		}
+		return ParseNpmList(output)
+	default:
+		return nil, fmt.Errorf("unknown tool package type: %s", pkgType)
+	}
+}
+
+// ParseVSCodeExtensions parses `code --list-extensions --show-versions` output ("publisher.name@version"),
+// keyed by lowercase extension ID
+func ParseVSCodeExtensions(output string) map[string]string {
+	versions := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		id, version, _ := strings.Cut(strings.TrimSpace(line), "@")
+		if !strings.Contains(id, ".") || strings.ContainsAny(id, " \t") {
+			continue
+		}
+		versions[NormalizeName("vscode", id)] = version
+	}
+	return versions
+}
+
+// ParseCargoList parses `cargo install --list` output, where each crate is listed as
+// "name v1.2.3:" (or "name v1.2.3 (source):") followed by its indented binaries
+func ParseCargoList(output string) map[string]string {
+	versions := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), ":"))
+		if len(fields) < 2 {
+			continue
+		}
+		versions[fields[0]] = strings.TrimPrefix(strings.TrimSuffix(fields[1], ":"), "v")
+	}
+	return versions
+}
+
+// npmBundled are the global packages that ship with Node.js rather than being installed with npm
+var npmBundled = map[string]bool{"npm": true, "corepack": true}
+
+// ParseNpmList parses `npm ls --global --depth=0 --json` output, leaving out the packages bundled with Node.js
+func ParseNpmList(output string) (map[string]string, error) {
+	var tree struct {
+		Dependencies map[string]struct {
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	}
+	if err := json.Unmarshal([]byte(output), &tree); err != nil {
+		return nil, fmt.Errorf("failed to parse npm package list: %w", err)
+	}
+
+	versions := make(map[string]string)
+	for name, dep := range tree.Dependencies {
+		if !npmBundled[name] {
+			versions[name] = dep.Version
+		}
+	}
+	return versions, nil
+}
+
+// GoBinary is a program installed with go install
+type GoBinary struct {
+	Path    string // Package path, e.g. golang.org/x/tools/gopls
+	File    string // Installed binary
+	Version string // Version of the main module
+}
+
+// GoBinDir returns the directory go install writes binaries to: GOBIN, or the bin directory of the first GOPATH entry
+func GoBinDir(r runner.Runner) (string, error) {
+	output, err := r.RunCommand("go", "env", "GOBIN", "GOPATH")
+	if err != nil {
+		return "", fmt.Errorf("failed to get Go environment: %w", err)
+	}
+
+	// One line per variable, empty when unset
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if gobin := strings.TrimSpace(lines[0]); gobin != "" {
+		return gobin, nil
+	}
+	if len(lines) < 2 || strings.TrimSpace(lines[1]) == "" {
+		return "", fmt.Errorf("neither GOBIN nor GOPATH is set")
+	}
+	return filepath.Join(filepath.SplitList(strings.TrimSpace(lines[1]))[0], "bin"), nil
+}
+
+// GoBinaries returns the programs in the go install directory, read from their embedded build information
+func GoBinaries(r runner.Runner) ([]GoBinary, error) {
+	dir, err := GoBinDir(r)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.FileExists(dir) {
+		return nil, nil
+	}
+
+	output, err := r.RunCommand("go", "version", "-m", dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Go binaries in %s: %w", dir, err)
+	}
+	return ParseGoVersion(output), nil
+}
+
+// ParseGoVersion parses `go version -m` output: a "file: go1.x" line per binary followed by
+// indented build information such as "path <package>" and "mod <module> <version> <sum>"
+func ParseGoVersion(output string) []GoBinary {
+	var binaries []GoBinary
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] != '\t' {
+			file, _, found := strings.Cut(line, ": ")
+			if found {
+				binaries = append(binaries, GoBinary{File: file})
+			}
+			continue
+		}
+		if len(binaries) == 0 {
+			continue
+		}
+
+		current := &binaries[len(binaries)-1]
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 2 && fields[0] == "path":
+			current.Path = fields[1]
+		case len(fields) >= 3 && fields[0] == "mod":
+			current.Version = fields[2]
+		}
+	}
+
+	// Binaries without build information were not built by go install
+	result := binaries[:0]
+	for _, binary := range binaries {
+		if binary.Path != "" {
+			result = append(result, binary)
+		}
+	}
+	return result
+}
+
+// masListLine matches a line of `mas list` output: "<id>  <name>  (<version>)"
+var masListLine = regexp.MustCompile(`^(\d+)\s+(.*?)(?:\s+\(([^()]*)\))?$`)
+
+// ParseMasList parses `mas list` output into apps, separating the version from the name
+func ParseMasList(output string) []types.MasApp {
+	var masApps []types.MasApp
+
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		m := masListLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		id, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		masApps = append(masApps, types.MasApp{
+			Name:    strings.TrimSpace(m[2]),
+			ID:      id,
+			Version: m[3],
+		})
+	}
+
+	return masApps
+}
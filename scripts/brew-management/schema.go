@@ -0,0 +1,16 @@
+package main
+
+import (
+	_ "embed"
+
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/validate"
+)
+
+// packagesSchema is the JSON Schema generated from the configuration types by generate.go
+//
+//go:embed packages.schema.json
+var packagesSchema []byte
+
+func init() {
+	validate.DefaultSchema = packagesSchema
+}
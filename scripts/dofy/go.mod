@@ -1,22 +0,0 @@
-module github.com/shiron-dev/dotfiles/scripts/dofy
-
-go 1.26.6
-
-require (
-	github.com/cweill/gotests v1.9.0
-	github.com/fatih/color v1.19.0
-	github.com/google/wire v0.7.0
-	github.com/pkg/errors v0.9.1
-	go.uber.org/mock v0.6.0
-)
-
-require (
-	github.com/google/subcommands v1.2.0 // indirect
-	github.com/mattn/go-colorable v0.1.14 // indirect
-	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/mod v0.40.0 // indirect
-	golang.org/x/sync v0.22.0 // indirect
-	golang.org/x/sys v0.47.0 // indirect
-	golang.org/x/tools v0.49.0 // indirect
-)
@@ -29,7 +29,7 @@ func InitializeControllerSet(stdout stdoutType, stderr stderrType) (*Controllers
 	fileInfrastructureImpl := infrastructure.NewFileInfrastructure()
 	gitInfrastructureImpl := infrastructure.NewGitInfrastructure()
 	brewUsecaseImpl := usecase.NewBrewUsecase(brewInfrastructureImpl, depsInfrastructureImpl, printOutUsecaseImpl, configUsecaseImpl)
-	depsUsecaseImpl := usecase.NewDepsUsecase(depsInfrastructureImpl, brewInfrastructureImpl, fileInfrastructureImpl, gitInfrastructureImpl, printOutUsecaseImpl, brewUsecaseImpl)
+	depsUsecaseImpl := usecase.NewDepsUsecase(depsInfrastructureImpl, brewInfrastructureImpl, fileInfrastructureImpl, gitInfrastructureImpl, printOutUsecaseImpl, brewUsecaseImpl, configUsecaseImpl)
 	vsCodeInfrastructureImpl := infrastructure.NewVSCodeInfrastructure()
 	vsCodeUsecaseImpl := usecase.NewVSCodeUsecase(vsCodeInfrastructureImpl, gitInfrastructureImpl, fileInfrastructureImpl, printOutUsecaseImpl, configUsecaseImpl)
 	dofyControllerImpl := controller.NewDofyController(ansibleUsecaseImpl, printOutUsecaseImpl, configUsecaseImpl, depsUsecaseImpl, vsCodeUsecaseImpl)
@@ -66,7 +66,7 @@ func InitializeTestUsecaseSet(mockAnsibleInfrastructure *mock_infrastructure.Moc
 	ansibleUsecaseImpl := usecase.NewAnsibleUsecase(mockAnsibleInfrastructure, printOutUsecaseImpl)
 	configUsecaseImpl := usecase.NewConfigUsecase(mockConfigInfrastructure)
 	brewUsecaseImpl := usecase.NewBrewUsecase(mockBrewInfrastructure, mockDepsInfrastructure, printOutUsecaseImpl, configUsecaseImpl)
-	depsUsecaseImpl := usecase.NewDepsUsecase(mockDepsInfrastructure, mockBrewInfrastructure, mockFileInfrastructure, mockGitInfrastructure, printOutUsecaseImpl, brewUsecaseImpl)
+	depsUsecaseImpl := usecase.NewDepsUsecase(mockDepsInfrastructure, mockBrewInfrastructure, mockFileInfrastructure, mockGitInfrastructure, printOutUsecaseImpl, brewUsecaseImpl, configUsecaseImpl)
 	testUsecaseSet := &TestUsecaseSet{
 		AnsibleUsecase:  ansibleUsecaseImpl,
 		BrewUsecase:     brewUsecaseImpl,
@@ -9,6 +9,10 @@ const (
 	BrewBundleTypeFormula
 	BrewBundleTypeCask
 	BrewBundleTypeMas
+	BrewBundleTypeVSCode
+	BrewBundleTypeWhalebrew
+	BrewBundleTypeGo
+	BrewBundleTypeCargo
 )
 
 type BrewBundle struct {
@@ -28,6 +32,14 @@ func BrewBundleTypeFromString(str string) BrewBundleType {
 		return BrewBundleTypeCask
 	case "mas":
 		return BrewBundleTypeMas
+	case "vscode":
+		return BrewBundleTypeVSCode
+	case "whalebrew":
+		return BrewBundleTypeWhalebrew
+	case "go":
+		return BrewBundleTypeGo
+	case "cargo":
+		return BrewBundleTypeCargo
 	default:
 		return BrewBundleTypeFormula
 	}
@@ -45,6 +57,14 @@ func (b BrewBundle) String() string {
 		str = "cask"
 	case BrewBundleTypeMas:
 		str = "mas"
+	case BrewBundleTypeVSCode:
+		str = "vscode"
+	case BrewBundleTypeWhalebrew:
+		str = "whalebrew"
+	case BrewBundleTypeGo:
+		str = "go"
+	case BrewBundleTypeCargo:
+		str = "cargo"
 	}
 
 	str += " \"" + b.Name + "\""
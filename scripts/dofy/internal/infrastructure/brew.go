@@ -1,8 +1,8 @@
 package infrastructure
 
 import (
-	"bufio"
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/brewfile"
 	"github.com/shiron-dev/dotfiles/scripts/dofy/internal/domain"
 )
 
@@ -193,83 +194,34 @@ func (b *BrewInfrastructureImpl) CleanupBrewBundle(path string, isForce bool, so
 }
 
 func (b *BrewInfrastructureImpl) ReadBrewBundle(path string) ([]domain.BrewBundle, error) {
-	//nolint:gosec
-	file, err := os.Open(path)
+	file, err := brewfile.ParseFile(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "deps infrastructure: failed to open file")
+		return nil, errors.Wrap(err, "deps infrastructure: failed to parse file")
 	}
 
-	defer func() {
-		if err := file.Close(); err != nil {
-			log.Fatal(err)
-		}
-	}()
-
-	scanner := bufio.NewScanner(file)
-
 	var bundles []domain.BrewBundle
 
-	lastCategories := []string{}
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if len(line) == 0 {
-			continue
-		}
-
-		if line[0] == '#' {
-			lastCategories = getCategory(line, lastCategories)
-
-			continue
-		}
-
-		spInd := strings.Index(line, " ")
-		if spInd == -1 {
-			continue
-		}
+	for _, section := range file.Sections {
+		for _, entry := range section.Entries {
+			others := []string{}
+			if entry.Type == "mas" {
+				others = append(others, fmt.Sprintf("id: %d", entry.ID))
+			}
 
-		prefix := line[:spInd]
-		formula := line[spInd+1:]
-		cFormula := strings.Split(formula, ",")
+			others = append(others, entry.Options...)
 
-		others := []string{}
-		for _, c := range cFormula[1:] {
-			others = append(others, strings.TrimSpace(c))
+			bundles = append(bundles, domain.BrewBundle{
+				Name:       entry.Name,
+				Others:     others,
+				BundleType: domain.BrewBundleTypeFromString(entry.Type),
+				Categories: append([]string{}, section.Categories...),
+			})
 		}
-
-		bundles = append(bundles, domain.BrewBundle{
-			Name:       strings.TrimSpace(strings.Trim(strings.ReplaceAll(cFormula[0], ",", ""), "\"")),
-			Others:     others,
-			BundleType: domain.BrewBundleTypeFromString(prefix),
-			Categories: append([]string{}, lastCategories...),
-		})
 	}
 
 	return bundles, nil
 }
 
-func getCategory(line string, lastCategories []string) []string {
-	count := 0
-
-	for _, c := range line {
-		if c == '#' {
-			count++
-		} else {
-			break
-		}
-	}
-
-	size := len(lastCategories)
-	for i := count - 1; i < size; i++ {
-		lastCategories = lastCategories[:len(lastCategories)-1]
-	}
-
-	lastCategories = append(lastCategories, strings.TrimSpace(line[count:]))
-
-	return lastCategories
-}
-
 func (b *BrewInfrastructureImpl) WriteBrewBundle(path string, bundles []domain.BrewBundle) error { //nolint:cyclop
 	//nolint:gosec
 	file, err := os.Create(path)
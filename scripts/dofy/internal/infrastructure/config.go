@@ -2,12 +2,11 @@ package infrastructure
 
 import (
 	"os/exec"
-	"os/user"
-	"path/filepath"
 	"runtime"
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/location"
 )
 
 type ConfigInfrastructure interface {
@@ -45,11 +44,13 @@ func (c *ConfigInfrastructureImpl) GetArch() (string, error) {
 	return strings.TrimSpace(string(arch)), nil
 }
 
+// GetDotfilesDir resolves the dotfiles directory the same way as brew-manager: from DOFY_HOME or
+// BREW_MANAGER_CONFIG, the shared config file, the enclosing checkout, or the default path.
 func (c *ConfigInfrastructureImpl) GetDotfilesDir() (string, error) {
-	usr, err := user.Current()
+	loc, err := location.Resolve(location.Options{})
 	if err != nil {
-		return "", errors.Wrap(err, "deps usecase: failed to get current user")
+		return "", errors.Wrap(err, "config infrastructure: failed to resolve dotfiles dir")
 	}
 
-	return filepath.Join(usr.HomeDir, "/projects/github.com/shiron-dev/dotfiles/"), nil
+	return loc.Dir, nil
 }
@@ -3,7 +3,6 @@ package infrastructure_test
 import (
 	"os"
 	"os/exec"
-	"os/user"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -134,27 +133,26 @@ func TestConfigInfrastructureImpl_GetArch(t *testing.T) {
 	}
 }
 
+//nolint:paralleltest // t.Setenv cannot be used in parallel tests
 func TestConfigInfrastructureImpl_GetDotfilesDir(t *testing.T) {
-	t.Parallel()
+	dotfilesDir := t.TempDir()
 
 	tests := []struct {
-		name    string
-		want    string
-		wantErr bool
+		name              string
+		dofyHome          string
+		brewManagerConfig string
+		want              string
+		wantErr           bool
 	}{
-		{"no error", func() string {
-			usr, err := user.Current()
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			return filepath.Join(usr.HomeDir, "/projects/github.com/shiron-dev/dotfiles/")
-		}(), false},
+		{"DOFY_HOME", dotfilesDir, "", dotfilesDir, false},
+		{"BREW_MANAGER_CONFIG file", dotfilesDir, filepath.Join(dotfilesDir, "data/brew/packages.yaml"), dotfilesDir, false},
+		{"BREW_MANAGER_CONFIG dir", "", dotfilesDir, dotfilesDir, false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
+			t.Setenv("DOFY_HOME", tt.dofyHome)
+			t.Setenv("BREW_MANAGER_CONFIG", tt.brewManagerConfig)
 
 			infra, err := di.InitializeTestInfrastructureSet(os.Stdout, os.Stderr)
 			if err != nil {
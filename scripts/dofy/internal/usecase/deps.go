@@ -6,7 +6,6 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
-	"os/user"
 	"path/filepath"
 	"strings"
 	"syscall"
@@ -50,6 +49,7 @@ type DepsUsecaseImpl struct {
 	gitInfrastructure  infrastructure.GitInfrastructure
 	printOutUC         PrintOutUsecase
 	brewUC             BrewUsecase
+	configUC           ConfigUsecase
 
 	resolveBrewDiffWithEditorCount int
 }
@@ -61,6 +61,7 @@ func NewDepsUsecase(
 	gitInfrastructure infrastructure.GitInfrastructure,
 	printOutUC PrintOutUsecase,
 	brewUC BrewUsecase,
+	configUC ConfigUsecase,
 ) *DepsUsecaseImpl {
 	return &DepsUsecaseImpl{
 		depsInfrastructure:             depsInfrastructure,
@@ -69,6 +70,7 @@ func NewDepsUsecase(
 		gitInfrastructure:              gitInfrastructure,
 		printOutUC:                     printOutUC,
 		brewUC:                         brewUC,
+		configUC:                       configUC,
 		resolveBrewDiffWithEditorCount: 0,
 	}
 }
@@ -120,12 +122,12 @@ func (d *DepsUsecaseImpl) CloneDotfiles() error {
 https://github.com/shiron-dev/dotfiles.git
 `)
 
-	usr, err := user.Current()
+	dotPath, err := d.configUC.GetDotfilesDir()
 	if err != nil {
-		return errors.Wrap(err, "deps usecase: failed to get current user")
+		return errors.Wrap(err, "deps usecase: failed to get dotfiles dir")
 	}
 
-	if _, err := os.Stat(usr.HomeDir + "/projects/github.com/shiron-dev/dotfiles"); err == nil {
+	if _, err := os.Stat(dotPath); err == nil {
 		d.printOutUC.Println("dotfiles directory already exists")
 	} else {
 		d.printOutUC.Println("Cloning dotfiles repository")
@@ -135,7 +137,7 @@ https://github.com/shiron-dev/dotfiles.git
 			"git",
 			"clone",
 			"https://github.com/shiron-dev/dotfiles.git",
-			filepath.Join(usr.HomeDir, "/projects/github.com/shiron-dev/dotfiles"),
+			dotPath,
 		)
 		if err := cmd.Run(); err != nil {
 			return errors.Wrap(err, "deps usecase: failed to clone dotfiles repository")
@@ -146,13 +148,13 @@ https://github.com/shiron-dev/dotfiles.git
 }
 
 func (d *DepsUsecaseImpl) InstallBrewBundle(forceInstall bool) error {
-	usr, err := user.Current()
+	dotPath, err := d.configUC.GetDotfilesDir()
 	if err != nil {
-		return errors.Wrap(err, "deps usecase: failed to get current user")
+		return errors.Wrap(err, "deps usecase: failed to get dotfiles dir")
 	}
 
-	brewPath := usr.HomeDir + "/projects/github.com/shiron-dev/dotfiles/data/brew/Brewfile"
-	brewTmpPath := usr.HomeDir + "/projects/github.com/shiron-dev/dotfiles/data/brew/Brewfile.tmp"
+	brewPath := filepath.Join(dotPath, "data/brew/Brewfile")
+	brewTmpPath := filepath.Join(dotPath, "data/brew/Brewfile.tmp")
 
 	d.printOutUC.PrintMdf(`
 ## Installing brew packages
@@ -185,6 +185,7 @@ func TestDepsUsecaseImpl_CloneDotfiles(t *testing.T) {
 			}
 
 			mPrintOut.EXPECT().Print(gomock.Any()).AnyTimes()
+			mCfg.EXPECT().GetDotfilesDir().Return(t.TempDir(), nil)
 
 			d := uc.DepsUsecase
 
@@ -233,6 +234,7 @@ func TestDepsUsecaseImpl_InstallBrewBundle(t *testing.T) {
 			mCfg.EXPECT().GetOS().Return("testOS", nil)
 			mCfg.EXPECT().GetOSVersion().Return("testOSVersion", nil)
 			mCfg.EXPECT().GetArch().Return("testArch", nil)
+			mCfg.EXPECT().GetDotfilesDir().Return(t.TempDir(), nil)
 			mBrew.EXPECT().DumpTmpBrewBundle(gomock.Any(), false, sout, serror).Return(nil)
 			mBrew.EXPECT().InstallBrewBundle(gomock.Any(), sout, serror).Return(nil)
 			mBrew.EXPECT().ReadBrewBundle(gomock.Any()).Return([]domain.BrewBundle{
@@ -5,7 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
-	"brew-manager/pkg/types"
+	"github.com/shiron-dev/dotfiles/scripts/brew-management/pkg/types"
 
 	"github.com/invopop/jsonschema"
 )